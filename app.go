@@ -1,19 +1,26 @@
 package f2
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
 	"time"
 
 	"github.com/pterm/pterm"
 	"github.com/urfave/cli/v2"
 
+	"github.com/ayoisaiah/f2/edit"
 	"github.com/ayoisaiah/f2/find"
+	"github.com/ayoisaiah/f2/internal/archive"
 	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+	"github.com/ayoisaiah/f2/internal/ledger"
 	"github.com/ayoisaiah/f2/rename"
 	"github.com/ayoisaiah/f2/replace"
 	"github.com/ayoisaiah/f2/report"
@@ -24,6 +31,16 @@ var errConflictDetected = errors.New(
 	"resolve conflicts before proceeding or use -F/--fix-conflicts to auto-fix",
 )
 
+// ErrCheckFailed is returned in --check-only mode if the planned changes
+// contain conflicts.
+var ErrCheckFailed = errors.New(
+	"the planned changes contain conflicts",
+)
+
+// ExitCodeCheckFailed is the exit status used for ErrCheckFailed so that
+// scripts can distinguish conflicts from other errors.
+const ExitCodeCheckFailed = 2
+
 const (
 	EnvUpdateNotifier = "F2_UPDATE_NOTIFIER"
 	EnvNoColor        = "NO_COLOR"
@@ -34,7 +51,7 @@ const (
 // supportedDefaultOptions contains those flags that can be
 // overridden through the `F2_DEFAULT_OPTS` environmental variable.
 var supportedDefaultOptions = []string{
-	"hidden", "allow-overwrites", "exclude", "exec", "fix-conflicts", "include-dir", "ignore-case", "ignore-ext", "json", "max-depth", "no-color", "only-dir", "quiet", "recursive", "replace-limit", "sort", "sortr", "string-mode", "verbose",
+	"hidden", "allow-control-chars", "allow-invalid-utf8", "allow-overwrites", "atomic-within-dir", "chain-rules", "check-only", "check-perms", "checkpoint", "cleanup-on-failure", "collapse-separators", "copy", "counter-group-by", "counter-scope", "counter-start", "counter-step", "dereference-count", "empty-dirs", "exclude", "exclude-from", "exclude-ignore-case", "exclude-mode", "exec", "ext-only", "first-line", "fix-conflicts", "group-by-operation", "hardlinks", "include-dir", "ignore-case", "ignore-ext", "include-ext", "include-from", "include-own-files", "json", "max-depth", "max-entries-per-dir", "no-backup", "no-color", "normalize-unicode", "on-error", "only-dir", "only-empty", "only-hidden", "only-non-empty", "preserve-ext-case", "preserve-structure", "quiet", "recursive", "relative-to", "remove-broken-links", "replace-limit", "replace-scope", "report-broken-links", "retries", "retry-delay", "route-by-ext", "separators", "size-buckets", "skip-already-named", "skip-empty-targets", "skip-identical", "skip-unreadable", "sort", "sort-changes", "sortr", "stem-only", "stop-on-match", "string-mode", "symlinks", "target-dir", "template", "timings", "traversal-order", "tree", "trim", "trim-chars", "unicode", "verbose", "verify-copy",
 }
 
 func init() {
@@ -220,8 +237,32 @@ func checkForUpdates(app *cli.App) {
 	}
 }
 
+// createOutputFile creates or truncates the file at the specified path so
+// that the report can be written to it. The returned function flushes and
+// closes the file.
+func createOutputFile(path string) (io.Writer, func() error, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	writer := bufio.NewWriter(f)
+
+	closeFn := func() error {
+		err := writer.Flush()
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		return f.Close()
+	}
+
+	return writer, closeFn, nil
+}
+
 // run starts a new renaming operation.
-func run(ctx *cli.Context) error {
+func run(ctx *cli.Context) (err error) {
 	conf, err := config.Init(ctx)
 	if err != nil {
 		return err
@@ -230,38 +271,232 @@ func run(ctx *cli.Context) error {
 	report.Stdout = conf.Stdout
 	report.Stderr = conf.Stderr
 
+	if conf.OutputFile != "" {
+		writer, closeFn, ferr := createOutputFile(conf.OutputFile)
+		if ferr != nil {
+			return ferr
+		}
+
+		report.Stdout = writer
+
+		defer func() {
+			ferr := closeFn()
+			if err == nil {
+				err = ferr
+			}
+		}()
+	}
+
+	// the operation is stopped at the next file or directory once
+	// interrupted so that the completed renames are still recorded
+	cancelCtx, stop := signal.NotifyContext(ctx.Context, os.Interrupt)
+	defer stop()
+
+	if conf.Timings {
+		defer func() {
+			report.Timings(conf.StageTimings)
+		}()
+	}
+
+	if conf.ClearLedger {
+		err = ledger.Clear()
+		if err != nil {
+			return err
+		}
+
+		report.LedgerCleared()
+
+		return nil
+	}
+
+	if conf.ShowLast {
+		return rename.Last(conf)
+	}
+
 	if conf.Revert {
-		return rename.Undo(conf)
+		return rename.Undo(cancelCtx, conf)
 	}
 
-	matches, err := find.Find(conf)
+	if conf.Resume {
+		return rename.Resume(cancelCtx, conf)
+	}
+
+	if conf.ReplayFile != "" {
+		changes, err := rename.LoadReplay(conf)
+		if err != nil {
+			return err
+		}
+
+		return validateAndRename(cancelCtx, conf, changes)
+	}
+
+	if conf.Explain != "" {
+		steps, err := find.Explain(conf, conf.Explain)
+		if err != nil {
+			return err
+		}
+
+		report.Explanation(conf.Explain, steps)
+
+		// the intermediate targets of a matched path are shown if it goes
+		// through more than one replacement
+		if len(steps) > 0 && steps[len(steps)-1].Accepted &&
+			len(conf.ReplacementSlice) > 1 {
+			change, err := replace.Explain(conf, conf.Explain)
+			if err != nil {
+				return err
+			}
+
+			report.Stages(conf, []*file.Change{change})
+		}
+
+		return nil
+	}
+
+	// the entries of the archive are searched instead of the filesystem
+	if conf.ArchiveMode {
+		a, aerr := archive.Open(conf.PathsToFilesOrDirs[0])
+		if aerr != nil {
+			return aerr
+		}
+
+		defer a.Close()
+
+		conf.Archive = a
+		conf.FS = a.FS()
+		conf.PathsToFilesOrDirs = nil
+	}
+
+	if conf.Plan {
+		out, err := Plan(cancelCtx, conf)
+
+		// the conflicts are part of the plan
+		var conflictErr *rename.ConflictError
+		if err != nil && !errors.As(err, &conflictErr) {
+			return err
+		}
+
+		report.Plan(conf, out)
+
+		return nil
+	}
+
+	start := time.Now()
+
+	matches, err := find.Find(cancelCtx, conf)
 	if err != nil {
 		return err
 	}
 
-	if len(matches) == 0 {
-		report.NoMatches(conf.JSON)
+	conf.RecordTiming(config.StageFind, start, matches.Len())
+
+	if !conf.JSON {
+		report.SkippedPaths(conf.SkippedPaths)
+		report.Warnings(conf.Warnings)
+		report.BrokenLinks(conf)
+	}
+
+	// the broken links that are to be removed still need to go through the
+	// rest of the operation even if nothing else matched
+	if len(matches) == 0 &&
+		(!conf.RemoveBrokenLinks || len(conf.BrokenLinks) == 0) {
+		report.NoMatches(conf)
 		return nil
 	}
 
+	start = time.Now()
+
 	changes, err := replace.Replace(conf, matches)
 	if err != nil {
 		return err
 	}
 
-	conflicts := validate.Validate(
-		changes,
-		conf.AutoFixConflicts,
-		conf.AllowOverwrites,
-	)
+	conf.RecordTiming(config.StageReplace, start, len(changes))
+
+	if conf.Edit {
+		changes, err = edit.Edit(conf, changes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return validateAndRename(cancelCtx, conf, changes)
+}
+
+// validateAndRename checks the changes for conflicts and commits them if
+// none are detected.
+func validateAndRename(
+	ctx context.Context,
+	conf *config.Config,
+	changes []*file.Change,
+) error {
+	if conf.SkipEmptyTargets {
+		changes = replace.SkipEmptyTargets(changes)
+
+		if len(changes) == 0 {
+			report.EmptyTargets(conf)
+			return nil
+		}
+	}
+
+	if conf.SkipAlreadyNamed {
+		changes = replace.SkipAlreadyNamed(changes)
+
+		if len(changes) == 0 {
+			report.AlreadyNamed(conf)
+			return nil
+		}
+	}
+
+	if conf.SkipIdentical {
+		var skipped []file.SkippedPath
+
+		changes, skipped = replace.SkipIdentical(conf, changes)
+
+		if !conf.JSON {
+			report.SkippedIdentical(skipped)
+		}
+
+		if len(changes) == 0 {
+			report.IdenticalTargets(conf)
+			return nil
+		}
+	}
+
+	start := time.Now()
+
+	conflicts := validate.Validate(changes, conf)
+
+	conf.RecordTiming(config.StageValidate, start, len(changes))
+
+	if conf.CountOnly {
+		report.Stats(changes, conflicts)
+		return nil
+	}
+
+	if conf.CheckOnly {
+		if len(conflicts) > 0 {
+			report.Conflicts(conf, conflicts)
+
+			return ErrCheckFailed
+		}
+
+		report.NoConflicts(conf, changes)
+
+		return nil
+	}
 
 	if len(conflicts) > 0 {
-		report.Conflicts(conflicts, conf.JSON)
+		report.Conflicts(conf, conflicts)
 
 		return errConflictDetected
 	}
 
-	return rename.Rename(conf, changes)
+	if conf.Simulate {
+		return rename.Simulate(ctx, conf, changes)
+	}
+
+	return rename.Rename(ctx, conf, changes)
 }
 
 // NewApp creates a new app instance.
@@ -288,12 +523,48 @@ or: FIND [REPLACE] [PATHS TO FILES AND DIRECTORIES...]`
 				DefaultText: "<path/to/csv/file>",
 				TakesFile:   true,
 			},
+			&cli.BoolFlag{
+				Name:  "csv-in-order",
+				Usage: "Apply each row of the CSV file whose source is a glob pattern to the next file matched by the pattern\n\t\t\t\tso that repeating the pattern renames the matched files in order. By default, a row applies to\n\t\t\t\tevery matched file, and the rows referring to a file that is already renamed by a previous row are ignored.",
+			},
+			&cli.StringFlag{
+				Name:        "map",
+				Usage:       "Load a JSON file that maps each source to its target, and rename accordingly.\n\t\t\t\tIt may contain an object such as {\"a.txt\": \"b.txt\"} or an array of objects\n\t\t\t\twith \"source\" and \"target\" fields. Relative sources are resolved against the map file's directory.\n\t\t\t\tIt cannot be combined with -f/--find or -r/--replace.",
+				DefaultText: "<path/to/json/file>",
+				TakesFile:   true,
+			},
+			&cli.StringFlag{
+				Name:        "rules",
+				Usage:       "Load ordered find and replace pairs from a JSON or YAML file with parallel 'find' and 'replace' lists.\n\t\t\t\tThe optional 'ignore_case' and 'string_mode' lists enable the corresponding options for individual rules.\n\t\t\t\tFiles matching any of the rules are renamed by applying each rule in sequence.",
+				DefaultText: "<path/to/rules/file>",
+				TakesFile:   true,
+			},
+			&cli.BoolFlag{
+				Name:  "chain-rules",
+				Usage: "Apply the rules of the rules file as a pipeline where each rule matches against the name produced\n\t\t\t\tby the preceding rules. By default, a rule only applies to the files whose original names it matches.",
+			},
+			&cli.StringFlag{
+				Name:        "targets-file",
+				Usage:       "Load the target names from a text file with one name per line, and apply them to the matches\n\t\t\t\tin the order that they are sorted in. The number of names must be equal to the number of matches.",
+				DefaultText: "<path/to/text/file>",
+				TakesFile:   true,
+			},
+			&cli.BoolFlag{
+				Name:  "partial",
+				Usage: "Apply as many names from the targets file as are available when the number of names differs\n\t\t\t\tfrom the number of matches. The remaining matches are left unchanged.",
+			},
 			&cli.StringSliceFlag{
 				Name:        "find",
 				Aliases:     []string{"f"},
 				Usage:       "Search pattern. Treated as a regular expression unless combined with s/--string-mode.\n\t\t\t\tDefaults to the entire file name if omitted.",
 				DefaultText: "<pattern>",
 			},
+			&cli.StringFlag{
+				Name:        "find-from",
+				Usage:       "Read the search pattern from the specified file instead of the command line. A trailing newline\n\t\t\t\tis ignored. Cannot be combined with `-f/--find`.",
+				DefaultText: "<file>",
+				TakesFile:   true,
+			},
 			&cli.StringSliceFlag{
 				Name:        "replace",
 				Aliases:     []string{"r"},
@@ -305,26 +576,172 @@ or: FIND [REPLACE] [PATHS TO FILES AND DIRECTORIES...]`
 				Aliases: []string{"u"},
 				Usage:   "Undo the last operation performed in the current working directory if possible.\n\t\t\t\tLearn more: https://github.com/ayoisaiah/f2/wiki/Undoing-a-renaming-operation.",
 			},
+			&cli.StringFlag{
+				Name:        "undo-file",
+				Usage:       "Undo the operation recorded in the specified backup file regardless of the current working directory.\n\t\t\t\tThe backup file is left in place after the operation is reverted.",
+				DefaultText: "<path/to/backup/file>",
+				TakesFile:   true,
+			},
+			&cli.StringFlag{
+				Name:        "apply-from-backup",
+				Usage:       "Apply the operation recorded in the specified backup file to the directory specified as the path\n\t\t\t\targument (or the current directory) instead of the one it was carried out in. The directory\n\t\t\t\tmust have the same structure so that each renamed path exists there.",
+				DefaultText: "<path/to/backup/file>",
+				TakesFile:   true,
+			},
+			&cli.StringFlag{
+				Name:        "relocate-to",
+				Usage:       "Resolve the paths recorded in a backup file against the specified directory when undoing an operation.\n\t\t\t\tUse this if the renamed files have been moved since the operation was carried out.",
+				DefaultText: "<path/to/dir>",
+				TakesFile:   true,
+			},
+			&cli.BoolFlag{
+				Name:  "allow-control-chars",
+				Usage: "Allow target names to contain control characters such as newlines and tabs.\n\t\t\t\tSuch names are detected as a conflict by default.",
+			},
+			&cli.BoolFlag{
+				Name:  "allow-invalid-utf8",
+				Usage: "Match file names that are not valid UTF-8 against their raw bytes and preserve those\n\t\t\t\tbytes in the target names and backup files.",
+			},
 			&cli.BoolFlag{
 				Name:  "allow-overwrites",
 				Usage: "Allow the renaming operation to overwite existing files.\n\t\t\t\tNote that using this option can lead to unrecoverable data loss in the renamed files.",
 			},
+			&cli.BoolFlag{
+				Name:  "archive",
+				Usage: "Rename the entries of the zip or tar archive specified as the path argument instead of files\n\t\t\t\ton the filesystem. The original archive is backed up so that the operation can be undone.",
+			},
+			&cli.BoolFlag{
+				Name:  "atomic-within-dir",
+				Usage: "Move all the sources to temporary names within their directories before moving any of them\n\t\t\t\tto their targets so that no target collides with a source that is yet to be renamed. This allows overlapping\n\t\t\t\tchanges such as rotations (a -> b, b -> c, c -> a) to be committed in any order.",
+			},
+			&cli.BoolFlag{
+				Name:  "check-perms",
+				Usage: "Verify that the source and target directories of each change are writable\n\t\t\t\tso that permission errors are reported before the renaming operation is carried out.",
+			},
+			&cli.BoolFlag{
+				Name:  "checkpoint",
+				Usage: "Record the progress of the renaming operation so that it can be completed through --resume\n\t\t\t\tif it is interrupted. The plan is written before any file is renamed, and the progress is\n\t\t\t\tsynced to disk after each change which slows down large operations.",
+			},
+			&cli.BoolFlag{
+				Name:  "check-only",
+				Usage: "Compute the planned changes and report any conflicts without modifying the filesystem.\n\t\t\t\tExits with status 2 if conflicts are detected so that it can be used as a check in scripts.",
+			},
+			&cli.BoolFlag{
+				Name:  "clear-ledger",
+				Usage: "Forget the paths recorded in the ledger by --stop-on-match so that they can be matched again.",
+			},
+			&cli.BoolFlag{
+				Name:  "cleanup-on-failure",
+				Usage: "Remove the directories created for the targets that are left empty when some of the changes fail,\n\t\t\t\tand list the changes that were applied so that they can be reviewed.",
+			},
+			&cli.BoolFlag{
+				Name:  "collapse-separators",
+				Usage: "Reduce each run of separator characters in the target to a single character and trim\n\t\t\t\tseparators from the ends of each name (the extension is preserved).\n\t\t\t\tThe separators may be changed through --separators.",
+			},
+			&cli.BoolFlag{
+				Name:  "copy",
+				Usage: "Copy each matched file or directory to its target instead of renaming it.",
+			},
+			&cli.StringFlag{
+				Name:        "counter-group-by",
+				Usage:       "Restart the numbering of index variables for each group of matches that share the same key.\n\t\t\t\tThe key is computed from each match's path relative to its path argument, either through\n\t\t\t\t'level:<n>' for its first n directories (e.g. 'level:1' for the top-level directory) or a regular\n\t\t\t\texpression whose capture groups (or entire match) make up the key. Takes precedence over --counter-scope.",
+				DefaultText: "<level:n|regex>",
+			},
+			&cli.StringFlag{
+				Name:        "counter-scope",
+				Usage:       "Determines whether index variables number the matches sequentially across all directories ('global'),\n\t\t\t\trestart the numbering in each directory ('perdir'), or restart the numbering for each path\n\t\t\t\targument including its subdirectories ('perroot'). Set to 'global' by default.",
+				Value:       "global",
+				DefaultText: "<global|perdir|perroot>",
+			},
+			&cli.IntFlag{
+				Name:        "counter-start",
+				Usage:       "The number that index variables start counting from unless a starting number is specified in the variable itself.",
+				Value:       1,
+				DefaultText: "<integer>",
+			},
+			&cli.IntFlag{
+				Name:        "counter-step",
+				Usage:       "The amount by which index variables are incremented for each file unless a step is specified in the variable itself.",
+				Value:       1,
+				DefaultText: "<integer>",
+			},
+			&cli.UintFlag{
+				Name:        "dereference-count",
+				Usage:       "Limits the number of links that are dereferenced in a chain of symlinks when their targets are\n\t\t\t\tmatched (--symlinks target). Longer chains are reported and skipped. Set to 0 by default for no limit.",
+				Value:       0,
+				DefaultText: "<integer>",
+			},
+			&cli.BoolFlag{
+				Name:  "edit",
+				Usage: "Open the target of each match in a text editor (determined by $VISUAL or $EDITOR) and rename\n\t\t\t\taccording to the edited file. Each line must remain on its original position unless\n\t\t\t\tit is prefixed with its original line number and a tab character.",
+			},
+			&cli.BoolFlag{
+				Name:  "count",
+				Usage: "Print statistics about the matches (the number of matches, how many would change, conflicts,\n\t\t\t\tand a breakdown by extension) instead of listing each one. No changes are made in this mode.",
+			},
+			&cli.BoolFlag{
+				Name:  "empty-dirs",
+				Usage: "Treat directories without any entries as empty when --only-empty or --only-non-empty is set.",
+			},
 			&cli.StringSliceFlag{
 				Name:        "exclude",
 				Aliases:     []string{"E"},
-				Usage:       "Exclude files and directories that match the provided regular expression pattern. \n\t\t\t\tMultiple exclude patterns can be specified by repeating this option in a command.\n\n\t\t\t\tE.g: `-E 'json' -E 'yml'` filters out JSON and YAML files from the matched files.\n\t\t\t\tIt is equivalent to `-E 'json|yaml'`.",
+				Usage:       "Exclude files and directories that match the provided regular expression pattern. \n\t\t\t\tMultiple exclude patterns can be specified by repeating this option in a command.\n\n\t\t\t\tE.g: `-E 'json' -E 'yml'` filters out JSON and YAML files from the matched files.\n\t\t\t\tIt is equivalent to `-E 'json|yaml'`. See also `--exclude-mode`.",
 				DefaultText: "<pattern>",
 			},
+			&cli.StringFlag{
+				Name:        "explain",
+				Usage:       "Report whether the specified file or directory would be matched by the provided options and\n\t\t\t\twhich stage of the search accepted or rejected it (type, hidden, extension, exclude, include or match)\n\t\t\t\twithout renaming anything. Useful for debugging find and exclude patterns.",
+				DefaultText: "<path>",
+			},
+			&cli.StringFlag{
+				Name:        "exclude-from",
+				Usage:       "Read exclude patterns from the specified file (one regular expression per line) and combine\n\t\t\t\tthem with any patterns provided through `--exclude`. Blank lines and lines starting with '#' are ignored.",
+				DefaultText: "<file>",
+				TakesFile:   true,
+			},
+			&cli.BoolFlag{
+				Name:  "exclude-ignore-case",
+				Usage: "Match the exclude patterns case-insensitively regardless of whether -i/--ignore-case is set.",
+			},
+			&cli.StringFlag{
+				Name:        "exclude-mode",
+				Usage:       "Determines how multiple exclude patterns are combined. Set to 'any' (the default)\n\t\t\t\tto exclude files that match at least one pattern, or 'all' to exclude only\n\t\t\t\tthose files that match every pattern.",
+				Value:       "any",
+				DefaultText: "<any|all>",
+			},
 			&cli.BoolFlag{
 				Name:    "exec",
 				Aliases: []string{"x"},
 				Usage:   "Execute the renaming operation and commit the changes to the filesystem.",
 			},
+			&cli.BoolFlag{
+				Name:  "ext-only",
+				Usage: "Search for matches in the extension of each file (without the leading dot) and replace\n\t\t\t\tonly the extension, leaving the rest of the name untouched. Directories are not matched.",
+			},
+			&cli.StringFlag{
+				Name:        "first-line",
+				Usage:       "Only match files whose first line matches the specified regular expression.\n\t\t\t\tOnly the first 512 bytes of each file are read. Useful for matching scripts by\n\t\t\t\ttheir shebang line (e.g. '^#!.*python'). Directories are never matched.",
+				DefaultText: "<pattern>",
+			},
 			&cli.BoolFlag{
 				Name:    "fix-conflicts",
 				Aliases: []string{"F"},
 				Usage:   "Automatically fix renaming conflicts based on predefined rules.\n\t\t\t\tLearn more: https://github.com/ayoisaiah/f2/wiki/Validation-and-conflict-detection.",
 			},
+			&cli.BoolFlag{
+				Name:  "git",
+				Usage: "Rename the files that are tracked in a Git repository through 'git mv' so that their history is\n\t\t\t\tpreserved and the index is updated. Untracked files are renamed as usual.",
+			},
+			&cli.BoolFlag{
+				Name:  "group-by-operation",
+				Usage: "Group the changes in dry-run mode by the kind of operation that each one performs: renames\n\t\t\t\twithin the same directory, case changes, moves to existing directories and moves to new directories.",
+			},
+			&cli.StringFlag{
+				Name:        "hardlinks",
+				Usage:       "Treat the matched names that are hard links to the same file as a group. Either rename only the\n\t\t\t\tfirst name of each group and skip the others ('first'), or rename all of them with the same\n\t\t\t\tvalue for index variables ('all').",
+				DefaultText: "<first|all>",
+			},
 			&cli.BoolFlag{
 				Name:    "hidden",
 				Aliases: []string{"H"},
@@ -338,22 +755,41 @@ or: FIND [REPLACE] [PATHS TO FILES AND DIRECTORIES...]`
 			&cli.BoolFlag{
 				Name:    "ignore-case",
 				Aliases: []string{"i"},
-				Usage:   "Ignore string casing when searching for matches.",
+				Usage:   "Ignore string casing when searching for matches. Case folding applies to all Unicode letters.",
 			},
 			&cli.BoolFlag{
 				Name:    "ignore-ext",
 				Aliases: []string{"e"},
 				Usage:   "Ignore the file extension when searching for matches.",
 			},
+			&cli.BoolFlag{
+				Name:  "include-ext",
+				Usage: "Reattach the original extension to each target when the extension is ignored (-e/--ignore-ext).\n\t\t\t\tOnly the last extension is considered (e.g. '.gz' in 'file.tar.gz'). Enabled by default;\n\t\t\t\tuse '--include-ext=false' to construct the full target (including its extension) yourself.",
+				Value: true,
+			},
+			&cli.StringFlag{
+				Name:        "include-from",
+				Usage:       "Only match the files and directories listed in the specified file (one path per line) if they\n\t\t\t\talso match the find pattern. Relative paths are resolved against each path argument (or the\n\t\t\t\tcurrent directory). Blank lines and lines starting with '#' are ignored.",
+				DefaultText: "<file>",
+				TakesFile:   true,
+			},
+			&cli.BoolFlag{
+				Name:  "include-own-files",
+				Usage: "Match the CSV, map and rules files used in the operation, and the backup files created by f2.\n\t\t\t\tThese files are excluded from the matches by default.",
+			},
 			&cli.BoolFlag{
 				Name:    "interactive",
 				Aliases: []string{"n"},
-				Usage:   "Prompt to execute renaming operation after a dry-run.",
+				Usage:   "Prompt to execute renaming operation after a dry-run. Press ENTER or 'a' to commit the changes,\n\t\t\t\t'e' to edit them in your editor first or 'q' to quit without committing.",
 			},
 			&cli.BoolFlag{
 				Name:  "json",
 				Usage: "Always produce JSON output except for error messages which go to the standard error",
 			},
+			&cli.BoolFlag{
+				Name:  "last",
+				Usage: "Print the changes made by the last operation in the current working directory and when it was\n\t\t\t\tcarried out without modifying anything.",
+			},
 			&cli.UintFlag{
 				Name:        "max-depth",
 				Aliases:     []string{"m"},
@@ -361,15 +797,77 @@ or: FIND [REPLACE] [PATHS TO FILES AND DIRECTORIES...]`
 				Value:       0,
 				DefaultText: "<integer>",
 			},
+			&cli.UintFlag{
+				Name:        "max-entries-per-dir",
+				Usage:       "Abort the search if a directory contains more than the specified number of entries\n\t\t\t\tinstead of loading all of them into memory (set to 0 by default for no limit).",
+				Value:       0,
+				DefaultText: "<integer>",
+			},
+			&cli.BoolFlag{
+				Name:  "no-backup",
+				Usage: "Do not create a backup file for the renaming operation. The operation cannot be reverted\n\t\t\t\tthrough -u/--undo when this option is set.",
+			},
 			&cli.BoolFlag{
 				Name:  "no-color",
 				Usage: "Disable coloured output.",
 			},
+			&cli.StringFlag{
+				Name:        "normalize-unicode",
+				Usage:       "Convert the targets to the specified Unicode normalization form so that names which look identical\n\t\t\t\tare also encoded identically. macOS uses NFD while most other systems use NFC.",
+				DefaultText: "<nfc|nfd>",
+			},
+			&cli.BoolFlag{
+				Name:    "null",
+				Aliases: []string{"0"},
+				Usage:   "Separate the paths read from the standard input through the '-' path argument with NUL bytes\n\t\t\t\tinstead of newlines, such as in the output of 'find -print0'.",
+			},
+			&cli.StringFlag{
+				Name:        "num-fallback",
+				Usage:       "The value used in place of the {num} variable for files whose names do not contain a number.\n\t\t\t\tIf unset, such files cause the renaming operation to fail.",
+				DefaultText: "<text>",
+			},
+			&cli.StringFlag{
+				Name:        "on-error",
+				Usage:       "Determines what happens when a file cannot be renamed. Set to 'continue' (the default)\n\t\t\t\tto attempt the remaining changes and report all failures at the end, or 'abort' to stop\n\t\t\t\tat the first failure and leave the remaining files untouched.",
+				Value:       "continue",
+				DefaultText: "<continue|abort>",
+			},
 			&cli.BoolFlag{
 				Name:    "only-dir",
 				Aliases: []string{"D"},
 				Usage:   "Rename only directories, not files (implies -d/--include-dir).",
 			},
+			&cli.BoolFlag{
+				Name:  "only-empty",
+				Usage: "Match only empty (zero-byte) files. Directories are matched regardless of whether they are\n\t\t\t\tempty unless --empty-dirs is set.",
+			},
+			&cli.BoolFlag{
+				Name:  "only-hidden",
+				Usage: "Match only hidden files (implies -H/--hidden). Files specified as path arguments are\n\t\t\t\tmatched regardless of whether they are hidden.",
+			},
+			&cli.BoolFlag{
+				Name:  "only-non-empty",
+				Usage: "Match only non-empty files. Directories are matched regardless of whether they are\n\t\t\t\tempty unless --empty-dirs is set.",
+			},
+			&cli.StringFlag{
+				Name:        "output-file",
+				Usage:       "Write the report (or the JSON output if --json is set) to the specified file instead of\n\t\t\t\tthe standard output. The file is created if it does not exist, or truncated otherwise.",
+				DefaultText: "<file>",
+				TakesFile:   true,
+			},
+			&cli.BoolFlag{
+				Name:  "plan",
+				Usage: "Print the matches and their planned changes along with any conflicts in JSON format\n\t\t\t\twithout renaming anything. Must be combined with --json.",
+			},
+			&cli.StringFlag{
+				Name:        "prefix",
+				Usage:       "Insert the specified text at the start of each target name. If no replacement is provided,\n\t\t\t\tthe matched names are left as is apart from the prefix.",
+				DefaultText: "<text>",
+			},
+			&cli.BoolFlag{
+				Name:  "preserve-ext-case",
+				Usage: "Leave the case of the file extension (the part after the last dot) intact when case\n\t\t\t\ttransformations such as {.lw} are applied to a match that includes it. This has no effect\n\t\t\t\twith -e/--ignore-ext or --ext-only since the extension is not transformed with the name.",
+			},
 			&cli.BoolFlag{
 				Name:    "quiet",
 				Aliases: []string{"q"},
@@ -380,6 +878,16 @@ or: FIND [REPLACE] [PATHS TO FILES AND DIRECTORIES...]`
 				Aliases: []string{"R"},
 				Usage:   "Recursively traverse directories when searching for matches.",
 			},
+			&cli.StringFlag{
+				Name:        "relative-to",
+				Usage:       "Display the paths in the report and JSON output relative to the specified directory.\n\t\t\t\tThe paths in the report are relative to the working directory by default.\n\t\t\t\tThe files are still renamed using their absolute paths.",
+				DefaultText: "<dir>",
+				TakesFile:   true,
+			},
+			&cli.BoolFlag{
+				Name:  "remove-broken-links",
+				Usage: "Remove the matched broken symlinks instead of renaming them once the operation is confirmed.\n\t\t\t\tThey are only listed in dry-run mode. Implies --report-broken-links. Removed links are recreated by --undo.",
+			},
 			&cli.IntFlag{
 				Name:        "replace-limit",
 				Aliases:     []string{"l"},
@@ -387,6 +895,84 @@ or: FIND [REPLACE] [PATHS TO FILES AND DIRECTORIES...]`
 				Value:       0,
 				DefaultText: "<integer>",
 			},
+			&cli.StringFlag{
+				Name:        "replace-scope",
+				Usage:       "Determines whether the replacement string replaces only the matched portions of each file name\n\t\t\t\t('match') or the entire file name if it contains a match ('name'). Capture variables refer\n\t\t\t\tto the first match in the latter case. Set to 'match' by default.",
+				Value:       "match",
+				DefaultText: "<match|name>",
+			},
+			&cli.BoolFlag{
+				Name:  "report-broken-links",
+				Usage: "List the symlinks whose targets do not exist that are found while searching for matches.",
+			},
+			&cli.BoolFlag{
+				Name:  "resume",
+				Usage: "Complete the renaming operation in the current directory that was interrupted before it finished.\n\t\t\t\tThe changes that were already applied are skipped. Only operations carried out with\n\t\t\t\t--checkpoint can be resumed.",
+			},
+			&cli.UintFlag{
+				Name:        "retries",
+				Usage:       "Retry a failed rename up to the specified number of times if the failure is transient\n\t\t\t\t(such as when the file is busy or locked). Set to 0 by default for no retries.",
+				Value:       0,
+				DefaultText: "<integer>",
+			},
+			&cli.DurationFlag{
+				Name:        "retry-delay",
+				Usage:       "The delay before the first retry of a failed rename. It is doubled after each attempt.",
+				Value:       100 * time.Millisecond,
+				DefaultText: "<duration>",
+			},
+			&cli.StringSliceFlag{
+				Name:        "route-by-ext",
+				Usage:       "Place each renamed file in the directory mapped to its extension relative to its own directory,\n\t\t\t\tcreating it as needed.\n\t\t\t\tUse '*' as the extension to set the directory for unmapped extensions. Can be repeated.\n\t\t\t\tIt may be used without -f/-r in which case every matched file is routed with its name unchanged.",
+				DefaultText: "<ext=dir>",
+			},
+			&cli.StringFlag{
+				Name:        "target-dir",
+				Usage:       "Place each renamed file in the specified directory, creating it as needed. The matches are\n\t\t\t\tflattened into the directory unless --preserve-structure is set.",
+				DefaultText: "<path/to/dir>",
+				TakesFile:   true,
+			},
+			&cli.BoolFlag{
+				Name:  "preserve-structure",
+				Usage: "Recreate the directory of each match relative to the path argument it was found in under\n\t\t\t\tthe directory specified through --target-dir instead of flattening the matches.",
+			},
+			&cli.Int64Flag{
+				Name:        "seed",
+				Usage:       "Seed the generator used for random string and UUID variables so that the output is reproducible.\n\t\t\t\tA random seed is used by default.",
+				DefaultText: "<integer>",
+			},
+			&cli.StringFlag{
+				Name:        "separators",
+				Usage:       "The characters that are collapsed when --collapse-separators is set.\n\t\t\t\tDefaults to spaces, hyphens and underscores.",
+				Value:       " -_",
+				DefaultText: "<characters>",
+			},
+			&cli.BoolFlag{
+				Name:  "simulate",
+				Usage: "Perform the renaming operation on a temporary copy of the directory structure of the\n\t\t\t\tmatched files and print the resulting tree. The copy is discarded afterwards so the\n\t\t\t\toriginal files are left untouched.",
+			},
+			&cli.StringFlag{
+				Name:        "size-buckets",
+				Usage:       "Set the thresholds used by the {sizebucket} variable as two comma-separated sizes.\n\t\t\t\tFiles smaller than the first size are 'small', files smaller than the second one are\n\t\t\t\t'medium' and the rest are 'large'. Units such as KB, MB and GB are based on powers of 1024.",
+				Value:       "1MB,100MB",
+				DefaultText: "<small,large>",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-already-named",
+				Usage: "Drop any match whose name is already identical to its target so that repeated runs\n\t\t\t\tof the same renaming operation do not report unchanged files.",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-empty-targets",
+				Usage: "Drop any match whose target has an empty name (such as when every part of a template resolves\n\t\t\t\tto an empty string) instead of reporting it as a conflict.",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-identical",
+				Usage: "Drop any change whose target already exists with the same contents as the source (compared\n\t\t\t\tby their SHA-256 hashes) instead of overwriting it or reporting a conflict. The dropped changes\n\t\t\t\tare reported as skipped. Targets with different contents are subject to the overwrite policy.",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-unreadable",
+				Usage: "Skip paths that cannot be read (such as directories without read permission) instead\n\t\t\t\tof aborting the search. The skipped paths are reported once the search is complete.",
+			},
 			&cli.StringFlag{
 				Name: "sort",
 				Usage: `Sort the matches in ascending order according to the provided '<sort>'.
@@ -403,20 +989,89 @@ or: FIND [REPLACE] [PATHS TO FILES AND DIRECTORIES...]`
         `,
 				DefaultText: "<sort>",
 			},
+			&cli.StringFlag{
+				Name:        "sort-changes",
+				Usage:       "Order the changes in the report and JSON output by their source names ('source'),\n\t\t\t\ttarget names ('target'), or directories ('dir'). This does not affect the order in which\n\t\t\t\tthe matches are numbered or renamed.",
+				DefaultText: "<source|target|dir>",
+			},
 			&cli.StringFlag{
 				Name:        "sortr",
 				Usage:       "Same options as --sort but presents the matches in the reverse order.",
 				DefaultText: "<sort>",
 			},
+			&cli.BoolFlag{
+				Name:  "stop-on-match",
+				Usage: "Record the paths produced by the renaming operation in a ledger and skip any match that\n\t\t\t\tis already recorded there so that repeating the same operation does not rename the\n\t\t\t\tresults again. Use --clear-ledger to forget the recorded paths.",
+			},
+			&cli.BoolFlag{
+				Name:  "stem-only",
+				Usage: "Search for matches in the name of each file without its extension and reattach the\n\t\t\t\textension to the target. Equivalent to -e/--ignore-ext with --include-ext.",
+			},
 			&cli.BoolFlag{
 				Name:    "string-mode",
 				Aliases: []string{"s"},
 				Usage:   "Treats the search pattern (specified by -f/--find) as a non-regex string.",
 			},
+			&cli.StringFlag{
+				Name:        "suffix",
+				Usage:       "Insert the specified text at the end of each target name before the extension.\n\t\t\t\tIf no replacement is provided, the matched names are left as is apart from the suffix.",
+				DefaultText: "<text>",
+			},
+			&cli.BoolFlag{
+				Name:  "suffix-after-ext",
+				Usage: "Append the text provided through --suffix after the extension instead of before it.",
+			},
 			&cli.BoolFlag{
-				Name:    "verbose",
-				Aliases: []string{"V"},
-				Usage:   "Enable verbose output during the renaming operation.",
+				Name:  "swap",
+				Usage: "Allow the targets of a renaming operation to be the sources of other changes in any order\n\t\t\t\tso that names can be swapped (a -> b, b -> a) or rotated. Cycles are resolved through temporary\n\t\t\t\tnames and the changes are committed in an order that avoids overwriting any path.",
+			},
+			&cli.StringFlag{
+				Name:        "symlinks",
+				Usage:       "Determines how matched symlinks are handled. They are renamed themselves ('link'), the files\n\t\t\t\tthat they point to are matched and renamed instead while the links are updated to keep\n\t\t\t\tpointing to them ('target'), or they are skipped ('skip'). Set to 'link' by default.",
+				Value:       "link",
+				DefaultText: "<link|target|skip>",
+			},
+			&cli.BoolFlag{
+				Name:  "template",
+				Usage: "Parse the replacement as a Go template (text/template) that is executed for each match.\n\t\t\t\tThe template data provides .Name, .Stem, .Ext, .Dir, .Match, .Groups, .Index, .Counter,\n\t\t\t\t.Size, .ModTime and .IsDir, and the upper, lower, title, trim, trimPrefix, trimSuffix,\n\t\t\t\treplace, contains, hasPrefix, hasSuffix and pad functions are available in addition to\n\t\t\t\tthe builtin ones. Replacement variables are not supported in templates.",
+			},
+			&cli.BoolFlag{
+				Name:  "timings",
+				Usage: "Print how long the find, replace, validate and rename stages took and the number of\n\t\t\t\tentries that each stage processed to the standard error once the operation completes.\n\t\t\t\tThe timings are also included in the JSON output as the 'timings' object.",
+			},
+			&cli.StringFlag{
+				Name:        "traversal-order",
+				Usage:       "Determines the order in which directories are searched in recursive mode. Each level of\n\t\t\t\tdirectories is searched before the next one in 'bfs' mode, while 'dfs' mode searches the\n\t\t\t\tsubdirectories of each directory before its siblings. Set to 'bfs' by default.",
+				Value:       "bfs",
+				DefaultText: "<bfs|dfs>",
+			},
+			&cli.BoolFlag{
+				Name:  "tree",
+				Usage: "Print the paths that result from the renaming operation as a tree grouped by directory\n\t\t\t\tafter the table of changes in dry-run mode. Has no effect with --json or -q/--quiet.",
+			},
+			&cli.BoolFlag{
+				Name:  "trim",
+				Usage: "Strip whitespace from both ends of each target name (the extension is preserved) and from\n\t\t\t\tthe end of the extension. The characters may be changed through --trim-chars.",
+			},
+			&cli.StringFlag{
+				Name:        "trim-chars",
+				Usage:       "The characters that are stripped when --trim is set, such as ' .-' to remove stray spaces, dots\n\t\t\t\tand dashes. Defaults to whitespace.",
+				DefaultText: "<characters>",
+			},
+			&cli.BoolFlag{
+				Name:  "unicode",
+				Usage: "Make the \\d, \\w and \\s classes in the find pattern match Unicode digits, letters (including\n\t\t\t\tcombining marks) and spaces instead of ASCII only. Unicode scripts and categories such as\n\t\t\t\t\\p{Han} and POSIX classes such as [[:digit:]] can be used regardless.",
+			},
+			&cli.BoolFlag{
+				Name:  "verify-copy",
+				Usage: "Compare the checksum of each copied file with its source when used with --copy.\n\t\t\t\tThe copy is removed and reported as failed if the checksums do not match.",
+			},
+			&config.VerbosityFlag{
+				BoolFlag: &cli.BoolFlag{
+					Name:    "verbose",
+					Aliases: []string{"V"},
+					Usage:   "Enable verbose output during the renaming operation. Repeat it (-VV) in dry-run mode to\n\t\t\t\texplain each target by listing the substrings matched by each find pattern along with\n\t\t\t\ttheir capture groups, the expansion of the replacement for each match and the result.",
+				},
 			},
 		},
 		UseShortOptionHandling: true,
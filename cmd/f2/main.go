@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"os"
 
 	"github.com/pterm/pterm"
@@ -15,6 +16,11 @@ func main() {
 	if err != nil {
 		pterm.EnableOutput()
 		pterm.Fprintln(os.Stderr, pterm.Error.Sprint(err))
+
+		if errors.Is(err, f2.ErrCheckFailed) {
+			os.Exit(f2.ExitCodeCheckFailed)
+		}
+
 		os.Exit(1)
 	}
 }
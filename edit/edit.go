@@ -0,0 +1,223 @@
+// Package edit allows the targets of a renaming operation to be modified in
+// a text editor before the operation is validated and carried out. Each
+// target is written to a temporary file (one path per line) which is opened
+// in the user's preferred editor, and the edited paths are read back once the
+// editor exits
+package edit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+	internalos "github.com/ayoisaiah/f2/internal/os"
+)
+
+var (
+	errLineCountMismatch = errors.New(
+		"the edited file contains %d lines, but %d lines were expected. Each line must correspond to exactly one file",
+	)
+
+	errLinesReordered = errors.New(
+		"line %d of the edited file matches the original path on line %d. Reordering lines is not supported unless each line is prefixed with its original line number and a tab character",
+	)
+
+	errInvalidPairing = errors.New(
+		"line %d of the edited file does not have a valid pairing column. When pairing columns are used, every line must be prefixed with a unique original line number (between 1 and %d) and a tab character",
+	)
+)
+
+// pairingRegex matches a line that is explicitly paired with an original
+// line number through a `<number>\t` prefix.
+var pairingRegex = regexp.MustCompile(`^(\d+)\t(.*)$`)
+
+// editorCommand returns the command used to launch the user's preferred
+// editor. The `$VISUAL` and `$EDITOR` environmental variables are consulted
+// in that order before falling back to a platform default.
+func editorCommand() ([]string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == internalos.Windows {
+			editor = "notepad"
+		}
+	}
+
+	return shellquote.Split(editor)
+}
+
+// writeTargets writes the path to each target on a separate line.
+func writeTargets(f *os.File, changes []*file.Change) error {
+	writer := bufio.NewWriter(f)
+
+	for _, change := range changes {
+		_, err := writer.WriteString(
+			filepath.Join(change.BaseDir, change.Target) + "\n",
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+// readLines reads the contents of the edited file. A trailing newline at the
+// end of the file is not treated as an additional line.
+func readLines(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	content := strings.ReplaceAll(string(b), "\r\n", "\n")
+	content = strings.TrimSuffix(content, "\n")
+
+	if content == "" {
+		return []string{}, nil
+	}
+
+	return strings.Split(content, "\n"), nil
+}
+
+// pairLines associates each edited line with the index of its original
+// line. Lines are paired by position unless every line is prefixed with a
+// pairing column, in which case the specified line numbers are used instead.
+func pairLines(lines, original []string) (map[int]string, error) {
+	if len(lines) != len(original) {
+		return nil, fmt.Errorf(
+			errLineCountMismatch.Error(),
+			len(lines),
+			len(original),
+		)
+	}
+
+	paired := make(map[int]string, len(lines))
+
+	if len(lines) > 0 && pairingRegex.MatchString(lines[0]) {
+		for i, line := range lines {
+			submatch := pairingRegex.FindStringSubmatch(line)
+			if submatch == nil {
+				return nil, fmt.Errorf(errInvalidPairing.Error(), i+1, len(lines))
+			}
+
+			n, err := strconv.Atoi(submatch[1])
+			if err != nil || n < 1 || n > len(lines) {
+				return nil, fmt.Errorf(errInvalidPairing.Error(), i+1, len(lines))
+			}
+
+			if _, exists := paired[n-1]; exists {
+				return nil, fmt.Errorf(errInvalidPairing.Error(), i+1, len(lines))
+			}
+
+			paired[n-1] = submatch[2]
+		}
+
+		return paired, nil
+	}
+
+	originalIndex := make(map[string]int, len(original))
+	for i, v := range original {
+		originalIndex[v] = i
+	}
+
+	for i, line := range lines {
+		if j, ok := originalIndex[line]; ok && j != i && line != original[i] {
+			return nil, fmt.Errorf(errLinesReordered.Error(), i+1, j+1)
+		}
+
+		paired[i] = line
+	}
+
+	return paired, nil
+}
+
+// Edit opens the targets of the provided changes in the user's editor and
+// updates each change with the edited target once the editor exits.
+func Edit(
+	conf *config.Config,
+	changes []*file.Change,
+) ([]*file.Change, error) {
+	f, err := os.CreateTemp("", "f2-edit-*.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(f.Name())
+
+	err = writeTargets(f, changes)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := readLines(f.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := editorCommand()
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args, f.Name())
+
+	//nolint:gosec // the editor is chosen by the user
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = conf.Stdin
+	cmd.Stdout = conf.Stderr
+	cmd.Stderr = conf.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := readLines(f.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	paired, err := pairLines(lines, original)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, change := range changes {
+		edited := paired[i]
+		if edited == "" {
+			change.Target = ""
+			continue
+		}
+
+		target, err := filepath.Rel(change.BaseDir, edited)
+		if err != nil {
+			return nil, err
+		}
+
+		change.Target = target
+	}
+
+	return changes, nil
+}
@@ -1,9 +1,15 @@
 package f2_test
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"os"
@@ -15,10 +21,13 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/adrg/xdg"
+	"github.com/dsnet/compress/bzip2"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	shellquote "github.com/kballard/go-shellquote"
@@ -30,8 +39,13 @@ import (
 	"github.com/ayoisaiah/f2/internal/status"
 
 	"github.com/ayoisaiah/f2"
+	"github.com/ayoisaiah/f2/find"
+	"github.com/ayoisaiah/f2/internal/config"
 	"github.com/ayoisaiah/f2/internal/conflict"
 	internalos "github.com/ayoisaiah/f2/internal/os"
+	"github.com/ayoisaiah/f2/rename"
+	"github.com/ayoisaiah/f2/replace"
+	"github.com/ayoisaiah/f2/validate"
 )
 
 func init() {
@@ -42,9 +56,22 @@ func init() {
 
 	projectRoot = dir
 
-	workingDir, err := filepath.Abs(".")
+	var err error
+
+	backupFilePath, err = backupFileFor(".")
+	if err != nil {
+		log.Fatalf("Unable to retrieve backup file path: %v", err)
+	}
+
+	rand.Seed(time.Now().UnixNano())
+}
+
+// backupFileFor returns the path to the backup file that is created when
+// renaming from the specified working directory.
+func backupFileFor(dir string) (string, error) {
+	workingDir, err := filepath.Abs(dir)
 	if err != nil {
-		log.Fatalf("Unable to retrieve test working directory: %v", err)
+		return "", err
 	}
 
 	workingDir = strings.ReplaceAll(workingDir, "/", "_")
@@ -53,18 +80,17 @@ func init() {
 		workingDir = strings.ReplaceAll(workingDir, ":", "_")
 	}
 
-	backupFilePath, err = xdg.DataFile(
+	return xdg.DataFile(
 		filepath.Join("f2", "backups", workingDir+".json"),
 	)
-	if err != nil {
-		log.Fatalf("Unable to retrieve xdg data file directory: %v", err)
-	}
-
-	rand.Seed(time.Now().UnixNano())
 }
 
 var nonAlphanumericRegex = regexp.MustCompile(`[^a-zA-Z0-9]+`)
 
+var uuidRegex = regexp.MustCompile(
+	`[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}`,
+)
+
 var projectRoot string
 
 var testFixtures = "testdata"
@@ -220,6 +246,7 @@ type TestCase struct {
 	DefaultOpts string              `json:"default_opts"`
 	GoldenFile  string              `json:"golden_file"`
 	Setup       []string            `json:"setup"`
+	Env         map[string]string   `json:"env"`
 }
 
 func retrieveTestCases(t *testing.T, filename string) []TestCase {
@@ -302,6 +329,96 @@ func retrieveTestCases(t *testing.T, filename string) []TestCase {
 	return cases
 }
 
+// setupFiles contains the files that are created in the test directory for
+// the setup parameter of the same name. Paths that end with a slash are
+// created as empty directories.
+var setupFiles = map[string]map[string]string{
+	"targets": {
+		"targets.txt":       "first.arw\nsecond.arw\n",
+		"targets-crlf.txt":  "first.arw\r\n\r\nsecond.arw",
+		"targets-short.txt": "first.arw\n",
+		"targets-long.txt":  "first.arw\nsecond.arw\nthird.arw\n",
+	},
+	"rules": {
+		"rules.json": `{"find": ["test", "_A"], "replace": ["exam", "-B"]}`,
+		"rules.yaml": "find: ['001', '002']\nreplace: ['one', 'two']\n",
+		"rules.yml": `find: ['TXT', '_A.']
+replace: ['md', '_B.']
+ignore_case: [true, false]
+string_mode: [false, true]
+`,
+		// the second rule only matches the names produced by the first one
+		"chain.json":      `{"find": ["test_", "exam"], "replace": ["exam_", "quiz"]}`,
+		"mismatched.json": `{"find": ["test", "_A"], "replace": ["exam"]}`,
+		"options.json":    `{"find": ["test"], "replace": ["exam"], "ignore_case": [true, false]}`,
+	},
+	// the target of one source is the name of another source, and two
+	// sources share the same name in different directories
+	"map": {
+		"map/b.txt":     "",
+		"map/c.txt":     "",
+		"map/one/x.txt": "",
+		"map/two/x.txt": "",
+		"map/map.json": `{
+  "c.txt": "b.txt",
+  "b.txt": "a.txt",
+  "one/x.txt": "y.txt",
+  "two/x.txt": "z.txt"
+}`,
+	},
+	"sizes": {
+		"sizes/buckets/a": strings.Repeat("x", 9),
+		"sizes/buckets/b": strings.Repeat("x", 10),
+		"sizes/buckets/c": strings.Repeat("x", 19),
+		"sizes/buckets/d": strings.Repeat("x", 20),
+		"sizes/default/a": strings.Repeat("x", 1<<20-1),
+		"sizes/default/b": strings.Repeat("x", 1<<20),
+		"sizes/human/a":   "",
+		"sizes/human/b":   strings.Repeat("x", 1023),
+		"sizes/human/c":   strings.Repeat("x", 1024),
+		"sizes/human/d":   strings.Repeat("x", 1536),
+		"sizes/human/e":   strings.Repeat("x", 1<<20+1<<18),
+	},
+	// sorting by size interleaves the files in both directories
+	"interleaved": {
+		"interleaved/a/one.txt":   "x",
+		"interleaved/b/two.txt":   "xx",
+		"interleaved/a/three.txt": "xxx",
+		"interleaved/b/four.txt":  "xxxx",
+	},
+	"emptiness": {
+		"mixed/empty-dir/":           "",
+		"mixed/empty.txt":            "",
+		"mixed/full.txt":             "contents",
+		"mixed/full-dir/nested.txt":  "",
+		"mixed/full-dir/another.txt": "contents",
+	},
+	"own files": {
+		"own/a.txt":       "",
+		"own/b.txt":       "",
+		"own/rows.csv":    "*,tagged\n",
+		"own/backup.json": `{"working_dir":"/tmp","changes":[]}`,
+		"own/data.json":   `{"name":"data"}`,
+	},
+	"hashes": {
+		"hashes/hello.txt": "hello",
+	},
+	// the copy of a.txt is up to date while that of b.txt is stale
+	"identical": {
+		"identical/a.txt":        "same",
+		"identical/b.txt":        "new",
+		"identical/backup/a.txt": "same",
+		"identical/backup/b.txt": "old",
+	},
+	"tree": {
+		"tree/photos/2021/a.jpg":  "",
+		"tree/photos/2022/b.jpg":  "",
+		"tree/photos/c.jpg":       "",
+		"tree/videos/2021/d.mp4":  "",
+		"tree/videos/clips/e.mp4": "",
+	},
+}
+
 // modifyTestingEnv changes some properties of the test environment
 // based on the setup parameter.
 func modifyTestingEnv(
@@ -327,6 +444,116 @@ func modifyTestingEnv(
 		}
 	}
 
+	// hides files through their attributes without a leading dot
+	if slices.Contains(setup, "windows_attributes") {
+		err := setHidden(filepath.Join(testDir, "images", "dsc-001.arw"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = setSystem(filepath.Join(testDir, "images", "dsc-002.arw"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if slices.Contains(setup, "read-only") {
+		// permission checks are bypassed for the root user
+		if os.Geteuid() == 0 {
+			t.SkipNow()
+		}
+
+		dir := filepath.Join(testDir, "dev")
+
+		err := os.Chmod(dir, 0o555)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() {
+			_ = os.Chmod(dir, 0o755)
+		})
+	}
+
+	if slices.Contains(setup, "backup") {
+		b, err := os.ReadFile(
+			filepath.Join(projectRoot, testFixtures, "backups", "relocated.json"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(filepath.Join(testDir, "backup.json"), b, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if slices.Contains(setup, "archives") {
+		dir := filepath.Join(testDir, "archives")
+
+		err := os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"backup.tar.gz", "notes.txt"} {
+			err = os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if slices.Contains(setup, "scripts") {
+		dir := filepath.Join(testDir, "scripts")
+
+		err := os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files := map[string][]byte{
+			"backup.sh": []byte("#!/bin/bash\ntar -czf backup.tar.gz .\n"),
+			"serve":     []byte("#!/usr/bin/env python3\nimport http.server\n"),
+			"notes.txt": []byte("bash is a shell\n"),
+			"logo.png":  []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+			"data.bin":  {0x00, 0x01, 0x02, 0x03, 0xff, 0xfe},
+		}
+
+		for name, content := range files {
+			err = os.WriteFile(filepath.Join(dir, name), content, 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, v := range setup {
+		for name, content := range setupFiles[v] {
+			path := filepath.Join(testDir, filepath.FromSlash(name))
+
+			if strings.HasSuffix(name, "/") {
+				err := os.MkdirAll(path, os.ModePerm)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				continue
+			}
+
+			err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = os.WriteFile(path, []byte(content), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
 	if slices.Contains(setup, "exiftool") {
 		_, err := exec.LookPath("exiftool")
 		if err != nil {
@@ -371,6 +598,10 @@ func preTestSetup(
 
 	t.Setenv(f2.EnvDefaultOpts, tc.DefaultOpts)
 
+	for k, v := range tc.Env {
+		t.Setenv(k, v)
+	}
+
 	// modify the base directory
 	for i := range tc.Changes {
 		ch := tc.Changes[i]
@@ -527,18 +758,3371 @@ func TestAllOSes(t *testing.T) {
 	runTestCases(t, cases)
 }
 
-func TestShortHelp(t *testing.T) {
-	help := f2.ShortHelp(f2.NewApp())
+func TestUUIDVariablesAreUnique(t *testing.T) {
+	testDir := setupFileSystem(t, "uuid_variables_are_unique")
 
-	if runtime.GOOS == internalos.Windows {
-		// TODO: due to line endings on Windows
-		// FIXME: Needs to be corrected instead of ignored
-		t.SkipNow()
+	args := parseArgs(
+		t,
+		t.Name(),
+		fmt.Sprintf("-f '.*' -r '{uuid}-{uuid}' -R --json '%s'", testDir),
+	)
+
+	result, err := executeTest(args)
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
 	}
 
-	g := goldie.New(
+	var output internaljson.Output
+
+	err = json.Unmarshal(result, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output.Changes) == 0 {
+		t.Fatal("expected at least one change")
+	}
+
+	seen := make(map[string]bool)
+
+	for _, ch := range output.Changes {
+		for _, uuid := range uuidRegex.FindAllString(ch.Target, -1) {
+			if seen[uuid] {
+				t.Fatalf("UUID %s was generated more than once", uuid)
+			}
+
+			seen[uuid] = true
+		}
+	}
+
+	if len(seen) != 2*len(output.Changes) {
+		t.Fatalf(
+			"expected %d distinct UUIDs, got %d",
+			2*len(output.Changes),
+			len(seen),
+		)
+	}
+}
+
+func TestInvalidFileDateLayout(t *testing.T) {
+	testDir := setupFileSystem(t, "invalid_file_date_layout")
+
+	args := parseArgs(
 		t,
-		goldie.WithFixtureDir(filepath.Join(projectRoot, testFixtures)),
+		t.Name(),
+		fmt.Sprintf("-r '{fdate.layout}' '%s'", filepath.Join(testDir, "movies")),
 	)
-	g.Assert(t, "help", []byte(help))
+
+	_, err := executeTest(args)
+	if err == nil || !strings.Contains(err.Error(), "Invalid date layout") {
+		t.Fatalf("expected an invalid date layout error, got: %v", err)
+	}
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	testDir := setupFileSystem(t, "invalid_template")
+
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	args := parseArgs(
+		t,
+		t.Name(),
+		fmt.Sprintf(
+			"-f 'dsc' -r '{{.Name' --template -x '%s'",
+			filepath.Join(testDir, "images"),
+		),
+	)
+
+	_, err := executeTest(args)
+	if err == nil || !strings.Contains(err.Error(), "template") {
+		t.Fatalf("expected a template parse error, got: %v", err)
+	}
+
+	// nothing is renamed if the template cannot be parsed
+	_, err = os.Stat(filepath.Join(testDir, "images", "dsc-001.arw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNumVariableRequiresNumber(t *testing.T) {
+	testDir := setupFileSystem(t, "num_variable_requires_number")
+
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	args := parseArgs(
+		t,
+		t.Name(),
+		fmt.Sprintf("-f '.*' -r '{num+1}' '%s'", filepath.Join(testDir, "ebooks")),
+	)
+
+	_, err := executeTest(args)
+	if err == nil || !strings.Contains(err.Error(), "no number was found") {
+		t.Fatalf("expected an error about the missing number, got: %v", err)
+	}
+}
+
+func TestFindFromFileConflictsWithFind(t *testing.T) {
+	testDir := setupFileSystem(t, "find_from_file_conflicts_with_find")
+
+	patternFile := filepath.Join(testDir, "pattern.txt")
+
+	err := os.WriteFile(patternFile, []byte("dsc\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := parseArgs(
+		t,
+		t.Name(),
+		fmt.Sprintf(
+			"--find-from '%s' -f arw '%s'",
+			patternFile,
+			filepath.Join(testDir, "images"),
+		),
+	)
+
+	_, err = executeTest(args)
+	if err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Fatalf("expected an error about combining find options, got: %v", err)
+	}
+}
+
+func TestSwapCycles(t *testing.T) {
+	testCases := []struct {
+		name string
+		// the contents of each file. Sorting by size numbers the files
+		// in a different order from their names which creates a cycle
+		contents map[string]string
+		want     map[string]string
+	}{
+		{
+			name: "swap the names of two files",
+			contents: map[string]string{
+				"1.txt": "aa",
+				"2.txt": "a",
+			},
+			want: map[string]string{
+				"1.txt": "a",
+				"2.txt": "aa",
+			},
+		},
+		{
+			name: "rotate the names of three files",
+			contents: map[string]string{
+				"1.txt": "aaa",
+				"2.txt": "a",
+				"3.txt": "aa",
+			},
+			want: map[string]string{
+				"1.txt": "a",
+				"2.txt": "aa",
+				"3.txt": "aaa",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			testDir := setupFileSystem(t, cleanString(tc.name))
+			dir := filepath.Join(testDir, "swap")
+
+			t.Setenv(f2.EnvDefaultOpts, "")
+
+			err := os.Mkdir(dir, 0o755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, content := range tc.contents {
+				err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			assertContents := func(want map[string]string) {
+				t.Helper()
+
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(entries) != len(want) {
+					t.Fatalf("expected %d files, got %d", len(want), len(entries))
+				}
+
+				for name, content := range want {
+					got, err := os.ReadFile(filepath.Join(dir, name))
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if string(got) != content {
+						t.Fatalf("expected %s to contain %q, got %q", name, content, got)
+					}
+				}
+			}
+
+			args := "-f '^\\d' -r '{%d}' --sort size -x"
+
+			// the targets conflict with the existing files without --swap
+			_, err = executeTest(parseArgs(t, tc.name, args+" "+dir))
+			if err == nil {
+				t.Fatal("expected a conflict without --swap")
+			}
+
+			assertContents(tc.contents)
+
+			result, err := executeTest(
+				parseArgs(t, tc.name, args+" --swap "+dir),
+			)
+			if err != nil {
+				t.Log(string(result))
+				t.Fatal(err)
+			}
+
+			assertContents(tc.want)
+
+			result, err = executeTest(parseArgs(t, tc.name, "-u -x"))
+			if err != nil {
+				t.Log(string(result))
+				t.Fatal(err)
+			}
+
+			assertContents(tc.contents)
+		})
+	}
+}
+
+func TestNoBackup(t *testing.T) {
+	testDir := setupFileSystem(t, "no_backup")
+
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	backupFile, err := backupFileFor(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = os.Remove(backupFile)
+
+	t.Cleanup(func() {
+		_ = os.Remove(backupFile)
+	})
+
+	dir := filepath.Join(testDir, "ebooks")
+
+	args := parseArgs(
+		t,
+		t.Name(),
+		fmt.Sprintf("-f 1984 -r orwell -x --no-backup '%s'", dir),
+	)
+
+	result, err := executeTest(args)
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "orwell.pdf")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(backupFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no backup file to be written, got: %v", err)
+	}
+
+	args = parseArgs(t, t.Name(), fmt.Sprintf("-f orwell -r 1984 -x '%s'", dir))
+
+	result, err = executeTest(args)
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(backupFile); err != nil {
+		t.Fatalf("expected a backup file to be written: %v", err)
+	}
+}
+
+func TestLastOperation(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	// the backup is kept in a temporary data directory
+	t.Cleanup(xdg.Reload)
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	xdg.Reload()
+
+	setupFileSystem(t, "last_operation")
+
+	_, err := executeTest(parseArgs(t, t.Name(), "--last"))
+	if err == nil {
+		t.Fatal("expected an error when no operation has been recorded")
+	}
+
+	result, err := executeTest(
+		parseArgs(t, t.Name(), "-f 'dsc' -r 'photo' -x images"),
+	)
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	result, err = executeTest(parseArgs(t, t.Name(), "--last"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"renamed 2 paths",
+		filepath.Join("images", "dsc-001.arw"),
+		filepath.Join("images", "photo-001.arw"),
+		filepath.Join("images", "dsc-002.arw"),
+		filepath.Join("images", "photo-002.arw"),
+	} {
+		if !strings.Contains(string(result), want) {
+			t.Fatalf("expected the output to contain %q, got:\n%s", want, result)
+		}
+	}
+
+	result, err = executeTest(parseArgs(t, t.Name(), "--last --json"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	var o internaljson.Output
+
+	err = json.Unmarshal(result, &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(o.Changes) != 2 || o.Changes[0].Target != "photo-001.arw" {
+		t.Fatalf("unexpected changes in the last operation: %s", prettyPrint(o.Changes))
+	}
+
+	// the renamed files are left alone
+	if _, err := os.Stat(filepath.Join("images", "photo-001.arw")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTargetsFile(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testCases := []struct {
+		name    string
+		targets string
+	}{
+		{
+			name:    "fewer names than matches",
+			targets: "targets-short.txt",
+		},
+		{
+			name:    "more names than matches",
+			targets: "targets-long.txt",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			testDir := setupFileSystem(t, cleanString(tc.name))
+
+			_, err := modifyTestingEnv(t, testDir, []string{"targets"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := executeTest(parseArgs(t, tc.name, fmt.Sprintf(
+				"-f 'dsc' --targets-file %s images",
+				tc.targets,
+			)))
+			if err == nil {
+				t.Fatalf("expected an error, got:\n%s", result)
+			}
+		})
+	}
+}
+
+func TestCheckOnly(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testCases := []struct {
+		name    string
+		args    string
+		wantErr bool
+	}{
+		{
+			name: "a plan without conflicts",
+			args: "-f 'dsc' -r 'photo' --check-only -x images",
+		},
+		{
+			name:    "a plan with conflicting targets",
+			args:    "-f 'dsc-\\d+' -r 'photo' --check-only -x images",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			setupFileSystem(t, cleanString(tc.name))
+
+			result, err := executeTest(parseArgs(t, tc.name, tc.args))
+			if tc.wantErr {
+				if !errors.Is(err, f2.ErrCheckFailed) {
+					t.Fatalf("expected %v, got: %v\n%s", f2.ErrCheckFailed, err, result)
+				}
+			} else if err != nil {
+				t.Log(string(result))
+				t.Fatal(err)
+			}
+
+			// the filesystem is not modified even with -x/--exec
+			for _, name := range []string{"dsc-001.arw", "dsc-002.arw"} {
+				if _, err := os.Stat(filepath.Join("images", name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	setupFileSystem(t, "annotate")
+
+	args := `-f '(?P<prefix>[a-z]+)-(\d+)(x)?' -r '${2}_${prefix}' -VV`
+
+	result, err := executeTest(parseArgs(t, t.Name(), args+" --json images"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	var o internaljson.Output
+
+	err = json.Unmarshal(result, &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`pattern '(?P<prefix>[a-z]+)-(\d+)(x)?' matched 1 time`,
+		`'dsc-001' at 0-7: $1 (prefix)='dsc', $2='001', $3=<unmatched> → '001_dsc'`,
+		`result: '001_dsc.arw'`,
+	}
+
+	var got []string
+
+	for _, change := range o.Changes {
+		if change.Source == "dsc-001.arw" {
+			got = change.Annotations
+		}
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected annotations (-want +got):\n%s", diff)
+	}
+
+	// the annotations are printed below the changes in dry-run mode
+	result, err = executeTest(parseArgs(t, t.Name(), args+" images"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	for _, annotation := range want {
+		if !strings.Contains(string(result), annotation) {
+			t.Fatalf("expected the output to contain %q, got:\n%s", annotation, result)
+		}
+	}
+
+	// the annotations are not part of the default or the plain verbose output
+	for _, extra := range []string{"", " -V", " --verbose"} {
+		result, err = executeTest(
+			parseArgs(t, t.Name(), `-f '(?P<prefix>[a-z]+)-(\d+)' -r '${2}_${prefix}'`+extra+" images"),
+		)
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		if strings.Contains(string(result), "pattern '") {
+			t.Fatalf("unexpected annotations in the output of %q:\n%s", extra, result)
+		}
+	}
+
+	// the long flag can be repeated as well
+	result, err = executeTest(parseArgs(t, t.Name(), args[:len(args)-4]+" --verbose --verbose images"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(result), want[0]) {
+		t.Fatalf("expected the output to contain %q, got:\n%s", want[0], result)
+	}
+}
+
+func TestUndoRemovesCreatedDirs(t *testing.T) {
+	testCases := []struct {
+		name string
+		// directories that exist before the renaming operation
+		existing []string
+		// directories that must be removed after undoing the operation
+		removed []string
+		// the number of directories created by the renaming operation
+		created int
+	}{
+		{
+			name:    "remove all created directories",
+			removed: []string{"javascript"},
+			created: 3,
+		},
+		{
+			name:     "keep directories that existed before the operation",
+			existing: []string{"javascript"},
+			removed:  []string{filepath.Join("javascript", "npm")},
+			created:  2,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			testDir := setupFileSystem(t, cleanString(tc.name))
+			dir := filepath.Join(testDir, "dev")
+
+			t.Setenv(f2.EnvDefaultOpts, "")
+
+			for _, v := range tc.existing {
+				err := os.MkdirAll(filepath.Join(dir, v), 0o755)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			args := parseArgs(
+				t,
+				tc.name,
+				fmt.Sprintf(
+					"-f '(index.ts)' -r 'javascript/npm/typescript/$1' -x --json '%s'",
+					dir,
+				),
+			)
+
+			result, err := executeTest(args)
+			if err != nil {
+				t.Log(string(result))
+				t.Fatal(err)
+			}
+
+			var o internaljson.Output
+
+			err = json.Unmarshal(result, &o)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if o.CreatedDirCount != tc.created {
+				t.Fatalf(
+					"expected %d created directories, got %d",
+					tc.created,
+					o.CreatedDirCount,
+				)
+			}
+
+			_, err = os.Stat(
+				filepath.Join(dir, "javascript", "npm", "typescript", "index.ts"),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err = executeTest(parseArgs(t, tc.name, "-u -x"))
+			if err != nil {
+				t.Log(string(result))
+				t.Fatal(err)
+			}
+
+			if _, err = os.Stat(filepath.Join(dir, "index.ts")); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, v := range tc.removed {
+				_, err = os.Stat(filepath.Join(dir, v))
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("expected %s to be removed, got: %v", v, err)
+				}
+			}
+
+			for _, v := range tc.existing {
+				if _, err = os.Stat(filepath.Join(dir, v)); err != nil {
+					t.Fatalf("expected %s to be kept: %v", v, err)
+				}
+			}
+		})
+	}
+}
+
+func TestUndoCopy(t *testing.T) {
+	testDir := setupFileSystem(t, "undo_copy")
+
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	dir := filepath.Join(testDir, "text")
+	source := filepath.Join(dir, "test.TXT")
+
+	args := parseArgs(
+		t,
+		t.Name(),
+		fmt.Sprintf("-f 'test\\.TXT' -r 'copies/copy.txt' --copy -x '%s'", dir),
+	)
+
+	result, err := executeTest(args)
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(result), "Created 1 directory") {
+		t.Fatalf("expected the created directory to be counted, got: %s", result)
+	}
+
+	// the source is modified after it was copied
+	err = os.WriteFile(source, []byte("modified"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = executeTest(parseArgs(t, t.Name(), "-u -x"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "modified" {
+		t.Fatalf("expected the modification of the source to be kept, got %q", b)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "copies"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the copy and its directory to be removed: %v", err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	testCases := []struct {
+		name string
+		args string
+		path string
+		want []string
+	}{
+		{
+			name: "matched with captured groups",
+			args: `-f '(\w+)-(\d+)' -e`,
+			path: "images/dsc-001.arw",
+			want: []string{
+				"extension  accepted: matching against 'dsc-001' (extension ignored)",
+				"match      accepted: matches the find pattern '(\\w+)-(\\d+)' with $0='dsc-001' $1='dsc' $2='001'",
+				"would be matched",
+			},
+		},
+		{
+			name: "directories are rejected by default",
+			args: "-f images",
+			path: "images",
+			want: []string{
+				"type       rejected: directories are skipped unless -d/--include-dir is set",
+				"would not be matched",
+			},
+		},
+		{
+			name: "files are rejected in only dir mode",
+			args: "-f dsc -D",
+			path: "images/dsc-001.arw",
+			want: []string{
+				"type       rejected: files are skipped when -D/--only-dir is set",
+			},
+		},
+		{
+			name: "hidden files are rejected by default",
+			args: "-f golang",
+			path: ".golang.pdf",
+			want: []string{
+				"hidden     rejected: hidden files are skipped unless -H/--hidden is set",
+			},
+		},
+		{
+			name: "hidden files are accepted with the hidden flag",
+			args: "-f golang -H",
+			path: ".golang.pdf",
+			want: []string{
+				"hidden     accepted: not skipped",
+				"would be matched",
+			},
+		},
+		{
+			name: "excluded files are rejected",
+			args: "-f dsc -E arw -E 001 --exclude-mode all",
+			path: "images/dsc-001.arw",
+			want: []string{
+				"exclude    rejected: excluded by 'arw, 001'",
+			},
+		},
+		{
+			name: "files that do not match the find pattern are rejected",
+			args: "-f jpg",
+			path: "images/dsc-001.arw",
+			want: []string{
+				"exclude    accepted: not excluded",
+				"match      rejected: does not match the find pattern 'jpg'",
+			},
+		},
+		{
+			name: "files whose first line does not match are rejected",
+			args: "-f dsc --first-line '^#!'",
+			path: "images/dsc-001.arw",
+			want: []string{
+				"match      accepted",
+				"content    rejected: first line '' does not match '^#!'",
+				"would not be matched",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			testDir := setupFileSystem(t, cleanString(tc.name))
+
+			t.Setenv(f2.EnvDefaultOpts, "")
+
+			args := parseArgs(
+				t,
+				tc.name,
+				fmt.Sprintf(
+					"%s --no-color --explain '%s'",
+					tc.args,
+					filepath.Join(testDir, tc.path),
+				),
+			)
+
+			result, err := executeTest(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range tc.want {
+				if !strings.Contains(string(result), want) {
+					t.Fatalf("expected output to contain %q, got:\n%s", want, result)
+				}
+			}
+		})
+	}
+}
+
+func TestShortHelp(t *testing.T) {
+	help := f2.ShortHelp(f2.NewApp())
+
+	if runtime.GOOS == internalos.Windows {
+		// TODO: due to line endings on Windows
+		// FIXME: Needs to be corrected instead of ignored
+		t.SkipNow()
+	}
+
+	g := goldie.New(
+		t,
+		goldie.WithFixtureDir(filepath.Join(projectRoot, testFixtures)),
+	)
+	g.Assert(t, "help", []byte(help))
+}
+
+func TestSkipUnreadable(t *testing.T) {
+	testDir := setupFileSystem(t, "skip_unreadable")
+
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	images := filepath.Join(testDir, "images")
+	missing := filepath.Join(testDir, "missing")
+
+	args := parseArgs(
+		t,
+		t.Name(),
+		fmt.Sprintf("-f dsc -r photo '%s' '%s'", images, missing),
+	)
+
+	_, err := executeTest(args)
+	if err == nil {
+		t.Fatal("expected the search to fail without --skip-unreadable")
+	}
+
+	args = parseArgs(
+		t,
+		t.Name(),
+		fmt.Sprintf(
+			"-f dsc -r photo --skip-unreadable --json '%s' '%s'",
+			images,
+			missing,
+		),
+	)
+
+	result, err := executeTest(args)
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	var out internaljson.Output
+
+	err = json.Unmarshal(result, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(out.Changes))
+	}
+
+	if len(out.Skipped) != 1 || out.Skipped[0].Path != missing {
+		t.Fatalf("expected %s to be skipped, got: %v", missing, out.Skipped)
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	testCases := []struct {
+		name string
+		args string
+		json bool
+	}{
+		{
+			name: "write the dry run report to a file",
+			args: "-f dsc -r photo",
+		},
+		{
+			name: "write the JSON output to a file",
+			args: "-f dsc -r photo --json",
+			json: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			testDir := setupFileSystem(t, cleanString(tc.name))
+
+			t.Setenv(f2.EnvDefaultOpts, "")
+
+			images := filepath.Join(testDir, "images")
+			outputFile := filepath.Join(testDir, "report.txt")
+
+			// the file is truncated before the report is written
+			err := os.WriteFile(outputFile, []byte("stale content"), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			args := parseArgs(t, tc.name, fmt.Sprintf("%s '%s'", tc.args, images))
+
+			want, err := executeTest(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			args = parseArgs(
+				t,
+				tc.name,
+				fmt.Sprintf("%s --output-file '%s' '%s'", tc.args, outputFile, images),
+			)
+
+			result, err := executeTest(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(result) != 0 {
+				t.Fatalf("expected no output, got: %s", string(result))
+			}
+
+			got, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tc.json {
+				if !bytes.Equal(got, want) {
+					t.Fatalf("expected file contents:\n%s\ngot:\n%s", want, got)
+				}
+
+				return
+			}
+
+			// the date may differ between both runs
+			var wantOut, gotOut internaljson.Output
+
+			err = json.Unmarshal(want, &wantOut)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = json.Unmarshal(got, &gotOut)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(
+				wantOut,
+				gotOut,
+				cmpopts.IgnoreFields(internaljson.Output{}, "Date"),
+			) {
+				t.Fatal(cmp.Diff(wantOut, gotOut))
+			}
+		})
+	}
+}
+
+func TestConcurrentOperations(t *testing.T) {
+	testDir := setupFileSystem(t, "concurrent_operations")
+
+	testCases := []struct {
+		find        string
+		replacement string
+		dir         string
+		want        []string
+	}{
+		{
+			find:        `dsc-\d+`,
+			replacement: "photo{%02d}",
+			dir:         filepath.Join(testDir, "images"),
+			want:        []string{"photo01.arw", "photo02.arw"},
+		},
+		{
+			find:        `startrails\d`,
+			replacement: "sky{%02d}",
+			dir:         filepath.Join(testDir, "images", "canon"),
+			want:        []string{"sky01.jpg", "sky02.jpg"},
+		},
+	}
+
+	errs := make([]error, len(testCases))
+
+	var wg sync.WaitGroup
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		conf := &config.Config{
+			Date:               time.Now(),
+			WorkingDir:         testDir,
+			PathsToFilesOrDirs: []string{tc.dir},
+			FindSlice:          []string{tc.find},
+			ReplacementSlice:   []string{tc.replacement},
+			CounterStart:       1,
+			CounterStep:        1,
+			OnError:            config.OnErrorContinue,
+			Exec:               true,
+			NoBackup:           true,
+		}
+
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			errs[i] = renameWith(conf)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, tc := range testCases {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+
+		for _, name := range tc.want {
+			if _, err := os.Stat(filepath.Join(tc.dir, name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestRenameWith(t *testing.T) {
+	targets := map[string]string{
+		"dsc-001.arw": "first.arw",
+		"dsc-002.arw": "second.arw",
+	}
+
+	testCases := []struct {
+		fn      rename.TargetFunc
+		name    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "uppercase the names",
+			fn: func(change *file.Change) string {
+				return strings.ToUpper(change.Source)
+			},
+			want: []string{"DSC-001.ARW", "DSC-002.ARW"},
+		},
+		{
+			name: "look up the targets in a map",
+			fn: func(change *file.Change) string {
+				return targets[change.Source]
+			},
+			want: []string{"first.arw", "second.arw"},
+		},
+		{
+			name: "detect conflicts in the computed targets",
+			fn: func(_ *file.Change) string {
+				return "photo.arw"
+			},
+			want:    []string{"dsc-001.arw", "dsc-002.arw"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			testDir := setupFileSystem(t, cleanString(tc.name))
+
+			dir := filepath.Join(testDir, "images")
+
+			conf := &config.Config{
+				Date:               time.Now(),
+				WorkingDir:         testDir,
+				PathsToFilesOrDirs: []string{dir},
+				FindSlice:          []string{`\.arw$`},
+				OnError:            config.OnErrorContinue,
+				Exec:               true,
+				NoBackup:           true,
+			}
+
+			err := conf.SetFindStringRegex(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			matches, err := find.Find(context.Background(), conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = rename.RenameWith(context.Background(), conf, matches, tc.fn)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error: %t, got: %v", tc.wantErr, err)
+			}
+
+			if tc.wantErr && len(conf.Conflicts) == 0 {
+				t.Fatal("expected the conflicts to be recorded in the config")
+			}
+
+			var conflictErr *rename.ConflictError
+			if tc.wantErr && !errors.As(err, &conflictErr) {
+				t.Fatalf("expected a conflict error, got: %v", err)
+			}
+
+			for _, name := range tc.want {
+				if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// renameWith runs a complete renaming operation with the specified config
+// without going through the CLI.
+func renameWith(conf *config.Config) error {
+	err := conf.SetFindStringRegex(0)
+	if err != nil {
+		return err
+	}
+
+	matches, err := find.Find(context.Background(), conf)
+	if err != nil {
+		return err
+	}
+
+	changes, err := replace.Replace(conf, matches)
+	if err != nil {
+		return err
+	}
+
+	if conflicts := validate.Validate(changes, conf); len(conflicts) > 0 {
+		return fmt.Errorf("unexpected conflicts: %v", conflicts)
+	}
+
+	return rename.Rename(context.Background(), conf, changes)
+}
+
+func TestConcurrentCSVFinds(t *testing.T) {
+	testDir := setupFileSystem(t, "concurrent_csv_finds")
+
+	testCases := []struct {
+		dir    string
+		record string
+		source string
+	}{
+		{
+			dir:    filepath.Join(testDir, "images"),
+			record: "dsc-001.arw,one",
+			source: "dsc-001.arw",
+		},
+		{
+			dir:    filepath.Join(testDir, "images", "canon"),
+			record: "startrails1.jpg,two",
+			source: "startrails1.jpg",
+		},
+	}
+
+	confs := make([]*config.Config, len(testCases))
+	errs := make([]error, len(testCases))
+
+	var wg sync.WaitGroup
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		csvFile := filepath.Join(tc.dir, "input.csv")
+
+		err := os.WriteFile(csvFile, []byte(tc.record+"\n"), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		confs[i] = &config.Config{CSVFilename: csvFile}
+
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			_, errs[i] = find.Find(context.Background(), confs[i])
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, tc := range testCases {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+
+		want := map[string][]string{
+			filepath.Join(tc.dir, tc.source): strings.Split(tc.record, ","),
+		}
+
+		if !cmp.Equal(want, confs[i].CSVRows) {
+			t.Fatal(cmp.Diff(want, confs[i].CSVRows))
+		}
+	}
+}
+
+// cancelAfter is a context that is cancelled once its error has been
+// checked a specific number of times.
+type cancelAfter struct {
+	context.Context
+	checks int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.checks <= 0 {
+		return context.Canceled
+	}
+
+	c.checks--
+
+	return nil
+}
+
+func TestFindCancelled(t *testing.T) {
+	testDir := setupFileSystem(t, "find_cancelled")
+
+	conf := &config.Config{
+		PathsToFilesOrDirs: []string{testDir},
+		FindSlice:          []string{"dsc"},
+		Recursive:          true,
+	}
+
+	err := conf.SetFindStringRegex(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the search path is checked once before the walk begins
+	// so the walk is cancelled at the second directory
+	ctx := &cancelAfter{Context: context.Background(), checks: 2}
+
+	matches, err := find.Find(ctx, conf)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got: %v", context.Canceled, err)
+	}
+
+	if matches != nil {
+		t.Fatalf("expected no matches after cancellation, got: %v", matches)
+	}
+
+	matches, err = find.Find(context.Background(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) == 0 {
+		t.Fatal("expected the search to succeed without cancellation")
+	}
+
+	// the rows of CSV and map files are not read once cancelled
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, conf := range []*config.Config{
+		{CSVFilename: filepath.Join(projectRoot, testFixtures, "input.csv")},
+		{MapFilename: filepath.Join(projectRoot, testFixtures, "map.json")},
+	} {
+		_, err = find.Find(cancelled, conf)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got: %v", context.Canceled, err)
+		}
+	}
+}
+
+func TestFindFS(t *testing.T) {
+	// fs.FS paths are always separated by forward slashes
+	if runtime.GOOS == internalos.Windows {
+		t.SkipNow()
+	}
+
+	fsys := fstest.MapFS{
+		"images/dsc-001.arw":           {},
+		"images/dsc-002.arw":           {},
+		"images/sony/dsc-003.arw":      {},
+		"images/canon/startrails1.jpg": {},
+		"images/.thumbs/dsc-001.jpg":   {},
+		"docs/.dsc-notes.txt":          {},
+	}
+
+	testCases := []struct {
+		name string
+		conf config.Config
+		want []string
+	}{
+		{
+			name: "search the current directory",
+			conf: config.Config{
+				FindSlice:  []string{"docs|images"},
+				IncludeDir: true,
+			},
+			want: []string{"docs", "images"},
+		},
+		{
+			name: "search the specified directory",
+			conf: config.Config{
+				FindSlice:          []string{"dsc"},
+				PathsToFilesOrDirs: []string{"images"},
+			},
+			want: []string{"images/dsc-001.arw", "images/dsc-002.arw"},
+		},
+		{
+			name: "search recursively",
+			conf: config.Config{
+				FindSlice: []string{"dsc"},
+				Recursive: true,
+			},
+			want: []string{
+				"images/dsc-001.arw",
+				"images/dsc-002.arw",
+				"images/sony/dsc-003.arw",
+			},
+		},
+		{
+			name: "search recursively with hidden files",
+			conf: config.Config{
+				FindSlice:     []string{"dsc"},
+				Recursive:     true,
+				IncludeHidden: true,
+			},
+			want: []string{
+				"docs/.dsc-notes.txt",
+				"images/.thumbs/dsc-001.jpg",
+				"images/dsc-001.arw",
+				"images/dsc-002.arw",
+				"images/sony/dsc-003.arw",
+			},
+		},
+		{
+			name: "limit the recursion depth",
+			conf: config.Config{
+				FindSlice:  []string{".*"},
+				Recursive:  true,
+				MaxDepth:   1,
+				IncludeDir: true,
+			},
+			want: []string{
+				"docs",
+				"images",
+				"images/canon",
+				"images/dsc-001.arw",
+				"images/dsc-002.arw",
+				"images/sony",
+			},
+		},
+		{
+			name: "search a file path",
+			conf: config.Config{
+				PathsToFilesOrDirs: []string{"images/sony/dsc-003.arw"},
+			},
+			want: []string{"images/sony/dsc-003.arw"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			conf := tc.conf
+			conf.FS = fsys
+
+			err := conf.SetFindStringRegex(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			matches, err := find.Find(context.Background(), &conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+
+			for dir, entries := range matches {
+				for _, entry := range entries {
+					got = append(got, stdpath.Join(dir, entry.Name()))
+				}
+			}
+
+			sort.Strings(got)
+
+			if !cmp.Equal(tc.want, got) {
+				t.Fatal(cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestUnicodeMode(t *testing.T) {
+	fsys := fstest.MapFS{
+		"写真.jpg":             {},
+		"photo42.jpg":        {},
+		"🎉party.txt":         {},
+		"cafe\u0301.txt":     {},
+		"ΣΟΦΙΑ.txt":          {},
+		"report\u3000q4.txt": {},
+		"٣.txt":              {},
+	}
+
+	testCases := []struct {
+		name string
+		conf config.Config
+		want []string
+	}{
+		{
+			name: "match a Unicode script",
+			conf: config.Config{
+				FindSlice: []string{`^\p{Han}+\.`},
+			},
+			want: []string{"写真.jpg"},
+		},
+		{
+			name: "match a POSIX class",
+			conf: config.Config{
+				FindSlice: []string{`[[:digit:]]{2}`},
+			},
+			want: []string{"photo42.jpg"},
+		},
+		{
+			name: "match an emoji through its Unicode category",
+			conf: config.Config{
+				FindSlice: []string{`^\p{So}`},
+			},
+			want: []string{"🎉party.txt"},
+		},
+		{
+			name: "match ASCII word characters only by default",
+			conf: config.Config{
+				FindSlice: []string{`^\w+\.txt$`},
+			},
+			want: []string{},
+		},
+		{
+			name: "match combining characters in unicode mode",
+			conf: config.Config{
+				FindSlice:   []string{`^\w+\.txt$`},
+				UnicodeMode: true,
+			},
+			want: []string{"cafe\u0301.txt", "ΣΟΦΙΑ.txt", "٣.txt"},
+		},
+		{
+			name: "match Unicode classes inside brackets in unicode mode",
+			conf: config.Config{
+				FindSlice:   []string{`^[\w.]+$`},
+				UnicodeMode: true,
+			},
+			want: []string{
+				"cafe\u0301.txt",
+				"photo42.jpg",
+				"ΣΟΦΙΑ.txt",
+				"٣.txt",
+				"写真.jpg",
+			},
+		},
+		{
+			name: "match Unicode digits and spaces in unicode mode",
+			conf: config.Config{
+				FindSlice:   []string{`^\d\.|\sq\d`},
+				UnicodeMode: true,
+			},
+			want: []string{"report\u3000q4.txt", "٣.txt"},
+		},
+		{
+			name: "leave quoted classes untouched in unicode mode",
+			conf: config.Config{
+				FindSlice:   []string{`\Q\w\E|party`},
+				UnicodeMode: true,
+			},
+			want: []string{"🎉party.txt"},
+		},
+		{
+			name: "fold the case of Unicode letters",
+			conf: config.Config{
+				FindSlice:  []string{"σοφια"},
+				IgnoreCase: true,
+			},
+			want: []string{"ΣΟΦΙΑ.txt"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			conf := tc.conf
+			conf.FS = fsys
+
+			err := conf.SetFindStringRegex(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			matches, err := find.Find(context.Background(), &conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+
+			for _, entries := range matches {
+				for _, entry := range entries {
+					got = append(got, entry.Name())
+				}
+			}
+
+			sort.Strings(got)
+
+			if !cmp.Equal(tc.want, got) {
+				t.Fatal(cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestTraversalOrder(t *testing.T) {
+	// fs.FS paths are always separated by forward slashes
+	if runtime.GOOS == internalos.Windows {
+		t.SkipNow()
+	}
+
+	fsys := fstest.MapFS{
+		"a.txt":                {},
+		"music/a.txt":          {},
+		"music/rock/a.txt":     {},
+		"music/rock/80s/a.txt": {},
+		"music/jazz/a.txt":     {},
+		"photos/a.txt":         {},
+		"photos/2023/a.txt":    {},
+	}
+
+	testCases := []struct {
+		name     string
+		order    string
+		maxDepth int
+		want     []string
+	}{
+		{
+			name:  "search breadth-first",
+			order: config.TraversalOrderBFS,
+			want: []string{
+				".",
+				"music",
+				"photos",
+				"music/jazz",
+				"music/rock",
+				"photos/2023",
+				"music/rock/80s",
+			},
+		},
+		{
+			name:  "search depth-first",
+			order: config.TraversalOrderDFS,
+			want: []string{
+				".",
+				"music",
+				"music/jazz",
+				"music/rock",
+				"music/rock/80s",
+				"photos",
+				"photos/2023",
+			},
+		},
+		{
+			name:     "search breadth-first up to the max depth",
+			order:    config.TraversalOrderBFS,
+			maxDepth: 2,
+			want: []string{
+				".",
+				"music",
+				"photos",
+				"music/jazz",
+				"music/rock",
+				"photos/2023",
+			},
+		},
+		{
+			name:     "search depth-first up to the max depth",
+			order:    config.TraversalOrderDFS,
+			maxDepth: 2,
+			want: []string{
+				".",
+				"music",
+				"music/jazz",
+				"music/rock",
+				"photos",
+				"photos/2023",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			conf := config.Config{
+				FS:             fsys,
+				FindSlice:      []string{"a"},
+				Recursive:      true,
+				MaxDepth:       tc.maxDepth,
+				TraversalOrder: tc.order,
+			}
+
+			err := conf.SetFindStringRegex(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = find.Find(context.Background(), &conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(tc.want, conf.SearchedDirs) {
+				t.Fatal(cmp.Diff(tc.want, conf.SearchedDirs))
+			}
+		})
+	}
+}
+
+func TestApplyFromBackup(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	sourceDir := setupFileSystem(t, "apply_from_backup_source")
+
+	result, err := executeTest(
+		parseArgs(t, "apply from backup", "-f '^(dsc|canon)' -r 'x$1' -R -d -x images"),
+	)
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	recorded, err := backupFileFor(sourceDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = os.Remove(recorded)
+
+	backup := filepath.Join(t.TempDir(), "backup.json")
+
+	err = os.WriteFile(backup, b, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cloneDir := setupFileSystem(t, "apply_from_backup_clone")
+
+	t.Cleanup(func() {
+		if path, err := backupFileFor(cloneDir); err == nil {
+			_ = os.Remove(path)
+		}
+	})
+
+	// the operation is applied from a different working directory
+	err = os.Chdir(sourceDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := fmt.Sprintf("--apply-from-backup '%s' -x '%s'", backup, cloneDir)
+
+	result, err = executeTest(parseArgs(t, "apply from backup", args))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"images/xdsc-001.arw",
+		"images/xdsc-002.arw",
+		"images/sony/xdsc-003.arw",
+		"images/xcanon/startrails1.jpg",
+	}
+
+	for _, name := range want {
+		_, err = os.Stat(filepath.Join(cloneDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the sources no longer exist in the clone
+	_, err = executeTest(parseArgs(t, "apply from backup", args))
+	if err == nil {
+		t.Fatal("expected the operation to fail since the sources do not exist")
+	}
+
+	// the applied operation can be undone like any other
+	err = os.Chdir(sourceDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cloneBackup, err := backupFileFor(cloneDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = executeTest(
+		parseArgs(t, "apply from backup", fmt.Sprintf("--undo-file '%s' -x", cloneBackup)),
+	)
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(filepath.Join(cloneDir, "images", "canon", "startrails1.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNestedDirRename(t *testing.T) {
+	testDir := setupFileSystem(t, "nested_dir_rename")
+
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	original := []string{
+		"nested/a/h.txt",
+		"nested/a/b/g.txt",
+		"nested/a/b/c/f.txt",
+	}
+
+	for _, name := range original {
+		path := filepath.Join(testDir, filepath.FromSlash(name))
+
+		err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(path, nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	args := "-f '^(\\w)' -r 'x$1' -R -d"
+
+	result, err := executeTest(parseArgs(t, "nested dir rename", args+" --json nested"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	var output internaljson.Output
+
+	err = json.Unmarshal(result, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the contents of each directory must be renamed before the directory
+	for i, ch := range output.Changes {
+		dir := filepath.Join(ch.BaseDir, ch.Source)
+
+		for _, next := range output.Changes[i+1:] {
+			if next.BaseDir == dir ||
+				strings.HasPrefix(next.BaseDir, dir+string(os.PathSeparator)) {
+				t.Fatalf(
+					"'%s' was renamed before its contents '%s'",
+					dir,
+					filepath.Join(next.BaseDir, next.Source),
+				)
+			}
+		}
+	}
+
+	result, err = executeTest(parseArgs(t, "nested dir rename", args+" -x nested"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	renamed := []string{
+		"nested/xa/xh.txt",
+		"nested/xa/xb/xg.txt",
+		"nested/xa/xb/xc/xf.txt",
+	}
+
+	for _, name := range renamed {
+		_, err = os.Stat(filepath.Join(testDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the directories are restored before their contents on undo
+	result, err = executeTest(parseArgs(t, "nested dir rename", "-u -x"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	for _, name := range original {
+		_, err = os.Stat(filepath.Join(testDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeZip creates a zip archive at the specified path that contains the
+// entries in files. The contents of each entry is its original name.
+func writeZip(t *testing.T, path string, files []string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+
+	for _, name := range files {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = entry.Write([]byte(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readZip returns the contents of each entry in the zip archive at the
+// specified path keyed by the entry name.
+func readZip(t *testing.T, path string) map[string]string {
+	t.Helper()
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	entries := make(map[string]string)
+
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := io.ReadAll(rc)
+		rc.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries[f.Name] = string(b)
+	}
+
+	return entries
+}
+
+func TestArchive(t *testing.T) {
+	files := []string{"a.txt", "docs/b.txt", "docs/c.txt", "docs/notes.md"}
+
+	original := make(map[string]string)
+	for _, name := range files {
+		original[name] = name
+	}
+
+	testCases := []struct {
+		want    map[string]string
+		name    string
+		args    string
+		wantErr bool
+	}{
+		{
+			name: "rename files in nested directories",
+			args: "-f txt -r text -R --archive -x",
+			want: map[string]string{
+				"a.text":        "a.txt",
+				"docs/b.text":   "docs/b.txt",
+				"docs/c.text":   "docs/c.txt",
+				"docs/notes.md": "docs/notes.md",
+			},
+		},
+		{
+			name: "rename a directory and its contents",
+			args: "-f docs -r notes -d --archive -x",
+			want: map[string]string{
+				"a.txt":          "a.txt",
+				"notes/b.txt":    "docs/b.txt",
+				"notes/c.txt":    "docs/c.txt",
+				"notes/notes.md": "docs/notes.md",
+			},
+		},
+		{
+			name: "filter by the first line of the archived files",
+			args: "-f txt -r text -R --first-line '^docs' --archive -x",
+			want: map[string]string{
+				"a.txt":         "a.txt",
+				"docs/b.text":   "docs/b.txt",
+				"docs/c.text":   "docs/c.txt",
+				"docs/notes.md": "docs/notes.md",
+			},
+		},
+		{
+			name:    "detect conflicts within the archive",
+			args:    "-f '^a' -r 'docs/b' --archive -x",
+			want:    original,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			testDir := setupFileSystem(t, cleanString(tc.name))
+
+			t.Setenv(f2.EnvDefaultOpts, "")
+
+			archivePath := filepath.Join(testDir, "archive.zip")
+
+			writeZip(t, archivePath, files)
+
+			args := parseArgs(t, tc.name, fmt.Sprintf("%s '%s'", tc.args, archivePath))
+
+			result, err := executeTest(args)
+			if (err != nil) != tc.wantErr {
+				t.Log(string(result))
+				t.Fatalf("expected error: %t, got: %v", tc.wantErr, err)
+			}
+
+			got := readZip(t, archivePath)
+			if !cmp.Equal(tc.want, got) {
+				t.Fatal(cmp.Diff(tc.want, got))
+			}
+
+			if tc.wantErr {
+				return
+			}
+
+			// the original archive is restored on undo
+			result, err = executeTest(parseArgs(t, tc.name, "-u -x"))
+			if err != nil {
+				t.Log(string(result))
+				t.Fatal(err)
+			}
+
+			got = readZip(t, archivePath)
+			if !cmp.Equal(original, got) {
+				t.Fatal(cmp.Diff(original, got))
+			}
+		})
+	}
+}
+
+// tarModTime is the modification time of each entry in the tar archives
+// created by writeTar.
+var tarModTime = time.Date(2021, time.March, 5, 10, 30, 0, 0, time.UTC)
+
+// writeTar creates a tar archive (optionally compressed with gzip or bzip2)
+// at the specified path that contains the entries in files. The contents of
+// each entry is its original name.
+func writeTar(t *testing.T, path string, files []string, compression string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	var dst io.WriteCloser = f
+
+	switch compression {
+	case "gzip":
+		dst = gzip.NewWriter(f)
+	case "bzip2":
+		dst, err = bzip2.NewWriter(f, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := tar.NewWriter(dst)
+
+	for _, name := range files {
+		err = w.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Size:     int64(len(name)),
+			Mode:     0o640,
+			Uid:      1000,
+			Gid:      1000,
+			Uname:    "f2",
+			Gname:    "f2",
+			ModTime:  tarModTime,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = w.Write([]byte(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if compression != "" {
+		err = dst.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTar returns the contents of each entry in the tar archive at the
+// specified path keyed by the entry name. It fails if the metadata written
+// by writeTar was not preserved.
+func readTar(t *testing.T, path, compression string) map[string]string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	var src io.Reader = f
+
+	switch compression {
+	case "gzip":
+		src, err = gzip.NewReader(f)
+	case "bzip2":
+		src, err = bzip2.NewReader(f, nil)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := tar.NewReader(src)
+
+	entries := make(map[string]string)
+
+	for {
+		header, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if header.Mode != 0o640 || header.Uid != 1000 || header.Gid != 1000 ||
+			header.Uname != "f2" || !header.ModTime.Equal(tarModTime) {
+			t.Fatalf("metadata of '%s' was not preserved: %+v", header.Name, header)
+		}
+
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries[header.Name] = string(b)
+	}
+
+	return entries
+}
+
+func TestTarArchive(t *testing.T) {
+	files := []string{"a.txt", "docs/b.txt", "docs/notes.md"}
+
+	original := make(map[string]string)
+	for _, name := range files {
+		original[name] = name
+	}
+
+	testCases := []struct {
+		want        map[string]string
+		name        string
+		args        string
+		archive     string
+		compression string
+	}{
+		{
+			name:    "rename the entries of a plain tarball",
+			args:    "-f txt -r text -R --archive -x",
+			archive: "archive.tar",
+			want: map[string]string{
+				"a.text":        "a.txt",
+				"docs/b.text":   "docs/b.txt",
+				"docs/notes.md": "docs/notes.md",
+			},
+		},
+		{
+			name:        "rename the entries of a gzip tarball",
+			args:        "-f docs -r notes -d --archive -x",
+			archive:     "archive.tar.gz",
+			compression: "gzip",
+			want: map[string]string{
+				"a.txt":          "a.txt",
+				"notes/b.txt":    "docs/b.txt",
+				"notes/notes.md": "docs/notes.md",
+			},
+		},
+		{
+			name:        "detect gzip compression without the extension",
+			args:        "-f '(notes)' -r '{<$1>.up}' -R --archive -x",
+			archive:     "archive.tar",
+			compression: "gzip",
+			want: map[string]string{
+				"a.txt":         "a.txt",
+				"docs/b.txt":    "docs/b.txt",
+				"docs/NOTES.md": "docs/notes.md",
+			},
+		},
+		{
+			name:        "rename the entries of a bzip2 tarball",
+			args:        "-f txt -r text -R --archive -x",
+			archive:     "archive.tar.bz2",
+			compression: "bzip2",
+			want: map[string]string{
+				"a.text":        "a.txt",
+				"docs/b.text":   "docs/b.txt",
+				"docs/notes.md": "docs/notes.md",
+			},
+		},
+		{
+			name:        "detect bzip2 compression without the extension",
+			args:        "-f docs -r notes -d --archive -x",
+			archive:     "archive.tar",
+			compression: "bzip2",
+			want: map[string]string{
+				"a.txt":          "a.txt",
+				"notes/b.txt":    "docs/b.txt",
+				"notes/notes.md": "docs/notes.md",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			testDir := setupFileSystem(t, cleanString(tc.name))
+
+			t.Setenv(f2.EnvDefaultOpts, "")
+
+			archivePath := filepath.Join(testDir, tc.archive)
+
+			writeTar(t, archivePath, files, tc.compression)
+
+			args := parseArgs(t, tc.name, fmt.Sprintf("%s '%s'", tc.args, archivePath))
+
+			result, err := executeTest(args)
+			if err != nil {
+				t.Log(string(result))
+				t.Fatal(err)
+			}
+
+			got := readTar(t, archivePath, tc.compression)
+			if !cmp.Equal(tc.want, got) {
+				t.Fatal(cmp.Diff(tc.want, got))
+			}
+
+			// the original archive is restored on undo
+			result, err = executeTest(parseArgs(t, tc.name, "-u -x"))
+			if err != nil {
+				t.Log(string(result))
+				t.Fatal(err)
+			}
+
+			got = readTar(t, archivePath, tc.compression)
+			if !cmp.Equal(original, got) {
+				t.Fatal(cmp.Diff(original, got))
+			}
+		})
+	}
+
+}
+
+func TestStopOnMatch(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	// the ledger is kept in a temporary data directory
+	t.Cleanup(xdg.Reload)
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	xdg.Reload()
+
+	testDir := setupFileSystem(t, "stop_on_match")
+
+	t.Cleanup(func() {
+		if path, err := backupFileFor(testDir); err == nil {
+			_ = os.Remove(path)
+		}
+	})
+
+	args := "-f 'atomic' -r 'atomic_v2' --stop-on-match -x ebooks"
+
+	// the second run would rename the result of the first one again
+	// if it was not recorded in the ledger
+	for i := 0; i < 2; i++ {
+		result, err := executeTest(parseArgs(t, "stop on match", args))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+	}
+
+	_, err := os.Stat(filepath.Join(testDir, "ebooks", "atomic_v2-habits.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := executeTest(parseArgs(t, "stop on match", "--clear-ledger"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	result, err = executeTest(parseArgs(t, "stop on match", args))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(
+		filepath.Join(testDir, "ebooks", "atomic_v2_v2-habits.pdf"),
+	)
+	if err != nil {
+		t.Fatal("expected the file to be matched once the ledger is cleared")
+	}
+}
+
+func TestTimings(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "timings")
+
+	t.Cleanup(func() {
+		if path, err := backupFileFor(testDir); err == nil {
+			_ = os.Remove(path)
+		}
+	})
+
+	result, err := executeTest(
+		parseArgs(t, "timings", "-f 'atomic' -r 'nuclear' --timings --json -x ebooks"),
+	)
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	var o internaljson.Output
+
+	err = json.Unmarshal(result, &o)
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	stages := []string{
+		config.StageFind,
+		config.StageReplace,
+		config.StageValidate,
+		config.StageRename,
+	}
+
+	if len(o.Timings) != len(stages) {
+		t.Fatalf("expected timings for %v, got: %v", stages, o.Timings)
+	}
+
+	for _, stage := range stages {
+		timing, ok := o.Timings[stage]
+		if !ok {
+			t.Fatalf("expected a timing for the %s stage, got: %v", stage, o.Timings)
+		}
+
+		if timing.Entries != 1 {
+			t.Fatalf(
+				"expected the %s stage to process 1 entry, got: %d",
+				stage,
+				timing.Entries,
+			)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "plan")
+
+	t.Cleanup(func() {
+		if path, err := backupFileFor(testDir); err == nil {
+			_ = os.Remove(path)
+		}
+	})
+
+	args := "-f '(\\d+)' -r '{$1}_{index}' -R --json movies"
+
+	result, err := executeTest(parseArgs(t, "plan", "--plan "+args))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	var plan internaljson.Output
+
+	err = json.Unmarshal(result, &plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !plan.DryRun || len(plan.Changes) != 4 {
+		t.Fatalf("expected a dry run with 4 changes, got: %s", result)
+	}
+
+	// the filesystem is left untouched
+	for _, change := range plan.Changes {
+		_, err = os.Stat(filepath.Join(change.BaseDir, change.Source))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err = executeTest(parseArgs(t, "plan", "-x "+args))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	var executed internaljson.Output
+
+	err = json.Unmarshal(result, &executed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(plan.Changes, executed.Changes) {
+		t.Fatal(cmp.Diff(plan.Changes, executed.Changes))
+	}
+
+	for _, change := range plan.Changes {
+		_, err = os.Stat(filepath.Join(change.BaseDir, change.Target))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPlanConflictError(t *testing.T) {
+	testDir := setupFileSystem(t, "plan_conflict_error")
+
+	dir := filepath.Join(testDir, "images")
+
+	conf := &config.Config{
+		Date:               time.Now(),
+		WorkingDir:         testDir,
+		PathsToFilesOrDirs: []string{dir},
+		FindSlice:          []string{`dsc-\d+`},
+		ReplacementSlice:   []string{"photo"},
+		OnError:            config.OnErrorContinue,
+	}
+
+	err := conf.SetFindStringRegex(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := f2.Plan(context.Background(), conf)
+
+	var conflictErr *rename.ConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("expected a conflict error, got: %v", err)
+	}
+
+	if out == nil || !cmp.Equal(out.Conflicts, conflictErr.Conflicts) {
+		t.Fatal("expected the conflicts to be included in the plan as well")
+	}
+
+	var sources []string
+
+	for _, conflicts := range conflictErr.Conflicts {
+		for _, c := range conflicts {
+			if c.Target == filepath.Join(dir, "photo.arw") {
+				sources = append(sources, c.Sources...)
+			}
+		}
+	}
+
+	want := []string{
+		filepath.Join(dir, "dsc-001.arw"),
+		filepath.Join(dir, "dsc-002.arw"),
+	}
+
+	less := cmpopts.SortSlices(func(a, b string) bool { return a < b })
+
+	if diff := cmp.Diff(want, sources, less); diff != "" {
+		t.Fatalf("unexpected conflicting sources (-want +got):\n%s", diff)
+	}
+
+	if !strings.Contains(err.Error(), "conflict") {
+		t.Fatalf("unexpected error message: %v", err)
+	}
+}
+
+func TestMaxEntriesPerDir(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "max_entries_per_dir")
+
+	images := filepath.Join(testDir, "images")
+
+	// the subdirectory exceeds the cap that the parent directory is within
+	for i := 4; i <= 8; i++ {
+		name := fmt.Sprintf("dsc-%03d.arw", i)
+
+		err := os.WriteFile(filepath.Join(images, "sony", name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		args    string
+		wantErr string
+	}{
+		{
+			name:    "directory exceeds the cap",
+			args:    "-f dsc -r photo --max-entries-per-dir 3",
+			wantErr: "contains more than 3 entries",
+		},
+		{
+			name: "directory within the cap",
+			args: "-f dsc -r photo --max-entries-per-dir 4",
+		},
+		{
+			name:    "subdirectory exceeds the cap in recursive mode",
+			args:    "-f dsc -r photo -R --max-entries-per-dir 4",
+			wantErr: "contains more than 4 entries",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			args := parseArgs(t, tc.name, fmt.Sprintf("%s '%s'", tc.args, images))
+
+			result, err := executeTest(args)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Log(string(result))
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCSVDuplicateSources(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "csv_duplicate_sources")
+
+	_, err := modifyTestingEnv(t, testDir, []string{"testdata"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name         string
+		args         string
+		wantWarnings int
+	}{
+		{
+			name: "rows referring to a renamed file are ignored",
+			args: "-csv testdata/duplicate.csv -r '{f} — {csv.2}{ext}' --json",
+			// the second glob row matches every audio file again
+			wantWarnings: 4,
+		},
+		{
+			name:         "repeated glob rows apply to the matched files in order",
+			args:         "-csv testdata/duplicate.csv --csv-in-order -r '{f} — {csv.2}{ext}' --json",
+			wantWarnings: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := executeTest(parseArgs(t, tc.name, tc.args))
+			if err != nil {
+				t.Log(string(result))
+				t.Fatal(err)
+			}
+
+			var o internaljson.Output
+
+			err = json.Unmarshal(result, &o)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(o.Warnings) != tc.wantWarnings {
+				t.Fatalf(
+					"expected %d warnings, got: %v",
+					tc.wantWarnings,
+					o.Warnings,
+				)
+			}
+
+			for _, warning := range o.Warnings {
+				if !strings.Contains(warning, "line") {
+					t.Fatalf("expected the warning to refer to a line: %s", warning)
+				}
+			}
+		})
+	}
+}
+
+// The targets of the map file would be ignored by a find pattern.
+func TestMapConflictsWithFind(t *testing.T) {
+	testDir := setupFileSystem(t, "map_conflicts_with_find")
+
+	_, err := modifyTestingEnv(t, testDir, []string{"map"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = executeTest(parseArgs(t, t.Name(), "--map map/map.json -f x -r y"))
+	if err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Fatalf("expected an error about combining --map with -f/-r, got: %v", err)
+	}
+}
+
+func TestInvalidReplaceScope(t *testing.T) {
+	testDir := setupFileSystem(t, "invalid_replace_scope")
+
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	_, err := executeTest(parseArgs(
+		t,
+		t.Name(),
+		fmt.Sprintf("-f A -r B --replace-scope all '%s'", filepath.Join(testDir, "text")),
+	))
+	if err == nil {
+		t.Fatal("expected an error for an invalid --replace-scope value")
+	}
+}
+
+func TestOverwrites(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "overwrites")
+
+	newDir := func(t *testing.T) string {
+		t.Helper()
+
+		dir, err := os.MkdirTemp(testDir, "overwrites")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"a.txt", "b.txt", "a.md"} {
+			err = os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return dir
+	}
+
+	testCases := []struct {
+		name    string
+		args    string
+		want    []string // relative to the test directory
+		wantErr bool
+	}{
+		{
+			name: "existing targets are listed when overwrites are allowed",
+			args: "-f txt -r md --allow-overwrites",
+			want: []string{"a.md"},
+		},
+		{
+			name:    "existing targets are conflicts by default",
+			args:    "-f txt -r md",
+			wantErr: true,
+		},
+		{
+			name: "existing targets are not overwritten when conflicts are fixed",
+			args: "-f txt -r md -F",
+		},
+		{
+			name: "targets that are renamed first are not overwritten",
+			args: "-f '^a\\.' -r a. -f 'md$' -r markdown -f 'txt$' -r md --allow-overwrites",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			dir := newDir(t)
+
+			result, err := executeTest(
+				parseArgs(t, tc.name, fmt.Sprintf("%s --json '%s'", tc.args, dir)),
+			)
+			if (err != nil) != tc.wantErr {
+				t.Log(string(result))
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var o internaljson.Output
+
+			err = json.Unmarshal(result, &o)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want []string
+			for _, v := range tc.want {
+				want = append(want, filepath.Join(dir, v))
+			}
+
+			if diff := cmp.Diff(want, o.Overwrites); diff != "" {
+				t.Fatalf("unexpected overwrites (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("existing targets are listed in the report", func(t *testing.T) {
+		dir := newDir(t)
+
+		result, err := executeTest(parseArgs(
+			t,
+			t.Name(),
+			fmt.Sprintf("-f txt -r md --allow-overwrites '%s'", dir),
+		))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		want := "1 existing file will be overwritten"
+		if !strings.Contains(string(result), want) ||
+			!strings.Contains(
+				string(result),
+				filepath.Join(filepath.Base(dir), "a.md"),
+			) {
+			t.Fatalf("expected the report to list the overwritten file:\n%s", result)
+		}
+	})
+}
+
+func TestRulesFile(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "rules_file")
+
+	_, err := modifyTestingEnv(t, testDir, []string{"rules"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{
+			name:    "mismatched lists are rejected",
+			file:    "mismatched.json",
+			wantErr: "contains 1 replacements but 2 find patterns",
+		},
+		{
+			name:    "mismatched options are rejected",
+			file:    "options.json",
+			wantErr: "contains 2 ignore_case values but 1 find patterns",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := executeTest(parseArgs(
+				t,
+				tc.name,
+				fmt.Sprintf("--rules %s --json text", tc.file),
+			))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// The intermediate results of the chained rules are recorded in verbose mode.
+func TestChainRules(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "chain_rules")
+
+	_, err := modifyTestingEnv(t, testDir, []string{"rules"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := executeTest(parseArgs(
+		t,
+		t.Name(),
+		"--rules chain.json --chain-rules --verbose --json text",
+	))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	var o internaljson.Output
+
+	err = json.Unmarshal(result, &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string][]string)
+
+	for _, change := range o.Changes {
+		got[change.Source] = change.Stages
+	}
+
+	want := map[string][]string{
+		"test_A.txt":   {"exam_A.txt", "quiz_A.txt"},
+		"test_A-1.txt": {"exam_A-1.txt", "quiz_A-1.txt"},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected stages (-want +got):\n%s", diff)
+	}
+}
+
+func TestRelativeTo(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "relative_to")
+
+	newDir := func(t *testing.T) string {
+		t.Helper()
+
+		dir, err := os.MkdirTemp(testDir, "relative")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sub := filepath.Join(dir, "sub")
+
+		err = os.Mkdir(sub, os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"a.txt", "a.md"} {
+			err = os.WriteFile(filepath.Join(sub, name), nil, 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return dir
+	}
+
+	t.Run("paths in the JSON output are relative to the base", func(t *testing.T) {
+		dir := newDir(t)
+
+		result, err := executeTest(parseArgs(
+			t,
+			t.Name(),
+			fmt.Sprintf(
+				"-f txt -r md -R --allow-overwrites --json --relative-to '%s' '%s'",
+				dir,
+				dir,
+			),
+		))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		var o internaljson.Output
+
+		err = json.Unmarshal(result, &o)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(o.Changes) != 1 || o.Changes[0].BaseDir != "sub" {
+			t.Fatalf("expected the base directory to be relative:\n%s", result)
+		}
+
+		want := []string{filepath.Join("sub", "a.md")}
+		if diff := cmp.Diff(want, o.Overwrites); diff != "" {
+			t.Fatalf("unexpected overwrites (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("paths in the report are relative to the base", func(t *testing.T) {
+		dir := newDir(t)
+
+		result, err := executeTest(parseArgs(
+			t,
+			t.Name(),
+			fmt.Sprintf(
+				"-f txt -r md -R --allow-overwrites --relative-to '%s' '%s'",
+				filepath.Join(dir, "sub"),
+				dir,
+			),
+		))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		if strings.Contains(string(result), dir) ||
+			!strings.Contains(string(result), "a.txt") {
+			t.Fatalf("expected the report to use relative paths:\n%s", result)
+		}
+	})
+
+	t.Run("paths in the report are relative to the working directory by default", func(t *testing.T) {
+		dir := newDir(t)
+
+		result, err := executeTest(parseArgs(
+			t,
+			t.Name(),
+			fmt.Sprintf("-f txt -r md -R --allow-overwrites '%s'", dir),
+		))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		want := filepath.Join(filepath.Base(dir), "sub", "a.txt")
+		if strings.Contains(string(result), testDir) ||
+			!strings.Contains(string(result), want) {
+			t.Fatalf("expected the report to use relative paths:\n%s", result)
+		}
+	})
+
+	t.Run("files are renamed at their absolute paths", func(t *testing.T) {
+		dir := newDir(t)
+
+		result, err := executeTest(parseArgs(
+			t,
+			t.Name(),
+			fmt.Sprintf(
+				"-f a.txt -r b.txt -R -x --no-backup --relative-to '%s' '%s'",
+				testDir,
+				dir,
+			),
+		))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		_, err = os.Stat(filepath.Join(dir, "sub", "b.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestInvalidSizeBuckets(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	setupFileSystem(t, "invalid_size_buckets")
+
+	for _, buckets := range []string{"10MB", "20B,10B", "small,large"} {
+		_, err := executeTest(parseArgs(t, t.Name(), fmt.Sprintf(
+			"-f dsc -r photo --size-buckets '%s' images",
+			buckets,
+		)))
+		if err == nil {
+			t.Fatalf("expected an error for --size-buckets %s", buckets)
+		}
+	}
+}
+
+func TestEmptinessFiltersCannotBeCombined(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	setupFileSystem(t, "emptiness_filters_cannot_be_combined")
+
+	_, err := executeTest(parseArgs(
+		t,
+		t.Name(),
+		"-f '^' -r x- --only-empty --only-non-empty images",
+	))
+	if err == nil {
+		t.Fatal("expected an error when --only-empty and --only-non-empty are combined")
+	}
+}
+
+func TestGitMode(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "git_mode")
+
+	repo := filepath.Join(testDir, "repo")
+
+	git := func(t *testing.T, args ...string) string {
+		t.Helper()
+
+		cmd := exec.Command("git", append([]string{
+			"-C", repo,
+			"-c", "user.name=f2",
+			"-c", "user.email=f2@example.com",
+		}, args...)...)
+
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", args[0], err, out)
+		}
+
+		return string(out)
+	}
+
+	err := os.MkdirAll(repo, os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	git(t, "init", "-q")
+
+	for _, name := range []string{"tracked.txt", "untracked.txt"} {
+		err = os.WriteFile(filepath.Join(repo, name), []byte(name), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git(t, "add", "tracked.txt")
+	git(t, "commit", "-q", "-m", "initial")
+
+	status := func(t *testing.T) []string {
+		t.Helper()
+
+		lines := strings.Split(strings.TrimSpace(git(t, "status", "--porcelain")), "\n")
+
+		sort.Strings(lines)
+
+		return lines
+	}
+
+	result, err := executeTest(parseArgs(t, t.Name(), "-f '(.*)' -r 'new_$1' -x --git repo"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	// the tracked file is staged as a rename while the untracked file is
+	// renamed on the filesystem only
+	want := []string{
+		"?? new_untracked.txt",
+		"R  tracked.txt -> new_tracked.txt",
+	}
+
+	if diff := cmp.Diff(want, status(t)); diff != "" {
+		t.Fatalf("unexpected status after renaming (-want +got):\n%s", diff)
+	}
+
+	result, err = executeTest(parseArgs(t, t.Name(), "-u -x --git"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	want = []string{"?? untracked.txt"}
+
+	if diff := cmp.Diff(want, status(t)); diff != "" {
+		t.Fatalf("unexpected status after undoing (-want +got):\n%s", diff)
+	}
+
+	// the backup records that Git was used so the flag is not needed to
+	// undo the operation
+	result, err = executeTest(parseArgs(t, t.Name(), "-f '(.*)' -r 'new_$1' -x --git repo"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	result, err = executeTest(parseArgs(t, t.Name(), "-u -x"))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, status(t)); diff != "" {
+		t.Fatalf("unexpected status after undoing without --git (-want +got):\n%s", diff)
+	}
+}
+
+func TestGroupByOperation(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "group_by_operation")
+
+	dir := filepath.Join(testDir, "ops")
+
+	err := os.MkdirAll(filepath.Join(dir, "archive"), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"draft.txt", "readme.txt", "notes.txt", "todo.txt", "keep.txt"} {
+		err = os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows := "draft.txt,final.txt\nreadme.txt,README.txt\nnotes.txt,archive/notes.txt\ntodo.txt,later/todo.txt\nkeep.txt,keep.txt\n"
+
+	csvFile := filepath.Join(dir, "ops.csv")
+
+	err = os.WriteFile(csvFile, []byte(rows), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := executeTest(parseArgs(
+		t,
+		t.Name(),
+		fmt.Sprintf("--csv '%s' --group-by-operation", csvFile),
+	))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	sections := []string{
+		"Renamed in place",
+		"Case changes",
+		"Moved to existing directories",
+		"Moved to new directories",
+		"Unchanged",
+	}
+
+	// got maps each source to the section that it is listed in
+	got := make(map[string]string)
+
+	var section string
+
+	for _, line := range strings.Split(string(result), "\n") {
+		for _, s := range sections {
+			if strings.Contains(line, s+" (") {
+				section = s
+			}
+		}
+
+		fields := strings.Split(line, "|")
+		if len(fields) < 3 {
+			continue
+		}
+
+		source := strings.TrimSpace(fields[1])
+		if strings.HasSuffix(source, ".txt") {
+			got[filepath.Base(source)] = section
+		}
+	}
+
+	want := map[string]string{
+		"draft.txt":  "Renamed in place",
+		"readme.txt": "Case changes",
+		"notes.txt":  "Moved to existing directories",
+		"todo.txt":   "Moved to new directories",
+		"keep.txt":   "Unchanged",
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected sections (-want +got):\n%s\n%s", diff, result)
+	}
+}
+
+func TestAtomicWithinDir(t *testing.T) {
+	testCases := []struct {
+		name string
+		args string
+		want map[string]string
+	}{
+		{
+			// sorting by size numbers the files in a different order from
+			// their names: 2 -> 1, 3 -> 2, 1 -> 3
+			name: "rotate the names of three files",
+			args: "--sort size",
+			want: map[string]string{
+				"1.txt": "a",
+				"2.txt": "aa",
+				"3.txt": "aaa",
+			},
+		},
+		{
+			// 1 -> 2, 2 -> 3, 3 -> 4
+			name: "shift the names of overlapping files",
+			args: "--counter-start 2",
+			want: map[string]string{
+				"2.txt": "aaa",
+				"3.txt": "a",
+				"4.txt": "aa",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(f2.EnvDefaultOpts, "")
+
+			testDir := setupFileSystem(t, cleanString(tc.name))
+
+			dir := filepath.Join(testDir, "staged")
+
+			err := os.Mkdir(dir, 0o755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			original := map[string]string{
+				"1.txt": "aaa",
+				"2.txt": "a",
+				"3.txt": "aa",
+			}
+
+			for name, content := range original {
+				err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			assertContents := func(want map[string]string) {
+				t.Helper()
+
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(entries) != len(want) {
+					t.Fatalf("expected %d files, got %d", len(want), len(entries))
+				}
+
+				for name, content := range want {
+					got, err := os.ReadFile(filepath.Join(dir, name))
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if string(got) != content {
+						t.Fatalf("expected %s to contain %q, got %q", name, content, got)
+					}
+				}
+			}
+
+			args := fmt.Sprintf("-f '^\\d' -r '{%%d}' %s -x", tc.args)
+
+			// the targets conflict with the sources that are yet to be
+			// renamed without staging
+			_, err = executeTest(parseArgs(t, tc.name, args+" "+dir))
+			if err == nil {
+				t.Fatal("expected a conflict without --atomic-within-dir")
+			}
+
+			assertContents(original)
+
+			result, err := executeTest(
+				parseArgs(t, tc.name, args+" --atomic-within-dir "+dir),
+			)
+			if err != nil {
+				t.Log(string(result))
+				t.Fatal(err)
+			}
+
+			assertContents(tc.want)
+
+			result, err = executeTest(parseArgs(t, tc.name, "-u -x"))
+			if err != nil {
+				t.Log(string(result))
+				t.Fatal(err)
+			}
+
+			assertContents(original)
+		})
+	}
+}
+
+// A source that is moved into another directory must not overwrite a source
+// in that directory before it is staged.
+func TestAtomicWithinDirAcrossDirs(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "atomic_within_dir_across_dirs")
+
+	root := filepath.Join(testDir, "staged")
+
+	files := map[string]string{
+		filepath.Join("a", "x.txt"):  "a",
+		filepath.Join("b", "x2.txt"): "b",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a/x.txt -> b/x2.txt and b/x2.txt -> b/x22.txt
+	result, err := executeTest(parseArgs(t, t.Name(), fmt.Sprintf(
+		"-f '^x(2?)' -r '../b/x2$1' -R --atomic-within-dir -x --no-backup %s",
+		root,
+	)))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		filepath.Join("b", "x2.txt"):  "a",
+		filepath.Join("b", "x22.txt"): "b",
+	}
+
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(got) != content {
+			t.Fatalf("expected %s to contain %q, got %q", name, content, got)
+		}
+	}
+}
+
+func TestSkipIdentical(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "skip_identical")
+
+	_, err := modifyTestingEnv(t, testDir, []string{"identical"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(testDir, "identical")
+
+	result, err := executeTest(parseArgs(t, t.Name(), fmt.Sprintf(
+		"-f '(.*)\\.txt' -r 'backup/$1.txt' --copy --skip-identical --allow-overwrites -x --json '%s'",
+		dir,
+	)))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	var o internaljson.Output
+
+	err = json.Unmarshal(result, &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(o.Changes) != 1 || o.Changes[0].Source != "b.txt" ||
+		!o.Changes[0].WillOverwrite {
+		t.Fatalf("expected b.txt to overwrite its target, got %s", prettyPrint(o.Changes))
+	}
+
+	if len(o.Skipped) != 1 ||
+		o.Skipped[0].Path != filepath.Join(dir, "a.txt") {
+		t.Fatalf("expected a.txt to be skipped, got %v", o.Skipped)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "backup", "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != "new" {
+		t.Fatalf("expected the stale copy to be overwritten, got %q", got)
+	}
+}
+
+func TestCounterScopeMixedPathArgs(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "counter_scope_mixed_path_args")
+
+	// the relative path argument is resolved against the test directory
+	result, err := executeTest(parseArgs(t, t.Name(), fmt.Sprintf(
+		"-r {%%02d}{{ext}} -R --counter-scope perroot --json images '%s'",
+		filepath.Join(testDir, "movies"),
+	)))
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	var o internaljson.Output
+
+	err = json.Unmarshal(result, &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]string, len(o.Changes))
+	for _, change := range o.Changes {
+		got[change.Source] = change.Target
+	}
+
+	want := map[string]string{
+		"dsc-001.arw":                        "01.arw",
+		"dsc-002.arw":                        "02.arw",
+		"dsc-003.arw":                        "03.arw",
+		"startrails1.jpg":                    "04.jpg",
+		"startrails2.jpg":                    "05.jpg",
+		"green-mile_1999.mp4":                "01.mp4",
+		"No Pressure (2021) S1.E1.1080p.mkv": "02.mkv",
+		"No Pressure (2021) S1.E2.1080p.mkv": "03.mkv",
+		"No Pressure (2021) S1.E3.1080p.mkv": "04.mkv",
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected targets (-want +got):\n%s", diff)
+	}
 }
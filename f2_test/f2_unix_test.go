@@ -3,14 +3,1176 @@
 
 package f2_test
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ayoisaiah/f2"
+	"github.com/ayoisaiah/f2/internal/conflict"
+	internaljson "github.com/ayoisaiah/f2/internal/json"
+)
 
 // dummy function necessary for compilation in Unix.
 func setHidden(_ string) error {
 	return nil
 }
 
+// dummy function necessary for compilation in Unix.
+func setSystem(_ string) error {
+	return nil
+}
+
 func TestUnix(t *testing.T) {
 	cases := retrieveTestCases(t, "unix.json")
 	runTestCases(t, cases)
 }
+
+func TestEditRejectsInvalidChanges(t *testing.T) {
+	testCases := []struct {
+		name   string
+		editor string
+		want   string
+	}{
+		{
+			name:   "reordered lines",
+			editor: `perl -0777 -pi -e '$_ = join "", reverse split /^/'`,
+			want:   "Reordering lines is not supported",
+		},
+		{
+			name:   "removed lines",
+			editor: "perl -ni -e 'print if $. == 1'",
+			want:   "the edited file contains 1 lines, but 2 lines were expected",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			testDir := setupFileSystem(t, cleanString(tc.name))
+
+			t.Setenv("VISUAL", "")
+			t.Setenv("EDITOR", tc.editor)
+			t.Setenv(f2.EnvDefaultOpts, "")
+
+			args := parseArgs(
+				t,
+				tc.name,
+				fmt.Sprintf("--edit '%s'", filepath.Join(testDir, "images")),
+			)
+
+			_, err := executeTest(args)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got: %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestSkipUnreadableDirectory(t *testing.T) {
+	// permission checks are bypassed for the root user
+	if os.Geteuid() == 0 {
+		t.SkipNow()
+	}
+
+	testDir := setupFileSystem(t, "skip_unreadable_directory")
+
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	images := filepath.Join(testDir, "images")
+	unreadable := filepath.Join(images, "sony")
+
+	err := os.Chmod(unreadable, 0o000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chmod(unreadable, 0o755)
+	})
+
+	args := parseArgs(
+		t,
+		t.Name(),
+		fmt.Sprintf("-f 'dsc|startrails' -r photo -R --skip-unreadable --json '%s'", images),
+	)
+
+	result, err := executeTest(args)
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	var out internaljson.Output
+
+	err = json.Unmarshal(result, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// dsc-001.arw, dsc-002.arw, startrails1.jpg and startrails2.jpg
+	if len(out.Changes) != 4 {
+		t.Fatalf("expected 4 changes, got %d", len(out.Changes))
+	}
+
+	if len(out.Skipped) != 1 || out.Skipped[0].Path != unreadable {
+		t.Fatalf("expected %s to be skipped, got: %v", unreadable, out.Skipped)
+	}
+
+	// the skipped paths are still listed if nothing else matches
+	args = parseArgs(
+		t,
+		t.Name(),
+		fmt.Sprintf("-f 'no-match' -r photo -R --skip-unreadable --json '%s'", images),
+	)
+
+	result, err = executeTest(args)
+	if err != nil {
+		t.Log(string(result))
+		t.Fatal(err)
+	}
+
+	out = internaljson.Output{}
+
+	err = json.Unmarshal(result, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Changes) != 0 {
+		t.Fatalf("expected no changes, got %d", len(out.Changes))
+	}
+
+	if len(out.Skipped) != 1 || out.Skipped[0].Path != unreadable {
+		t.Fatalf("expected %s to be skipped, got: %v", unreadable, out.Skipped)
+	}
+}
+
+func TestAllowInvalidUTF8(t *testing.T) {
+	testDir := setupFileSystem(t, "allow_invalid_utf8")
+
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	dir := filepath.Join(testDir, "raw")
+
+	err := os.Mkdir(dir, os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "caf\xe9" is "café" in Latin-1 which is not valid UTF-8
+	invalid := "caf\xe9.txt"
+
+	for _, name := range []string{invalid, "plain.txt"} {
+		err = os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+		if err != nil {
+			// some filesystems reject names that are not valid UTF-8
+			t.Skip(err)
+		}
+	}
+
+	exists := func(name string) {
+		t.Helper()
+
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(args string) {
+		t.Helper()
+
+		result, err := executeTest(parseArgs(t, t.Name(), args))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+	}
+
+	// names that are not matched are left as is
+	run(fmt.Sprintf("-f plain -r simple -x '%s'", dir))
+	exists(invalid)
+	exists("simple.txt")
+
+	// the invalid byte is matched by `.` and preserved in the target
+	run(fmt.Sprintf("-f '(caf.)\\.txt$' -r '{<$1>.up}.md' --allow-invalid-utf8 -x '%s'", dir))
+	exists("CAF\xe9.md")
+
+	// the backup records the raw bytes so the operation can be reverted
+	run("-u -x")
+	exists(invalid)
+}
+
+func TestControlCharacters(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "control_characters")
+
+	dir := filepath.Join(testDir, "control")
+
+	err := os.Mkdir(dir, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "first\nline.txt"), nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("source name is escaped", func(t *testing.T) {
+		args := parseArgs(
+			t,
+			t.Name(),
+			fmt.Sprintf("-f 'line' -r 'row' --no-color '%s'", dir),
+		)
+
+		result, err := executeTest(args)
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		for _, want := range []string{`first\nline.txt`, `first\nrow.txt`} {
+			if !strings.Contains(string(result), want) {
+				t.Fatalf("expected output to contain %q, got:\n%s", want, result)
+			}
+		}
+	})
+
+	t.Run("target with control characters is a conflict", func(t *testing.T) {
+		args := parseArgs(
+			t,
+			t.Name(),
+			fmt.Sprintf("-f 'line' -r 'line\r\t' --json '%s'", dir),
+		)
+
+		result, _ := executeTest(args)
+
+		var out internaljson.Output
+
+		err := json.Unmarshal(result, &out)
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		slice := out.Conflicts[conflict.ControlCharacters]
+		if len(slice) != 1 || slice[0].Cause != `\r,\t` {
+			t.Fatalf("expected a control characters conflict, got: %v", out.Conflicts)
+		}
+	})
+
+	t.Run("target with control characters is allowed", func(t *testing.T) {
+		args := parseArgs(
+			t,
+			t.Name(),
+			fmt.Sprintf(
+				"-f 'line' -r 'new\tline' --allow-control-chars -x '%s'",
+				dir,
+			),
+		)
+
+		result, err := executeTest(args)
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		_, err = os.Stat(filepath.Join(dir, "first\nnew\tline.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestNormalizeUnicode(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "normalize_unicode")
+
+	const (
+		decomposed  = "cafe\u0301" // e followed by a combining acute accent
+		precomposed = "caf\u00e9"  // a single precomposed é
+		resumeNFD   = "re\u0301sume\u0301"
+		resumeNFC   = "r\u00e9sum\u00e9"
+	)
+
+	newDir := func(t *testing.T, names ...string) string {
+		t.Helper()
+
+		dir, err := os.MkdirTemp(testDir, "normalize")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range names {
+			err = os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return dir
+	}
+
+	planned := func(t *testing.T, args string) internaljson.Output {
+		t.Helper()
+
+		result, _ := executeTest(parseArgs(t, t.Name(), args))
+
+		var out internaljson.Output
+
+		err := json.Unmarshal(result, &out)
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		return out
+	}
+
+	t.Run("decomposed name is normalized", func(t *testing.T) {
+		dir := newDir(t, decomposed+".txt")
+
+		out := planned(t, fmt.Sprintf("--normalize-unicode nfc --json '%s'", dir))
+
+		if len(out.Changes) != 1 || out.Changes[0].Target != precomposed+".txt" {
+			t.Fatalf("expected the name to be normalized, got: %v", out.Changes)
+		}
+
+		result, err := executeTest(parseArgs(
+			t,
+			t.Name(),
+			fmt.Sprintf("--normalize-unicode nfc -x '%s'", dir),
+		))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 1 || entries[0].Name() != precomposed+".txt" {
+			t.Fatalf("expected only %q, got: %v", precomposed+".txt", entries)
+		}
+	})
+
+	t.Run("precomposed name is decomposed", func(t *testing.T) {
+		dir := newDir(t, precomposed+".txt")
+
+		out := planned(t, fmt.Sprintf("--normalize-unicode nfd --json '%s'", dir))
+
+		if len(out.Changes) != 1 || out.Changes[0].Target != decomposed+".txt" {
+			t.Fatalf("expected the name to be decomposed, got: %v", out.Changes)
+		}
+	})
+
+	t.Run("equivalent existing name is a conflict", func(t *testing.T) {
+		dir := newDir(t, "resume.pdf", resumeNFD+".pdf")
+
+		args := fmt.Sprintf("-f '^resume' -r '%s' --json", resumeNFC)
+
+		// the names are distinct without normalization
+		out := planned(t, fmt.Sprintf("%s '%s'", args, dir))
+		if len(out.Conflicts) != 0 {
+			t.Fatalf("expected no conflicts, got: %v", out.Conflicts)
+		}
+
+		out = planned(
+			t,
+			fmt.Sprintf("%s --normalize-unicode nfc '%s'", args, dir),
+		)
+
+		slice := out.Conflicts[conflict.FileExists]
+		if len(slice) != 1 ||
+			slice[0].Target != filepath.Join(dir, resumeNFD+".pdf") {
+			t.Fatalf("expected a file exists conflict, got: %v", out.Conflicts)
+		}
+	})
+}
+
+func TestHardlinks(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "hardlinks")
+
+	dir, err := os.MkdirTemp(testDir, "hardlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a.txt", "c.txt"} {
+		err = os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// b.txt is another name for a.txt
+	err = os.Link(filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	targets := func(t *testing.T, args string) map[string]string {
+		t.Helper()
+
+		result, _ := executeTest(
+			parseArgs(t, t.Name(), fmt.Sprintf("%s --json '%s'", args, dir)),
+		)
+
+		var out internaljson.Output
+
+		err := json.Unmarshal(result, &out)
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		m := make(map[string]string)
+		for _, change := range out.Changes {
+			m[change.Source] = change.Target
+		}
+
+		return m
+	}
+
+	t.Run("first name of each group is renamed", func(t *testing.T) {
+		got := targets(t, "-r 'file{%d}{ext}' --hardlinks first")
+
+		want := map[string]string{"a.txt": "file1.txt", "c.txt": "file2.txt"}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected targets (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("all names in a group share the index", func(t *testing.T) {
+		got := targets(t, "-r 'file{%d}_{f}{ext}' --hardlinks all")
+
+		want := map[string]string{
+			"a.txt": "file1_a.txt",
+			"b.txt": "file1_b.txt",
+			"c.txt": "file2_c.txt",
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected targets (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("inode variable is shared by hard links", func(t *testing.T) {
+		got := targets(t, "-r '{inode}_{f}{ext}'")
+
+		inode := func(name string) string {
+			return strings.SplitN(got[name], "_", 2)[0]
+		}
+
+		if inode("a.txt") != inode("b.txt") {
+			t.Fatalf("expected hard links to share the inode, got: %v", got)
+		}
+
+		if inode("a.txt") == inode("c.txt") {
+			t.Fatalf("expected different files to differ in inode, got: %v", got)
+		}
+	})
+
+	t.Run("invalid mode is rejected", func(t *testing.T) {
+		_, err := executeTest(
+			parseArgs(t, t.Name(), fmt.Sprintf("-r x --hardlinks some '%s'", dir)),
+		)
+		if err == nil {
+			t.Fatal("expected an error for an invalid --hardlinks value")
+		}
+	})
+}
+
+func TestInteractive(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  string
+		editor string
+		want   []string // the names in the directory afterwards
+		output []string
+	}{
+		{
+			name:   "accept all",
+			input:  "a\n",
+			want:   []string{"a.md", "b.md"},
+			output: []string{"2 renames, 0 conflicts"},
+		},
+		{
+			name:  "enter accepts",
+			input: "\n",
+			want:  []string{"a.md", "b.md"},
+		},
+		{
+			name:  "quit",
+			input: "q\n",
+			want:  []string{"a.txt", "b.txt"},
+		},
+		{
+			name:  "end of input cancels",
+			input: "",
+			want:  []string{"a.txt", "b.txt"},
+		},
+		{
+			name:  "end of input after an unknown action cancels",
+			input: "x\n",
+			want:  []string{"a.txt", "b.txt"},
+		},
+		{
+			name:   "unknown action is rejected",
+			input:  "x\nq\n",
+			want:   []string{"a.txt", "b.txt"},
+			output: []string{`Unknown action: "x"`},
+		},
+		{
+			name:   "edit before accepting",
+			input:  "e\na\n",
+			editor: `perl -pi -e 's/b\.md$/c.md/'`,
+			want:   []string{"a.md", "c.md"},
+		},
+		{
+			name:   "conflicts must be resolved",
+			input:  "e\na\nq\n",
+			editor: `perl -pi -e '$_ = "\n" if $. == 2'`,
+			want:   []string{"a.txt", "b.txt"},
+			output: []string{
+				"2 renames, 1 conflict",
+				"cannot be committed until the conflicts are resolved",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			testDir := setupFileSystem(t, "interactive")
+
+			t.Setenv("VISUAL", "")
+			t.Setenv("EDITOR", tc.editor)
+			t.Setenv(f2.EnvDefaultOpts, "")
+
+			dir := filepath.Join(testDir, "interactive")
+
+			err := os.Mkdir(dir, 0o755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, name := range []string{"a.txt", "b.txt"} {
+				err = os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var buf bytes.Buffer
+
+			app := f2.GetApp(strings.NewReader(tc.input), &buf)
+
+			err = app.Run(parseArgs(
+				t,
+				tc.name,
+				fmt.Sprintf("-f txt -r md --interactive --no-backup '%s'", dir),
+			))
+			if err != nil {
+				t.Log(buf.String())
+				t.Fatal(err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, len(entries))
+			for i, entry := range entries {
+				got[i] = entry.Name()
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Log(buf.String())
+				t.Fatalf("unexpected names (-want +got):\n%s", diff)
+			}
+
+			for _, s := range tc.output {
+				if !strings.Contains(buf.String(), s) {
+					t.Fatalf("expected output to contain %q, got:\n%s", s, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "symlinks")
+
+	// the link in the links directory points to a file in the files directory
+	newDir := func(t *testing.T) string {
+		t.Helper()
+
+		dir, err := os.MkdirTemp(testDir, "symlinks")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, sub := range []string{"files", "links"} {
+			err = os.Mkdir(filepath.Join(dir, sub), os.ModePerm)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, path := range []string{"files/report.txt", "links/notes.txt"} {
+			err = os.WriteFile(filepath.Join(dir, path), nil, 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = os.Symlink(
+			filepath.Join("..", "files", "report.txt"),
+			filepath.Join(dir, "links", "report-link"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return dir
+	}
+
+	readlink := func(t *testing.T, path string) string {
+		t.Helper()
+
+		link, err := os.Readlink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return link
+	}
+
+	for _, args := range []string{"", "--symlinks link"} {
+		args := args
+
+		t.Run("links are renamed in link mode "+args, func(t *testing.T) {
+			dir := newDir(t)
+
+			result, err := executeTest(parseArgs(t, t.Name(), fmt.Sprintf(
+				"-f report -r summary -x --no-backup %s '%s'",
+				args,
+				filepath.Join(dir, "links"),
+			)))
+			if err != nil {
+				t.Log(string(result))
+				t.Fatal(err)
+			}
+
+			got := readlink(t, filepath.Join(dir, "links", "summary-link"))
+			if want := filepath.Join("..", "files", "report.txt"); got != want {
+				t.Fatalf("expected the link to point to %s, got: %s", want, got)
+			}
+
+			_, err = os.Stat(filepath.Join(dir, "files", "report.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	t.Run("targets are renamed and links updated in target mode", func(t *testing.T) {
+		dir := newDir(t)
+
+		result, err := executeTest(parseArgs(t, t.Name(), fmt.Sprintf(
+			"-f report -r summary -x --no-backup --symlinks target '%s'",
+			filepath.Join(dir, "links"),
+		)))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		_, err = os.Stat(filepath.Join(dir, "files", "summary.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := readlink(t, filepath.Join(dir, "links", "report-link"))
+		if want := filepath.Join("..", "files", "summary.txt"); got != want {
+			t.Fatalf("expected the link to point to %s, got: %s", want, got)
+		}
+	})
+
+	t.Run("links are left out in skip mode", func(t *testing.T) {
+		dir := newDir(t)
+
+		result, err := executeTest(parseArgs(t, t.Name(), fmt.Sprintf(
+			"-f '^' -r new- --symlinks skip --json '%s'",
+			filepath.Join(dir, "links"),
+		)))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		var out internaljson.Output
+
+		err = json.Unmarshal(result, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, change := range out.Changes {
+			got = append(got, change.Source)
+		}
+
+		if diff := cmp.Diff([]string{"notes.txt"}, got); diff != "" {
+			t.Fatalf("unexpected changes (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestBrokenLinks(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "broken_links")
+
+	// c.txt is a broken symlink among regular files
+	newDir := func(t *testing.T) string {
+		t.Helper()
+
+		dir, err := os.MkdirTemp(testDir, "broken")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"a.txt", "b.txt"} {
+			err = os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = os.Symlink("missing.txt", filepath.Join(dir, "c.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return dir
+	}
+
+	output := func(t *testing.T, args, dir string) internaljson.Output {
+		t.Helper()
+
+		result, err := executeTest(
+			parseArgs(t, t.Name(), fmt.Sprintf("%s --json '%s'", args, dir)),
+		)
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		var out internaljson.Output
+
+		err = json.Unmarshal(result, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return out
+	}
+
+	sources := func(out internaljson.Output) []string {
+		var got []string
+		for _, change := range out.Changes {
+			got = append(got, change.Source)
+		}
+
+		return got
+	}
+
+	t.Run("broken links are listed and can be renamed", func(t *testing.T) {
+		dir := newDir(t)
+
+		out := output(t, "-f txt -r md --report-broken-links", dir)
+
+		want := []string{filepath.Join(dir, "c.txt")}
+		if diff := cmp.Diff(want, out.BrokenLinks); diff != "" {
+			t.Fatalf("unexpected broken links (-want +got):\n%s", diff)
+		}
+
+		want = []string{"a.txt", "b.txt", "c.txt"}
+		if diff := cmp.Diff(want, sources(out)); diff != "" {
+			t.Fatalf("unexpected changes (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("broken links are not listed by default", func(t *testing.T) {
+		dir := newDir(t)
+
+		out := output(t, "-f txt -r md", dir)
+
+		if out.BrokenLinks != nil {
+			t.Fatalf("unexpected broken links: %v", out.BrokenLinks)
+		}
+	})
+
+	t.Run("broken links do not abort content matching", func(t *testing.T) {
+		dir := newDir(t)
+
+		out := output(t, "-f txt -r md --first-line '^a'", dir)
+
+		if diff := cmp.Diff([]string{"a.txt"}, sources(out)); diff != "" {
+			t.Fatalf("unexpected changes (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("broken links are removed", func(t *testing.T) {
+		dir := newDir(t)
+
+		result, err := executeTest(parseArgs(t, t.Name(), fmt.Sprintf(
+			"-f txt -r md --remove-broken-links -x --no-backup '%s'",
+			dir,
+		)))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		_, err = os.Lstat(filepath.Join(dir, "c.txt"))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected the broken link to be removed: %v", err)
+		}
+
+		for _, name := range []string{"a.md", "b.md"} {
+			_, err = os.Stat(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("broken links are kept in dry-run mode", func(t *testing.T) {
+		dir := newDir(t)
+
+		out := output(t, "-f txt -r md --remove-broken-links", dir)
+
+		if diff := cmp.Diff([]string{"a.txt", "b.txt"}, sources(out)); diff != "" {
+			t.Fatalf("unexpected changes (-want +got):\n%s", diff)
+		}
+
+		_, err := os.Lstat(filepath.Join(dir, "c.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("broken links that are not matched are kept", func(t *testing.T) {
+		dir := newDir(t)
+
+		err := os.Symlink("missing.log", filepath.Join(dir, "d.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := executeTest(parseArgs(t, t.Name(), fmt.Sprintf(
+			"-f txt -r md -E c --remove-broken-links -x --no-backup '%s'",
+			dir,
+		)))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"c.txt", "d.log"} {
+			_, err = os.Lstat(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatalf("expected %s to be kept: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("broken links are kept if the operation is cancelled", func(t *testing.T) {
+		dir := newDir(t)
+
+		var buf bytes.Buffer
+
+		app := f2.GetApp(strings.NewReader("q\n"), &buf)
+
+		err := app.Run(parseArgs(t, t.Name(), fmt.Sprintf(
+			"-f txt -r md --remove-broken-links --interactive --no-backup '%s'",
+			dir,
+		)))
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			_, err = os.Lstat(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatalf("expected %s to be kept: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("removed broken links are restored by undo", func(t *testing.T) {
+		t.Cleanup(xdg.Reload)
+		t.Setenv("XDG_DATA_HOME", t.TempDir())
+		xdg.Reload()
+
+		dir := newDir(t)
+
+		result, err := executeTest(parseArgs(t, t.Name(), fmt.Sprintf(
+			"-f txt -r md --remove-broken-links -x '%s'",
+			dir,
+		)))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		_, err = os.Lstat(filepath.Join(dir, "c.txt"))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected the broken link to be removed: %v", err)
+		}
+
+		result, err = executeTest(parseArgs(t, t.Name(), "-u -x"))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		target, err := os.Readlink(filepath.Join(dir, "c.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if target != "missing.txt" {
+			t.Fatalf("expected the link to point to missing.txt, got %s", target)
+		}
+	})
+}
+
+func TestStdinPaths(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "stdin_paths")
+
+	dir, err := os.MkdirTemp(testDir, "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a.txt", "b\nc.txt", "d.txt"} {
+		err = os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name  string
+		args  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "paths are separated by newlines",
+			args:  "-",
+			input: filepath.Join(dir, "a.txt") + "\n" + filepath.Join(dir, "d.txt") + "\n",
+			want:  []string{"a.txt", "d.txt"},
+		},
+		{
+			name: "paths are separated by NUL bytes",
+			args: "-0 -",
+			input: filepath.Join(dir, "a.txt") + "\x00" +
+				filepath.Join(dir, "b\nc.txt") + "\x00",
+			want: []string{"a.txt", "b\nc.txt"},
+		},
+		{
+			name:  "paths are separated by NUL bytes in the long form",
+			args:  "--null -",
+			input: filepath.Join(dir, "b\nc.txt"),
+			want:  []string{"b\nc.txt"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			app := f2.GetApp(strings.NewReader(tc.input), &buf)
+
+			err := app.Run(parseArgs(
+				t,
+				tc.name,
+				"-f txt -r md --json "+tc.args,
+			))
+			if err != nil {
+				t.Log(buf.String())
+				t.Fatal(err)
+			}
+
+			var out internaljson.Output
+
+			err = json.Unmarshal(buf.Bytes(), &out)
+			if err != nil {
+				t.Log(buf.String())
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, change := range out.Changes {
+				got = append(got, change.Source)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("unexpected changes (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("paths cannot be read in interactive mode", func(t *testing.T) {
+		app := f2.GetApp(strings.NewReader(""), io.Discard)
+
+		err := app.Run(parseArgs(t, t.Name(), "-f txt -r md --interactive -"))
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("the current directory is not searched without paths", func(t *testing.T) {
+		for _, input := range []string{"", "\x00\x00"} {
+			var buf bytes.Buffer
+
+			app := f2.GetApp(strings.NewReader(input), &buf)
+
+			err := app.Run(parseArgs(t, t.Name(), "-f txt -r md --json -0 -"))
+			if err == nil {
+				t.Fatalf("expected an error for %q, got:\n%s", input, buf.String())
+			}
+		}
+	})
+}
+
+func TestDereferenceCount(t *testing.T) {
+	t.Setenv(f2.EnvDefaultOpts, "")
+
+	testDir := setupFileSystem(t, "dereference_count")
+
+	dir := filepath.Join(testDir, "chain")
+
+	for _, sub := range []string{"files", "links"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, path := range []string{"files/report.txt", "links/notes.txt"} {
+		err := os.WriteFile(filepath.Join(dir, path), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// links/report-link -> files/hop-2 -> files/hop-1 -> files/report.txt
+	chain := [][2]string{
+		{"report.txt", "files/hop-1"},
+		{"hop-1", "files/hop-2"},
+		{filepath.Join("..", "files", "hop-2"), "links/report-link"},
+	}
+
+	for _, link := range chain {
+		err := os.Symlink(link[0], filepath.Join(dir, link[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(t *testing.T, depth int) internaljson.Output {
+		t.Helper()
+
+		result, err := executeTest(parseArgs(t, t.Name(), fmt.Sprintf(
+			"-f '^' -r new- --symlinks target --dereference-count %d --json '%s'",
+			depth,
+			filepath.Join(dir, "links"),
+		)))
+		if err != nil {
+			t.Log(string(result))
+			t.Fatal(err)
+		}
+
+		var out internaljson.Output
+
+		err = json.Unmarshal(result, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return out
+	}
+
+	sources := func(out internaljson.Output) []string {
+		var got []string
+		for _, change := range out.Changes {
+			got = append(got, change.Source)
+		}
+
+		sort.Strings(got)
+
+		return got
+	}
+
+	t.Run("a chain within the limit is resolved", func(t *testing.T) {
+		out := run(t, 3)
+
+		want := []string{"notes.txt", "report.txt"}
+		if diff := cmp.Diff(want, sources(out)); diff != "" {
+			t.Fatalf("unexpected sources (-want +got):\n%s", diff)
+		}
+
+		if len(out.Warnings) != 0 {
+			t.Fatalf("expected no warnings, got: %v", out.Warnings)
+		}
+	})
+
+	t.Run("a chain exceeding the limit is reported and skipped", func(t *testing.T) {
+		out := run(t, 2)
+
+		want := []string{"notes.txt"}
+		if diff := cmp.Diff(want, sources(out)); diff != "" {
+			t.Fatalf("unexpected sources (-want +got):\n%s", diff)
+		}
+
+		if len(out.Warnings) != 1 ||
+			!strings.Contains(out.Warnings[0], "longer than the limit of 2") {
+			t.Fatalf("expected a warning for the chain, got: %v", out.Warnings)
+		}
+	})
+}
@@ -8,13 +8,13 @@ import (
 	"testing"
 )
 
-func setHidden(path string) error {
+func setAttributes(path string, attrs uint32) error {
 	filenameW, err := syscall.UTF16PtrFromString(path)
 	if err != nil {
 		return err
 	}
 
-	err = syscall.SetFileAttributes(filenameW, syscall.FILE_ATTRIBUTE_HIDDEN)
+	err = syscall.SetFileAttributes(filenameW, attrs)
 	if err != nil {
 		return err
 	}
@@ -22,6 +22,14 @@ func setHidden(path string) error {
 	return nil
 }
 
+func setHidden(path string) error {
+	return setAttributes(path, syscall.FILE_ATTRIBUTE_HIDDEN)
+}
+
+func setSystem(path string) error {
+	return setAttributes(path, syscall.FILE_ATTRIBUTE_SYSTEM)
+}
+
 func TestWindows(t *testing.T) {
 	cases := retrieveTestCases(t, "windows.json")
 	runTestCases(t, cases)
@@ -0,0 +1,61 @@
+package find
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// allowlist holds the absolute paths that are eligible to be matched when an
+// include file is provided through --include-from.
+type allowlist struct {
+	paths map[string]bool
+}
+
+// newAllowlist reads the paths listed in the specified file and resolves the
+// relative ones against each search root. A path argument that is a file is
+// resolved against the directory that contains it.
+func newAllowlist(pathToFile string, pathsToSearch []string) (*allowlist, error) {
+	lines, err := readPatternFile(pathToFile)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := pathsToSearch
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	a := &allowlist{paths: make(map[string]bool)}
+
+	for _, root := range roots {
+		if info, err := os.Stat(root); err == nil && !info.IsDir() {
+			root = filepath.Dir(root)
+		}
+
+		for _, line := range lines {
+			path := filepath.FromSlash(line)
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(root, path)
+			}
+
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return nil, err
+			}
+
+			a.paths[absPath] = true
+		}
+	}
+
+	return a, nil
+}
+
+// allows reports whether the entry with the specified name in dir is listed.
+func (a *allowlist) allows(filename, dir string) bool {
+	absPath, err := filepath.Abs(filepath.Join(dir, filename))
+	if err != nil {
+		return false
+	}
+
+	return a.paths[absPath]
+}
@@ -4,27 +4,188 @@
 package find
 
 import (
+	"bytes"
+	"context"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
 	"golang.org/x/exp/slices"
 
 	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+	"github.com/ayoisaiah/f2/internal/ledger"
+	internalos "github.com/ayoisaiah/f2/internal/os"
 	internalpath "github.com/ayoisaiah/f2/internal/path"
+	"github.com/ayoisaiah/f2/internal/sniff"
 )
 
 const (
 	dotCharacter = 46
 )
 
-// csvRows keeps track of each row in a CSV file so that it can be associated
-// with a file renaming change. The key is the absolute path of the source file
-// and the value is the correspoding row in the CSV file.
-var csvRows = make(map[string][]string)
+var (
+	errInvalidMapFile = errors.New(
+		"map file must contain an object of source and target pairs or an array of objects with source and target fields",
+	)
+
+	errDuplicateMapSource = errors.New(
+		"source '%s' is specified more than once in map file '%s'",
+	)
+
+	errNoCSVGlobMatches = errors.New(
+		"the pattern '%s' in the CSV file does not match any files",
+	)
+
+	errDuplicateCSVSource = errors.New(
+		"'%s' on line %d of the CSV file was ignored since the file is already associated with line %d",
+	)
+
+	errNoRemainingCSVGlobMatches = errors.New(
+		"line %d of the CSV file was ignored since every file matched by '%s' is already associated with a previous line",
+	)
+
+	errTooManyEntries = errors.New(
+		"'%s' contains more than %d entries. Increase --max-entries-per-dir or narrow down the search",
+	)
+)
+
+// mapEntry represents a single source and target pair in a JSON map file.
+type mapEntry struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// csvRows holds the rows of the CSV file from the last search for use by
+// GetCSVRows. The rows of each search are recorded in conf.CSVRows.
+var (
+	csvRowsMu sync.Mutex
+	csvRows   = make(map[string][]string)
+)
+
+// osFS provides access to the real filesystem through the fs.FS interface.
+// Unlike os.DirFS, it accepts any path that is valid on the current operating
+// system including absolute paths.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+// onOS reports whether fsys is the real filesystem.
+func onOS(fsys fs.FS) bool {
+	if l, ok := fsys.(limitedFS); ok {
+		fsys = l.FS
+	}
+
+	_, ok := fsys.(osFS)
+
+	return ok
+}
+
+// hiddenIn reports whether the entry is hidden in fsys. The attributes of the
+// entries are only checked on the real filesystem, so only dotfiles are
+// considered hidden elsewhere (such as in archives).
+func hiddenIn(fsys fs.FS, filename, dir string) (bool, error) {
+	if !onOS(fsys) {
+		return filename[0] == dotCharacter, nil
+	}
+
+	return isHidden(filename, dir)
+}
+
+// limitedFS caps the number of entries that are read from each directory so
+// that huge directories are rejected before all their entries are loaded.
+type limitedFS struct {
+	fs.FS
+	maxEntries int
+}
+
+func (l limitedFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(l.FS, name)
+}
+
+// ReadDir reads the entries of the named directory in batches and returns an
+// error as soon as there are more than the maximum. The entries are sorted by
+// name like those returned by fs.ReadDir.
+func (l limitedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := l.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	dir, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return fs.ReadDir(l.FS, name)
+	}
+
+	var entries []fs.DirEntry
+
+	for {
+		batch, err := dir.ReadDir(l.maxEntries + 1 - len(entries))
+		entries = append(entries, batch...)
+
+		if len(entries) > l.maxEntries {
+			return nil, fmt.Errorf(errTooManyEntries.Error(), name, l.maxEntries)
+		}
+
+		if errors.Is(err, io.EOF) || len(batch) == 0 {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+// skipper keeps track of the paths that were skipped during a search because
+// they could not be read.
+type skipper struct {
+	paths   []file.SkippedPath
+	enabled bool
+}
+
+// skip records a path that could not be read so that the search can
+// continue if unreadable paths are to be skipped. Otherwise, the error is
+// returned as is.
+func (s *skipper) skip(path string, err error) error {
+	if !s.enabled {
+		return err
+	}
+
+	s.paths = append(s.paths, file.SkippedPath{
+		Path:  path,
+		Error: err.Error(),
+	})
+
+	return nil
+}
 
 // readCSVFile reads all the records contained in a CSV file specified by
 // `pathToCSV`.
@@ -46,101 +207,777 @@ func readCSVFile(pathToCSV string) ([][]string, error) {
 	return records, nil
 }
 
-// filterMatches filters out files that do not match the find string or one
-// that matches any exclusion patterns.
-func filterMatches(
-	pathsToFilter internalpath.Collection,
+// Filtering stages reported by Explain.
+const (
+	StageType      = "type"
+	StageHidden    = "hidden"
+	StageExtension = "extension"
+	StageExclude   = "exclude"
+	StageInclude   = "include"
+	StageMatch     = "match"
+	StageContent   = "content"
+	StageEmpty     = "empty"
+)
+
+// Step describes the outcome of a single filtering stage.
+type Step struct {
+	Stage    string
+	Detail   string
+	Accepted bool
+}
+
+// filter holds the criteria that each directory entry is checked against
+// before it is included in the matches.
+type filter struct {
+	fsys           fs.FS
+	searchRegex    *regexp.Regexp
+	firstLineRegex *regexp.Regexp
+	excludeMode    string
+	pathsToSearch  []string
+	excludeRegexes []*regexp.Regexp
+	allowlist      *allowlist // nil unless --include-from is set
+	includeDir     bool
+	includeHidden  bool
+	onlyHidden     bool
+	onlyDir        bool
+	ignoreExt      bool
+	extOnly        bool
+	onlyEmpty      bool
+	onlyNonEmpty   bool
+	emptyDirs      bool // directories are filtered by emptiness as well
+	// names that are not valid UTF-8 are escaped before matching
+	allowInvalidUTF8 bool
+}
+
+func newFilter(
+	fsys fs.FS,
 	pathsToSearch []string,
 	searchRegex *regexp.Regexp, excludeFilterInput []string,
-	includeDir, includeHidden, onlyDir, ignoreExt bool,
-) error {
-	excludeFilter := strings.Join(excludeFilterInput, "|")
+	excludeMode, firstLinePattern string,
+	includeDir, includeHidden, onlyHidden, onlyDir, ignoreExt, extOnly,
+	onlyEmpty, onlyNonEmpty, emptyDirs,
+	allowInvalidUTF8, excludeIgnoreCase bool,
+) (*filter, error) {
+	var firstLineRegex *regexp.Regexp
+
+	if firstLinePattern != "" {
+		re, err := regexp.Compile(firstLinePattern)
+		if err != nil {
+			return nil, err
+		}
+
+		firstLineRegex = re
+	}
 
-	excludeMatchRegex, err := regexp.Compile(excludeFilter)
+	excludeRegexes := make([]*regexp.Regexp, 0, len(excludeFilterInput))
+
+	for _, pattern := range excludeFilterInput {
+		if excludeIgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		excludeRegexes = append(excludeRegexes, re)
+	}
+
+	return &filter{
+		fsys:           fsys,
+		searchRegex:    searchRegex,
+		firstLineRegex: firstLineRegex,
+		excludeMode:    excludeMode,
+		pathsToSearch:  pathsToSearch,
+		excludeRegexes: excludeRegexes,
+		includeDir:     includeDir,
+		includeHidden:  includeHidden,
+		onlyHidden:     onlyHidden,
+		onlyDir:        onlyDir,
+		ignoreExt:      ignoreExt,
+		extOnly:        extOnly,
+		onlyEmpty:      onlyEmpty,
+		onlyNonEmpty:   onlyNonEmpty,
+		emptyDirs:      emptyDirs,
+
+		allowInvalidUTF8: allowInvalidUTF8,
+	}, nil
+}
+
+// rejectType returns the reason an entry is filtered out due to being a file
+// or directory. An empty string is returned if the entry is accepted.
+func (f *filter) rejectType(isDir bool) string {
+	if isDir && !f.includeDir {
+		return "directories are skipped unless -d/--include-dir is set"
+	}
+
+	if f.onlyDir && !isDir {
+		return "files are skipped when -D/--only-dir is set"
+	}
+
+	if f.extOnly && isDir {
+		return "directories are skipped when --ext-only is set"
+	}
+
+	return ""
+}
+
+// rejectHidden returns the reason a hidden entry (or a visible one if only
+// hidden entries are matched) is filtered out. An empty string is returned if
+// the entry is accepted or it was specified as a path argument.
+func (f *filter) rejectHidden(filename, dir string) (string, error) {
+	if f.includeHidden && !f.onlyHidden {
+		return "", nil
+	}
+
+	entryIsHidden, err := hiddenIn(f.fsys, filename, dir)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	rejected := entryIsHidden
+	reason := "hidden files are skipped unless -H/--hidden is set"
+
+	if f.onlyHidden {
+		rejected = !entryIsHidden
+		reason = "visible files are skipped when --only-hidden is set"
+	}
+
+	if !rejected {
+		return "", nil
+	}
+
+	// Ensure file arguments are not affected
+	isPathArg, err := f.isPathArg(filename, dir)
+	if err != nil {
+		return "", err
+	}
+
+	if isPathArg {
+		return "", nil
+	}
+
+	return reason, nil
+}
+
+// isPathArg reports whether the entry was explicitly specified as one of the
+// paths to search.
+func (f *filter) isPathArg(filename, dir string) (bool, error) {
+	entryPath := filepath.Join(dir, filename)
+
+	for _, pathArg := range f.pathsToSearch {
+		// relative paths can be compared as is which avoids resolving
+		// them against a working directory that may not exist when
+		// searching a virtual filesystem
+		a, b := entryPath, filepath.Clean(pathArg)
+
+		if filepath.IsAbs(a) != filepath.IsAbs(b) {
+			var err error
+
+			a, err = filepath.Abs(a)
+			if err != nil {
+				return false, err
+			}
+
+			b, err = filepath.Abs(b)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		if strings.EqualFold(a, b) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// nameToMatch returns the part of the filename that the exclude and find
+// patterns are matched against.
+func (f *filter) nameToMatch(filename string, isDir bool) string {
+	if f.allowInvalidUTF8 {
+		filename = internalpath.EscapeInvalidUTF8(filename)
+	}
+
+	if f.ignoreExt && !isDir {
+		return internalpath.FilenameWithoutExtension(filename)
+	}
+
+	if f.extOnly && !isDir {
+		return internalpath.Extension(filename)
+	}
+
+	return filename
+}
+
+// excludedBy returns the exclude pattern that filters out the name. In `all`
+// mode, the name must match every pattern to be excluded so all the patterns
+// are returned. Otherwise, matching any of the patterns is sufficient. An
+// empty string is returned if the name is not excluded.
+func (f *filter) excludedBy(name string) string {
+	if len(f.excludeRegexes) == 0 {
+		return ""
+	}
+
+	patterns := make([]string, 0, len(f.excludeRegexes))
+
+	for _, re := range f.excludeRegexes {
+		matched := re.MatchString(name)
+
+		if f.excludeMode == config.ExcludeModeAll && !matched {
+			return ""
+		}
+
+		if f.excludeMode != config.ExcludeModeAll && matched {
+			return re.String()
+		}
+
+		patterns = append(patterns, re.String())
+	}
+
+	if f.excludeMode == config.ExcludeModeAll {
+		return strings.Join(patterns, ", ")
+	}
+
+	return ""
+}
+
+// accepts reports whether the entry passes every filtering stage.
+func (f *filter) accepts(entry fs.DirEntry, dir string) (bool, error) {
+	filename, isDir := entry.Name(), entry.IsDir()
+
+	if f.rejectType(isDir) != "" {
+		return false, nil
+	}
+
+	reason, err := f.rejectHidden(filename, dir)
+	if err != nil || reason != "" {
+		return false, err
+	}
+
+	name := f.nameToMatch(filename, isDir)
+
+	if f.excludedBy(name) != "" {
+		return false, nil
+	}
+
+	if f.allowlist != nil && !f.allowlist.allows(filename, dir) {
+		return false, nil
+	}
+
+	if !f.searchRegex.MatchString(name) {
+		return false, nil
+	}
+
+	reason, err = f.rejectEmpty(entry, dir)
+	if err != nil || reason != "" {
+		return false, err
+	}
+
+	reason, err = f.rejectContent(filename, dir, isDir)
+	if err != nil || reason != "" {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// rejectEmpty returns the reason an entry is filtered out due to being empty
+// or non-empty. Files are empty if their size is zero. Directories are only
+// filtered if emptyDirs is set, in which case they are empty if they contain
+// no entries. An empty string is returned if the entry is accepted.
+func (f *filter) rejectEmpty(entry fs.DirEntry, dir string) (string, error) {
+	if !f.onlyEmpty && !f.onlyNonEmpty {
+		return "", nil
+	}
+
+	var empty bool
+
+	if entry.IsDir() {
+		if !f.emptyDirs {
+			return "", nil
+		}
+
+		dirEntry, err := fs.ReadDir(f.fsys, filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return "", err
+		}
+
+		empty = len(dirEntry) == 0
+	} else {
+		info, err := entry.Info()
+		if err != nil {
+			return "", err
+		}
+
+		empty = info.Size() == 0
+	}
+
+	if f.onlyEmpty && !empty {
+		return "non-empty entries are skipped when --only-empty is set", nil
+	}
+
+	if f.onlyNonEmpty && empty {
+		return "empty entries are skipped when --only-non-empty is set", nil
+	}
+
+	return "", nil
+}
+
+// rejectContent returns the reason an entry is filtered out due to the first
+// line of its contents. An empty string is returned if the entry is accepted.
+func (f *filter) rejectContent(
+	filename, dir string,
+	isDir bool,
+) (string, error) {
+	if f.firstLineRegex == nil {
+		return "", nil
+	}
+
+	if isDir {
+		return "directories have no contents to match", nil
+	}
+
+	line, err := sniff.FirstLine(f.fsys, filepath.Join(dir, filename))
+	if err != nil {
+		// a dangling symlink should not abort the search
+		if onOS(f.fsys) && isBrokenLink(filepath.Join(dir, filename)) {
+			return "broken symlinks have no contents to match", nil
+		}
+
+		return "", err
+	}
+
+	if !f.firstLineRegex.MatchString(line) {
+		return fmt.Sprintf(
+			"first line '%s' does not match '%s'",
+			line,
+			f.firstLineRegex.String(),
+		), nil
+	}
+
+	return "", nil
+}
+
+// explain runs each filtering stage against the entry and returns their
+// outcomes up to and including the first stage that rejects it.
+func (f *filter) explain(entry fs.DirEntry, dir string) ([]Step, error) {
+	var steps []Step
+
+	filename, isDir := entry.Name(), entry.IsDir()
+
+	entryType := "file"
+	if isDir {
+		entryType = "directory"
+	}
+
+	if reason := f.rejectType(isDir); reason != "" {
+		return append(steps, Step{Stage: StageType, Detail: reason}), nil
+	}
+
+	steps = append(steps, Step{
+		Stage:    StageType,
+		Detail:   entryType,
+		Accepted: true,
+	})
+
+	reason, err := f.rejectHidden(filename, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if reason != "" {
+		return append(steps, Step{Stage: StageHidden, Detail: reason}), nil
+	}
+
+	steps = append(steps, Step{
+		Stage:    StageHidden,
+		Detail:   "not skipped",
+		Accepted: true,
+	})
+
+	name := f.nameToMatch(filename, isDir)
+
+	detail := fmt.Sprintf("matching against '%s'", name)
+	switch {
+	case f.extOnly && !isDir:
+		detail += " (extension only)"
+	case name != filename:
+		detail += " (extension ignored)"
+	}
+
+	steps = append(steps, Step{
+		Stage:    StageExtension,
+		Detail:   detail,
+		Accepted: true,
+	})
+
+	if pattern := f.excludedBy(name); pattern != "" {
+		return append(steps, Step{
+			Stage:  StageExclude,
+			Detail: fmt.Sprintf("excluded by '%s'", pattern),
+		}), nil
+	}
+
+	steps = append(steps, Step{
+		Stage:    StageExclude,
+		Detail:   "not excluded",
+		Accepted: true,
+	})
+
+	if f.allowlist != nil {
+		if !f.allowlist.allows(filename, dir) {
+			return append(steps, Step{
+				Stage:  StageInclude,
+				Detail: "not listed in the include file",
+			}), nil
+		}
+
+		steps = append(steps, Step{
+			Stage:    StageInclude,
+			Detail:   "listed in the include file",
+			Accepted: true,
+		})
+	}
+
+	submatches := f.searchRegex.FindStringSubmatch(name)
+	if submatches == nil {
+		return append(steps, Step{
+			Stage: StageMatch,
+			Detail: fmt.Sprintf(
+				"does not match the find pattern '%s'",
+				f.searchRegex.String(),
+			),
+		}), nil
+	}
+
+	groups := make([]string, len(submatches))
+	for i, v := range submatches {
+		groups[i] = fmt.Sprintf("$%d='%s'", i, v)
+	}
+
+	steps = append(steps, Step{
+		Stage: StageMatch,
+		Detail: fmt.Sprintf(
+			"matches the find pattern '%s' with %s",
+			f.searchRegex.String(),
+			strings.Join(groups, " "),
+		),
+		Accepted: true,
+	})
+
+	if f.onlyEmpty || f.onlyNonEmpty {
+		reason, err = f.rejectEmpty(entry, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if reason != "" {
+			return append(steps, Step{Stage: StageEmpty, Detail: reason}), nil
+		}
+
+		steps = append(steps, Step{
+			Stage:    StageEmpty,
+			Detail:   "not skipped",
+			Accepted: true,
+		})
+	}
+
+	if f.firstLineRegex == nil {
+		return steps, nil
+	}
+
+	reason, err = f.rejectContent(filename, dir, isDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if reason != "" {
+		return append(steps, Step{Stage: StageContent, Detail: reason}), nil
+	}
+
+	steps = append(steps, Step{
+		Stage: StageContent,
+		Detail: fmt.Sprintf(
+			"first line matches '%s'",
+			f.firstLineRegex.String(),
+		),
+		Accepted: true,
+	})
+
+	return steps, nil
+}
+
+// readPatternFile reads the newline-delimited patterns contained in the file
+// specified by `pathToFile`. Blank lines and lines beginning with `#` are
+// ignored.
+func readPatternFile(pathToFile string) ([]string, error) {
+	b, err := os.ReadFile(pathToFile)
+	if err != nil {
+		return nil, err
 	}
 
+	var patterns []string
+
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		patterns = append(patterns, line)
+	}
+
+	return patterns, nil
+}
+
+// filterMatches filters out files that do not match the find string or one
+// that matches any exclusion patterns.
+func filterMatches(
+	pathsToFilter internalpath.Collection,
+	f *filter,
+) error {
 	for path, dirEntry := range pathsToFilter {
 		filteredDirEntry := dirEntry[:0]
 
 		for _, entry := range dirEntry {
-			filename := entry.Name()
+			accepted, err := f.accepts(entry, path)
+			if err != nil {
+				return err
+			}
 
-			entryIsDir := entry.IsDir()
+			if accepted {
+				filteredDirEntry = append(filteredDirEntry, entry)
+			}
+		}
 
-			if entryIsDir && !includeDir {
+		if len(filteredDirEntry) == 0 {
+			delete(pathsToFilter, path)
+			continue
+		}
+
+		pathsToFilter[path] = filteredDirEntry
+	}
+
+	return nil
+}
+
+// findBrokenLinks records the symlinks among the matches whose targets do not
+// exist in conf.BrokenLinks. A link is broken if os.Lstat succeeds for it but
+// os.Stat fails. Only the links that are accepted by the filter are recorded,
+// and they are left out of the matches if they are to be removed.
+func findBrokenLinks(
+	conf *config.Config,
+	paths internalpath.Collection,
+	f *filter,
+) error {
+	// the entries of archives are not checked
+	if !conf.ReportBrokenLinks || conf.FS != nil {
+		return nil
+	}
+
+	for _, dir := range conf.SearchedDirs {
+		dirEntry, ok := paths[dir]
+		if !ok {
+			continue
+		}
+
+		entries := dirEntry[:0]
+
+		for _, entry := range dirEntry {
+			path := filepath.Join(dir, entry.Name())
+
+			if entry.Type()&fs.ModeSymlink == 0 || !isBrokenLink(path) {
+				entries = append(entries, entry)
 				continue
 			}
 
-			if onlyDir && !entryIsDir {
+			accepted, err := f.accepts(entry, dir)
+			if err != nil {
+				return err
+			}
+
+			if accepted {
+				conf.BrokenLinks = append(conf.BrokenLinks, path)
+			}
+
+			if !accepted || !conf.RemoveBrokenLinks {
+				entries = append(entries, entry)
+			}
+		}
+
+		paths[dir] = entries
+	}
+
+	return nil
+}
+
+// isBrokenLink reports whether the path is a symlink whose target does not
+// exist.
+func isBrokenLink(path string) bool {
+	if _, err := os.Lstat(path); err != nil {
+		return false
+	}
+
+	_, err := os.Stat(path)
+
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// handleSymlinks applies the configured symlink handling mode to the entries
+// that were found. In SymlinkHandlingSkip mode, symlinks are left out. In
+// SymlinkHandlingTarget mode, each symlink is replaced by the file at the end
+// of its chain of links so that the file is matched and renamed instead, and
+// the link that points to the file directly is recorded in
+// conf.LinkedTargets. The symlinks whose targets cannot be resolved are left
+// out with a warning.
+func handleSymlinks(
+	conf *config.Config,
+	paths internalpath.Collection,
+) error {
+	skip := conf.SymlinkHandling == config.SymlinkHandlingSkip
+	// the targets of the entries of archives cannot be resolved
+	resolve := conf.SymlinkHandling == config.SymlinkHandlingTarget &&
+		conf.FS == nil
+
+	if !skip && !resolve {
+		return nil
+	}
+
+	conf.LinkedTargets = make(map[string][]string)
+
+	// the targets are added once every directory has been processed so
+	// that they are not resolved again
+	targets := make(internalpath.Collection)
+
+	for dir, dirEntry := range paths {
+		entries := dirEntry[:0]
+
+		for _, entry := range dirEntry {
+			if entry.Type()&fs.ModeSymlink == 0 {
+				entries = append(entries, entry)
 				continue
 			}
 
-			if !includeHidden {
-				entryIsHidden, err := isHidden(filename, path)
+			if skip {
+				continue
+			}
+
+			linkPath := filepath.Join(dir, entry.Name())
+
+			target, link, err := internalos.ResolveLink(
+				linkPath,
+				conf.MaxSymlinkDepth,
+			)
+			if err != nil {
+				conf.Warnings = append(conf.Warnings, fmt.Sprintf(
+					"the symlink '%s' was skipped since its target could not be resolved: %v",
+					linkPath,
+					err,
+				))
+
+				continue
+			}
+
+			info, err := os.Lstat(target)
+			if err != nil {
+				return err
+			}
+
+			// the target is referred to in the same way as the
+			// directory of the link
+			targetPath := target
+			if !filepath.IsAbs(dir) {
+				targetPath, err = filepath.Rel(conf.WorkingDir, target)
 				if err != nil {
 					return err
 				}
+			}
 
-				// Ensure file arguments are not affected
-				if entryIsHidden {
-					entryAbsPath, err := filepath.Abs(
-						filepath.Join(path, filename),
-					)
-					if err != nil {
-						return err
-					}
+			if _, ok := conf.LinkedTargets[targetPath]; !ok {
+				targetDir := filepath.Dir(targetPath)
+				targets[targetDir] = append(
+					targets[targetDir],
+					fs.FileInfoToDirEntry(info),
+				)
 
-					shouldSkip := true
+				// the target belongs to the path argument of its link
+				if _, ok := conf.DirRoots[targetDir]; !ok {
+					conf.DirRoots[targetDir] = conf.DirRoots[dir]
+				}
+			}
 
-					for _, pathArg := range pathsToSearch {
-						argAbsPath, err := filepath.Abs(pathArg)
-						if err != nil {
-							return err
-						}
+			if !slices.Contains(conf.LinkedTargets[targetPath], link) {
+				conf.LinkedTargets[targetPath] = append(
+					conf.LinkedTargets[targetPath],
+					link,
+				)
+			}
+		}
 
-						if strings.EqualFold(entryAbsPath, argAbsPath) {
-							shouldSkip = false
-						}
-					}
+		paths[dir] = entries
+	}
 
-					if shouldSkip {
-						continue
-					}
+	for dir, dirEntry := range targets {
+	entryLoop:
+		for _, entry := range dirEntry {
+			// the target may have been found by the search as well
+			for _, e := range paths[dir] {
+				if e.Name() == entry.Name() {
+					continue entryLoop
 				}
 			}
 
-			if ignoreExt && !entryIsDir {
-				filename = internalpath.FilenameWithoutExtension(filename)
-			}
+			paths[dir] = append(paths[dir], entry)
+		}
+	}
 
-			if excludeFilter != "" && excludeMatchRegex.MatchString(filename) {
-				continue
-			}
+	return nil
+}
 
-			matched := searchRegex.MatchString(filename)
-			if matched {
+// skipProcessed filters out the paths that were produced by previous
+// renaming operations according to the ledger.
+func skipProcessed(pathsToFilter internalpath.Collection) error {
+	l, err := ledger.Load()
+	if err != nil {
+		return err
+	}
+
+	for path, dirEntry := range pathsToFilter {
+		dir, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+
+		filteredDirEntry := dirEntry[:0]
+
+		for _, entry := range dirEntry {
+			if !l.Contains(filepath.Join(dir, entry.Name())) {
 				filteredDirEntry = append(filteredDirEntry, entry)
 			}
-
-			pathsToFilter[path] = filteredDirEntry
 		}
 
 		if len(filteredDirEntry) == 0 {
 			delete(pathsToFilter, path)
+			continue
 		}
+
+		pathsToFilter[path] = filteredDirEntry
 	}
 
 	return nil
 }
 
 func removeHidden(
+	fsys fs.FS,
 	de []os.DirEntry,
 	baseDir string,
 ) (ret []os.DirEntry, err error) {
 	for _, e := range de {
-		r, err := isHidden(e.Name(), baseDir)
+		r, err := hiddenIn(fsys, e.Name(), baseDir)
 		if err != nil {
 			return nil, err
 		}
@@ -153,83 +990,182 @@ func removeHidden(
 	return ret, nil
 }
 
+// walk reads the contents of the directories beneath the roots up to the
+// maximum depth (if set). In breadth-first order, each level of directories
+// is read before the next one. In depth-first order, the subdirectories of a
+// directory are read before its siblings. The directories that were read are
+// returned in the order they were visited.
 func walk(
+	ctx context.Context,
+	fsys fs.FS,
 	paths internalpath.Collection,
+	roots []string,
 	maxDepth int,
 	includeHidden bool,
-) error {
-	var recursedPaths []string
+	order string,
+	skipped *skipper,
+	origins map[string]string,
+) ([]string, error) {
+	var visited []string
+
+	walked := make(map[string]bool, len(roots))
+	for _, root := range roots {
+		walked[root] = true
+	}
+
+	// subdirs reads the contents of each subdirectory of dir and returns
+	// the ones that have not been walked yet
+	subdirs := func(dir string) ([]string, error) {
+		dirContents := paths[dir]
 
-	var currentDepth int
+		if !includeHidden {
+			var err error
+			dirContents, err = removeHidden(fsys, dirContents, dir)
+			if err != nil {
+				return nil, err
+			}
+		}
 
-	// currentLevel represents the current level of directories
-	// and their contents
-	currentLevel := make(map[string][]os.DirEntry)
+		var result []string
 
-loop:
-	// The goal of each iteration is to created entries for each
-	// unaccounted directory in the current level
-	for dir, dirContents := range paths {
-		if slices.Contains(recursedPaths, dir) {
-			continue
+		for _, entry := range dirContents {
+			if !entry.IsDir() {
+				continue
+			}
+
+			fp := filepath.Join(dir, entry.Name())
+			if walked[fp] {
+				continue
+			}
+
+			dirEntry, err := fs.ReadDir(fsys, fp)
+			if err != nil {
+				err = skipped.skip(fp, err)
+				if err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			paths[fp] = dirEntry
+			walked[fp] = true
+
+			// the subdirectories belong to the path argument of
+			// the directory they were found in
+			if _, ok := origins[fp]; !ok {
+				origins[fp] = origins[dir]
+			}
+
+			result = append(result, fp)
 		}
 
-		if !includeHidden {
-			var err error
-			dirContents, err = removeHidden(dirContents, dir)
+		return result, nil
+	}
+
+	// belowMaxDepth reports whether the subdirectories of a directory at
+	// the specified depth should be read
+	belowMaxDepth := func(depth int) bool {
+		return maxDepth <= 0 || depth+1 < maxDepth
+	}
+
+	if order == config.TraversalOrderDFS {
+		var visit func(dir string, depth int) error
+
+		visit = func(dir string, depth int) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			dirs, err := subdirs(dir)
 			if err != nil {
 				return err
 			}
-		}
 
-		for _, entry := range dirContents {
-			if entry.IsDir() {
-				fp := filepath.Join(dir, entry.Name())
-				dirEntry, err := os.ReadDir(fp)
+			for _, subdir := range dirs {
+				visited = append(visited, subdir)
+
+				if !belowMaxDepth(depth) {
+					continue
+				}
+
+				err = visit(subdir, depth+1)
 				if err != nil {
 					return err
 				}
+			}
+
+			return nil
+		}
 
-				currentLevel[fp] = dirEntry
+		for _, root := range roots {
+			err := visit(root, 0)
+			if err != nil {
+				return nil, err
 			}
 		}
 
-		recursedPaths = append(recursedPaths, dir)
+		return visited, nil
 	}
 
-	// if there are directories in the current level
-	// store each directory entry and empty the
-	// currentLevel so that it may be repopulated
-	if len(currentLevel) > 0 {
-		for dir, dirContents := range currentLevel {
-			paths[dir] = dirContents
+	currentLevel := roots
+
+	for depth := 0; len(currentLevel) > 0; depth++ {
+		var nextLevel []string
+
+		for _, dir := range currentLevel {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			dirs, err := subdirs(dir)
+			if err != nil {
+				return nil, err
+			}
 
-			delete(currentLevel, dir)
+			nextLevel = append(nextLevel, dirs...)
 		}
 
-		currentDepth++
-		if !(maxDepth > 0 && currentDepth == maxDepth) {
-			goto loop
+		visited = append(visited, nextLevel...)
+
+		if !belowMaxDepth(depth) {
+			break
 		}
+
+		currentLevel = nextLevel
 	}
 
-	return nil
+	return visited, nil
 }
 
 // searchPaths groups the paths that will be searched and their
-// directory contents.
+// directory contents. The directories are also returned in the order they
+// were searched.
 func searchPaths(
+	ctx context.Context,
+	fsys fs.FS,
 	pathsToSearch []string,
 	maxDepth int,
 	recursive, includeHidden bool,
-) (internalpath.Collection, error) {
+	order string,
+	skipped *skipper,
+	origins map[string]string,
+) (internalpath.Collection, []string, error) {
 	paths := make(internalpath.Collection)
 
+	// dirs contains the directory of each path argument while roots only
+	// contains the directory arguments since only those are walked
+	var dirs, roots []string
+
 	if len(pathsToSearch) == 0 {
 		pathsToSearch = append(pathsToSearch, ".")
 	}
 
 	for _, path := range pathsToSearch {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
 		var fileInfo os.FileInfo
 
 		path = filepath.Clean(path)
@@ -239,17 +1175,34 @@ func searchPaths(
 			continue
 		}
 
-		fileInfo, err := os.Stat(path)
+		fileInfo, err := fs.Stat(fsys, path)
 		if err != nil {
-			return nil, err
+			err = skipped.skip(path, err)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			continue
 		}
 
 		if fileInfo.IsDir() {
-			paths[path], err = os.ReadDir(path)
+			var dirEntry []fs.DirEntry
+
+			dirEntry, err = fs.ReadDir(fsys, path)
 			if err != nil {
-				return nil, err
+				err = skipped.skip(path, err)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				continue
 			}
 
+			paths[path] = dirEntry
+			origins[path] = path
+			dirs = append(dirs, path)
+			roots = append(roots, path)
+
 			continue
 		}
 
@@ -257,9 +1210,23 @@ func searchPaths(
 
 		var dirEntry []fs.DirEntry
 
-		dirEntry, err = os.ReadDir(dir)
+		dirEntry, err = fs.ReadDir(fsys, dir)
 		if err != nil {
-			return nil, err
+			err = skipped.skip(dir, err)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			continue
+		}
+
+		if _, ok := paths[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+
+		// the matches of a file argument are found in its directory
+		if _, ok := origins[dir]; !ok {
+			origins[dir] = dir
 		}
 
 	entryLoop:
@@ -281,29 +1248,104 @@ func searchPaths(
 	}
 
 	if recursive {
-		err := walk(paths, maxDepth, includeHidden)
+		visited, err := walk(
+			ctx,
+			fsys,
+			paths,
+			roots,
+			maxDepth,
+			includeHidden,
+			order,
+			skipped,
+			origins,
+		)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+
+		for _, dir := range visited {
+			// the directory of a file argument may be walked as well
+			if !slices.Contains(dirs, dir) {
+				dirs = append(dirs, dir)
+			}
 		}
 	}
 
-	return paths, nil
+	return paths, dirs, nil
+}
+
+// addPath adds the file at the specified absolute path to its parent
+// directory's entries in the paths collection (if not already present)
+// and returns its file info.
+func addPath(
+	paths internalpath.Collection,
+	absSourcePath string,
+) (fs.FileInfo, error) {
+	fileInfo, err := os.Stat(absSourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceDir := filepath.Dir(absSourcePath)
+
+	dirEntry, err := os.ReadDir(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+entryLoop:
+	for _, entry := range dirEntry {
+		if entry.Name() == fileInfo.Name() {
+			// Ensure that the file is not already
+			// present in the directory entry
+			for _, e := range paths[sourceDir] {
+				if e.Name() == fileInfo.Name() {
+					break entryLoop
+				}
+			}
+
+			paths[sourceDir] = append(paths[sourceDir], entry)
+
+			break
+		}
+	}
+
+	return fileInfo, nil
 }
 
 // handleCSV reads the provided CSV file, and finds all the
-// valid candidates for replacement.
+// valid candidates for replacement. Sources that contain glob
+// metacharacters are expanded relative to the directory of the CSV file.
+//
+// Each file is renamed according to the first row that refers to it, either
+// directly or through a glob pattern. Any later rows that refer to the same
+// file are ignored with a warning. In --csv-in-order mode, each row with a
+// glob pattern applies to the next file matched by the pattern that is not
+// renamed according to a previous row instead of every matched file, so that
+// repeating a pattern assigns the rows to the matched files in order.
 func handleCSV(
-	csvFilename string,
-	findSliceOpt, replacementSliceOpt []string,
+	ctx context.Context,
+	conf *config.Config,
+	skipped *skipper,
 ) (internalpath.Collection, error) {
 	paths := make(internalpath.Collection)
 
-	records, err := readCSVFile(csvFilename)
+	// lines maps the absolute path of each source to the line of the row
+	// that it is renamed according to
+	lines := make(map[string]int)
+
+	// rows keeps track of each row in the CSV file so that it can be
+	// associated with a file renaming change. The key is the absolute path
+	// of the source file and the value is the correspoding row in the file.
+	// Each file matched by a glob pattern shares the row of the pattern.
+	rows := make(map[string][]string)
+
+	records, err := readCSVFile(conf.CSVFilename)
 	if err != nil {
 		return nil, err
 	}
 
-	csvAbsPath, err := filepath.Abs(csvFilename)
+	csvAbsPath, err := filepath.Abs(conf.CSVFilename)
 	if err != nil {
 		return nil, err
 	}
@@ -312,63 +1354,118 @@ func handleCSV(
 
 	replacementSlice := make([]string, 0, len(records))
 
-	for _, record := range records {
+	own := newOwnFiles(conf)
+
+	for i, record := range records {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		if len(record) == 0 {
 			continue
 		}
 
+		line := i + 1
+
 		source := strings.TrimSpace(record[0])
 
 		absSourcePath := filepath.Join(filepath.Dir(csvAbsPath), source)
 
-		fileInfo, err2 := os.Stat(absSourcePath)
-		if err2 != nil {
-			return nil, err2
-		}
-
-		findSlice = append(findSlice, fileInfo.Name())
+		// a glob pattern applies the row to each file that it matches
+		sources := []string{absSourcePath}
+		if strings.ContainsAny(source, "*?[") {
+			sources, err = filepath.Glob(absSourcePath)
+			if err != nil {
+				return nil, err
+			}
 
-		sourceDir := filepath.Dir(absSourcePath)
+			// unlike the sources that are listed explicitly, f2's own
+			// files are not matched by glob patterns
+			if own != nil {
+				filtered := sources[:0]
 
-		var dirEntry []fs.DirEntry
+				for _, sourcePath := range sources {
+					if !own.contains(sourcePath) {
+						filtered = append(filtered, sourcePath)
+					}
+				}
 
-		dirEntry, err2 = os.ReadDir(sourceDir)
-		if err2 != nil {
-			return nil, err2
-		}
+				sources = filtered
+			}
 
-	entryLoop:
-		for _, entry := range dirEntry {
-			if entry.Name() == fileInfo.Name() {
-				// Ensure that the file is not already
-				// present in the directory entry
-				for _, e := range paths[sourceDir] {
-					if e.Name() == fileInfo.Name() {
-						break entryLoop
-					}
+			if len(sources) == 0 {
+				err = skipped.skip(
+					absSourcePath,
+					fmt.Errorf(errNoCSVGlobMatches.Error(), source),
+				)
+				if err != nil {
+					return nil, err
 				}
 
-				paths[sourceDir] = append(paths[sourceDir], entry)
+				continue
+			}
 
-				break
+			if conf.CSVInOrder {
+				sources = nextUnclaimed(sources, lines)
+				if len(sources) == 0 {
+					conf.Warnings = append(conf.Warnings, fmt.Sprintf(
+						errNoRemainingCSVGlobMatches.Error(),
+						line,
+						source,
+					))
+
+					continue
+				}
 			}
 		}
 
-		if len(record) > 1 {
-			target := strings.TrimSpace(record[1])
+		for _, sourcePath := range sources {
+			if prev, ok := lines[sourcePath]; ok {
+				conf.Warnings = append(conf.Warnings, fmt.Sprintf(
+					errDuplicateCSVSource.Error(),
+					sourcePath,
+					line,
+					prev,
+				))
 
-			replacementSlice = append(replacementSlice, target)
-		}
+				continue
+			}
+
+			fileInfo, err2 := addPath(paths, sourcePath)
+			if err2 != nil {
+				err2 = skipped.skip(sourcePath, err2)
+				if err2 != nil {
+					return nil, err2
+				}
+
+				continue
+			}
+
+			findSlice = append(findSlice, fileInfo.Name())
+
+			if len(record) > 1 {
+				target := strings.TrimSpace(record[1])
 
-		csvRows[absSourcePath] = record
+				replacementSlice = append(replacementSlice, target)
+			}
+
+			rows[sourcePath] = record
+			lines[sourcePath] = line
+		}
 	}
 
-	if len(replacementSliceOpt) == 0 {
-		if len(findSliceOpt) == 0 {
-			config.SetFindSlice(findSlice)
-			config.SetReplacementSlice(replacementSlice)
+	conf.CSVRows = rows
+
+	csvRowsMu.Lock()
+	csvRows = rows
+	csvRowsMu.Unlock()
 
-			err = config.SetFindStringRegex(0)
+	if len(conf.ReplacementSlice) == 0 {
+		if len(conf.FindSlice) == 0 {
+			conf.FindSlice = findSlice
+			conf.ReplacementSlice = replacementSlice
+
+			err = conf.SetFindStringRegex(0)
 			if err != nil {
 				return nil, err
 			}
@@ -378,42 +1475,313 @@ func handleCSV(
 	return paths, nil
 }
 
-func Find(conf *config.Config) (internalpath.Collection, error) {
+// nextUnclaimed returns the first of the sources that is not renamed according
+// to a row of the CSV file yet.
+func nextUnclaimed(sources []string, lines map[string]int) []string {
+	for _, source := range sources {
+		if _, ok := lines[source]; !ok {
+			return []string{source}
+		}
+	}
+
+	return nil
+}
+
+// readMapFile reads the source and target pairs contained in the JSON file
+// specified by `pathToMap`. The file may contain a single object that maps
+// each source to its target, or an array of objects with `source` and
+// `target` fields. The order of the pairs in the file is preserved.
+func readMapFile(pathToMap string) ([]mapEntry, error) {
+	b, err := os.ReadFile(pathToMap)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []mapEntry
+
+	b = bytes.TrimSpace(b)
+
+	if bytes.HasPrefix(b, []byte("[")) {
+		err = json.Unmarshal(b, &entries)
+		if err != nil {
+			return nil, err
+		}
+
+		return entries, nil
+	}
+
+	// decode the object token by token since unmarshalling into a map
+	// loses the order of the keys and hides duplicate sources
+	dec := json.NewDecoder(bytes.NewReader(b))
+
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if delim, ok := t.(json.Delim); !ok || delim != '{' {
+		return nil, errInvalidMapFile
+	}
+
+	for dec.More() {
+		t, err = dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		source, ok := t.(string)
+		if !ok {
+			return nil, errInvalidMapFile
+		}
+
+		var target string
+
+		err = dec.Decode(&target)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, mapEntry{Source: source, Target: target})
+	}
+
+	return entries, nil
+}
+
+// handleMapFile reads the provided JSON map file, and finds all the valid
+// candidates for replacement. Relative sources are resolved against the
+// directory that contains the map file. Each source may only be specified
+// once. The target of each source is recorded in conf.MapTargets.
+func handleMapFile(
+	ctx context.Context,
+	conf *config.Config,
+) (internalpath.Collection, error) {
+	paths := make(internalpath.Collection)
+
+	entries, err := readMapFile(conf.MapFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	mapAbsPath, err := filepath.Abs(conf.MapFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	// targets maps the absolute path of each source to its target
+	targets := make(map[string]string, len(entries))
+
+	seen := make(map[string]bool, len(entries))
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		source := strings.TrimSpace(entry.Source)
+
+		absSourcePath := source
+		if !filepath.IsAbs(source) {
+			absSourcePath = filepath.Join(filepath.Dir(mapAbsPath), source)
+		}
+
+		if seen[absSourcePath] {
+			return nil, fmt.Errorf(
+				errDuplicateMapSource.Error(),
+				source,
+				conf.MapFilename,
+			)
+		}
+
+		seen[absSourcePath] = true
+
+		_, err = addPath(paths, absSourcePath)
+		if err != nil {
+			return nil, err
+		}
+
+		targets[absSourcePath] = strings.TrimSpace(entry.Target)
+	}
+
+	// the targets are assigned to the sources directly so that they are
+	// not matched against the names of the other sources
+	conf.MapTargets = targets
+
+	return paths, nil
+}
+
+// Find searches for the paths that match the options in the specified
+// configuration. Any paths that were skipped because they could not be
+// read are recorded in conf.SkippedPaths. The search is stopped with the
+// context's error if it is cancelled. The paths are searched in conf.FS if
+// set, or the real filesystem otherwise.
+func Find(
+	ctx context.Context,
+	conf *config.Config,
+) (internalpath.Collection, error) {
+	skipped := &skipper{enabled: conf.SkipUnreadable}
+
+	conf.SearchedDirs = nil
+	conf.LinkedTargets = nil
+	conf.BrokenLinks = nil
+	conf.MapTargets = nil
+	conf.DirRoots = nil
+	conf.Warnings = nil
+
+	defer func() {
+		conf.SkippedPaths = skipped.paths
+	}()
+
+	if conf.MapFilename != "" {
+		return handleMapFile(ctx, conf)
+	}
+
 	if conf.CSVFilename != "" {
-		return handleCSV(
-			conf.CSVFilename,
-			conf.FindSlice,
-			conf.ReplacementSlice,
-		)
+		return handleCSV(ctx, conf, skipped)
+	}
+
+	var fsys fs.FS = osFS{}
+	if conf.FS != nil {
+		fsys = conf.FS
+	}
+
+	if conf.MaxEntriesPerDir > 0 {
+		fsys = limitedFS{FS: fsys, maxEntries: conf.MaxEntriesPerDir}
 	}
 
-	paths, err := searchPaths(
+	conf.DirRoots = make(map[string]string)
+
+	paths, dirs, err := searchPaths(
+		ctx,
+		fsys,
 		conf.PathsToFilesOrDirs,
 		conf.MaxDepth,
 		conf.Recursive,
 		conf.IncludeHidden,
+		conf.TraversalOrder,
+		skipped,
+		conf.DirRoots,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	err = filterMatches(
-		paths,
+	conf.SearchedDirs = dirs
+
+	f, err := filterFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// the broken links are found before the symlinks are handled since
+	// their targets cannot be resolved
+	err = findBrokenLinks(conf, paths, f)
+	if err != nil {
+		return nil, err
+	}
+
+	err = handleSymlinks(conf, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filterMatches(paths, f)
+	if err != nil {
+		return nil, err
+	}
+
+	excludeOwnFiles(conf, paths)
+
+	// the entries of archives are not recorded in the ledger
+	if conf.StopOnMatch && conf.FS == nil {
+		err = skipProcessed(paths)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
+
+func filterFromConfig(conf *config.Config) (*filter, error) {
+	excludeFilter := conf.ExcludeFilter
+
+	if conf.ExcludeFromFile != "" {
+		patterns, err := readPatternFile(conf.ExcludeFromFile)
+		if err != nil {
+			return nil, err
+		}
+
+		excludeFilter = append(
+			append([]string{}, conf.ExcludeFilter...),
+			patterns...,
+		)
+	}
+
+	var fsys fs.FS = osFS{}
+	if conf.FS != nil {
+		fsys = conf.FS
+	}
+
+	f, err := newFilter(
+		fsys,
 		conf.PathsToFilesOrDirs,
 		conf.SearchRegex,
-		conf.ExcludeFilter,
+		excludeFilter,
+		conf.ExcludeMode,
+		conf.ContentFirstLine,
 		conf.IncludeDir,
 		conf.IncludeHidden,
+		conf.OnlyHidden,
 		conf.OnlyDir,
 		conf.IgnoreExt,
+		conf.ExtOnly,
+		conf.OnlyEmpty,
+		conf.OnlyNonEmpty,
+		conf.EmptyDirs,
+		conf.AllowInvalidUTF8,
+		conf.ExcludeIgnoreCase,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return paths, nil
+	if conf.IncludeFromFile != "" {
+		f.allowlist, err = newAllowlist(
+			conf.IncludeFromFile,
+			conf.PathsToFilesOrDirs,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// Explain runs the filtering stages used when searching for matches against
+// the specified path and returns the outcome of each stage up to the first one
+// that rejects the path.
+func Explain(conf *config.Config, path string) ([]Step, error) {
+	fileInfo, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := filterFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	path = filepath.Clean(path)
+
+	return f.explain(fs.FileInfoToDirEntry(fileInfo), filepath.Dir(path))
 }
 
+// GetCSVRows returns the rows of the CSV file from the last search. Use
+// conf.CSVRows instead if several searches may run at the same time.
 func GetCSVRows() map[string][]string {
+	csvRowsMu.Lock()
+	defer csvRowsMu.Unlock()
+
 	return csvRows
 }
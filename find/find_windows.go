@@ -6,11 +6,13 @@ package find
 import (
 	"path/filepath"
 	"syscall"
+	"unsafe"
 )
 
 const pathSeperator = `\`
 
-// isHidden checks if a file is hidden on Windows.
+// isHidden checks if a file is hidden on Windows. Dotfiles and files with the
+// hidden or system attribute are considered hidden.
 func isHidden(filename, baseDir string) (bool, error) {
 	// dotfiles also count as hidden
 	if filename[0] == dotCharacter {
@@ -31,10 +33,20 @@ func isHidden(filename, baseDir string) (bool, error) {
 		return false, err
 	}
 
-	attributes, err := syscall.GetFileAttributes(pointer)
+	var data syscall.Win32FileAttributeData
+
+	err = syscall.GetFileAttributesEx(
+		pointer,
+		syscall.GetFileExInfoStandard,
+		(*byte)(unsafe.Pointer(&data)),
+	)
 	if err != nil {
 		return false, err
 	}
 
-	return attributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0, nil
+	hiddenAttributes := uint32(
+		syscall.FILE_ATTRIBUTE_HIDDEN | syscall.FILE_ATTRIBUTE_SYSTEM,
+	)
+
+	return data.FileAttributes&hiddenAttributes != 0, nil
 }
@@ -0,0 +1,133 @@
+package find
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrg/xdg"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	internalpath "github.com/ayoisaiah/f2/internal/path"
+)
+
+// ownFiles identifies the files that f2 reads or writes in the course of an
+// operation (the CSV, map, rules and pattern files, and the backup files) so
+// that they are not matched accidentally.
+type ownFiles struct {
+	paths   map[string]bool
+	dataDir string
+}
+
+// newOwnFiles returns the files that are excluded from the matches according
+// to the configuration. It returns nil if they are not excluded.
+func newOwnFiles(conf *config.Config) *ownFiles {
+	// the entries of archives are never the files on the disk
+	if conf.IncludeOwnFiles || conf.FS != nil {
+		return nil
+	}
+
+	o := &ownFiles{
+		paths:   make(map[string]bool),
+		dataDir: filepath.Join(xdg.DataHome, "f2"),
+	}
+
+	for _, path := range []string{
+		conf.CSVFilename,
+		conf.MapFilename,
+		conf.RulesFile,
+		conf.TargetsFile,
+		conf.FindFromFile,
+		conf.ExcludeFromFile,
+		conf.IncludeFromFile,
+	} {
+		if path == "" {
+			continue
+		}
+
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+
+		o.paths[absPath] = true
+	}
+
+	return o
+}
+
+// contains reports whether the file at the specified absolute path is one of
+// f2's own files. Any JSON file in the data directory, or elsewhere with the
+// contents of a backup file, is considered to be a backup file.
+func (o *ownFiles) contains(absPath string) bool {
+	if o.paths[absPath] {
+		return true
+	}
+
+	if !strings.EqualFold(filepath.Ext(absPath), ".json") {
+		return false
+	}
+
+	if strings.HasPrefix(absPath, o.dataDir+string(filepath.Separator)) {
+		return true
+	}
+
+	return isBackupFile(absPath)
+}
+
+// isBackupFile reports whether the file at the specified path is a backup
+// file created by f2 (a JSON object with `working_dir` and `changes` fields).
+func isBackupFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+
+	defer f.Close()
+
+	var backup struct {
+		WorkingDir *string          `json:"working_dir"`
+		Changes    *json.RawMessage `json:"changes"`
+	}
+
+	err = json.NewDecoder(f).Decode(&backup)
+	if err != nil {
+		return false
+	}
+
+	return backup.WorkingDir != nil && backup.Changes != nil
+}
+
+// excludeOwnFiles removes f2's own files from the paths.
+func excludeOwnFiles(conf *config.Config, paths internalpath.Collection) {
+	o := newOwnFiles(conf)
+	if o == nil {
+		return
+	}
+
+	for dir, entries := range paths {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+
+		filtered := entries[:0]
+
+		for _, entry := range entries {
+			if !entry.IsDir() &&
+				o.contains(filepath.Join(absDir, entry.Name())) {
+				continue
+			}
+
+			filtered = append(filtered, entry)
+		}
+
+		if len(filtered) == 0 {
+			delete(paths, dir)
+			continue
+		}
+
+		paths[dir] = filtered
+	}
+}
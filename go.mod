@@ -11,7 +11,7 @@ require (
 	github.com/pterm/pterm v0.12.46
 	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
 	github.com/urfave/cli/v2 v2.4.10
-	golang.org/x/sys v0.1.0 // indirect
+	golang.org/x/sys v0.1.0
 	golang.org/x/text v0.3.7
 	gopkg.in/djherbis/times.v1 v1.3.0
 )
@@ -19,8 +19,11 @@ require (
 require (
 	github.com/araddon/dateparse v0.0.0-20210429162001-6b43995a97de
 	github.com/davecgh/go-spew v1.1.1
+	github.com/dsnet/compress v0.0.1
+	github.com/olekukonko/tablewriter v0.0.5
 	github.com/sebdah/goldie/v2 v2.5.3
 	golang.org/x/exp v0.0.0-20221028150844-83b7d23a625f
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -31,7 +34,6 @@ require (
 	github.com/gookit/color v1.5.2 // indirect
 	github.com/lithammer/fuzzysearch v1.1.5 // indirect
 	github.com/mattn/go-runewidth v0.0.13 // indirect
-	github.com/olekukonko/tablewriter v0.0.5 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rivo/uniseg v0.4.2 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
@@ -26,13 +26,13 @@ func helpText() string {
 		pterm.Yellow("VERSION"),
 	)
 	flags := fmt.Sprintf(
-		"{{if .VisibleFlags}}%s\n{{range .VisibleFlags}}{{ if (eq .Name `find` `undo` `replace` `csv`) }}\t\t{{if .Aliases}}-{{range $element := .Aliases}}%s,{{end}}{{end}} %s\n\t\t\t\t{{.Usage}}\n\n{{end}}{{end}}",
+		"{{if .VisibleFlags}}%s\n{{range .VisibleFlags}}{{ if (eq .Name `find` `find-from` `undo` `replace` `csv` `map`) }}\t\t{{if .Aliases}}-{{range $element := .Aliases}}%s,{{end}}{{end}} %s\n\t\t\t\t{{.Usage}}\n\n{{end}}{{end}}",
 		pterm.Yellow("FLAGS"),
 		pterm.Green("{{$element}}"),
 		pterm.Green("--{{.Name}} {{.DefaultText}}"),
 	)
 	options := fmt.Sprintf(
-		"%s\n{{range .VisibleFlags}}{{ if not (eq .Name `find` `undo` `replace` `csv`) }}\t\t{{if .Aliases}}-{{range $element := .Aliases}}%s,{{end}}{{end}} %s\n\t\t\t\t{{.Usage}}\n\n{{end}}{{end}}{{end}}",
+		"%s\n{{range .VisibleFlags}}{{ if not (eq .Name `find` `find-from` `undo` `replace` `csv` `map`) }}\t\t{{if .Aliases}}-{{range $element := .Aliases}}%s,{{end}}{{end}} %s\n\t\t\t\t{{.Usage}}\n\n{{end}}{{end}}{{end}}",
 		pterm.Yellow("OPTIONS"),
 		pterm.Green("{{$element}}"),
 		pterm.Green("--{{.Name}} {{.DefaultText}}"),
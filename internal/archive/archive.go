@@ -0,0 +1,306 @@
+// Package archive renames the entries of zip and tar archives without
+// extracting them
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ayoisaiah/f2/internal/file"
+)
+
+var errDuplicateEntry = errors.New(
+	"renaming the archive entries would result in more than one entry named '%s'",
+)
+
+var errUnsupportedArchive = errors.New(
+	"'%s' is not a zip or tar archive",
+)
+
+// format is the archive format along with its compression (if any).
+type format int
+
+const (
+	formatZip format = iota
+	formatTar
+	formatTarGzip
+	formatTarBzip2
+)
+
+// extensions maps the supported archive extensions to their formats.
+var extensions = map[string]format{
+	".zip":     formatZip,
+	".tar":     formatTar,
+	".tar.gz":  formatTarGzip,
+	".tgz":     formatTarGzip,
+	".tar.bz2": formatTarBzip2,
+	".tbz2":    formatTarBzip2,
+	".tbz":     formatTarBzip2,
+}
+
+// Archive represents an archive whose entries are searched and renamed in
+// place of the files on the filesystem.
+type Archive struct {
+	fsys fs.FS
+	file *os.File
+	// zip is only set for zip archives
+	zip *zip.Reader
+	// Path is the location of the archive on the filesystem
+	Path string
+	// Backup is the location of the copy of the original archive that is
+	// made before its entries are renamed (if any)
+	Backup string
+	format format
+}
+
+// extensionFormat returns the format of the archive according to its
+// extension.
+func extensionFormat(name string) (format, bool) {
+	name = strings.ToLower(name)
+
+	for ext, f := range extensions {
+		if strings.HasSuffix(name, ext) {
+			return f, true
+		}
+	}
+
+	return 0, false
+}
+
+// IsArchive reports whether the path refers to a supported archive
+// according to its extension.
+func IsArchive(name string) bool {
+	_, ok := extensionFormat(name)
+	return ok
+}
+
+// detectFormat determines the format of the archive from its magic bytes.
+// The extension is used for archives that cannot be identified otherwise
+// such as tarballs in the pre-POSIX format.
+func detectFormat(f *os.File) (format, error) {
+	//nolint:gomnd // the ustar magic ends at byte 262
+	head := make([]byte, 512)
+
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.EOF) &&
+		!errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, err
+	}
+
+	head = head[:n]
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK")):
+		return formatZip, nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return formatTarGzip, nil
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return formatTarBzip2, nil
+	case len(head) > 262 && bytes.HasPrefix(head[257:], []byte("ustar")):
+		return formatTar, nil
+	}
+
+	if ext, ok := extensionFormat(f.Name()); ok && ext != formatZip {
+		return ext, nil
+	}
+
+	return 0, fmt.Errorf(errUnsupportedArchive.Error(), f.Name())
+}
+
+// Open opens the archive at the specified path. The archive must be closed
+// once its entries have been renamed.
+func Open(name string) (*Archive, error) {
+	name, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Archive{
+		Path: name,
+		file: f,
+	}
+
+	a.format, err = detectFormat(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if a.format == formatZip {
+		err = a.openZip()
+	} else {
+		err = a.openTar()
+	}
+
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// FS returns the entries of the archive as a filesystem.
+func (a *Archive) FS() fs.FS {
+	return a.fsys
+}
+
+// Close closes the archive. It is safe to call Close more than once.
+func (a *Archive) Close() error {
+	if a.file == nil {
+		return nil
+	}
+
+	err := a.file.Close()
+	a.file = nil
+
+	return err
+}
+
+// entryName returns the name of the entry that a change refers to. The names
+// of entries are always separated by forward slashes.
+func entryName(dir, name string) string {
+	return path.Join(filepath.ToSlash(dir), filepath.ToSlash(name))
+}
+
+// newName returns the name of the entry after the renaming operation. The
+// entry is affected by the change to its own name and those of the
+// directories that contain it. Leading `./` and trailing slashes are
+// preserved.
+func newName(name string, targets map[string]string) string {
+	clean := path.Clean(name)
+	if clean == "." {
+		return name
+	}
+
+	var original, renamed string
+
+	for _, component := range strings.Split(clean, "/") {
+		original = path.Join(original, component)
+
+		if target, ok := targets[original]; ok {
+			component = target
+		}
+
+		renamed = path.Join(renamed, component)
+	}
+
+	if strings.HasPrefix(name, "./") {
+		renamed = "./" + renamed
+	}
+
+	if strings.HasSuffix(name, "/") {
+		renamed += "/"
+	}
+
+	return renamed
+}
+
+// renamer tracks the new names of the entries in an archive so that no two
+// entries end up with the same name.
+type renamer struct {
+	targets map[string]string
+	seen    map[string]bool
+}
+
+func newRenamer(changes []*file.Change) *renamer {
+	targets := make(map[string]string, len(changes))
+
+	for _, ch := range changes {
+		targets[entryName(ch.BaseDir, ch.Source)] = filepath.ToSlash(ch.Target)
+	}
+
+	return &renamer{
+		targets: targets,
+		seen:    make(map[string]bool),
+	}
+}
+
+// rename returns the new name of the entry or an error if another
+// entry has already been given the same name.
+func (r *renamer) rename(name string) (string, error) {
+	name = newName(name, r.targets)
+
+	key := path.Clean(name)
+	if r.seen[key] {
+		return "", fmt.Errorf(errDuplicateEntry.Error(), key)
+	}
+
+	r.seen[key] = true
+
+	return name, nil
+}
+
+// Rename writes a copy of the archive in which the entries are renamed
+// according to the changes, and replaces the original archive with it. The
+// archive is closed afterwards.
+func (a *Archive) Rename(changes []*file.Change) (err error) {
+	dir, base := filepath.Split(a.Path)
+
+	// the new archive is written alongside the original so that it can
+	// replace it atomically
+	tmp, err := os.CreateTemp(dir, "."+base+".*")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	r := newRenamer(changes)
+
+	if a.format == formatZip {
+		err = a.writeZip(tmp, r)
+	} else {
+		err = a.writeTar(tmp, r)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	info, err := a.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Chmod(info.Mode())
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	// the original must be closed before it can be replaced on Windows
+	err = a.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), a.Path)
+}
@@ -0,0 +1,265 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/dsnet/compress/bzip2"
+)
+
+// tarFS provides access to the entries of a tar archive. Only the metadata of
+// each entry is available since the archive must be read sequentially.
+type tarFS struct {
+	infos    map[string]fs.FileInfo
+	children map[string][]string
+}
+
+// dirInfo describes a directory that is not recorded in the archive but is
+// implied by the names of its entries.
+type dirInfo struct {
+	name string
+}
+
+func (d dirInfo) Name() string       { return d.name }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o755 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() any           { return nil }
+
+// add records an entry and the directories that contain it.
+func (t *tarFS) add(name string, info fs.FileInfo) {
+	if _, exists := t.infos[name]; !exists {
+		dir := path.Dir(name)
+		if name != "." {
+			t.children[dir] = append(t.children[dir], name)
+		}
+
+		if dir != name {
+			if _, exists := t.infos[dir]; !exists {
+				t.add(dir, dirInfo{name: path.Base(dir)})
+			}
+		}
+	}
+
+	t.infos[name] = info
+}
+
+func (t *tarFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	info, ok := t.infos[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return info, nil
+}
+
+func (t *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, err := t.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	children := t.children[name]
+
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, child := range children {
+		entries = append(entries, fs.FileInfoToDirEntry(t.infos[child]))
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+func (t *tarFS) Open(name string) (fs.File, error) {
+	info, err := t.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tarFile{fsys: t, name: name, info: info}, nil
+}
+
+// tarFile is an entry of a tar archive whose contents cannot be read.
+type tarFile struct {
+	fsys *tarFS
+	info fs.FileInfo
+	name string
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *tarFile) Close() error { return nil }
+
+func (f *tarFile) Read(_ []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+}
+
+func (f *tarFile) ReadDir(_ int) ([]fs.DirEntry, error) {
+	return f.fsys.ReadDir(f.name)
+}
+
+// decompress returns a reader for the uncompressed contents of the archive.
+func (a *Archive) decompress() (io.Reader, error) {
+	_, err := a.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:exhaustive // zip archives are not handled here
+	switch a.format {
+	case formatTarGzip:
+		return gzip.NewReader(a.file)
+	case formatTarBzip2:
+		return bzip2.NewReader(a.file, nil)
+	}
+
+	return a.file, nil
+}
+
+// openTar reads the headers of each entry in the tar archive.
+func (a *Archive) openTar() error {
+	r, err := a.decompress()
+	if err != nil {
+		return err
+	}
+
+	t := &tarFS{
+		infos:    make(map[string]fs.FileInfo),
+		children: make(map[string][]string),
+	}
+
+	t.add(".", dirInfo{name: "."})
+
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(header.Name)
+		if name == "." || !fs.ValidPath(name) {
+			continue
+		}
+
+		t.add(name, header.FileInfo())
+	}
+
+	a.fsys = t
+
+	return nil
+}
+
+// compress returns a writer that compresses its input in the same way as the
+// original archive before writing it to w.
+func (a *Archive) compress(w io.Writer) (io.WriteCloser, error) {
+	//nolint:exhaustive // zip archives are not handled here
+	switch a.format {
+	case formatTarGzip:
+		return gzip.NewWriter(w), nil
+	case formatTarBzip2:
+		return bzip2.NewWriter(w, nil)
+	}
+
+	return nopWriteCloser{w}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// writeTar writes each entry of the tar archive to w under its new name. The
+// headers are otherwise preserved so that the modes, ownership and timestamps
+// of the entries are unchanged.
+func (a *Archive) writeTar(w io.Writer, r *renamer) (err error) {
+	src, err := a.decompress()
+	if err != nil {
+		return err
+	}
+
+	dst, err := a.compress(w)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		cerr := dst.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+
+	tr := tar.NewReader(src)
+	tw := tar.NewWriter(dst)
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		header.Name, err = r.rename(header.Name)
+		if err != nil {
+			return err
+		}
+
+		// hard links refer to other entries in the archive
+		if header.Typeflag == tar.TypeLink {
+			header.Linkname = newName(header.Linkname, r.targets)
+		}
+
+		// the names are recorded in the PAX records for long paths
+		// and they take precedence over the header fields
+		delete(header.PAXRecords, "path")
+		delete(header.PAXRecords, "linkpath")
+
+		err = tw.WriteHeader(header)
+		if err != nil && header.Format != tar.FormatPAX {
+			// the new name may not fit in the original format
+			header.Format = tar.FormatPAX
+
+			err = tw.WriteHeader(header)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		//nolint:gosec // the contents are copied as is
+		_, err = io.Copy(tw, tr)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
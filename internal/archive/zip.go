@@ -0,0 +1,65 @@
+package archive
+
+import (
+	"archive/zip"
+	"io"
+)
+
+// openZip reads the central directory of the zip archive.
+func (a *Archive) openZip() error {
+	info, err := a.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	a.zip, err = zip.NewReader(a.file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	a.fsys = a.zip
+
+	return nil
+}
+
+// writeZip writes each entry of the zip archive to w under its new name. The
+// entries are copied without being decompressed.
+func (a *Archive) writeZip(w io.Writer, r *renamer) error {
+	zw := zip.NewWriter(w)
+
+	for _, f := range a.zip.File {
+		header := f.FileHeader
+
+		name, err := r.rename(f.Name)
+		if err != nil {
+			return err
+		}
+
+		header.Name = name
+
+		err = copyZipEntry(zw, f, &header)
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// copyZipEntry copies the compressed contents of the entry to the writer
+// under the specified header.
+func copyZipEntry(w *zip.Writer, f *zip.File, header *zip.FileHeader) error {
+	r, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+
+	dst, err := w.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, r)
+
+	return err
+}
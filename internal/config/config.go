@@ -5,24 +5,254 @@ package config
 import (
 	"errors"
 	"io"
+	"io/fs"
+	"math/rand"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/slices"
+
+	"github.com/ayoisaiah/f2/internal/archive"
+	"github.com/ayoisaiah/f2/internal/conflict"
+	"github.com/ayoisaiah/f2/internal/file"
 )
 
 var (
+	errPreserveStructureWithoutTargetDir = errors.New(
+		"Invalid argument: `--preserve-structure` can only be used with `--target-dir`",
+	)
+
 	errInvalidArgument = errors.New(
-		"Invalid argument: one of `-f`, `-r`, `-csv` or `-u` must be present and set to a non empty string value. Use 'f2 --help' for more information",
+		"Invalid argument: one of `-f`, `--find-from`, `-r`, `-csv`, `--map`, `--targets-file`, `--prefix`, `--suffix`, `--route-by-ext`, `-u`, `--undo-file`, `--last` or `--edit` must be present and set to a non empty string value. Use 'f2 --help' for more information",
 	)
 
 	errInvalidSimpleModeArgs = errors.New(
 		"At least one argument must be specified in simple mode",
 	)
+
+	errInvalidExcludeMode = errors.New(
+		"Invalid argument: `--exclude-mode` must be set to 'any' or 'all'",
+	)
+
+	errFindFromConflict = errors.New(
+		"Invalid argument: `--find-from` cannot be combined with `-f/--find`",
+	)
+
+	errMapConflict = errors.New(
+		"Invalid argument: `--map` cannot be combined with `-f/--find`, `--find-from` or `-r/--replace` since the targets are taken from the map file",
+	)
+
+	errInvalidCounterScope = errors.New(
+		"Invalid argument: `--counter-scope` must be set to 'global', 'perdir' or 'perroot'",
+	)
+
+	errInvalidCounterGroupBy = errors.New(
+		"Invalid argument: `--counter-group-by` must be set to 'level:<n>' with a positive n or a valid regular expression",
+	)
+
+	errInvalidHardlinkGroup = errors.New(
+		"Invalid argument: `--hardlinks` must be set to 'first' or 'all'",
+	)
+
+	errInvalidSymlinkHandling = errors.New(
+		"Invalid argument: `--symlinks` must be set to 'link', 'target' or 'skip'",
+	)
+
+	errInvalidReplaceScope = errors.New(
+		"Invalid argument: `--replace-scope` must be set to 'match' or 'name'",
+	)
+
+	errInvalidOutputSort = errors.New(
+		"Invalid argument: `--sort-changes` must be set to 'source', 'target' or 'dir'",
+	)
+
+	errInvalidTraversalOrder = errors.New(
+		"Invalid argument: `--traversal-order` must be set to 'bfs' or 'dfs'",
+	)
+
+	errInvalidArchive = errors.New(
+		"Invalid argument: `--archive` requires a single path to a zip or tar archive",
+	)
+
+	errEmptyConflict = errors.New(
+		"Invalid argument: `--only-empty` cannot be combined with `--only-non-empty`",
+	)
+
+	errStdinPathsConflict = errors.New(
+		"Invalid argument: paths cannot be read from the standard input (`-`) in combination with `--interactive` or `--edit`",
+	)
+
+	errNoStdinPaths = errors.New(
+		"Invalid argument: no paths were read from the standard input (`-`)",
+	)
+
+	errStagedConflict = errors.New(
+		"Invalid argument: `--atomic-within-dir` cannot be combined with `--copy` or `--archive`",
+	)
+
+	errGitNotFound = errors.New(
+		"Invalid argument: `--git` requires git to be installed and available in the PATH",
+	)
+
+	errGitConflict = errors.New(
+		"Invalid argument: `--git` cannot be combined with `--copy` or `--archive`",
+	)
+
+	errArchiveConflict = errors.New(
+		"Invalid argument: `--archive` cannot be combined with `--csv`, `--map` or `--copy`",
+	)
+
+	errInvalidReplay = errors.New(
+		"Invalid argument: `--apply-from-backup` accepts a single path to the directory that the operation is applied to",
+	)
+
+	errReplayConflict = errors.New(
+		"Invalid argument: `--apply-from-backup` cannot be combined with `-u/--undo`, `--archive`, `--csv` or `--map`",
+	)
+
+	errExtOnlyConflict = errors.New(
+		"Invalid argument: `--ext-only` cannot be combined with `-e/--ignore-ext` or `--stem-only`",
+	)
+
+	errInvalidOnError = errors.New(
+		"Invalid argument: `--on-error` must be set to 'continue' or 'abort'",
+	)
+
+	errInvalidNormalization = errors.New(
+		"Invalid argument: `--normalize-unicode` must be set to 'nfc' or 'nfd'",
+	)
+
+	errInvalidPlan = errors.New(
+		"Invalid argument: `--plan` requires `--json` and cannot be combined with `-x/--exec` or `-i/--interactive`",
+	)
+
+	errInvalidRoute = errors.New(
+		"Invalid argument: each `--route-by-ext` value must be in the form 'ext=dir' where ext may be '*' for the default directory",
+	)
+)
+
+const (
+	// ExcludeModeAny excludes a file if it matches any of the exclude
+	// patterns. This is the default.
+	ExcludeModeAny = "any"
+	// ExcludeModeAll excludes a file only if it matches every exclude
+	// pattern.
+	ExcludeModeAll = "all"
+)
+
+const (
+	// CounterScopeGlobal numbers the matches sequentially across
+	// all directories. This is the default.
+	CounterScopeGlobal = "global"
+	// CounterScopePerDir restarts the numbering in each directory.
+	CounterScopePerDir = "perdir"
+	// CounterScopePerRoot restarts the numbering for each path argument
+	// (including its subdirectories in recursive mode).
+	CounterScopePerRoot = "perroot"
+)
+
+const (
+	// ReplaceScopeMatch replaces only the matched portions of each name and
+	// keeps the rest of the name intact. This is the default.
+	ReplaceScopeMatch = "match"
+	// ReplaceScopeName replaces the entire name with the replacement if the
+	// name contains a match.
+	ReplaceScopeName = "name"
+)
+
+const (
+	// HardlinkGroupFirst renames only the first of the matched names that
+	// refer to the same file and skips its other hard links.
+	HardlinkGroupFirst = "first"
+	// HardlinkGroupAll renames all the matched names that refer to the same
+	// file and gives them the same value for index variables.
+	HardlinkGroupAll = "all"
+)
+
+const (
+	// SymlinkHandlingLink renames the matched symlinks themselves. This is
+	// the default.
+	SymlinkHandlingLink = "link"
+	// SymlinkHandlingTarget renames the files that the matched symlinks
+	// point to and updates the links so that they keep pointing to them.
+	SymlinkHandlingTarget = "target"
+	// SymlinkHandlingSkip leaves symlinks out of the matches.
+	SymlinkHandlingSkip = "skip"
 )
 
+const (
+	// OutputSortSource orders the reported changes by their source names.
+	OutputSortSource = "source"
+	// OutputSortTarget orders the reported changes by their target names.
+	OutputSortTarget = "target"
+	// OutputSortDir orders the reported changes by their directories and
+	// then by their source names.
+	OutputSortDir = "dir"
+)
+
+const (
+	// TraversalOrderBFS reads each level of directories before the next one
+	// in recursive mode. This is the default.
+	TraversalOrderBFS = "bfs"
+	// TraversalOrderDFS reads the subdirectories of each directory before
+	// moving on to its siblings in recursive mode.
+	TraversalOrderDFS = "dfs"
+)
+
+const (
+	// OnErrorContinue attempts the remaining changes after a failure and
+	// reports all the errors at the end. This is the default.
+	OnErrorContinue = "continue"
+	// OnErrorAbort stops the renaming operation after the first failure,
+	// leaving the remaining changes untouched.
+	OnErrorAbort = "abort"
+)
+
+const (
+	// NormalizeNFC composes the characters in the targets, which is the
+	// form used by most systems.
+	NormalizeNFC = "nfc"
+	// NormalizeNFD decomposes the characters in the targets, which is the
+	// form used by macOS.
+	NormalizeNFD = "nfd"
+)
+
+// Stages of the renaming operation that are timed in timings mode.
+const (
+	StageFind     = "find"
+	StageReplace  = "replace"
+	StageValidate = "validate"
+	StageRename   = "rename"
+)
+
+// Timing records how long a stage of the renaming operation took and the
+// number of entries that it processed.
+type Timing struct {
+	Stage    string        `json:"-"`
+	Duration time.Duration `json:"duration_ns"`
+	Entries  int           `json:"entries"`
+}
+
+// DiskSpace records the space that the copies require on a filesystem along
+// with the space that is available on it. Dir is an existing directory on
+// the filesystem that receives some of the copies.
+type DiskSpace struct {
+	Dir       string `json:"dir"`
+	Required  int64  `json:"required"`
+	Available int64  `json:"available"`
+}
+
+// Insufficient reports whether the copies do not fit on the filesystem.
+func (d DiskSpace) Insufficient() bool {
+	return d.Required > d.Available
+}
+
 var conf *Config
 
 // Config represents the program configuration.
@@ -31,19 +261,81 @@ type Config struct {
 	Stdin              io.Reader
 	Stderr             io.Writer
 	Stdout             io.Writer
+	FS                 fs.FS // searched instead of the real filesystem if set
 	SearchRegex        *regexp.Regexp
+	Archive            *archive.Archive    // set while renaming within an archive
+	Conflicts          conflict.Collection // set by the last validation
+	Random             *rand.Rand          // set by the last replacement
+	CSVRows            map[string][]string // set by the last CSV search
+	MapTargets         map[string]string   // set by the last map file search
+	Hashes             map[string]string   // cached by the last replacement
+	RouteByExt         map[string]string   // lowercase extension to directory
+	TargetDir          string              // absolute path
+	LinkedTargets      map[string][]string // symlink targets to their links
+	DirRoots           map[string]string   // set by the last search
 	CSVFilename        string
+	ExcludeMode        string
+	CounterScope       string
+	CounterGroupBy     string
+	CounterGroupLevel  int            // set through --counter-group-by level:<n>
+	CounterGroupRegex  *regexp.Regexp // set through --counter-group-by <regex>
+	HardlinkGroup      string
+	SymlinkHandling    string
+	ReplaceScope       string
+	OnError            string
+	OutputSort         string
+	TraversalOrder     string
+	MapFilename        string
+	RulesFile          string
+	DisplayRelativeTo  string
 	Sort               string
 	Replacement        string
 	WorkingDir         string
+	UndoFile           string
+	RelocateTo         string
+	ReplayFile         string
+	ReplayRoot         string
+	Explain            string
+	ExcludeFromFile    string
+	IncludeFromFile    string
+	FindFromFile       string
+	ContentFirstLine   string
+	Separators         string
+	TrimChars          string // whitespace if empty
+	Prefix             string
+	OutputFile         string
+	NumFallback        string
+	NormalizeUnicode   string
+	Suffix             string
 	FindSlice          []string
 	ExcludeFilter      []string
+	Rules              []Rule // loaded from the rules file
+	TargetsFile        string
+	Targets            []string // loaded from the targets file
 	ReplacementSlice   []string
 	PathsToFilesOrDirs []string
+	SearchedDirs       []string // set by the last search
+	Warnings           []string // set by the last search
+	Overwrites         []string // set by the last validation
+	BrokenLinks        []string // set by the last search
 	NumberOffset       []int
+	SizeBuckets        []int64            // upper limits of the small and medium sizes
+	SkippedPaths       []file.SkippedPath // set by the last search
+	RemovedLinks       []file.RemovedLink // set by the last operation
+	CompletedChanges   []*file.Change     // set when resuming an operation
+	StageTimings       []Timing           // recorded in timings mode
+	DiskSpace          []DiskSpace        // estimated in copy mode
 	MaxDepth           int
+	MaxEntriesPerDir   int
+	MaxSymlinkDepth    int
+	CreatedDirs        int // set by the last operation
 	StartNumber        int
+	CounterStart       int
+	CounterStep        int
 	ReplaceLimit       int
+	Retries            int
+	RetryDelay         time.Duration
+	Seed               int64
 	Recursive          bool
 	IgnoreCase         bool
 	ReverseSort        bool
@@ -53,14 +345,211 @@ type Config struct {
 	IgnoreExt          bool
 	AllowOverwrites    bool
 	Verbose            bool
+	VerboseLevel       int
+	Annotate           bool
 	IncludeHidden      bool
+	IncludeOwnFiles    bool
 	Quiet              bool
 	AutoFixConflicts   bool
 	Exec               bool
+	SeedSet            bool // a seed of zero is only fixed if it is set
 	StringLiteralMode  bool
 	SimpleMode         bool
 	JSON               bool
 	Interactive        bool
+	CheckPermissions   bool
+	Copy               bool
+	UseGit             bool
+	VerifyCopy         bool
+	Edit               bool
+	ReattachExt        bool
+	SkipAlreadyNamed   bool
+	SkipIdentical      bool
+	SkipEmptyTargets   bool
+	CountOnly          bool
+	Swap               bool
+	StagedRename       bool
+	NoBackup           bool
+	CollapseSeparators bool
+	Trim               bool
+	SkipUnreadable     bool
+	NullInput          bool
+	OnlyEmpty          bool
+	OnlyNonEmpty       bool
+	EmptyDirs          bool
+	ReportBrokenLinks  bool
+	RemoveBrokenLinks  bool
+	SuffixAfterExt     bool
+	ExtOnly            bool
+	StemOnly           bool
+	OnlyHidden         bool
+	AllowInvalidUTF8   bool
+	ArchiveMode        bool
+	UnicodeMode        bool
+	PreserveExtCase    bool
+	Simulate           bool
+	TreeOutput         bool
+	GroupByOperation   bool
+	StopOnMatch        bool
+	ClearLedger        bool
+	TemplateMode       bool
+	Timings            bool
+	AllowControlChars  bool
+	Resume             bool
+	Checkpoint         bool
+	CheckOnly          bool
+	PreserveStructure  bool
+	CleanupOnFailure   bool
+	ShowLast           bool
+	ExcludeIgnoreCase  bool
+	Plan               bool
+	CSVInOrder         bool
+	ChainRules         bool
+	PartialTargets     bool
+}
+
+// unicodeClasses maps the Perl character classes to their Unicode
+// equivalents.
+var unicodeClasses = map[rune]string{
+	'd': `\p{Nd}`,
+	'D': `\P{Nd}`,
+	'w': `[\p{L}\p{M}\p{N}_]`,
+	'W': `[^\p{L}\p{M}\p{N}_]`,
+	's': `[\s\p{Z}]`,
+	'S': `[^\s\p{Z}]`,
+}
+
+// unicodeBracketClasses is used for the Perl character classes inside
+// brackets. The negated word and space classes cannot be expressed there so
+// they are left as is.
+var unicodeBracketClasses = map[rune]string{
+	'd': `\p{Nd}`,
+	'D': `\P{Nd}`,
+	'w': `\p{L}\p{M}\p{N}_`,
+	's': `\s\p{Z}`,
+}
+
+// unicodePattern rewrites the `\d`, `\w` and `\s` classes (and their
+// negations) in the pattern so that they match Unicode digits, letters
+// (including combining marks) and spaces since they are limited to ASCII in
+// Go's regular expressions. Literal text between `\Q` and `\E` and POSIX
+// classes such as `[:digit:]` are left untouched.
+func unicodePattern(pattern string) string {
+	runes := []rune(pattern)
+
+	var b strings.Builder
+
+	var inClass bool
+
+	// indexOf returns the index of the sequence in runes starting from
+	// the specified position or -1 if it is not present
+	indexOf := func(seq string, from int) int {
+		n := len([]rune(seq))
+
+		for j := from; j+n <= len(runes); j++ {
+			if string(runes[j:j+n]) == seq {
+				return j
+			}
+		}
+
+		return -1
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			next := runes[i+1]
+
+			if next == 'Q' {
+				end := indexOf(`\E`, i+2)
+				if end < 0 {
+					b.WriteString(string(runes[i:]))
+					return b.String()
+				}
+
+				b.WriteString(string(runes[i : end+2]))
+				i = end + 1
+
+				continue
+			}
+
+			i++
+
+			classes := unicodeClasses
+			if inClass {
+				classes = unicodeBracketClasses
+			}
+
+			if class, ok := classes[next]; ok {
+				b.WriteString(class)
+				continue
+			}
+
+			b.WriteRune(r)
+			b.WriteRune(next)
+		case r == '[' && !inClass:
+			inClass = true
+
+			b.WriteRune(r)
+
+			// a closing bracket at the start of a class is literal
+			if i+1 < len(runes) && runes[i+1] == '^' {
+				i++
+				b.WriteRune(runes[i])
+			}
+
+			if i+1 < len(runes) && runes[i+1] == ']' {
+				i++
+				b.WriteRune(runes[i])
+			}
+		case r == '[' && inClass && i+1 < len(runes) && runes[i+1] == ':':
+			end := indexOf(":]", i+2)
+			if end < 0 {
+				b.WriteRune(r)
+				continue
+			}
+
+			b.WriteString(string(runes[i : end+2]))
+			i = end + 1
+		case r == ']' && inClass:
+			inClass = false
+
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// findPattern returns the pattern for the find string at the specified index
+// according to the search options. The options of a rule are applied in
+// addition to the global ones.
+func (c *Config) findPattern(i int) string {
+	findPattern := c.FindSlice[i]
+
+	stringMode, ignoreCase := c.StringLiteralMode, c.IgnoreCase
+	if i < len(c.Rules) {
+		stringMode = stringMode || c.Rules[i].StringMode
+		ignoreCase = ignoreCase || c.Rules[i].IgnoreCase
+	}
+
+	// Escape all regular expression metacharacters in string literal mode
+	if stringMode {
+		findPattern = regexp.QuoteMeta(findPattern)
+	} else if c.UnicodeMode {
+		findPattern = unicodePattern(findPattern)
+	}
+
+	// case folding applies to all Unicode letters (such as Σ and σ)
+	if ignoreCase {
+		findPattern = "(?i)" + findPattern
+	}
+
+	return findPattern
 }
 
 // SetFindStringRegex compiles a regular expression for the
@@ -72,41 +561,345 @@ func (c *Config) SetFindStringRegex(replacementIndex int) error {
 	// is found
 	findPattern := ".*"
 	if len(c.FindSlice) > replacementIndex {
-		findPattern = c.FindSlice[replacementIndex]
+		findPattern = c.findPattern(replacementIndex)
+	}
+
+	re, err := regexp.Compile(findPattern)
+	if err != nil {
+		return err
+	}
+
+	c.SearchRegex = re
 
-		// Escape all regular expression metacharacters in string literal mode
-		if c.StringLiteralMode {
-			findPattern = regexp.QuoteMeta(findPattern)
+	return nil
+}
+
+// setRulesRegex compiles a regular expression that matches the file names
+// which are matched by any of the rules so that each rule can be applied
+// independently of the others. The flags of each pattern are confined to
+// its own group.
+func (c *Config) setRulesRegex() error {
+	patterns := make([]string, len(c.Rules))
+
+	for i := range c.Rules {
+		patterns[i] = "(?:" + c.findPattern(i) + ")"
+	}
+
+	re, err := regexp.Compile(strings.Join(patterns, "|"))
+	if err != nil {
+		return err
+	}
+
+	c.SearchRegex = re
+
+	return nil
+}
+
+// StdinPathArg is the path argument that is replaced with the paths read
+// from the standard input.
+const StdinPathArg = "-"
+
+// readStdinPaths replaces the `-` path argument with the paths listed in the
+// standard input. The paths are separated by newlines, or by NUL bytes in
+// NullInput mode (as produced by `find -print0`) so that any path can be
+// listed. Empty entries are ignored. It is an error if no paths are left so
+// that the current directory is not searched instead.
+func (c *Config) readStdinPaths() error {
+	i := slices.Index(c.PathsToFilesOrDirs, StdinPathArg)
+	if i < 0 {
+		return nil
+	}
+
+	// the standard input is consumed by the paths
+	if c.Interactive || c.Edit {
+		return errStdinPathsConflict
+	}
+
+	b, err := io.ReadAll(c.Stdin)
+	if err != nil {
+		return err
+	}
+
+	sep := "\n"
+	if c.NullInput {
+		sep = "\x00"
+	}
+
+	var paths []string
+
+	for _, path := range strings.Split(string(b), sep) {
+		if !c.NullInput {
+			path = strings.TrimSuffix(path, "\r")
 		}
 
-		if c.IgnoreCase {
-			findPattern = "(?i)" + findPattern
+		if path != "" {
+			paths = append(paths, path)
 		}
 	}
 
-	re, err := regexp.Compile(findPattern)
+	args := make([]string, 0, len(c.PathsToFilesOrDirs)+len(paths))
+	args = append(args, c.PathsToFilesOrDirs[:i]...)
+	args = append(args, paths...)
+
+	for _, arg := range c.PathsToFilesOrDirs[i+1:] {
+		if arg != StdinPathArg {
+			args = append(args, arg)
+		}
+	}
+
+	if len(args) == 0 {
+		return errNoStdinPaths
+	}
+
+	c.PathsToFilesOrDirs = args
+
+	return nil
+}
+
+// RouteDefault is the key of the directory that files with unmapped
+// extensions are routed to.
+const RouteDefault = "*"
+
+// setRoutes parses the `ext=dir` mappings of the --route-by-ext flag.
+// Extensions are matched case-insensitively with or without the leading dot.
+func (c *Config) setRoutes(routes []string) error {
+	if len(routes) == 0 {
+		return nil
+	}
+
+	c.RouteByExt = make(map[string]string, len(routes))
+
+	for _, route := range routes {
+		ext, dir, found := strings.Cut(route, "=")
+
+		ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+		if !found || ext == "" || dir == "" {
+			return errInvalidRoute
+		}
+
+		c.RouteByExt[ext] = filepath.Clean(dir)
+	}
+
+	return nil
+}
+
+// setTargetDir sets the directory that the targets are placed in, and
+// whether the structure of the search is preserved within it.
+func (c *Config) setTargetDir(dir string, preserveStructure bool) error {
+	if dir == "" {
+		if preserveStructure {
+			return errPreserveStructureWithoutTargetDir
+		}
+
+		return nil
+	}
+
+	absDir, err := filepath.Abs(dir)
 	if err != nil {
 		return err
 	}
 
-	c.SearchRegex = re
+	c.TargetDir = absDir
+	c.PreserveStructure = preserveStructure
 
 	return nil
 }
 
 func (c *Config) setOptions(ctx *cli.Context) error {
 	if len(ctx.StringSlice("find")) == 0 &&
+		ctx.String("find-from") == "" &&
 		len(ctx.StringSlice("replace")) == 0 &&
 		ctx.String("csv") == "" &&
-		!ctx.Bool("undo") {
+		ctx.String("map") == "" &&
+		ctx.String("rules") == "" &&
+		ctx.String("targets-file") == "" &&
+		ctx.String("prefix") == "" &&
+		ctx.String("suffix") == "" &&
+		ctx.String("undo-file") == "" &&
+		ctx.String("apply-from-backup") == "" &&
+		!ctx.Bool("undo") &&
+		!ctx.Bool("last") &&
+		len(ctx.StringSlice("route-by-ext")) == 0 &&
+		ctx.String("target-dir") == "" &&
+		ctx.String("normalize-unicode") == "" &&
+		!ctx.Bool("trim") &&
+		!ctx.Bool("edit") &&
+		!ctx.Bool("resume") &&
+		!ctx.Bool("clear-ledger") {
 		return errInvalidArgument
 	}
 
 	c.FindSlice = ctx.StringSlice("find")
+	c.FindFromFile = ctx.String("find-from")
 	c.ReplacementSlice = ctx.StringSlice("replace")
+
+	if c.FindFromFile != "" {
+		if len(c.FindSlice) > 0 {
+			return errFindFromConflict
+		}
+
+		b, err := os.ReadFile(c.FindFromFile)
+		if err != nil {
+			return err
+		}
+
+		pattern := strings.TrimSuffix(string(b), "\n")
+		pattern = strings.TrimSuffix(pattern, "\r")
+
+		c.FindSlice = []string{pattern}
+	}
 	c.CSVFilename = ctx.String("csv")
+	c.CSVInOrder = ctx.Bool("csv-in-order")
+	c.MapFilename = ctx.String("map")
+
+	if c.MapFilename != "" &&
+		(len(c.FindSlice) > 0 || len(c.ReplacementSlice) > 0) {
+		return errMapConflict
+	}
+
+	c.RulesFile = ctx.String("rules")
+	c.ChainRules = ctx.Bool("chain-rules")
+
+	if c.RulesFile != "" {
+		if len(c.FindSlice) > 0 || len(c.ReplacementSlice) > 0 ||
+			c.CSVFilename != "" || c.MapFilename != "" {
+			return errRulesConflict
+		}
+
+		rules, err := readRules(c.RulesFile)
+		if err != nil {
+			return err
+		}
+
+		c.Rules = rules
+
+		for _, rule := range rules {
+			c.FindSlice = append(c.FindSlice, rule.Find)
+			c.ReplacementSlice = append(c.ReplacementSlice, rule.Replacement)
+		}
+	}
+
+	c.TargetsFile = ctx.String("targets-file")
+	c.PartialTargets = ctx.Bool("partial")
+
+	if c.PartialTargets && c.TargetsFile == "" {
+		return errPartialWithoutTargets
+	}
+
+	if c.TargetsFile != "" {
+		if len(c.ReplacementSlice) > 0 || c.CSVFilename != "" ||
+			c.MapFilename != "" || c.RulesFile != "" {
+			return errTargetsConflict
+		}
+
+		targets, err := readTargets(c.TargetsFile)
+		if err != nil {
+			return err
+		}
+
+		c.Targets = targets
+	}
 	c.Revert = ctx.Bool("undo")
+	c.ClearLedger = ctx.Bool("clear-ledger")
+	c.Resume = ctx.Bool("resume")
+	c.ShowLast = ctx.Bool("last")
+	c.UndoFile = ctx.String("undo-file")
+	c.RelocateTo = ctx.String("relocate-to")
+	c.ReplayFile = ctx.String("apply-from-backup")
+	c.Edit = ctx.Bool("edit")
+	c.Explain = ctx.String("explain")
+	c.CountOnly = ctx.Bool("count")
+	c.Prefix = ctx.String("prefix")
+	c.OutputFile = ctx.String("output-file")
+	c.NumFallback = ctx.String("num-fallback")
+	c.Suffix = ctx.String("suffix")
+	c.SuffixAfterExt = ctx.Bool("suffix-after-ext")
+
+	err := c.setRoutes(ctx.StringSlice("route-by-ext"))
+	if err != nil {
+		return err
+	}
+
+	err = c.setTargetDir(ctx.String("target-dir"), ctx.Bool("preserve-structure"))
+	if err != nil {
+		return err
+	}
+
+	// an explicit backup file implies an undo operation
+	if c.UndoFile != "" {
+		c.Revert = true
+	}
 	c.PathsToFilesOrDirs = ctx.Args().Slice()
+	c.NullInput = ctx.Bool("null")
+
+	err = c.readStdinPaths()
+	if err != nil {
+		return err
+	}
+
+	c.ArchiveMode = ctx.Bool("archive")
+
+	if c.ArchiveMode && !c.Revert {
+		if len(c.PathsToFilesOrDirs) != 1 ||
+			!archive.IsArchive(c.PathsToFilesOrDirs[0]) {
+			return errInvalidArchive
+		}
+
+		if c.CSVFilename != "" || c.MapFilename != "" || c.Copy {
+			return errArchiveConflict
+		}
+	}
+
+	if c.StagedRename && (c.Copy || c.ArchiveMode) {
+		return errStagedConflict
+	}
+
+	c.UseGit = ctx.Bool("git")
+
+	if c.UseGit {
+		if c.Copy || c.ArchiveMode {
+			return errGitConflict
+		}
+
+		_, err = exec.LookPath("git")
+		if err != nil {
+			return errGitNotFound
+		}
+	}
+
+	if c.ReplayFile != "" {
+		if c.Revert || c.ArchiveMode || c.CSVFilename != "" ||
+			c.MapFilename != "" {
+			return errReplayConflict
+		}
+
+		if len(c.PathsToFilesOrDirs) > 1 {
+			return errInvalidReplay
+		}
+
+		// the operation is applied to the current directory by default
+		c.ReplayRoot = "."
+		if len(c.PathsToFilesOrDirs) == 1 {
+			c.ReplayRoot = c.PathsToFilesOrDirs[0]
+		}
+	}
+
+	// in edit mode, the targets default to the original names
+	// so that they may be modified in the editor
+	if c.Edit && len(c.FindSlice) == 0 && len(c.ReplacementSlice) == 0 &&
+		c.CSVFilename == "" && c.MapFilename == "" {
+		c.ReplacementSlice = []string{"$0"}
+	}
+
+	// the matched names are preserved when they are only affixed, routed
+	// or normalized
+	if (c.Prefix != "" || c.Suffix != "" || len(c.RouteByExt) > 0 ||
+		c.TargetDir != "" || c.NormalizeUnicode != "" || c.TargetsFile != "" ||
+		c.Trim) &&
+		len(c.ReplacementSlice) == 0 &&
+		c.CSVFilename == "" && c.MapFilename == "" {
+		c.ReplacementSlice = []string{"$0"}
+	}
 
 	// Ensure that each findString has a corresponding replacement.
 	// The replacement defaults to an empty string if unset
@@ -114,6 +907,10 @@ func (c *Config) setOptions(ctx *cli.Context) error {
 		c.ReplacementSlice = append(c.ReplacementSlice, "")
 	}
 
+	if len(c.Rules) > 0 {
+		return c.setRulesRegex()
+	}
+
 	return c.SetFindStringRegex(0)
 }
 
@@ -150,31 +947,134 @@ func (c *Config) setSimpleModeOptions(ctx *cli.Context) error {
 	return c.SetFindStringRegex(0)
 }
 
+// setCounterGroupBy parses the expression that determines the key which the
+// index numbers are grouped by. It is either `level:<n>` for the first n
+// directories of each match's path relative to its path argument, or a
+// regular expression whose capture groups (or entire match) on that path
+// make up the key.
+func (c *Config) setCounterGroupBy(value string) error {
+	c.CounterGroupBy = value
+
+	if value == "" {
+		return nil
+	}
+
+	if strings.HasPrefix(value, "level:") {
+		n, err := strconv.Atoi(strings.TrimPrefix(value, "level:"))
+		if err != nil || n < 1 {
+			return errInvalidCounterGroupBy
+		}
+
+		c.CounterGroupLevel = n
+
+		return nil
+	}
+
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return errInvalidCounterGroupBy
+	}
+
+	c.CounterGroupRegex = re
+
+	return nil
+}
+
 // setDefaultOpts applies the options that may be set through
 // F2_DEFAULT_OPTS.
-func (c *Config) setDefaultOpts(ctx *cli.Context) {
+func (c *Config) setDefaultOpts(ctx *cli.Context) error {
 	c.AutoFixConflicts = ctx.Bool("fix-conflicts")
 	c.IncludeDir = ctx.Bool("include-dir")
 	c.IncludeHidden = ctx.Bool("hidden")
+	c.IncludeOwnFiles = ctx.Bool("include-own-files")
 	c.IgnoreCase = ctx.Bool("ignore-case")
+	c.UnicodeMode = ctx.Bool("unicode")
 	c.IgnoreExt = ctx.Bool("ignore-ext")
+	c.ReattachExt = ctx.Bool("include-ext")
+	c.ExtOnly = ctx.Bool("ext-only")
+	c.StemOnly = ctx.Bool("stem-only")
+	c.PreserveExtCase = ctx.Bool("preserve-ext-case")
 	c.Recursive = ctx.Bool("recursive")
 	c.OnlyDir = ctx.Bool("only-dir")
+	c.OnlyHidden = ctx.Bool("only-hidden")
+	c.OnlyEmpty = ctx.Bool("only-empty")
+	c.OnlyNonEmpty = ctx.Bool("only-non-empty")
+	c.EmptyDirs = ctx.Bool("empty-dirs")
+	c.AllowInvalidUTF8 = ctx.Bool("allow-invalid-utf8")
 	c.StringLiteralMode = ctx.Bool("string-mode")
+	c.TemplateMode = ctx.Bool("template")
 	c.ExcludeFilter = ctx.StringSlice("exclude")
+	c.ExcludeFromFile = ctx.String("exclude-from")
+	c.IncludeFromFile = ctx.String("include-from")
+	c.ContentFirstLine = ctx.String("first-line")
+	c.ExcludeMode = ctx.String("exclude-mode")
+	c.ExcludeIgnoreCase = ctx.Bool("exclude-ignore-case")
 	c.MaxDepth = int(ctx.Uint("max-depth"))
-	c.Verbose = ctx.Bool("verbose")
+	c.MaxEntriesPerDir = int(ctx.Uint("max-entries-per-dir"))
+	c.VerboseLevel = verbosityLevel(ctx, "verbose")
+	c.Verbose = c.VerboseLevel > 0
+	c.Timings = ctx.Bool("timings")
 	c.AllowOverwrites = ctx.Bool("allow-overwrites")
+	c.AllowControlChars = ctx.Bool("allow-control-chars")
+	c.CheckPermissions = ctx.Bool("check-perms")
+	c.Checkpoint = ctx.Bool("checkpoint")
+	c.Copy = ctx.Bool("copy")
+	c.VerifyCopy = ctx.Bool("verify-copy")
+	c.Swap = ctx.Bool("swap")
+	c.StagedRename = ctx.Bool("atomic-within-dir")
+	c.Simulate = ctx.Bool("simulate")
+	c.StopOnMatch = ctx.Bool("stop-on-match")
+	c.NoBackup = ctx.Bool("no-backup")
 	c.ReplaceLimit = ctx.Int("replace-limit")
+	c.ReplaceScope = ctx.String("replace-scope")
+	c.Retries = int(ctx.Uint("retries"))
+	c.RetryDelay = ctx.Duration("retry-delay")
+	c.Seed = ctx.Int64("seed")
+	c.SeedSet = ctx.IsSet("seed")
+	c.CounterStart = ctx.Int("counter-start")
+	c.CounterStep = ctx.Int("counter-step")
+	c.CounterScope = ctx.String("counter-scope")
+	c.HardlinkGroup = ctx.String("hardlinks")
+	c.SymlinkHandling = ctx.String("symlinks")
+	c.MaxSymlinkDepth = int(ctx.Uint("dereference-count"))
+	c.OnError = ctx.String("on-error")
+	c.CleanupOnFailure = ctx.Bool("cleanup-on-failure")
+	c.NormalizeUnicode = strings.ToLower(ctx.String("normalize-unicode"))
+	c.OutputSort = ctx.String("sort-changes")
+	c.TraversalOrder = ctx.String("traversal-order")
+	c.SkipAlreadyNamed = ctx.Bool("skip-already-named")
+	c.SkipIdentical = ctx.Bool("skip-identical")
+	c.SkipEmptyTargets = ctx.Bool("skip-empty-targets")
+	c.CollapseSeparators = ctx.Bool("collapse-separators")
+	c.Trim = ctx.Bool("trim")
+	c.TrimChars = ctx.String("trim-chars")
+	c.SkipUnreadable = ctx.Bool("skip-unreadable")
+	c.RemoveBrokenLinks = ctx.Bool("remove-broken-links")
+	c.ReportBrokenLinks = ctx.Bool("report-broken-links") || c.RemoveBrokenLinks
+	c.Separators = ctx.String("separators")
 	c.Quiet = ctx.Bool("quiet")
 	c.JSON = ctx.Bool("json")
 	c.Exec = ctx.Bool("exec")
+	// the tree is not part of the JSON output and would be hidden in
+	// quiet mode anyway
+	c.TreeOutput = ctx.Bool("tree") && !c.JSON && !c.Quiet
+	c.GroupByOperation = ctx.Bool("group-by-operation")
 	c.Interactive = ctx.Bool("interactive")
 
 	if c.Interactive {
 		c.Exec = true
 	}
 
+	// the filesystem is never modified when only checking for conflicts
+	c.CheckOnly = ctx.Bool("check-only")
+	if c.CheckOnly {
+		c.Exec = false
+		c.Interactive = false
+	}
+
+	// the targets are explained in dry-run mode when `-VV` is given
+	c.Annotate = c.VerboseLevel > 1 && !c.Exec
+
 	// Sorting
 	if ctx.String("sort") != "" {
 		c.Sort = ctx.String("sort")
@@ -186,30 +1086,130 @@ func (c *Config) setDefaultOpts(ctx *cli.Context) {
 	if c.OnlyDir {
 		c.IncludeDir = true
 	}
-}
 
-func SetReplacement(replacement string) {
-	conf.Replacement = replacement
-}
+	// hidden directories are searched for hidden matches as well
+	if c.OnlyHidden {
+		c.IncludeHidden = true
+	}
 
-func SetFindStringRegex(replacementIndex int) error {
-	return conf.SetFindStringRegex(replacementIndex)
-}
+	if c.StemOnly {
+		c.IgnoreExt = true
+		c.ReattachExt = true
+	}
 
-func SetReplacementSlice(s []string) {
-	conf.ReplacementSlice = s
-}
+	if c.ExtOnly && c.IgnoreExt {
+		return errExtOnlyConflict
+	}
 
-func SetFindSlice(s []string) {
-	conf.FindSlice = s
-}
+	if c.OnlyEmpty && c.OnlyNonEmpty {
+		return errEmptyConflict
+	}
+
+	c.Plan = ctx.Bool("plan")
 
-func SetNumberOffset(offset []int) {
-	conf.NumberOffset = offset
+	err := c.setSizeBuckets(ctx.String("size-buckets"))
+	if err != nil {
+		return err
+	}
+
+	err = c.setCounterGroupBy(ctx.String("counter-group-by"))
+	if err != nil {
+		return err
+	}
+
+	// the displayed paths are made relative to an absolute base so that
+	// they don't depend on the working directory
+	if ctx.String("relative-to") != "" {
+		base, err := filepath.Abs(ctx.String("relative-to"))
+		if err != nil {
+			return err
+		}
+
+		c.DisplayRelativeTo = base
+	}
+
+	if c.Plan && (!c.JSON || c.Exec) {
+		return errInvalidPlan
+	}
+
+	if c.ExcludeMode == "" {
+		c.ExcludeMode = ExcludeModeAny
+	}
+
+	if c.ExcludeMode != ExcludeModeAny && c.ExcludeMode != ExcludeModeAll {
+		return errInvalidExcludeMode
+	}
+
+	if c.CounterScope == "" {
+		c.CounterScope = CounterScopeGlobal
+	}
+
+	if c.CounterScope != CounterScopeGlobal &&
+		c.CounterScope != CounterScopePerDir &&
+		c.CounterScope != CounterScopePerRoot {
+		return errInvalidCounterScope
+	}
+
+	if c.ReplaceScope == "" {
+		c.ReplaceScope = ReplaceScopeMatch
+	}
+
+	if c.ReplaceScope != ReplaceScopeMatch && c.ReplaceScope != ReplaceScopeName {
+		return errInvalidReplaceScope
+	}
+
+	if c.HardlinkGroup != "" &&
+		c.HardlinkGroup != HardlinkGroupFirst &&
+		c.HardlinkGroup != HardlinkGroupAll {
+		return errInvalidHardlinkGroup
+	}
+
+	if c.SymlinkHandling == "" {
+		c.SymlinkHandling = SymlinkHandlingLink
+	}
+
+	if c.SymlinkHandling != SymlinkHandlingLink &&
+		c.SymlinkHandling != SymlinkHandlingTarget &&
+		c.SymlinkHandling != SymlinkHandlingSkip {
+		return errInvalidSymlinkHandling
+	}
+
+	if c.TraversalOrder == "" {
+		c.TraversalOrder = TraversalOrderBFS
+	}
+
+	if c.TraversalOrder != TraversalOrderBFS &&
+		c.TraversalOrder != TraversalOrderDFS {
+		return errInvalidTraversalOrder
+	}
+
+	if c.OutputSort != "" &&
+		c.OutputSort != OutputSortSource &&
+		c.OutputSort != OutputSortTarget &&
+		c.OutputSort != OutputSortDir {
+		return errInvalidOutputSort
+	}
+
+	if c.OnError == "" {
+		c.OnError = OnErrorContinue
+	}
+
+	if c.OnError != OnErrorContinue && c.OnError != OnErrorAbort {
+		return errInvalidOnError
+	}
+
+	if c.NormalizeUnicode != "" && c.NormalizeUnicode != NormalizeNFC &&
+		c.NormalizeUnicode != NormalizeNFD {
+		return errInvalidNormalization
+	}
+
+	return nil
 }
 
-// Get retrives an already set config or panics if the configuration
-// has not yet been initialized.
+// Get retrives the config that was last set through Init or panics if the
+// configuration has not yet been initialized. It is retained for the CLI
+// only since the packages that carry out the renaming operation receive
+// their config explicitly.
 func Get() *Config {
 	if conf == nil {
 		panic("config has not been initialized")
@@ -218,6 +1218,20 @@ func Get() *Config {
 	return conf
 }
 
+// RecordTiming records the time elapsed since the start of the stage in
+// timings mode. Nothing is recorded otherwise.
+func (c *Config) RecordTiming(stage string, start time.Time, entries int) {
+	if !c.Timings {
+		return
+	}
+
+	c.StageTimings = append(c.StageTimings, Timing{
+		Stage:    stage,
+		Duration: time.Since(start),
+		Entries:  entries,
+	})
+}
+
 func Init(ctx *cli.Context) (*Config, error) {
 	conf = &Config{
 		Stdout: os.Stdout,
@@ -244,7 +1258,10 @@ func Init(ctx *cli.Context) (*Config, error) {
 
 	var err error
 
-	conf.setDefaultOpts(ctx)
+	err = conf.setDefaultOpts(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	if _, ok := ctx.App.Metadata["simple-mode"]; ok {
 		err = conf.setSimpleModeOptions(ctx)
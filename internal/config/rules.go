@@ -0,0 +1,109 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	errRulesLengthMismatch = errors.New(
+		"Invalid argument: the rules file contains %d %s but %d find patterns. Each rule must have a value in every list",
+	)
+
+	errEmptyRules = errors.New(
+		"Invalid argument: the rules file does not contain any find patterns",
+	)
+
+	errRulesConflict = errors.New(
+		"Invalid argument: `--rules` cannot be combined with `-f/--find`, `-r/--replace`, `--find-from`, `--csv` or `--map`",
+	)
+)
+
+// Rule is a find and replace pair loaded from a rules file along with the
+// options that apply to that pair alone.
+type Rule struct {
+	Find        string
+	Replacement string
+	IgnoreCase  bool
+	StringMode  bool
+}
+
+// rulesFile is the structure of a rules file. The rules are described by
+// parallel lists where each index corresponds to a single rule. The lists of
+// options may be omitted.
+type rulesFile struct {
+	Find       []string `json:"find"        yaml:"find"`
+	Replace    []string `json:"replace"     yaml:"replace"`
+	IgnoreCase []bool   `json:"ignore_case" yaml:"ignore_case"`
+	StringMode []bool   `json:"string_mode" yaml:"string_mode"`
+}
+
+// readRules loads the rules in the specified JSON or YAML file. YAML is
+// assumed for files with the `.yaml` or `.yml` extension.
+func readRules(path string) ([]Rule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f rulesFile
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &f)
+	default:
+		err = json.Unmarshal(b, &f)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if len(f.Find) == 0 {
+		return nil, errEmptyRules
+	}
+
+	lengths := []struct {
+		name     string
+		n        int
+		optional bool
+	}{
+		{"replacements", len(f.Replace), false},
+		{"ignore_case values", len(f.IgnoreCase), true},
+		{"string_mode values", len(f.StringMode), true},
+	}
+
+	for _, v := range lengths {
+		if v.n != len(f.Find) && (v.n != 0 || !v.optional) {
+			return nil, fmt.Errorf(
+				errRulesLengthMismatch.Error(),
+				v.n,
+				v.name,
+				len(f.Find),
+			)
+		}
+	}
+
+	rules := make([]Rule, len(f.Find))
+
+	for i, find := range f.Find {
+		rules[i].Find = find
+		rules[i].Replacement = f.Replace[i]
+
+		if len(f.IgnoreCase) > 0 {
+			rules[i].IgnoreCase = f.IgnoreCase[i]
+		}
+
+		if len(f.StringMode) > 0 {
+			rules[i].StringMode = f.StringMode[i]
+		}
+	}
+
+	return rules, nil
+}
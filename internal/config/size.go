@@ -0,0 +1,105 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var errInvalidSizeBuckets = errors.New(
+	"Invalid argument: `--size-buckets` must be set to two increasing sizes such as '1MB,100MB'",
+)
+
+// sizeUnits are the multipliers of the units accepted by parseSize.
+var sizeUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize parses a size such as `512`, `10KB` or `1.5GB` into a number of
+// bytes. The units are case-insensitive and based on powers of 1024 so that
+// they agree with the output of the {size.human} variable.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+
+	multiplier := 1.0
+
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.multiplier
+
+			break
+		}
+	}
+
+	bitSize := 64
+
+	n, err := strconv.ParseFloat(s, bitSize)
+	if err != nil || n < 0 {
+		return 0, errInvalidSizeBuckets
+	}
+
+	return int64(n * multiplier), nil
+}
+
+// HumanSize formats the size in bytes with the largest unit (based on powers
+// of 1024) that keeps the value at or above 1, such as `1.2MB`.
+func HumanSize(size int64) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	units := "KMGTPE"
+
+	value := float64(size) / unit
+
+	i := 0
+	for value >= unit && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+
+	bitSize := 64
+
+	formatted := strconv.FormatFloat(value, 'f', 1, bitSize)
+
+	return strings.TrimSuffix(formatted, ".0") + string(units[i]) + "B"
+}
+
+// setSizeBuckets parses the `small,large` thresholds of the --size-buckets
+// flag. Files smaller than the first threshold are small, files smaller than
+// the second one are medium, and the rest are large.
+func (c *Config) setSizeBuckets(value string) error {
+	small, large, found := strings.Cut(value, ",")
+	if !found {
+		return errInvalidSizeBuckets
+	}
+
+	smallLimit, err := parseSize(small)
+	if err != nil {
+		return err
+	}
+
+	largeLimit, err := parseSize(large)
+	if err != nil {
+		return err
+	}
+
+	if smallLimit >= largeLimit {
+		return errInvalidSizeBuckets
+	}
+
+	c.SizeBuckets = []int64{smallLimit, largeLimit}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+)
+
+var (
+	errEmptyTargets = errors.New(
+		"Invalid argument: the targets file does not contain any names",
+	)
+
+	errTargetsConflict = errors.New(
+		"Invalid argument: `--targets-file` cannot be combined with `-r/--replace`, `--csv`, `--map` or `--rules`",
+	)
+
+	errPartialWithoutTargets = errors.New(
+		"Invalid argument: `--partial` can only be used with `--targets-file`",
+	)
+)
+
+// readTargets loads the target names listed in the specified file, one per
+// line. Blank lines are ignored.
+func readTargets(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var targets []string
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		targets = append(targets, line)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(targets) == 0 {
+		return nil, errEmptyTargets
+	}
+
+	return targets, nil
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"flag"
+	"strconv"
+
+	"github.com/urfave/cli/v2"
+)
+
+// verbosity is a boolean flag value that counts how many times it was given
+// so that `-VV` can ask for more output than `-V`.
+type verbosity int
+
+// Set increments the level each time the flag is given. An explicit number
+// replaces the level so that the value can be copied to the other names of
+// the flag or set from the default options.
+func (v *verbosity) Set(s string) error {
+	if n, err := strconv.Atoi(s); err == nil {
+		*v = verbosity(n)
+
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+
+	if b {
+		*v++
+	} else {
+		*v = 0
+	}
+
+	return nil
+}
+
+func (v *verbosity) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+func (v *verbosity) Get() interface{} {
+	return int(*v)
+}
+
+// IsBoolFlag allows the flag to be given without a value.
+func (v *verbosity) IsBoolFlag() bool {
+	return true
+}
+
+// VerbosityFlag is a boolean flag that may be repeated to raise the
+// verbosity level.
+type VerbosityFlag struct {
+	*cli.BoolFlag
+}
+
+// Apply registers a fresh counter under each name of the flag.
+func (f *VerbosityFlag) Apply(set *flag.FlagSet) error {
+	v := new(verbosity)
+
+	for _, name := range f.Names() {
+		set.Var(v, name, f.Usage)
+	}
+
+	return nil
+}
+
+// verbosityLevel returns how many times the named flag was given.
+func verbosityLevel(ctx *cli.Context, name string) int {
+	if v, ok := ctx.Value(name).(int); ok {
+		return v
+	}
+
+	return 0
+}
@@ -3,15 +3,21 @@ package conflict
 // Name refers to a specific conflict.
 type Name string
 
+// Type classifies a conflict according to how it affects the renaming
+// operation. Several conflicts may share the same type.
+type Type string
+
 type (
 	// Collection represents all conflicts detected during a renaming operation.
 	Collection map[Name][]Conflict
 
 	// Conflict represents a single renaming operation conflict.
 	Conflict struct {
-		Target  string   `json:"target"`
-		Cause   string   `json:"cause"`
-		Sources []string `json:"sources"`
+		Target     string   `json:"target"`
+		Cause      string   `json:"cause"`
+		Type       Type     `json:"type"`
+		Suggestion string   `json:"suggestion"`
+		Sources    []string `json:"sources"`
 	}
 )
 
@@ -22,4 +28,92 @@ const (
 	MaxFilenameLengthExceeded Name = "maxFilenameLengthExceeded"
 	InvalidCharacters         Name = "invalidCharacters"
 	TrailingPeriod            Name = "trailingPeriod"
+	PermissionDenied          Name = "permissionDenied"
+	CaseCollision             Name = "caseCollision"
+	SourceNotFound            Name = "sourceNotFound"
+	ControlCharacters         Name = "controlCharacters"
+)
+
+const (
+	// TypeOverwrite indicates that the target already exists.
+	TypeOverwrite Type = "overwrite"
+	// TypeDuplicateTarget indicates that several sources share the same target.
+	TypeDuplicateTarget Type = "duplicate-target"
+	// TypeIllegalChar indicates that the target is not a valid name on the
+	// current operating system.
+	TypeIllegalChar Type = "illegal-char"
+	// TypeCaseCollision indicates that several targets differ only in letter
+	// case which is not allowed on case-insensitive filesystems.
+	TypeCaseCollision Type = "case-collision"
+	// TypeEmptyTarget indicates that the target is empty.
+	TypeEmptyTarget Type = "empty-target"
+	// TypeNameTooLong indicates that the target exceeds the maximum length.
+	TypeNameTooLong Type = "name-too-long"
+	// TypePermission indicates that a path cannot be modified by the current
+	// user.
+	TypePermission Type = "permission-denied"
+	// TypeMissingSource indicates that the source no longer exists, such as
+	// when it was moved or deleted after the operation was planned.
+	TypeMissingSource Type = "missing-source"
 )
+
+// classification holds the type and suggested resolution for each conflict.
+var classification = map[Name]struct {
+	typ        Type
+	suggestion string
+}{
+	EmptyFilename: {
+		TypeEmptyTarget,
+		"Change the replacement so that it produces a non-empty name, or use -F/--fix-conflicts to leave the file unchanged",
+	},
+	FileExists: {
+		TypeOverwrite,
+		"Use --allow-overwrites to replace the existing path, or -F/--fix-conflicts to append a number to the target",
+	},
+	OverwritingNewPath: {
+		TypeDuplicateTarget,
+		"Include a unique variable such as {%03d} in the replacement, or use -F/--fix-conflicts to append a number to the duplicate targets",
+	},
+	MaxFilenameLengthExceeded: {
+		TypeNameTooLong,
+		"Shorten the replacement, or use -F/--fix-conflicts to truncate the name",
+	},
+	InvalidCharacters: {
+		TypeIllegalChar,
+		"Remove the invalid characters from the replacement, or use -F/--fix-conflicts to strip them",
+	},
+	TrailingPeriod: {
+		TypeIllegalChar,
+		"Remove the trailing periods from the replacement, or use -F/--fix-conflicts to strip them",
+	},
+	PermissionDenied: {
+		TypePermission,
+		"Ensure that the affected directory is writable by the current user",
+	},
+	CaseCollision: {
+		TypeCaseCollision,
+		"Make the targets differ by more than letter case, or use -F/--fix-conflicts to append a number to the colliding targets",
+	},
+	ControlCharacters: {
+		TypeIllegalChar,
+		"Remove the control characters from the replacement, use --allow-control-chars to keep them, or -F/--fix-conflicts to strip them",
+	},
+	SourceNotFound: {
+		TypeMissingSource,
+		"Search for the matches again since the source was moved or deleted after the operation was planned, or use -F/--fix-conflicts to skip it",
+	},
+}
+
+// New creates a conflict of the specified kind that is classified with its
+// type and suggested resolution.
+func New(name Name, sources []string, target, cause string) Conflict {
+	c := classification[name]
+
+	return Conflict{
+		Sources:    sources,
+		Target:     target,
+		Cause:      cause,
+		Type:       c.typ,
+		Suggestion: c.suggestion,
+	}
+}
@@ -1,17 +1,106 @@
 package file
 
-import "github.com/ayoisaiah/f2/internal/status"
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ayoisaiah/f2/internal/status"
+)
 
 // Change represents a single renaming change.
 type Change struct {
+	ModTime        time.Time     `json:"-"`
 	OriginalSource string        `json:"-"`
 	Status         status.Status `json:"status"`
 	BaseDir        string        `json:"base_dir"`
+	Root           string        `json:"-"` // path argument the match was found in
 	Source         string        `json:"source"`
 	Target         string        `json:"target"`
 	Error          error         `json:"error,omitempty"`
 	CSVRow         []string      `json:"-"`
+	CreatedDirs    []string      `json:"created_dirs,omitempty"` // relative to BaseDir, deepest first
+	HardlinkID     string        `json:"-"`                      // shared by the hard links to the same file
+	Stages         []string      `json:"stages,omitempty"`       // target after each replacement in verbose mode
+	Annotations    []string      `json:"annotations,omitempty"`  // how each find pattern applies in annotate mode
+	Links          []string      `json:"links,omitempty"`        // symlinks updated to point to the target
+	Size           int64         `json:"-"`                      // size of the source when it was found
 	Index          int           `json:"-"`
+	GlobalIndex    int           `json:"-"` // position in the sorted batch before grouping
+	CounterIndex   int           `json:"-"` // position used by index variables
 	IsDir          bool          `json:"is_dir"`
 	WillOverwrite  bool          `json:"will_overwrite"`
+	Verified       bool          `json:"verified,omitempty"`
+}
+
+// HasEmptyTarget reports whether the name of the target is empty or made up of
+// whitespace alone, such as when every part of a template resolves to an empty
+// string.
+func (c *Change) HasEmptyTarget() bool {
+	if c.Target == "" || c.Target == "." {
+		return true
+	}
+
+	last := c.Target[len(c.Target)-1]
+	if last == '/' || last == filepath.Separator {
+		return true
+	}
+
+	return strings.TrimSpace(filepath.Base(c.Target)) == ""
+}
+
+// Operation is the kind of operation that a change performs.
+type Operation string
+
+const (
+	// OperationRename renames the source within its directory.
+	OperationRename Operation = "rename"
+	// OperationCaseChange changes the letter case of the source alone.
+	OperationCaseChange Operation = "case change"
+	// OperationRelocation moves the source to an existing directory.
+	OperationRelocation Operation = "relocation"
+	// OperationDirCreation moves the source to a directory that does not
+	// exist yet and is created for it.
+	OperationDirCreation Operation = "directory creation"
+	// OperationNone leaves the source as it is.
+	OperationNone Operation = "none"
+)
+
+// Operation classifies the change according to how the target differs from
+// the source. The dirExists function reports whether the specified directory
+// exists so that relocations into new directories can be told apart.
+func (c *Change) Operation(dirExists func(dir string) bool) Operation {
+	source := filepath.Clean(c.Source)
+	target := filepath.Clean(c.Target)
+
+	switch {
+	case source == target:
+		return OperationNone
+	case filepath.Dir(source) != filepath.Dir(target):
+		if len(c.CreatedDirs) > 0 ||
+			!dirExists(filepath.Join(c.BaseDir, filepath.Dir(target))) {
+			return OperationDirCreation
+		}
+
+		return OperationRelocation
+	case strings.EqualFold(source, target):
+		return OperationCaseChange
+	default:
+		return OperationRename
+	}
+}
+
+// RemovedLink represents a broken symlink that was removed along with the
+// renaming operation. Its target is recorded so that the link can be
+// recreated when the operation is undone.
+type RemovedLink struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+}
+
+// SkippedPath represents a path that could not be read while searching for
+// matches.
+type SkippedPath struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
 }
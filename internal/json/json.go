@@ -7,7 +7,7 @@ import (
 	"github.com/ayoisaiah/f2/internal/config"
 	"github.com/ayoisaiah/f2/internal/conflict"
 	"github.com/ayoisaiah/f2/internal/file"
-	"github.com/ayoisaiah/f2/validate"
+	internalpath "github.com/ayoisaiah/f2/internal/path"
 )
 
 // Output represents the structure of the output produced by the
@@ -15,9 +15,41 @@ import (
 type Output struct {
 	Conflicts  conflict.Collection `json:"conflicts,omitempty"`
 	WorkingDir string              `json:"working_dir"`
-	Date       string              `json:"date"`
-	Changes    []*file.Change      `json:"changes"`
-	DryRun     bool                `json:"dry_run"`
+	// Archive is the zip or tar archive whose entries were renamed (if any), and
+	// ArchiveBackup is the copy of the archive made before it was renamed
+	Archive       string             `json:"archive,omitempty"`
+	ArchiveBackup string             `json:"archive_backup,omitempty"`
+	Date          string             `json:"date"`
+	Changes       []*file.Change     `json:"changes"`
+	Skipped       []file.SkippedPath `json:"skipped,omitempty"`
+	Warnings      []string           `json:"warnings,omitempty"`
+	DryRun        bool               `json:"dry_run"`
+	// Overwrites contains the paths to the existing files that are
+	// overwritten by the changes
+	Overwrites []string `json:"overwrites,omitempty"`
+	// BrokenLinks contains the paths to the symlinks whose targets do not
+	// exist in --report-broken-links mode
+	BrokenLinks []string `json:"broken_links,omitempty"`
+	// RemovedLinks contains the broken symlinks that were removed in
+	// --remove-broken-links mode
+	RemovedLinks []file.RemovedLink `json:"removed_links,omitempty"`
+	// DiskSpace compares the space required by the copies on each
+	// destination filesystem with the space available on it in copy mode
+	DiskSpace []config.DiskSpace `json:"disk_space,omitempty"`
+	// CreatedDirCount is the number of directories that were created for
+	// the targets in execute mode
+	CreatedDirCount int `json:"created_dir_count,omitempty"`
+	// Copy indicates that the sources were copied to their targets instead
+	// of being renamed
+	Copy bool `json:"copy,omitempty"`
+	// Git indicates that the tracked sources were renamed through `git mv`
+	Git bool `json:"git,omitempty"`
+	// EscapedNames indicates that the bytes in the sources and targets
+	// which are not valid UTF-8 are escaped (see --allow-invalid-utf8)
+	EscapedNames bool `json:"escaped_names,omitempty"`
+	// Timings records the duration of each stage of the operation in
+	// timings mode
+	Timings map[string]config.Timing `json:"timings,omitempty"`
 }
 
 type OutputOpts struct {
@@ -27,17 +59,49 @@ type OutputOpts struct {
 	Print      bool // whether to print the JSON output
 }
 
-func GetOutput(
+// NewOutput creates the output for the changes along with the conflicts and
+// skipped paths recorded in the specified configuration.
+func NewOutput(
+	conf *config.Config,
 	changes []*file.Change,
-) ([]byte, error) {
-	conf := config.Get()
-
+) *Output {
 	out := Output{
 		WorkingDir: conf.WorkingDir,
 		Date:       conf.Date.Format(time.RFC3339),
 		DryRun:     !conf.Exec,
+		Copy:       conf.Copy,
+		Git:        conf.UseGit,
 		Changes:    changes,
-		Conflicts:  validate.GetConflicts(),
+		Conflicts:  conf.Conflicts,
+		Skipped:    conf.SkippedPaths,
+		Warnings:   conf.Warnings,
+		Overwrites: conf.Overwrites,
+
+		BrokenLinks:  conf.BrokenLinks,
+		RemovedLinks: conf.RemovedLinks,
+		DiskSpace:    conf.DiskSpace,
+
+		CreatedDirCount: conf.CreatedDirs,
+	}
+
+	if conf.Timings {
+		out.Timings = make(map[string]config.Timing, len(conf.StageTimings))
+
+		for _, t := range conf.StageTimings {
+			out.Timings[t.Stage] = t
+		}
+	}
+
+	if conf.Archive != nil {
+		out.Archive = conf.Archive.Path
+		out.ArchiveBackup = conf.Archive.Backup
+	}
+
+	// JSON strings cannot hold arbitrary bytes so invalid names are
+	// escaped to keep them from being replaced with U+FFFD
+	if conf.AllowInvalidUTF8 {
+		out.Changes = escapeChanges(changes)
+		out.EscapedNames = true
 	}
 
 	// prevent empty matches from being encoded as `null`
@@ -45,10 +109,109 @@ func GetOutput(
 		out.Changes = make([]*file.Change, 0)
 	}
 
-	b, err := json.MarshalIndent(out, "", "    ")
-	if err != nil {
-		return b, err
+	return &out
+}
+
+// Encode encodes the output in the indented format used for the `--json`
+// flag and backup files.
+func Encode(out *Output) ([]byte, error) {
+	return json.MarshalIndent(out, "", "    ")
+}
+
+// GetOutput encodes the changes along with the conflicts and skipped paths
+// recorded in the specified configuration.
+func GetOutput(
+	conf *config.Config,
+	changes []*file.Change,
+) ([]byte, error) {
+	return Encode(NewOutput(conf, changes))
+}
+
+// RelativeTo returns a copy of the output in which the paths to the changes,
+// conflicts and overwritten files are relative to the base directory. The
+// original output is left untouched since the changes are still committed with
+// their absolute paths.
+func RelativeTo(out *Output, base string) *Output {
+	if base == "" {
+		return out
+	}
+
+	rel := *out
+
+	rel.Changes = make([]*file.Change, len(out.Changes))
+
+	for i := range out.Changes {
+		ch := *out.Changes[i]
+		ch.BaseDir = internalpath.RelativeTo(base, ch.BaseDir)
+		rel.Changes[i] = &ch
+	}
+
+	if out.Conflicts != nil {
+		rel.Conflicts = make(conflict.Collection, len(out.Conflicts))
+
+		for name, conflicts := range out.Conflicts {
+			relConflicts := make([]conflict.Conflict, len(conflicts))
+
+			for i, c := range conflicts {
+				c.Target = internalpath.RelativeTo(base, c.Target)
+				c.Sources = make([]string, len(conflicts[i].Sources))
+
+				for j, s := range conflicts[i].Sources {
+					c.Sources[j] = internalpath.RelativeTo(base, s)
+				}
+
+				relConflicts[i] = c
+			}
+
+			rel.Conflicts[name] = relConflicts
+		}
+	}
+
+	rel.Overwrites = relativePaths(out.Overwrites, base)
+	rel.BrokenLinks = relativePaths(out.BrokenLinks, base)
+
+	if out.DiskSpace != nil {
+		rel.DiskSpace = make([]config.DiskSpace, len(out.DiskSpace))
+
+		for i, d := range out.DiskSpace {
+			d.Dir = internalpath.RelativeTo(base, d.Dir)
+			rel.DiskSpace[i] = d
+		}
+	}
+
+	return &rel
+}
+
+// relativePaths returns a copy of the paths relative to the base directory.
+func relativePaths(paths []string, base string) []string {
+	if paths == nil {
+		return nil
+	}
+
+	rel := make([]string, len(paths))
+
+	for i, path := range paths {
+		rel[i] = internalpath.RelativeTo(base, path)
+	}
+
+	return rel
+}
+
+// escapeChanges returns a copy of the changes in which the sources and targets
+// that are not valid UTF-8 are escaped.
+func escapeChanges(changes []*file.Change) []*file.Change {
+	if changes == nil {
+		return nil
+	}
+
+	escaped := make([]*file.Change, len(changes))
+
+	for i := range changes {
+		ch := *changes[i]
+		ch.Source = internalpath.EscapeInvalidUTF8(ch.Source)
+		ch.Target = internalpath.EscapeInvalidUTF8(ch.Target)
+		escaped[i] = &ch
 	}
 
-	return b, nil
+	return escaped
 }
@@ -0,0 +1,108 @@
+// Package ledger records the paths produced by previous renaming operations
+// so that they are not matched again when the same operation is repeated
+package ledger
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/adrg/xdg"
+)
+
+// Ledger is the set of absolute paths that have already been processed.
+type Ledger struct {
+	paths map[string]bool
+	path  string
+}
+
+// location returns the path to the ledger file in the data directory.
+func location() (string, error) {
+	return xdg.DataFile(filepath.Join("f2", "ledger.json"))
+}
+
+// Load reads the ledger from the data directory. An empty ledger is returned
+// if it does not exist yet.
+func Load() (*Ledger, error) {
+	path, err := location()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Ledger{
+		paths: make(map[string]bool),
+		path:  path,
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+
+	err = json.Unmarshal(b, &paths)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range paths {
+		l.paths[p] = true
+	}
+
+	return l, nil
+}
+
+// Contains reports whether the absolute path has been processed.
+func (l *Ledger) Contains(path string) bool {
+	return l.paths[path]
+}
+
+// Add records the absolute path as processed.
+func (l *Ledger) Add(path string) {
+	l.paths[path] = true
+}
+
+// Remove forgets the absolute path so that it can be matched again.
+func (l *Ledger) Remove(path string) {
+	delete(l.paths, path)
+}
+
+// Save writes the ledger to the data directory.
+func (l *Ledger) Save() error {
+	paths := make([]string, 0, len(l.paths))
+	for p := range l.paths {
+		paths = append(paths, p)
+	}
+
+	sort.Strings(paths)
+
+	b, err := json.MarshalIndent(paths, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(l.path, b, 0o600)
+}
+
+// Clear removes the ledger from the data directory.
+func Clear() error {
+	path, err := location()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package os
+
+import "syscall"
+
+// FreeSpace returns the number of bytes that are available to the current
+// user on the filesystem that contains the specified path.
+func FreeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+
+	//nolint:unconvert // the types of the fields differ across platforms
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+// DeviceID returns an identifier for the filesystem that contains the
+// specified path.
+func DeviceID(path string) (uint64, error) {
+	_, dev, err := inode(path)
+
+	return dev, err
+}
@@ -0,0 +1,32 @@
+//go:build windows
+// +build windows
+
+package os
+
+import "golang.org/x/sys/windows"
+
+// FreeSpace returns the number of bytes that are available to the current
+// user on the volume that contains the specified path.
+func FreeSpace(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var available uint64
+
+	err = windows.GetDiskFreeSpaceEx(p, &available, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return available, nil
+}
+
+// DeviceID returns the serial number of the volume that contains the
+// specified path.
+func DeviceID(path string) (uint64, error) {
+	_, volume, err := fileIndex(path)
+
+	return uint64(volume), err
+}
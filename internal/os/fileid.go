@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package os
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// FileID returns an identifier that is shared by all the hard links to the
+// file at the specified path. It is made up of the device and inode numbers
+// of the file. Symbolic links are not followed.
+func FileID(path string) (string, error) {
+	ino, dev, err := inode(path)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d:%d", dev, ino), nil
+}
+
+// Inode returns the inode number of the file at the specified path.
+func Inode(path string) (uint64, error) {
+	ino, _, err := inode(path)
+
+	return ino, err
+}
+
+func inode(path string) (ino, dev uint64, err error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, errFileIDUnavailable
+	}
+
+	//nolint:unconvert // the types of the fields differ across platforms
+	return uint64(stat.Ino), uint64(stat.Dev), nil
+}
@@ -0,0 +1,64 @@
+//go:build windows
+// +build windows
+
+package os
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// FileID returns an identifier that is shared by all the hard links to the
+// file at the specified path. It is made up of the serial number of the
+// volume and the file index reported by the filesystem.
+func FileID(path string) (string, error) {
+	index, volume, err := fileIndex(path)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d:%d", volume, index), nil
+}
+
+// Inode returns the file index of the file at the specified path which is
+// the closest equivalent of an inode number on Windows.
+func Inode(path string) (uint64, error) {
+	index, _, err := fileIndex(path)
+
+	return index, err
+}
+
+func fileIndex(path string) (index uint64, volume uint32, err error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// FILE_FLAG_BACKUP_SEMANTICS is required to open directories
+	h, err := windows.CreateFile(
+		p,
+		0,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil,
+		windows.OPEN_EXISTING,
+		windows.FILE_FLAG_BACKUP_SEMANTICS|windows.FILE_FLAG_OPEN_REPARSE_POINT,
+		0,
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer windows.CloseHandle(h) //nolint:errcheck // read-only handle
+
+	var info windows.ByHandleFileInformation
+
+	err = windows.GetFileInformationByHandle(h, &info)
+	if err != nil {
+		return 0, 0, errFileIDUnavailable
+	}
+
+	index = uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow)
+
+	return index, info.VolumeSerialNumber, nil
+}
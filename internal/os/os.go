@@ -1,9 +1,14 @@
 package os
 
 import (
+	"errors"
 	"regexp"
 )
 
+var errFileIDUnavailable = errors.New(
+	"the file ID is not available on this filesystem",
+)
+
 var (
 	// PartialWindowsForbiddenCharRegex is used to match the strings that contain forbidden
 	// characters in Windows' file names. This does not include also forbidden
@@ -0,0 +1,92 @@
+package os
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var errSymlinkLoop = errors.New("too many levels of symbolic links")
+
+var errSymlinkDepth = errors.New(
+	"the chain of symbolic links is longer than the limit of %d",
+)
+
+// ResolveLink follows the chain of symlinks that starts at the specified path
+// through os.Readlink and returns the absolute path to the file at the end of
+// the chain along with the absolute path to the last link in the chain (the
+// one that points to the file directly). Relative links are resolved against
+// the directory of the link. If maxDepth is positive, chains with more links
+// than maxDepth are not resolved.
+func ResolveLink(path string, maxDepth int) (target, lastLink string, err error) {
+	target, err = filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	seen := make(map[string]bool)
+
+	for {
+		info, err := os.Lstat(target)
+		if err != nil {
+			return "", "", err
+		}
+
+		if info.Mode()&fs.ModeSymlink == 0 {
+			return target, lastLink, nil
+		}
+
+		if seen[target] {
+			return "", "", &fs.PathError{Op: "readlink", Path: path, Err: errSymlinkLoop}
+		}
+
+		if maxDepth > 0 && len(seen) == maxDepth {
+			return "", "", &fs.PathError{
+				Op:   "readlink",
+				Path: path,
+				Err:  fmt.Errorf(errSymlinkDepth.Error(), maxDepth),
+			}
+		}
+
+		seen[target] = true
+
+		link, err := os.Readlink(target)
+		if err != nil {
+			return "", "", err
+		}
+
+		lastLink = target
+
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(target), link)
+		}
+
+		target = filepath.Clean(link)
+	}
+}
+
+// Relink updates the symlink at the specified path to point to the target.
+// The link keeps pointing to the target through a relative path if it
+// previously did so.
+func Relink(link, target string) error {
+	old, err := os.Readlink(link)
+	if err != nil {
+		return err
+	}
+
+	if !filepath.IsAbs(old) {
+		target, err = filepath.Rel(filepath.Dir(link), target)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Remove(link)
+	if err != nil {
+		return err
+	}
+
+	return os.Symlink(target, link)
+}
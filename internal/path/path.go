@@ -1,9 +1,13 @@
 package path
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	internalos "github.com/ayoisaiah/f2/internal/os"
 )
@@ -12,6 +16,17 @@ import (
 // contents.
 type Collection map[string][]os.DirEntry
 
+// Len returns the number of entries in the collection.
+func (c Collection) Len() int {
+	var n int
+
+	for _, entries := range c {
+		n += len(entries)
+	}
+
+	return n
+}
+
 // Separator represents the filepath separator.
 var Separator = "/"
 
@@ -21,8 +36,125 @@ func init() {
 	}
 }
 
+// escapeBase is the start of the private use range that the invalid bytes in a
+// file name are mapped to. Only bytes from 0x80 to 0xff can be invalid so the
+// escaped runes fall within U+10FE80 to U+10FEFF.
+const escapeBase = 0x10fe00
+
+// EscapeInvalidUTF8 maps each byte of the input that is not part of a valid
+// UTF-8 sequence to a rune in a private use range so that the name can be
+// matched, transformed and encoded as JSON without losing the original bytes.
+// The result can be reverted through UnescapeInvalidUTF8.
+func EscapeInvalidUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b.WriteRune(rune(escapeBase + int(s[i])))
+		} else {
+			b.WriteString(s[i : i+size])
+		}
+
+		i += size
+	}
+
+	return b.String()
+}
+
+// UnescapeInvalidUTF8 restores the bytes that were escaped by
+// EscapeInvalidUTF8. Any other content, including invalid bytes, is left
+// as is.
+func UnescapeInvalidUTF8(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r >= escapeBase+0x80 && r <= escapeBase+0xff {
+			b.WriteByte(byte(r - escapeBase))
+		} else {
+			b.WriteString(s[i : i+size])
+		}
+
+		i += size
+	}
+
+	return b.String()
+}
+
+// EscapeControl returns the visible escape sequence for a control character
+// such as `\n` or `\x1b`.
+func EscapeControl(r rune) string {
+	switch r {
+	case '\n':
+		return `\n`
+	case '\t':
+		return `\t`
+	case '\r':
+		return `\r`
+	}
+
+	if r <= 0xff {
+		return fmt.Sprintf(`\x%02x`, r)
+	}
+
+	return fmt.Sprintf(`\u%04x`, r)
+}
+
+// EscapeControlChars replaces each control character in the name with its
+// visible escape sequence so that it can be displayed on a single line.
+func EscapeControlChars(s string) string {
+	if strings.IndexFunc(s, unicode.IsControl) == -1 {
+		return s
+	}
+
+	var b strings.Builder
+
+	for _, r := range s {
+		if unicode.IsControl(r) {
+			b.WriteString(EscapeControl(r))
+			continue
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// Extension returns the extension of the input file name without
+// the leading dot.
+func Extension(fileName string) string {
+	return strings.TrimPrefix(filepath.Ext(fileName), ".")
+}
+
 // FilenameWithoutExtension returns the input file name
 // without its extension.
 func FilenameWithoutExtension(fileName string) string {
 	return fileName[:len(fileName)-len(filepath.Ext(fileName))]
 }
+
+// RelativeTo returns the path relative to the base directory. The path is
+// returned unchanged if the base is empty or if it cannot be made relative to
+// the base (such as when they are on different volumes).
+func RelativeTo(base, path string) string {
+	if base == "" || path == "" {
+		return path
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	rel, err := filepath.Rel(base, abs)
+	if err != nil {
+		return path
+	}
+
+	return rel
+}
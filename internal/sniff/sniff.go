@@ -0,0 +1,131 @@
+// Package sniff inspects the first few bytes of a file to determine its
+// format without reading the entire file
+package sniff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is the maximum number of bytes read from a file. It matches the
+// amount of data considered by http.DetectContentType.
+const sniffLen = 512
+
+// head returns up to the first sniffLen bytes of the file at path in fsys, or
+// on the real filesystem if fsys is nil.
+func head(fsys fs.FS, path string) ([]byte, error) {
+	var (
+		f   io.ReadCloser
+		err error
+	)
+
+	if fsys != nil {
+		f, err = fsys.Open(path)
+	} else {
+		f, err = os.Open(path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	b := make([]byte, sniffLen)
+
+	n, err := io.ReadFull(f, b)
+	if err != nil && !errors.Is(err, io.EOF) &&
+		!errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+
+	return b[:n], nil
+}
+
+// firstLine returns the bytes preceding the first line break.
+func firstLine(b []byte) string {
+	if i := bytes.IndexByte(b, '\n'); i != -1 {
+		b = b[:i]
+	}
+
+	return strings.TrimRight(string(b), "\r")
+}
+
+// FirstLine returns the first line of the file at path in fsys, or on the real
+// filesystem if fsys is nil. Only the first 512 bytes of the file are read so
+// the line may be truncated.
+func FirstLine(fsys fs.FS, path string) (string, error) {
+	b, err := head(fsys, path)
+	if err != nil {
+		return "", err
+	}
+
+	return firstLine(b), nil
+}
+
+// interpreter returns the name of the program specified in a shebang line
+// such as `#!/bin/bash` or `#!/usr/bin/env python3`.
+func interpreter(line string) string {
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	name := filepath.Base(fields[0])
+
+	if name == "env" {
+		for _, field := range fields[1:] {
+			// skip options such as `env -S`
+			if !strings.HasPrefix(field, "-") {
+				return filepath.Base(field)
+			}
+		}
+	}
+
+	return name
+}
+
+// Type returns a short name that describes the contents of the file at path.
+// Scripts are described by the interpreter in their shebang line, while
+// other files are described by their detected format (e.g. `png` or `pdf`).
+// Text files that cannot be classified further are reported as `text` and
+// anything else as `binary`.
+func Type(path string) (string, error) {
+	b, err := head(nil, path)
+	if err != nil {
+		return "", err
+	}
+
+	if len(b) == 0 {
+		return "empty", nil
+	}
+
+	if bytes.HasPrefix(b, []byte("#!")) {
+		if name := interpreter(firstLine(b)); name != "" {
+			return name, nil
+		}
+	}
+
+	contentType := http.DetectContentType(b)
+
+	if i := strings.IndexByte(contentType, ';'); i != -1 {
+		contentType = contentType[:i]
+	}
+
+	switch contentType {
+	case "text/plain":
+		return "text", nil
+	case "application/octet-stream":
+		return "binary", nil
+	}
+
+	_, subtype, _ := strings.Cut(contentType, "/")
+
+	return strings.TrimPrefix(subtype, "x-"), nil
+}
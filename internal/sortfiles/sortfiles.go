@@ -16,26 +16,51 @@ import (
 	internaltime "github.com/ayoisaiah/f2/internal/time"
 )
 
-// FilesBeforeDirs is used to sort files before directories to avoid renaming
-// conflicts. It also ensures that child directories are renamed before their
-// parents and vice versa in undo mode.
+// depth returns the number of components in the cleaned path.
+func depth(path string) int {
+	path = filepath.Clean(path)
+	if path == "." {
+		return 0
+	}
+
+	sep := string(filepath.Separator)
+
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+
+	return len(strings.Split(strings.Trim(path, sep), sep))
+}
+
+// FilesBeforeDirs orders the changes topologically so that the contents of a
+// directory are renamed before the directory itself. Otherwise, renaming the
+// directory first would invalidate the paths of the pending changes to its
+// contents. Deeper paths are renamed before shallower ones and files are
+// renamed before directories at the same depth. In undo mode, the directories
+// have to be restored before their contents so the order is reversed.
 func FilesBeforeDirs(changes []*file.Change, revert bool) []*file.Change {
+	depths := make(map[*file.Change]int, len(changes))
+
+	for _, ch := range changes {
+		depths[ch] = depth(filepath.Join(ch.BaseDir, ch.Source))
+	}
+
 	sort.SliceStable(changes, func(i, j int) bool {
 		compareElement1 := changes[i]
 		compareElement2 := changes[j]
 
-		// sort parent directories before child directories in revert mode
+		depth1, depth2 := depths[compareElement1], depths[compareElement2]
+
+		// restore parent directories before their contents in revert mode
 		if revert {
-			return len(compareElement1.BaseDir) < len(compareElement2.BaseDir)
+			return depth1 < depth2
 		}
 
-		// sort files before directories
-		if !compareElement1.IsDir {
-			return true
+		// rename the contents of directories before the directories
+		if depth1 != depth2 {
+			return depth1 > depth2
 		}
 
-		// sort child directories before parent directories
-		return len(compareElement1.BaseDir) > len(compareElement2.BaseDir)
+		// sort files before directories
+		return !compareElement1.IsDir && compareElement2.IsDir
 	})
 
 	return changes
@@ -168,3 +193,32 @@ func Changes(
 
 	return Alphabetically(changes, reverseSort), nil
 }
+
+// ForOutput returns a copy of the changes ordered by the specified key
+// (`source`, `target` or `dir`) for display purposes. The original order of
+// the changes is left as is.
+func ForOutput(changes []*file.Change, sortKey string) []*file.Change {
+	sorted := make([]*file.Change, len(changes))
+
+	copy(sorted, changes)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		compareElement1 := sorted[i]
+		compareElement2 := sorted[j]
+
+		switch sortKey {
+		case "target":
+			return strings.ToLower(compareElement1.Target) <
+				strings.ToLower(compareElement2.Target)
+		case "dir":
+			if compareElement1.BaseDir != compareElement2.BaseDir {
+				return compareElement1.BaseDir < compareElement2.BaseDir
+			}
+		}
+
+		return strings.ToLower(compareElement1.Source) <
+			strings.ToLower(compareElement2.Source)
+	})
+
+	return sorted
+}
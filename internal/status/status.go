@@ -11,5 +11,11 @@ const (
 	PathExists             Status = "path already exists"
 	OverwritingNewPath     Status = "overwriting newly renamed path"
 	InvalidCharacters      Status = "invalid characters present: (%s)"
+	ControlCharacters      Status = "control characters present: (%s)"
 	FilenameLengthExceeded Status = "max file name length exceeded: (%s)"
+	PermissionDenied       Status = "permission denied"
+	CaseCollision          Status = "target differs from another only in letter case"
+	SourceNotFound         Status = "source no longer exists"
+	Aborted                Status = "not renamed due to an earlier error"
+	Cancelled              Status = "not renamed because the operation was cancelled"
 )
@@ -0,0 +1,59 @@
+package f2
+
+import (
+	"context"
+
+	"github.com/ayoisaiah/f2/find"
+	"github.com/ayoisaiah/f2/internal/config"
+	internaljson "github.com/ayoisaiah/f2/internal/json"
+	"github.com/ayoisaiah/f2/rename"
+	"github.com/ayoisaiah/f2/replace"
+	"github.com/ayoisaiah/f2/validate"
+)
+
+// Plan searches for the matches, computes their targets and validates the
+// resulting changes according to the configuration without committing them.
+// The returned output is the same as the one printed through --json in
+// dry-run mode, and it includes any conflicts that were detected. A
+// *rename.ConflictError is returned along with the output in that case.
+// Nothing is written to the filesystem even if the configuration is set to
+// execute.
+func Plan(ctx context.Context, conf *config.Config) (*internaljson.Output, error) {
+	conf.Exec = false
+
+	matches, err := find.Find(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matches) == 0 {
+		return internaljson.NewOutput(conf, nil), nil
+	}
+
+	changes, err := replace.Replace(conf, matches)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.SkipEmptyTargets {
+		changes = replace.SkipEmptyTargets(changes)
+	}
+
+	if conf.SkipAlreadyNamed {
+		changes = replace.SkipAlreadyNamed(changes)
+	}
+
+	if conf.SkipIdentical {
+		changes, _ = replace.SkipIdentical(conf, changes)
+	}
+
+	conflicts := validate.Validate(changes, conf)
+
+	out := internaljson.NewOutput(conf, changes)
+
+	if len(conflicts) > 0 {
+		return out, &rename.ConflictError{Conflicts: conflicts}
+	}
+
+	return out, nil
+}
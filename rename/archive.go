@@ -0,0 +1,93 @@
+package rename
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adrg/xdg"
+
+	"github.com/ayoisaiah/f2/internal/archive"
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+	"github.com/ayoisaiah/f2/report"
+)
+
+// backupArchive copies the archive to the backup directory so that the
+// renaming operation can be reverted by restoring the copy.
+func backupArchive(a *archive.Archive) error {
+	backupPath, err := xdg.DataFile(
+		filepath.Join(
+			"f2",
+			"backups",
+			"archives",
+			fmt.Sprintf("%d-%s", time.Now().UnixNano(), filepath.Base(a.Path)),
+		),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = copyFile(a.Path, backupPath, false)
+	if err != nil {
+		return err
+	}
+
+	a.Backup = backupPath
+
+	return nil
+}
+
+// restoreArchive replaces the archive with the copy that was made before its
+// entries were renamed. The archive is replaced atomically and the copy is
+// removed afterwards.
+func restoreArchive(archivePath, backupPath string) error {
+	dir, base := filepath.Split(archivePath)
+
+	tmp := filepath.Join(dir, "."+base+".f2-restore")
+
+	err := copyFile(backupPath, tmp, false)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp, archivePath)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Remove(backupPath)
+}
+
+// renameArchive renames the entries of the archive according to the changes.
+// Unless disabled, the original archive is backed up before it is replaced.
+func renameArchive(conf *config.Config, changes []*file.Change) error {
+	a := conf.Archive
+
+	if !conf.NoBackup {
+		err := backupArchive(a)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := a.Rename(changes)
+	if err != nil {
+		if a.Backup != "" {
+			os.Remove(a.Backup)
+		}
+
+		return err
+	}
+
+	if !conf.NoBackup {
+		err = backupChanges(conf, changes)
+		if err != nil {
+			report.BackupFailed(err)
+		}
+	}
+
+	return nil
+}
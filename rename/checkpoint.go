@@ -0,0 +1,217 @@
+package rename
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/adrg/xdg"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+	internaljson "github.com/ayoisaiah/f2/internal/json"
+)
+
+var errNothingToResume = errors.New(
+	"nothing to resume",
+)
+
+// checkpoint records the progress of a renaming operation while it is being
+// committed so that it can be resumed if it is interrupted. The planned
+// changes are written in the same format as backup files, and the index of
+// each change is appended to the progress file once it is applied.
+type checkpoint struct {
+	progress *os.File
+	plan     string
+	offset   int // the number of changes applied before a resumed operation
+}
+
+// checkpointPaths returns the paths to the plan and progress files of the
+// checkpoint for operations carried out in the specified working directory.
+func checkpointPaths(workingDir string) (plan, progress string, err error) {
+	plan, err = xdg.DataFile(
+		filepath.Join("f2", "checkpoints", backupName(workingDir)),
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	return plan, strings.TrimSuffix(plan, ".json") + ".progress", nil
+}
+
+// newCheckpoint records the plan of the operation made up of the changes that
+// were completed before the operation was resumed (if any) followed by the
+// pending changes.
+func newCheckpoint(
+	conf *config.Config,
+	completed, pending []*file.Change,
+) (*checkpoint, error) {
+	plan, progress, err := checkpointPaths(conf.WorkingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*file.Change, 0, len(completed)+len(pending))
+	changes = append(changes, completed...)
+	changes = append(changes, pending...)
+
+	b, err := internaljson.GetOutput(conf, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:gomnd // number can be understood from context
+	err = os.WriteFile(plan, b, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(progress)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &checkpoint{
+		progress: f,
+		plan:     plan,
+		offset:   len(completed),
+	}
+
+	for i := range completed {
+		err = cp.write(i)
+		if err != nil {
+			_ = cp.remove()
+			return nil, err
+		}
+	}
+
+	return cp, nil
+}
+
+// write appends the index of an applied change to the progress file. The
+// file is synced each time so that the progress survives a crash.
+func (cp *checkpoint) write(i int) error {
+	_, err := fmt.Fprintln(cp.progress, i)
+	if err != nil {
+		return err
+	}
+
+	return cp.progress.Sync()
+}
+
+// done records the change at the specified index of the pending changes as
+// applied. Failures are ignored since the operation itself is unaffected.
+func (cp *checkpoint) done(i int) {
+	_ = cp.write(cp.offset + i)
+}
+
+// close closes the progress file so that the operation can be resumed.
+func (cp *checkpoint) close() error {
+	return cp.progress.Close()
+}
+
+// remove discards the checkpoint once the operation is no longer resumable.
+func (cp *checkpoint) remove() error {
+	_ = cp.progress.Close()
+
+	err := os.Remove(cp.progress.Name())
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(cp.plan)
+}
+
+// readProgress returns the set of the indices of the changes that were
+// applied according to the progress file. A partially written last line is
+// ignored.
+func readProgress(progress string) (map[int]bool, error) {
+	f, err := os.Open(progress)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[int]bool{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	applied := make(map[int]bool)
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		i, err := strconv.Atoi(scanner.Text())
+		if err != nil {
+			continue
+		}
+
+		applied[i] = true
+	}
+
+	return applied, scanner.Err()
+}
+
+// applied reports whether the change was applied before its progress could be
+// recorded, such as when the operation is interrupted right after a rename.
+func applied(conf *config.Config, change *file.Change) bool {
+	_, err := os.Lstat(filepath.Join(change.BaseDir, change.Source))
+	if conf.Copy || !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+
+	_, err = os.Lstat(filepath.Join(change.BaseDir, change.Target))
+
+	return err == nil
+}
+
+// Resume completes the interrupted operation recorded in the checkpoint for
+// the current working directory. The changes that were already applied are
+// skipped but still included in the backup of the operation.
+func Resume(ctx context.Context, conf *config.Config) error {
+	plan, progress, err := checkpointPaths(conf.WorkingDir)
+	if err != nil {
+		return err
+	}
+
+	if _, err = os.Stat(plan); errors.Is(err, fs.ErrNotExist) {
+		return errNothingToResume
+	}
+
+	o, err := readBackup(plan)
+	if err != nil {
+		return err
+	}
+
+	done, err := readProgress(progress)
+	if err != nil {
+		return err
+	}
+
+	var completed, pending []*file.Change
+
+	for i, change := range o.Changes {
+		if done[i] || applied(conf, change) {
+			completed = append(completed, change)
+			continue
+		}
+
+		pending = append(pending, change)
+	}
+
+	// the interrupted operation is carried out in the same mode and it
+	// can be resumed again if it is interrupted
+	conf.Copy = o.Copy
+	conf.UseGit = o.Git
+	conf.Checkpoint = true
+	conf.CompletedChanges = completed
+
+	return Rename(ctx, conf, pending)
+}
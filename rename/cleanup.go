@@ -0,0 +1,28 @@
+package rename
+
+import (
+	"github.com/ayoisaiah/f2/internal/file"
+)
+
+// cleanupAfterFailure removes the directories that were created for the
+// targets of the changes if they are empty because the changes that needed
+// them failed. The created directories recorded in each change are updated
+// so that the removed ones are not reported or backed up. It returns the
+// number of directories that were removed.
+func cleanupAfterFailure(changes []*file.Change) int {
+	removeCreatedDirs(changes)
+
+	var removed int
+
+	for _, change := range changes {
+		if len(change.CreatedDirs) == 0 {
+			continue
+		}
+
+		remaining := existingDirs(change.BaseDir, change.CreatedDirs)
+		removed += len(change.CreatedDirs) - len(remaining)
+		change.CreatedDirs = remaining
+	}
+
+	return removed
+}
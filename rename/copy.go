@@ -0,0 +1,166 @@
+package rename
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var errCopyVerificationFailed = errors.New(
+	"checksum of the copied file does not match the source",
+)
+
+var errCopySameFile = errors.New(
+	"source and target refer to the same file",
+)
+
+// checksumFunc computes the checksum of a copied file when it is verified.
+var checksumFunc = checksum
+
+// checksum computes the SHA-256 checksum of the specified file. The file is
+// streamed through the hash so that large files are not read into memory.
+func checksum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// copyFile copies the regular file at src to dst while preserving its
+// permission bits. If verify is set, the destination is read back after the
+// copy and its checksum is compared to that of the source. The destination is
+// removed if any of these steps fail so that partial copies are not left
+// behind.
+func copyFile(src, dst string, verify bool) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(
+		dst,
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
+		info.Mode().Perm(),
+	)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = os.Remove(dst)
+		}
+	}()
+
+	h := sha256.New()
+
+	_, err = io.Copy(out, io.TeeReader(in, h))
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+
+	if !verify {
+		return nil
+	}
+
+	sum, err := checksumFunc(dst)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(sum, h.Sum(nil)) {
+		return errCopyVerificationFailed
+	}
+
+	return nil
+}
+
+// copyDir recursively copies the directory at src to dst. Symbolic links are
+// recreated rather than followed. The destination tree is removed if the copy
+// fails at any point.
+func copyDir(src, dst string, verify bool) (err error) {
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(dst)
+		}
+	}()
+
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case d.IsDir():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			return os.MkdirAll(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(link, target)
+		}
+
+		return copyFile(path, target, verify)
+	})
+}
+
+// copyPath copies the file or directory at src to dst. It refuses to copy a
+// file onto itself which can happen on case-insensitive filesystems when only
+// the case of the name differs.
+func copyPath(src, dst string, isDir, verify bool) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if dstInfo, err := os.Stat(dst); err == nil && os.SameFile(srcInfo, dstInfo) {
+		return errCopySameFile
+	}
+
+	if isDir {
+		return copyDir(src, dst, verify)
+	}
+
+	return copyFile(src, dst, verify)
+}
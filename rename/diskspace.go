@@ -0,0 +1,138 @@
+package rename
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+	internalos "github.com/ayoisaiah/f2/internal/os"
+)
+
+var errInsufficientSpace = errors.New(
+	"not enough free space to copy the files to '%s': %s is required but only %s is available",
+)
+
+// freeSpaceFunc is the function used to query the free space on the
+// filesystem that contains a path.
+var freeSpaceFunc = internalos.FreeSpace
+
+// copySize returns the number of bytes that copying the source at the
+// specified path writes to the target. Directories are copied along with
+// their contents.
+func copySize(sourcePath string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(sourcePath, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		size += info.Size()
+
+		return nil
+	})
+
+	return size, err
+}
+
+// existingDir returns the nearest ancestor of the specified directory that
+// exists since the missing directories are only created during the copy.
+func existingDir(dir string) string {
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+
+		dir = parent
+	}
+}
+
+// estimateDiskSpace sums the sizes of the sources that are copied to each
+// filesystem and compares them with the space available on it. The
+// filesystems whose free space cannot be determined are left out of the
+// estimate.
+func estimateDiskSpace(changes []*file.Change) []config.DiskSpace {
+	var estimates []config.DiskSpace
+
+	// index maps the identifier of each filesystem to its estimate
+	index := make(map[string]int)
+
+	for _, change := range changes {
+		sourcePath := filepath.Join(change.BaseDir, change.Source)
+		targetPath := filepath.Join(change.BaseDir, change.Target)
+
+		if sourcePath == targetPath {
+			continue
+		}
+
+		size, err := copySize(sourcePath)
+		if err != nil {
+			continue
+		}
+
+		dir, err := filepath.Abs(existingDir(filepath.Dir(targetPath)))
+		if err != nil {
+			continue
+		}
+
+		key := dir
+		if dev, err := internalos.DeviceID(dir); err == nil {
+			key = fmt.Sprintf("%d", dev)
+		}
+
+		if i, ok := index[key]; ok {
+			estimates[i].Required += size
+			continue
+		}
+
+		available, err := freeSpaceFunc(dir)
+		if err != nil {
+			continue
+		}
+
+		index[key] = len(estimates)
+
+		estimates = append(estimates, config.DiskSpace{
+			Dir:       dir,
+			Required:  size,
+			Available: int64(available),
+		})
+	}
+
+	return estimates
+}
+
+// checkDiskSpace returns an error for the first filesystem that the copies
+// do not fit on.
+func checkDiskSpace(estimates []config.DiskSpace) error {
+	for _, d := range estimates {
+		if d.Insufficient() {
+			return fmt.Errorf(
+				errInsufficientSpace.Error(),
+				d.Dir,
+				config.HumanSize(d.Required),
+				config.HumanSize(d.Available),
+			)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package rename
+
+import (
+	"fmt"
+
+	"github.com/ayoisaiah/f2/internal/conflict"
+	"github.com/ayoisaiah/f2/internal/file"
+)
+
+// ConflictError is returned when the changes are not committed because
+// conflicts were detected in them. Use errors.As to access the conflicts.
+type ConflictError struct {
+	Conflicts conflict.Collection
+}
+
+func (e *ConflictError) Error() string {
+	var n int
+	for _, conflicts := range e.Conflicts {
+		n += len(conflicts)
+	}
+
+	if n == 1 {
+		return "1 conflict was detected in the renaming operation"
+	}
+
+	return fmt.Sprintf("%d conflicts were detected in the renaming operation", n)
+}
+
+// RenameError is returned when some of the changes could not be committed.
+// Changes contains the changes that failed, and the cause of each failure is
+// recorded in the Error field of the change.
+type RenameError struct {
+	err     error
+	Changes []*file.Change
+}
+
+func (e *RenameError) Error() string {
+	return e.err.Error()
+}
+
+func (e *RenameError) Unwrap() error {
+	return e.err
+}
+
+// newRenameError creates a RenameError for the changes that failed. They are
+// selected through their Error field since the changes may have been
+// reordered after they were committed.
+func newRenameError(err error, changes []*file.Change) error {
+	var failed []*file.Change
+
+	for _, change := range changes {
+		if change.Error != nil {
+			failed = append(failed, change)
+		}
+	}
+
+	return &RenameError{err: err, Changes: failed}
+}
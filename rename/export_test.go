@@ -0,0 +1,68 @@
+package rename
+
+import (
+	"context"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+)
+
+// RenameChanges exposes the rename loop for testing.
+func RenameChanges(
+	ctx context.Context,
+	changes []*file.Change,
+	conf *config.Config,
+) []int {
+	return rename(ctx, changes, conf, nil)
+}
+
+// SetRenameFunc replaces the function used to rename paths and returns
+// a function that restores the original.
+func SetRenameFunc(fn func(oldpath, newpath string) error) func() {
+	original := renameFunc
+	renameFunc = fn
+
+	return func() {
+		renameFunc = original
+	}
+}
+
+// SuccessfulChanges exposes the changes that are recorded in the backup file
+// for testing.
+func SuccessfulChanges(changes []*file.Change) []*file.Change {
+	return successfulChanges(changes)
+}
+
+// SimulateIn exposes the simulation of a renaming operation within the
+// specified directory for testing.
+func SimulateIn(
+	ctx context.Context,
+	conf *config.Config,
+	changes []*file.Change,
+	root string,
+) ([]string, error) {
+	return simulate(ctx, conf, changes, root)
+}
+
+// SetChecksumFunc replaces the function used to compute the checksum of a
+// copied file when it is verified and returns a function that restores the
+// original.
+func SetChecksumFunc(fn func(path string) ([]byte, error)) func() {
+	original := checksumFunc
+	checksumFunc = fn
+
+	return func() {
+		checksumFunc = original
+	}
+}
+
+// SetFreeSpaceFunc replaces the function used to query the free space on a
+// filesystem and returns a function that restores the original.
+func SetFreeSpaceFunc(fn func(path string) (uint64, error)) func() {
+	original := freeSpaceFunc
+	freeSpaceFunc = fn
+
+	return func() {
+		freeSpaceFunc = original
+	}
+}
@@ -0,0 +1,56 @@
+package rename
+
+import (
+	"context"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+	internalpath "github.com/ayoisaiah/f2/internal/path"
+	"github.com/ayoisaiah/f2/replace"
+	"github.com/ayoisaiah/f2/validate"
+)
+
+// TargetFunc computes the target name of a change. The returned name is
+// relative to the directory of the source, just like the targets produced
+// by the replacement patterns.
+type TargetFunc func(change *file.Change) string
+
+// RenameWith renames the matches (as returned by find.Find) according to the
+// targets computed by fn instead of the find and replacement patterns. The
+// changes are validated before they are committed, and an error is returned
+// without renaming anything if any conflicts are detected. The conflicts are
+// recorded in conf.Conflicts and in the returned *ConflictError.
+func RenameWith(
+	ctx context.Context,
+	conf *config.Config,
+	matches internalpath.Collection,
+	fn TargetFunc,
+) ([]*file.Change, error) {
+	changes, err := replace.Changes(conf, matches)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		change.Target = fn(change)
+	}
+
+	if conf.SkipEmptyTargets {
+		changes = replace.SkipEmptyTargets(changes)
+	}
+
+	if conf.SkipAlreadyNamed {
+		changes = replace.SkipAlreadyNamed(changes)
+	}
+
+	if conf.SkipIdentical {
+		changes, _ = replace.SkipIdentical(conf, changes)
+	}
+
+	conflicts := validate.Validate(changes, conf)
+	if len(conflicts) > 0 {
+		return changes, &ConflictError{Conflicts: conflicts}
+	}
+
+	return changes, Rename(ctx, conf, changes)
+}
@@ -0,0 +1,99 @@
+package rename
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitRenamer renames the paths that are tracked in a Git repository through
+// `git mv` so that the index is updated and the history of each file is
+// preserved. Untracked paths are renamed through renameFunc.
+type gitRenamer struct {
+	// repos maps each directory to the top-level directory of the
+	// repository that contains it, or an empty string if it is not in a
+	// repository
+	repos map[string]string
+}
+
+func newGitRenamer() *gitRenamer {
+	return &gitRenamer{repos: make(map[string]string)}
+}
+
+// runGit runs git with the specified arguments in dir.
+func runGit(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", err
+		}
+
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// repo returns the top-level directory of the repository that contains dir,
+// or an empty string if dir is not in a repository.
+func (g *gitRenamer) repo(dir string) string {
+	if root, ok := g.repos[dir]; ok {
+		return root
+	}
+
+	root, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		root = ""
+	}
+
+	g.repos[dir] = root
+
+	return root
+}
+
+// isTracked reports whether the path is tracked in a repository. A directory
+// is tracked if it contains tracked files.
+func (g *gitRenamer) isTracked(path string) bool {
+	dir := filepath.Dir(path)
+
+	if g.repo(dir) == "" {
+		return false
+	}
+
+	// ls-files fails if the path is not tracked
+	_, err := runGit(dir, "ls-files", "--error-unmatch", "--", filepath.Base(path))
+
+	return err == nil
+}
+
+// rename renames the source to the target.
+func (g *gitRenamer) rename(source, target string) error {
+	if !g.isTracked(source) {
+		return renameFunc(source, target)
+	}
+
+	// the paths are relative to the working directory rather than the
+	// directory that git is run in
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+
+	_, err = runGit(filepath.Dir(source), "mv", "--", source, target)
+
+	return err
+}
@@ -0,0 +1,35 @@
+package rename
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/report"
+)
+
+var errNoLastOperation = errors.New(
+	"no operation has been recorded for the current working directory",
+)
+
+// Last prints the changes recorded in the backup file of the last operation
+// performed in the current working directory. Nothing is modified.
+func Last(conf *config.Config) error {
+	backupFilePath, err := xdg.SearchDataFile(
+		filepath.Join("f2", "backups", backupName(conf.WorkingDir)),
+	)
+	if err != nil {
+		return errNoLastOperation
+	}
+
+	o, err := readBackup(backupFilePath)
+	if err != nil {
+		return err
+	}
+
+	report.LastOperation(conf, o)
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package rename
+
+import (
+	"path/filepath"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+	"github.com/ayoisaiah/f2/internal/ledger"
+)
+
+// updateLedger records the targets of the successful changes in the ledger
+// so that they are not matched again. When an operation is undone, the paths
+// that were restored to their original names are removed from the ledger
+// instead.
+func updateLedger(conf *config.Config, changes []*file.Change) error {
+	l, err := ledger.Load()
+	if err != nil {
+		return err
+	}
+
+	var updated bool
+
+	for _, change := range successfulChanges(changes) {
+		if change.Source == change.Target {
+			continue
+		}
+
+		baseDir, err := filepath.Abs(change.BaseDir)
+		if err != nil {
+			return err
+		}
+
+		if conf.Revert {
+			sourcePath := filepath.Join(baseDir, change.Source)
+			if l.Contains(sourcePath) {
+				l.Remove(sourcePath)
+
+				updated = true
+			}
+
+			continue
+		}
+
+		l.Add(filepath.Join(baseDir, change.Target))
+
+		updated = true
+	}
+
+	if !updated {
+		return nil
+	}
+
+	return l.Save()
+}
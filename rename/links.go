@@ -0,0 +1,63 @@
+package rename
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+)
+
+// removeBrokenLinks deletes the broken symlinks that were found by the search
+// once the operation has been confirmed. The removed links are recorded in
+// conf.RemovedLinks along with their targets so that they are backed up.
+func removeBrokenLinks(conf *config.Config) error {
+	conf.RemovedLinks = nil
+
+	if !conf.RemoveBrokenLinks {
+		return nil
+	}
+
+	for _, path := range conf.BrokenLinks {
+		target, err := os.Readlink(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+
+			return err
+		}
+
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+
+		err = os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		conf.RemovedLinks = append(conf.RemovedLinks, file.RemovedLink{
+			Path:   absPath,
+			Target: target,
+		})
+	}
+
+	return nil
+}
+
+// restoreLinks recreates the broken symlinks that were removed along with a
+// renaming operation when it is undone. The paths that exist are left alone.
+func restoreLinks(links []file.RemovedLink) error {
+	for _, link := range links {
+		err := os.Symlink(link.Target, link.Path)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+
+	return nil
+}
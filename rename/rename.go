@@ -5,8 +5,10 @@ package rename
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -17,26 +19,49 @@ import (
 	"github.com/adrg/xdg"
 	"github.com/pterm/pterm"
 
+	"github.com/ayoisaiah/f2/edit"
 	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/conflict"
 	"github.com/ayoisaiah/f2/internal/file"
 	internaljson "github.com/ayoisaiah/f2/internal/json"
 	internalos "github.com/ayoisaiah/f2/internal/os"
 	internalpath "github.com/ayoisaiah/f2/internal/path"
 	"github.com/ayoisaiah/f2/internal/sortfiles"
+	"github.com/ayoisaiah/f2/internal/status"
 	"github.com/ayoisaiah/f2/report"
+	"github.com/ayoisaiah/f2/validate"
 )
 
 var errRenameFailed = errors.New(
 	"some files could not be renamed. Revert the changes through the --undo flag",
 )
 
-var errs []int
+var errRenameAborted = errors.New("the renaming operation was aborted")
+
+var errSourceNotFound = errors.New(
+	"'%s' no longer exists. It may have been moved or deleted after the operation was planned",
+)
 
 // rename iterates over all the matches and renames them on the filesystem.
-// Directories are auto-created if necessary, and errors are aggregated.
+// Directories are auto-created if necessary, and errors are aggregated unless
+// the operation is set to abort at the first error. In copy mode, the sources
+// are copied to their targets instead, and in Git mode, the tracked sources
+// are renamed through `git mv`. The remaining changes are left untouched once
+// the context is cancelled. If set, done is called with the index of each
+// change once it is applied.
 func rename(
+	ctx context.Context,
 	changes []*file.Change,
+	conf *config.Config,
+	done func(i int),
 ) []int {
+	var errs []int
+
+	move := renameFunc
+	if conf.UseGit {
+		move = newGitRenamer().rename
+	}
+
 	for i := range changes {
 		change := changes[i]
 
@@ -48,6 +73,25 @@ func rename(
 			continue
 		}
 
+		if conf.OnError == config.OnErrorAbort && len(errs) > 0 {
+			change.Status = status.Aborted
+			continue
+		}
+
+		if ctx.Err() != nil {
+			change.Status = status.Cancelled
+			continue
+		}
+
+		// the source may have been removed since the changes were validated
+		if _, err := os.Lstat(sourcePath); errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, i)
+			change.Status = status.SourceNotFound
+			change.Error = fmt.Errorf(errSourceNotFound.Error(), sourcePath)
+
+			continue
+		}
+
 		// Account for case insensitive filesystems where renaming a filename to its
 		// upper or lowercase equivalent doesn't work. Fixing this involves the
 		// following steps:
@@ -55,7 +99,7 @@ func rename(
 		// 2. Rename <source> to <target>
 		// 3. Rename __<time>__<target> to <target> if case insensitive FS
 		var caseInsensitiveFS bool
-		if strings.EqualFold(sourcePath, targetPath) {
+		if strings.EqualFold(sourcePath, targetPath) && !conf.Copy {
 			caseInsensitiveFS = true
 			timeStr := fmt.Sprintf("%d", time.Now().UnixNano())
 			targetPath = filepath.Join(
@@ -73,23 +117,54 @@ func rename(
 			// consecutive slashes since `os.MkdirAll` handles that
 			dir := filepath.Dir(change.Target)
 
+			// the created directories are recorded so that they can be
+			// removed if the operation is undone
+			change.CreatedDirs = missingDirs(change.BaseDir, dir)
+
 			//nolint:gomnd // number can be understood from context
 			err := os.MkdirAll(filepath.Join(change.BaseDir, dir), 0o750)
+			if err != nil {
+				// only the directories that were created before the
+				// failure are recorded
+				change.CreatedDirs = existingDirs(change.BaseDir, change.CreatedDirs)
+				errs = append(errs, i)
+				change.Error = err
+
+				continue
+			}
+		}
+
+		if conf.Copy {
+			err := retry(conf, func() error {
+				return copyPath(sourcePath, targetPath, change.IsDir, conf.VerifyCopy)
+			})
 			if err != nil {
 				errs = append(errs, i)
 				change.Error = err
 
 				continue
 			}
+
+			change.Verified = conf.VerifyCopy
+
+			if done != nil {
+				done(i)
+			}
+
+			continue
 		}
 
-		err := os.Rename(sourcePath, targetPath) // step 2
+		err := retry(conf, func() error {
+			return move(sourcePath, targetPath) // step 2
+		})
 		// if the intermediate rename is successful,
 		// proceed with the original renaming operation
 		if err == nil && caseInsensitiveFS {
 			orginalTarget := filepath.Join(change.BaseDir, change.Target)
 
-			err = os.Rename(targetPath, orginalTarget) // step 3
+			err = retry(conf, func() error {
+				return move(targetPath, orginalTarget) // step 3
+			})
 		}
 
 		if err != nil {
@@ -98,27 +173,122 @@ func rename(
 
 			continue
 		}
+
+		// the symlinks that were matched in place of the source keep
+		// pointing to it once it is renamed
+		err = relink(change)
+		if err != nil {
+			errs = append(errs, i)
+			change.Error = err
+
+			continue
+		}
+
+		if done != nil {
+			done(i)
+		}
 	}
 
 	return errs
 }
 
-// backupChanges records the details of a renaming operation to the filesystem
-// so that it may be reverted if necessary.
-func backupChanges(changes []*file.Change, cwd string) error {
-	workingDir := strings.ReplaceAll(
-		cwd,
-		internalpath.Separator,
-		"_",
-	)
+// relink updates the symlinks recorded in the change to point to its target.
+func relink(change *file.Change) error {
+	if len(change.Links) == 0 {
+		return nil
+	}
+
+	target, err := filepath.Abs(filepath.Join(change.BaseDir, change.Target))
+	if err != nil {
+		return err
+	}
+
+	for _, link := range change.Links {
+		err = internalos.Relink(link, target)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// missingDirs returns each directory in the specified path (relative to the
+// base directory) that does not exist yet, starting from the deepest one.
+func missingDirs(baseDir, dir string) []string {
+	var missing []string
+
+	for dir != "." && dir != "" && dir != string(filepath.Separator) {
+		if _, err := os.Stat(filepath.Join(baseDir, dir)); err == nil {
+			break
+		}
+
+		missing = append(missing, dir)
+		dir = filepath.Dir(dir)
+	}
+
+	return missing
+}
+
+// existingDirs returns the directories (relative to baseDir) that exist.
+func existingDirs(baseDir string, dirs []string) []string {
+	var existing []string
+
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(baseDir, dir)); err == nil {
+			existing = append(existing, dir)
+		}
+	}
+
+	return existing
+}
+
+// createdDirs returns the number of directories that were created for the
+// targets of the changes. Each directory is only recorded in the change that
+// created it.
+func createdDirs(changes []*file.Change) int {
+	var n int
+
+	for _, change := range changes {
+		n += len(change.CreatedDirs)
+	}
+
+	return n
+}
+
+// successfulChanges returns the changes that were applied to the filesystem
+// excluding those that errored out or were never attempted.
+func successfulChanges(changes []*file.Change) []*file.Change {
+	successful := make([]*file.Change, 0, len(changes))
+
+	for _, change := range changes {
+		if change.Error != nil || change.Status == status.Aborted ||
+			change.Status == status.Cancelled {
+			continue
+		}
+
+		successful = append(successful, change)
+	}
+
+	return successful
+}
+
+// backupName returns the name of the backup file for the operations carried
+// out in the specified working directory.
+func backupName(workingDir string) string {
+	name := strings.ReplaceAll(workingDir, internalpath.Separator, "_")
 	if runtime.GOOS == internalos.Windows {
-		workingDir = strings.ReplaceAll(workingDir, ":", "_")
+		name = strings.ReplaceAll(name, ":", "_")
 	}
 
-	filename := workingDir + ".json"
+	return name + ".json"
+}
 
+// backupChanges records the details of a renaming operation to the filesystem
+// so that it may be reverted if necessary.
+func backupChanges(conf *config.Config, changes []*file.Change) error {
 	backupFilePath, err := xdg.DataFile(
-		filepath.Join("f2", "backups", filename),
+		filepath.Join("f2", "backups", backupName(conf.WorkingDir)),
 	)
 	if err != nil {
 		return err
@@ -137,20 +307,7 @@ func backupChanges(changes []*file.Change, cwd string) error {
 		}
 	}()
 
-	successfulChanges := make([]*file.Change, len(changes))
-
-	copy(successfulChanges, changes)
-
-	// remove files that errored out
-	for i := len(successfulChanges) - 1; i >= 0; i-- {
-		if successfulChanges[i].Error != nil {
-			successfulChanges = append(
-				successfulChanges[:i],
-				successfulChanges[i+1:]...)
-		}
-	}
-
-	b, err := internaljson.GetOutput(successfulChanges)
+	b, err := internaljson.GetOutput(conf, successfulChanges(changes))
 	if err != nil {
 		return err
 	}
@@ -167,22 +324,69 @@ func backupChanges(changes []*file.Change, cwd string) error {
 
 // commit applies the renaming operation to the filesystem.
 // A backup file is auto created as long as at least one file
-// was renamed and it wasn't an undo operation.
+// was renamed and it wasn't an undo operation or disabled
+// through --no-backup.
 func commit(
+	ctx context.Context,
 	fileChanges []*file.Change,
 	conf *config.Config,
 ) []int {
-	errs = rename(fileChanges)
+	var cp *checkpoint
+
+	var done func(i int)
+
+	// the undo operation is not resumable since it removes its backup
+	if conf.Checkpoint && !conf.Revert {
+		var err error
+
+		cp, err = newCheckpoint(conf, conf.CompletedChanges, fileChanges)
+		if err != nil {
+			report.CheckpointFailed(err)
+		} else {
+			done = cp.done
+		}
+	}
+
+	errs := rename(ctx, fileChanges, conf, done)
+
+	if len(errs) > 0 && conf.CleanupOnFailure {
+		removed := cleanupAfterFailure(fileChanges)
+
+		if !conf.JSON {
+			report.CleanedUp(conf, removed, successfulChanges(fileChanges))
+		}
+	}
+
+	// the checkpoint is kept if the operation is interrupted so that it
+	// can be resumed
+	if cp != nil {
+		if ctx.Err() != nil {
+			_ = cp.close()
+		} else {
+			_ = cp.remove()
+		}
+	}
 
 	if conf.Verbose {
+		action := "rename"
+		if conf.Copy {
+			action = "copy"
+		}
+
 		for _, change := range fileChanges {
 			sourcePath := filepath.Join(change.BaseDir, change.Source)
 			targetPath := filepath.Join(change.BaseDir, change.Target)
 
+			if change.Status == status.Aborted ||
+				change.Status == status.Cancelled {
+				continue
+			}
+
 			if change.Error != nil {
 				pterm.Fprintln(report.Stderr,
 					pterm.Error.Sprintf(
-						"Failed to rename %s to %s",
+						"Failed to %s %s to %s",
+						action,
 						sourcePath,
 						targetPath,
 					),
@@ -191,9 +395,15 @@ func commit(
 				continue
 			}
 
+			pastTense := "Renamed"
+			if conf.Copy {
+				pastTense = "Copied"
+			}
+
 			pterm.Fprintln(report.Stderr,
 				pterm.Success.Printfln(
-					"Renamed '%s' to '%s'",
+					"%s '%s' to '%s'",
+					pastTense,
 					pterm.Yellow(sourcePath),
 					pterm.Yellow(targetPath),
 				),
@@ -201,13 +411,26 @@ func commit(
 		}
 	}
 
-	if !conf.Revert {
-		err := backupChanges(fileChanges, conf.WorkingDir)
+	if !conf.Revert && !conf.NoBackup {
+		// the changes applied before a resumed operation are backed up
+		// along with the rest so that the entire operation can be undone
+		changes := make([]*file.Change, 0, len(conf.CompletedChanges)+len(fileChanges))
+		changes = append(changes, conf.CompletedChanges...)
+		changes = append(changes, fileChanges...)
+
+		err := backupChanges(conf, changes)
 		if err != nil {
 			report.BackupFailed(err)
 		}
 	}
 
+	if conf.StopOnMatch || conf.Revert {
+		err := updateLedger(conf, fileChanges)
+		if err != nil {
+			report.LedgerFailed(err)
+		}
+	}
+
 	if len(errs) > 0 {
 		sort.SliceStable(fileChanges, func(i, _ int) bool {
 			compareElement1 := fileChanges[i]
@@ -219,9 +442,75 @@ func commit(
 	return errs
 }
 
+// outputOrder returns the changes in the order in which they are reported.
+// This does not affect the order in which they are renamed.
+func outputOrder(
+	conf *config.Config,
+	fileChanges []*file.Change,
+) []*file.Change {
+	if conf.OutputSort != "" {
+		return sortfiles.ForOutput(fileChanges, conf.OutputSort)
+	}
+
+	return fileChanges
+}
+
+// planned returns a copy of each change so that the results of committing
+// the changes are not reflected in it.
+func planned(fileChanges []*file.Change) []*file.Change {
+	changes := make([]*file.Change, len(fileChanges))
+
+	for i, change := range fileChanges {
+		ch := *change
+		changes[i] = &ch
+	}
+
+	return changes
+}
+
+// interactive prompts the user to commit the changes and reports whether
+// they were accepted. If the user chooses to edit the changes instead, the
+// edited changes are validated again before the prompt is repeated.
+func interactive(
+	conf *config.Config,
+	fileChanges []*file.Change,
+) ([]*file.Change, bool, error) {
+	reader := bufio.NewReader(conf.Stdin)
+
+	var conflicts conflict.Collection
+
+	for {
+		action := report.Interactive(
+			conf,
+			reader,
+			outputOrder(conf, fileChanges),
+			conflicts,
+		)
+
+		switch action {
+		case report.ActionAccept:
+			return fileChanges, true, nil
+		case report.ActionQuit:
+			return fileChanges, false, nil
+		}
+
+		var err error
+
+		fileChanges, err = edit.Edit(conf, fileChanges)
+		if err != nil {
+			return nil, false, err
+		}
+
+		conflicts = validate.Validate(fileChanges, conf)
+	}
+}
+
 // Rename prints the changes to be made in dry-run mode
 // or commits the operation to the filesystem if in execute mode.
+// If the context is cancelled during the operation, the changes that were
+// already committed are backed up and the context's error is returned.
 func Rename(
+	ctx context.Context,
 	conf *config.Config,
 	fileChanges []*file.Change,
 ) error {
@@ -229,26 +518,120 @@ func Rename(
 		fileChanges = sortfiles.FilesBeforeDirs(fileChanges, conf.Revert)
 	}
 
+	// the copies are checked against the free space on their destination
+	// filesystems before they are reported so that the estimate is included
+	if conf.Copy && conf.Archive == nil {
+		conf.DiskSpace = estimateDiskSpace(fileChanges)
+	}
+
+	output := outputOrder(conf, fileChanges)
+
 	if !conf.Interactive && !conf.Exec && !conf.JSON {
-		report.NonInteractive(fileChanges)
+		report.NonInteractive(conf, output)
 		return nil
 	}
 
-	if conf.JSON {
-		report.JSON(fileChanges)
+	// the JSON output is printed once the changes are committed in
+	// execute mode so that it includes the number of created directories
+	// and the duration of the rename stage. The changes are reported as
+	// they were planned so that they are the same as in dry-run mode
+	deferJSON := conf.JSON && conf.Exec && !conf.Interactive
+
+	if deferJSON {
+		output = planned(output)
+	} else if conf.JSON {
+		report.JSON(conf, output)
 	} else if conf.Interactive {
-		report.Interactive(fileChanges)
+		changes, accepted, err := interactive(conf, fileChanges)
+		if err != nil || !accepted {
+			return err
+		}
+
+		fileChanges = changes
 	}
 
 	if !conf.Exec {
 		return nil
 	}
 
-	renameErrs := commit(fileChanges, conf)
+	if conf.Archive != nil {
+		return renameArchive(conf, fileChanges)
+	}
+
+	err := checkDiskSpace(conf.DiskSpace)
+	if err != nil {
+		return err
+	}
+
+	// the broken links are only removed once the changes have been
+	// validated and confirmed so that the removal is backed up with them
+	err = removeBrokenLinks(conf)
+	if err != nil {
+		return err
+	}
+
+	if conf.StagedRename {
+		fileChanges = stageChanges(fileChanges)
+	} else if conf.Swap && !conf.Copy {
+		fileChanges = orderSwaps(fileChanges)
+	}
+
+	start := time.Now()
+
+	renameErrs := commit(ctx, fileChanges, conf)
+
+	conf.RecordTiming(config.StageRename, start, len(fileChanges))
+
+	conf.CreatedDirs = createdDirs(fileChanges)
+
+	if !conf.JSON {
+		report.CreatedDirs(conf)
+	}
+
+	if deferJSON {
+		report.JSON(conf, output)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if renameErrs != nil {
-		// TODO: Print the errors
-		return errRenameFailed
+		if conf.OnError == config.OnErrorAbort {
+			return newRenameError(
+				abortError(fileChanges, conf),
+				fileChanges,
+			)
+		}
+
+		return newRenameError(errRenameFailed, fileChanges)
 	}
 
 	return nil
 }
+
+// abortError reports the change that caused the renaming operation to be
+// aborted.
+func abortError(fileChanges []*file.Change, conf *config.Config) error {
+	action := "rename"
+	if conf.Copy {
+		action = "copy"
+	}
+
+	for _, change := range fileChanges {
+		if change.Error == nil {
+			continue
+		}
+
+		return fmt.Errorf(
+			"%w after failing to %s '%s' to '%s': %v",
+			errRenameAborted,
+			action,
+			filepath.Join(change.BaseDir, change.Source),
+			filepath.Join(change.BaseDir, change.Target),
+			change.Error,
+		)
+	}
+
+	return errRenameAborted
+}
@@ -0,0 +1,827 @@
+package rename_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adrg/xdg"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/conflict"
+	"github.com/ayoisaiah/f2/internal/file"
+	"github.com/ayoisaiah/f2/internal/status"
+	"github.com/ayoisaiah/f2/rename"
+	"github.com/ayoisaiah/f2/report"
+	"github.com/ayoisaiah/f2/validate"
+)
+
+var errRenameFailed = errors.New("rename failed")
+
+func TestOnError(t *testing.T) {
+	testCases := []struct {
+		name        string
+		onError     string
+		wantRenamed []string
+		wantErrs    int
+	}{
+		{
+			name:        "continue after a failed change",
+			onError:     config.OnErrorContinue,
+			wantRenamed: []string{"a.txt", "c.txt"},
+			wantErrs:    1,
+		},
+		{
+			name:        "abort at the first failed change",
+			onError:     config.OnErrorAbort,
+			wantRenamed: []string{"a.txt"},
+			wantErrs:    1,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+				err := os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			restore := rename.SetRenameFunc(func(oldpath, newpath string) error {
+				if filepath.Base(oldpath) == "b.txt" {
+					return errRenameFailed
+				}
+
+				return os.Rename(oldpath, newpath)
+			})
+			defer restore()
+
+			changes := []*file.Change{
+				{BaseDir: dir, Source: "a.txt", Target: "a-renamed.txt"},
+				{BaseDir: dir, Source: "b.txt", Target: "b-renamed.txt"},
+				{BaseDir: dir, Source: "c.txt", Target: "c-renamed.txt"},
+			}
+
+			conf := &config.Config{
+				OnError: tc.onError,
+			}
+
+			errs := rename.RenameChanges(context.Background(), changes, conf)
+			if len(errs) != tc.wantErrs {
+				t.Fatalf("expected %d errors, got %d", tc.wantErrs, len(errs))
+			}
+
+			successful := rename.SuccessfulChanges(changes)
+			if len(successful) != len(tc.wantRenamed) {
+				t.Fatalf(
+					"expected %d successful changes, got %d",
+					len(tc.wantRenamed),
+					len(successful),
+				)
+			}
+
+			for i, change := range successful {
+				if change.Source != tc.wantRenamed[i] {
+					t.Fatalf(
+						"expected %s to be renamed, got %s",
+						tc.wantRenamed[i],
+						change.Source,
+					)
+				}
+
+				_, err := os.Stat(filepath.Join(dir, change.Target))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tc.onError != config.OnErrorAbort {
+				return
+			}
+
+			// the change after the failure must be left untouched
+			if changes[2].Status != status.Aborted {
+				t.Fatalf(
+					"expected status %q, got %q",
+					status.Aborted,
+					changes[2].Status,
+				)
+			}
+
+			_, err := os.Stat(filepath.Join(dir, "c.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRenameError(t *testing.T) {
+	isolateDataDir(t)
+
+	for _, onError := range []string{config.OnErrorContinue, config.OnErrorAbort} {
+		onError := onError
+
+		t.Run(onError, func(t *testing.T) {
+			dir := t.TempDir()
+
+			for _, name := range []string{"a.txt", "b.txt"} {
+				err := os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			restore := rename.SetRenameFunc(func(oldpath, newpath string) error {
+				if filepath.Base(oldpath) == "b.txt" {
+					return errRenameFailed
+				}
+
+				return os.Rename(oldpath, newpath)
+			})
+			defer restore()
+
+			changes := []*file.Change{
+				{BaseDir: dir, Source: "a.txt", Target: "a-renamed.txt"},
+				{BaseDir: dir, Source: "b.txt", Target: "b-renamed.txt"},
+			}
+
+			conf := &config.Config{
+				OnError:    onError,
+				Exec:       true,
+				NoBackup:   true,
+				Quiet:      true,
+				WorkingDir: dir,
+			}
+
+			err := rename.Rename(context.Background(), conf, changes)
+
+			var renameErr *rename.RenameError
+			if !errors.As(err, &renameErr) {
+				t.Fatalf("expected a rename error, got: %v", err)
+			}
+
+			if len(renameErr.Changes) != 1 ||
+				renameErr.Changes[0].Source != "b.txt" ||
+				!errors.Is(renameErr.Changes[0].Error, errRenameFailed) {
+				t.Fatalf("unexpected failed changes: %v", renameErr.Changes)
+			}
+		})
+	}
+}
+
+func TestRenameErrorFirstChange(t *testing.T) {
+	isolateDataDir(t)
+
+	for _, onError := range []string{config.OnErrorContinue, config.OnErrorAbort} {
+		onError := onError
+
+		t.Run(onError, func(t *testing.T) {
+			dir := t.TempDir()
+
+			for _, name := range []string{"a.txt", "b.txt"} {
+				err := os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			restore := rename.SetRenameFunc(func(oldpath, newpath string) error {
+				if filepath.Base(oldpath) == "a.txt" {
+					return errRenameFailed
+				}
+
+				return os.Rename(oldpath, newpath)
+			})
+			defer restore()
+
+			changes := []*file.Change{
+				{BaseDir: dir, Source: "a.txt", Target: "a-renamed.txt"},
+				{BaseDir: dir, Source: "b.txt", Target: "b-renamed.txt"},
+			}
+
+			conf := &config.Config{
+				OnError:    onError,
+				Exec:       true,
+				NoBackup:   true,
+				Quiet:      true,
+				WorkingDir: dir,
+			}
+
+			err := rename.Rename(context.Background(), conf, changes)
+
+			var renameErr *rename.RenameError
+			if !errors.As(err, &renameErr) {
+				t.Fatalf("expected a rename error, got: %v", err)
+			}
+
+			if len(renameErr.Changes) != 1 ||
+				renameErr.Changes[0].Source != "a.txt" ||
+				!errors.Is(renameErr.Changes[0].Error, errRenameFailed) {
+				t.Fatalf("unexpected failed changes: %v", renameErr.Changes)
+			}
+		})
+	}
+}
+
+// isolateDataDir keeps the backups and checkpoints created by the test in a
+// temporary data directory.
+func isolateDataDir(t *testing.T) {
+	t.Helper()
+
+	t.Cleanup(xdg.Reload)
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	xdg.Reload()
+}
+
+func TestRenameCancelled(t *testing.T) {
+	isolateDataDir(t)
+
+	dir := t.TempDir()
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the operation is cancelled right after the first rename
+	restore := rename.SetRenameFunc(func(oldpath, newpath string) error {
+		defer cancel()
+
+		return os.Rename(oldpath, newpath)
+	})
+	defer restore()
+
+	changes := []*file.Change{
+		{BaseDir: dir, Source: "a.txt", Target: "a-renamed.txt"},
+		{BaseDir: dir, Source: "b.txt", Target: "b-renamed.txt"},
+		{BaseDir: dir, Source: "c.txt", Target: "c-renamed.txt"},
+	}
+
+	conf := &config.Config{
+		WorkingDir: dir,
+		OnError:    config.OnErrorContinue,
+		Exec:       true,
+	}
+
+	err := rename.Rename(ctx, conf, changes)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got: %v", context.Canceled, err)
+	}
+
+	for _, change := range changes[1:] {
+		if change.Status != status.Cancelled {
+			t.Fatalf(
+				"expected status %q for %s, got %q",
+				status.Cancelled,
+				change.Source,
+				change.Status,
+			)
+		}
+	}
+
+	for _, name := range []string{"a-renamed.txt", "b.txt", "c.txt"} {
+		_, err = os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only the committed rename is recorded in the backup file
+	// so reverting the operation must restore it alone
+	err = rename.Undo(context.Background(), &config.Config{
+		WorkingDir: dir,
+		Revert:     true,
+		Exec:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		_, err = os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStaleSource(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newChanges := func() []*file.Change {
+		return []*file.Change{
+			{BaseDir: dir, Source: "a.txt", Target: "a-renamed.txt"},
+			{BaseDir: dir, Source: "b.txt", Target: "b-renamed.txt"},
+		}
+	}
+
+	conf := &config.Config{
+		OnError: config.OnErrorContinue,
+	}
+
+	changes := newChanges()
+
+	if conflicts := validate.Validate(changes, conf); len(conflicts) > 0 {
+		t.Fatalf("unexpected conflicts: %v", conflicts)
+	}
+
+	// the source is removed between planning and execution
+	err := os.Remove(filepath.Join(dir, "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conflicts := validate.Validate(newChanges(), conf)
+	if len(conflicts[conflict.SourceNotFound]) != 1 {
+		t.Fatalf("expected a missing source conflict, got: %v", conflicts)
+	}
+
+	errs := rename.RenameChanges(context.Background(), changes, conf)
+	if len(errs) != 1 || errs[0] != 1 {
+		t.Fatalf("expected the second change to fail, got: %v", errs)
+	}
+
+	if changes[1].Status != status.SourceNotFound {
+		t.Fatalf(
+			"expected status %q, got %q",
+			status.SourceNotFound,
+			changes[1].Status,
+		)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "a-renamed.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	dir := t.TempDir()
+
+	original := []string{"docs", "docs/a.txt", "docs/b.txt", "notes.md"}
+
+	for _, name := range original {
+		path := filepath.Join(dir, name)
+
+		var err error
+		if filepath.Ext(name) == "" {
+			err = os.Mkdir(path, 0o750)
+		} else {
+			err = os.WriteFile(path, []byte(name), 0o600)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes := []*file.Change{
+		{BaseDir: filepath.Join(dir, "docs"), Source: "a.txt", Target: "1.txt"},
+		{BaseDir: filepath.Join(dir, "docs"), Source: "b.txt", Target: "sub/2.txt"},
+		{BaseDir: dir, Source: "docs", Target: "papers", IsDir: true},
+		{BaseDir: dir, Source: "notes.md", Target: "notes.md"},
+	}
+
+	conf := &config.Config{
+		WorkingDir: dir,
+		IncludeDir: true,
+		OnError:    config.OnErrorContinue,
+	}
+
+	root := t.TempDir()
+
+	got, err := rename.SimulateIn(context.Background(), conf, changes, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"notes.md",
+		"papers",
+		"papers/1.txt",
+		"papers/sub",
+		"papers/sub/2.txt",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected simulated tree %v, got %v", want, got)
+	}
+
+	for _, name := range original {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("expected the original tree to be unchanged: %v", err)
+		}
+	}
+
+	for _, change := range changes {
+		if change.BaseDir != dir && change.BaseDir != filepath.Join(dir, "docs") {
+			t.Fatalf("expected the original changes to be unchanged: %v", change)
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	isolateDataDir(t)
+
+	dir := t.TempDir()
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes := []*file.Change{
+		{BaseDir: dir, Source: "a.txt", Target: "a-renamed.txt"},
+		{BaseDir: dir, Source: "b.txt", Target: "b-renamed.txt"},
+		{BaseDir: dir, Source: "c.txt", Target: "c-renamed.txt"},
+		{BaseDir: dir, Source: "d.txt", Target: "d-renamed.txt"},
+	}
+
+	conf := &config.Config{
+		WorkingDir: dir,
+		OnError:    config.OnErrorContinue,
+		Exec:       true,
+		Checkpoint: true,
+	}
+
+	// the process crashes while renaming the third file so nothing is
+	// cleaned up or backed up
+	restore := rename.SetRenameFunc(func(oldpath, newpath string) error {
+		if filepath.Base(oldpath) == "c.txt" {
+			panic(errRenameFailed)
+		}
+
+		return os.Rename(oldpath, newpath)
+	})
+
+	func() {
+		defer func() {
+			if r := recover(); r != errRenameFailed {
+				t.Fatalf("expected the rename to crash, got: %v", r)
+			}
+		}()
+
+		_ = rename.Rename(context.Background(), conf, changes)
+	}()
+
+	restore()
+
+	err := rename.Resume(context.Background(), &config.Config{
+		WorkingDir: dir,
+		OnError:    config.OnErrorContinue,
+		Exec:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{
+		"a-renamed.txt",
+		"b-renamed.txt",
+		"c-renamed.txt",
+		"d-renamed.txt",
+	} {
+		_, err = os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the checkpoint is removed once the operation is completed
+	err = rename.Resume(context.Background(), &config.Config{
+		WorkingDir: dir,
+		Exec:       true,
+	})
+	if err == nil {
+		t.Fatal("expected nothing to resume")
+	}
+
+	// the backup covers the changes applied before the interruption
+	err = rename.Undo(context.Background(), &config.Config{
+		WorkingDir: dir,
+		Revert:     true,
+		Exec:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		_, err = os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckpointOptIn(t *testing.T) {
+	isolateDataDir(t)
+
+	dir := t.TempDir()
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes := []*file.Change{
+		{BaseDir: dir, Source: "a.txt", Target: "a-renamed.txt"},
+		{BaseDir: dir, Source: "b.txt", Target: "b-renamed.txt"},
+	}
+
+	restore := rename.SetRenameFunc(func(oldpath, newpath string) error {
+		if filepath.Base(oldpath) == "b.txt" {
+			panic(errRenameFailed)
+		}
+
+		return os.Rename(oldpath, newpath)
+	})
+
+	func() {
+		defer func() {
+			if r := recover(); r != errRenameFailed {
+				t.Fatalf("expected the rename to crash, got: %v", r)
+			}
+		}()
+
+		_ = rename.Rename(context.Background(), &config.Config{
+			WorkingDir: dir,
+			Exec:       true,
+		}, changes)
+	}()
+
+	restore()
+
+	// nothing is recorded unless --checkpoint is set
+	err := rename.Resume(context.Background(), &config.Config{
+		WorkingDir: dir,
+		Exec:       true,
+	})
+	if err == nil {
+		t.Fatal("expected nothing to resume")
+	}
+}
+
+func TestDiskSpaceEstimate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		available   uint64
+		wantWarning bool
+	}{
+		{
+			name:      "the copies fit on the filesystem",
+			available: 1024,
+		},
+		{
+			name:        "the copies exceed the free space",
+			available:   150,
+			wantWarning: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			for _, name := range []string{"a.txt", "b.txt"} {
+				err := os.WriteFile(filepath.Join(dir, name), make([]byte, 100), 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			restore := rename.SetFreeSpaceFunc(func(string) (uint64, error) {
+				return tc.available, nil
+			})
+			defer restore()
+
+			var buf bytes.Buffer
+
+			stdout := report.Stdout
+			report.Stdout = &buf
+
+			defer func() {
+				report.Stdout = stdout
+			}()
+
+			newChanges := func() []*file.Change {
+				return []*file.Change{
+					{BaseDir: dir, Source: "a.txt", Target: "copies/a.txt"},
+					{BaseDir: dir, Source: "b.txt", Target: "copies/b.txt"},
+				}
+			}
+
+			conf := &config.Config{Copy: true}
+
+			err := rename.Rename(context.Background(), conf, newChanges())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []config.DiskSpace{
+				{Dir: dir, Required: 200, Available: int64(tc.available)},
+			}
+
+			if !reflect.DeepEqual(conf.DiskSpace, want) {
+				t.Fatalf("expected estimate %+v, got %+v", want, conf.DiskSpace)
+			}
+
+			gotWarning := strings.Contains(buf.String(), "Not enough free space")
+			if gotWarning != tc.wantWarning {
+				t.Fatalf(
+					"expected warning to be %t, got %t in output:\n%s",
+					tc.wantWarning,
+					gotWarning,
+					buf.String(),
+				)
+			}
+
+			if !tc.wantWarning {
+				return
+			}
+
+			// the copies are not attempted in execute mode
+			conf = &config.Config{Copy: true, Exec: true}
+
+			err = rename.Rename(context.Background(), conf, newChanges())
+			if err == nil {
+				t.Fatal("expected the operation to be aborted")
+			}
+
+			_, err = os.Stat(filepath.Join(dir, "copies"))
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("expected no copies to be made, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCleanupOnFailure(t *testing.T) {
+	isolateDataDir(t)
+
+	testCases := []struct {
+		name    string
+		cleanup bool
+	}{
+		{
+			name: "leave the created directories by default",
+		},
+		{
+			name:    "remove the empty directories after a failure",
+			cleanup: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			for _, name := range []string{"a.txt", "b.txt"} {
+				err := os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var buf bytes.Buffer
+
+			stdout := report.Stdout
+			report.Stdout = &buf
+
+			defer func() {
+				report.Stdout = stdout
+			}()
+
+			restore := rename.SetRenameFunc(func(oldpath, newpath string) error {
+				if filepath.Base(oldpath) == "b.txt" {
+					return errRenameFailed
+				}
+
+				return os.Rename(oldpath, newpath)
+			})
+			defer restore()
+
+			changes := []*file.Change{
+				{BaseDir: dir, Source: "a.txt", Target: "docs/a.txt"},
+				{BaseDir: dir, Source: "b.txt", Target: "notes/2024/b.txt"},
+			}
+
+			conf := &config.Config{
+				OnError:          config.OnErrorContinue,
+				CleanupOnFailure: tc.cleanup,
+				Exec:             true,
+				NoBackup:         true,
+				WorkingDir:       dir,
+			}
+
+			err := rename.Rename(context.Background(), conf, changes)
+
+			var renameErr *rename.RenameError
+			if !errors.As(err, &renameErr) {
+				t.Fatalf("expected a rename error, got: %v", err)
+			}
+
+			// the directory of the successful change is always kept
+			_, err = os.Stat(filepath.Join(dir, "docs", "a.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = os.Stat(filepath.Join(dir, "notes"))
+			if tc.cleanup != errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("unexpected state of the empty directory: %v", err)
+			}
+
+			if !tc.cleanup {
+				return
+			}
+
+			if conf.CreatedDirs != 1 {
+				t.Fatalf("expected 1 created directory, got %d", conf.CreatedDirs)
+			}
+
+			out := buf.String()
+			if !strings.Contains(out, "Removed 2 empty directories") ||
+				!strings.Contains(out, filepath.Join("docs", "a.txt")) {
+				t.Fatalf("unexpected output:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestCopyVerificationFailed(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the copy is reported as corrupted when it is read back
+	restore := rename.SetChecksumFunc(func(_ string) ([]byte, error) {
+		return []byte("corrupted"), nil
+	})
+	defer restore()
+
+	changes := []*file.Change{
+		{BaseDir: dir, Source: "a.txt", Target: "b.txt"},
+	}
+
+	conf := &config.Config{
+		Copy:       true,
+		VerifyCopy: true,
+		OnError:    config.OnErrorContinue,
+	}
+
+	errs := rename.RenameChanges(context.Background(), changes, conf)
+	if len(errs) != 1 || errs[0] != 0 {
+		t.Fatalf("expected the change to fail, got: %v", errs)
+	}
+
+	if changes[0].Error == nil ||
+		!strings.Contains(changes[0].Error.Error(), "checksum") {
+		t.Fatalf("expected a verification error, got: %v", changes[0].Error)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "b.txt"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the corrupted copy to be removed: %v", err)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
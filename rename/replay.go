@@ -0,0 +1,73 @@
+package rename
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+)
+
+var errReplayArchive = errors.New(
+	"operations on the entries of an archive cannot be applied to another directory",
+)
+
+var errReplayOutsideDir = errors.New(
+	"'%s' is outside the working directory ('%s') recorded in the backup file so the operation cannot be applied to another directory",
+)
+
+// LoadReplay reads the operation recorded in the backup file specified
+// through --apply-from-backup so that it can be applied to another directory
+// with the same structure. The base directory of each change is rebased from
+// the recorded working directory onto the new root. The changes are expected
+// to be validated before they are committed like those of a new operation so
+// that any sources which do not exist there are reported as conflicts.
+func LoadReplay(conf *config.Config) ([]*file.Change, error) {
+	o, err := readBackup(conf.ReplayFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Archive != "" {
+		return nil, errReplayArchive
+	}
+
+	root, err := filepath.Abs(conf.ReplayRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*file.Change, 0, len(o.Changes))
+
+	for _, ch := range o.Changes {
+		if filepath.IsAbs(ch.BaseDir) {
+			rel, err := filepath.Rel(o.WorkingDir, ch.BaseDir)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				return nil, fmt.Errorf(
+					errReplayOutsideDir.Error(),
+					ch.BaseDir,
+					o.WorkingDir,
+				)
+			}
+		}
+
+		// the outcome of the recorded operation is not carried over
+		changes = append(changes, &file.Change{
+			BaseDir:        ch.BaseDir,
+			Source:         ch.Source,
+			OriginalSource: ch.Source,
+			Target:         ch.Target,
+			IsDir:          ch.IsDir,
+		})
+	}
+
+	relocate(changes, o.WorkingDir, root, conf)
+
+	// the backup of the applied operation is recorded for the directory
+	// that it was applied to so that it can be undone from there
+	conf.WorkingDir = root
+
+	return changes, nil
+}
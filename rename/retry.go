@@ -0,0 +1,47 @@
+package rename
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/ayoisaiah/f2/internal/config"
+)
+
+// renameFunc is the function used to rename a path on the filesystem.
+var renameFunc = os.Rename
+
+// isTransient reports whether err matches one of the errors that are
+// known to be temporary on the current platform.
+func isTransient(err error) bool {
+	for _, e := range transientErrors {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retry invokes fn and retries it up to `conf.Retries` times if it fails
+// with a transient error. The delay between attempts starts at
+// `conf.RetryDelay` and doubles after each attempt.
+func retry(conf *config.Config, fn func() error) error {
+	delay := conf.RetryDelay
+
+	err := fn()
+
+	for attempt := 0; attempt < conf.Retries; attempt++ {
+		if err == nil || !isTransient(err) {
+			break
+		}
+
+		time.Sleep(delay)
+
+		delay *= 2
+
+		err = fn()
+	}
+
+	return err
+}
@@ -0,0 +1,120 @@
+package rename_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+	"github.com/ayoisaiah/f2/rename"
+)
+
+// failingRename returns a rename function that fails with `err` for the
+// first `failures` calls and renames the path afterwards. The number of
+// calls made is recorded in `calls`.
+func failingRename(
+	err error,
+	failures int,
+	calls *int,
+) func(oldpath, newpath string) error {
+	return func(oldpath, newpath string) error {
+		*calls++
+
+		if *calls <= failures {
+			return &os.LinkError{
+				Op:  "rename",
+				Old: oldpath,
+				New: newpath,
+				Err: err,
+			}
+		}
+
+		return os.Rename(oldpath, newpath)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       error
+		failures  int
+		retries   int
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "succeed after transient failures",
+			err:       syscall.EBUSY,
+			failures:  2,
+			retries:   3,
+			wantCalls: 3,
+		},
+		{
+			name:      "give up when retries are exhausted",
+			err:       syscall.EBUSY,
+			failures:  3,
+			retries:   2,
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		{
+			name:      "no retries by default",
+			err:       syscall.EBUSY,
+			failures:  1,
+			retries:   0,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "do not retry permanent failures",
+			err:       syscall.EACCES,
+			failures:  1,
+			retries:   3,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			err := os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var calls int
+
+			restore := rename.SetRenameFunc(
+				failingRename(tc.err, tc.failures, &calls),
+			)
+			defer restore()
+
+			changes := []*file.Change{
+				{BaseDir: dir, Source: "a.txt", Target: "b.txt"},
+			}
+
+			conf := &config.Config{
+				Retries:    tc.retries,
+				RetryDelay: time.Millisecond,
+			}
+
+			errs := rename.RenameChanges(context.Background(), changes, conf)
+
+			if calls != tc.wantCalls {
+				t.Fatalf("expected %d rename attempts, got %d", tc.wantCalls, calls)
+			}
+
+			if gotErr := len(errs) > 0; gotErr != tc.wantErr {
+				t.Fatalf("expected error: %t, got: %v", tc.wantErr, changes[0].Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package rename
+
+import "syscall"
+
+// transientErrors contains the errors that may be resolved by retrying
+// the operation.
+var transientErrors = []error{
+	syscall.EBUSY,
+	syscall.EAGAIN,
+	syscall.EINTR,
+	syscall.ETXTBSY,
+}
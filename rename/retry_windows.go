@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package rename
+
+import "golang.org/x/sys/windows"
+
+// transientErrors contains the errors that may be resolved by retrying
+// the operation. These are typically caused by another process (such as
+// an antivirus scanner or indexing service) holding the file open.
+var transientErrors = []error{
+	windows.ERROR_SHARING_VIOLATION,
+	windows.ERROR_LOCK_VIOLATION,
+}
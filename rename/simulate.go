@@ -0,0 +1,163 @@
+package rename
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+	"github.com/ayoisaiah/f2/internal/sortfiles"
+	"github.com/ayoisaiah/f2/report"
+)
+
+// mirrorDir returns the location of the directory within the simulation
+// root. Directories within the working directory keep their relative
+// location while others are reproduced from the root of the filesystem.
+func mirrorDir(root, workingDir, dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(workingDir, abs)
+	if err != nil || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = strings.TrimPrefix(abs, filepath.VolumeName(abs))
+	}
+
+	return filepath.Join(root, rel), nil
+}
+
+// mirror reproduces the sources of the changes within the simulation root.
+// Only the directory structure is reproduced so files are created empty. The
+// returned changes refer to the reproduced paths.
+func mirror(
+	root, workingDir string,
+	changes []*file.Change,
+) ([]*file.Change, error) {
+	mirrored := make([]*file.Change, len(changes))
+
+	for i, change := range changes {
+		baseDir, err := mirrorDir(root, workingDir, change.BaseDir)
+		if err != nil {
+			return nil, err
+		}
+
+		sourcePath := filepath.Join(baseDir, change.Source)
+
+		//nolint:gomnd // number can be understood from context
+		if change.IsDir {
+			err = os.MkdirAll(sourcePath, 0o750)
+		} else {
+			err = os.MkdirAll(filepath.Dir(sourcePath), 0o750)
+			if err == nil {
+				err = os.WriteFile(sourcePath, nil, 0o600)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		ch := *change
+		ch.BaseDir = baseDir
+		mirrored[i] = &ch
+	}
+
+	return mirrored, nil
+}
+
+// tree returns the path of each file and directory within the root relative
+// to it. Each directory is followed by its contents in lexical order.
+func tree(root string) ([]string, error) {
+	var paths []string
+
+	err := filepath.WalkDir(root, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		paths = append(paths, filepath.ToSlash(rel))
+
+		return nil
+	})
+
+	return paths, err
+}
+
+// simulate performs the renaming operation on a copy of the directory
+// structure of the sources within root and returns the resulting tree. The
+// original files are left untouched.
+func simulate(
+	ctx context.Context,
+	conf *config.Config,
+	fileChanges []*file.Change,
+	root string,
+) ([]string, error) {
+	changes, err := mirror(root, conf.WorkingDir, fileChanges)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.IncludeDir {
+		changes = sortfiles.FilesBeforeDirs(changes, conf.Revert)
+	}
+
+	if conf.StagedRename {
+		changes = stageChanges(changes)
+	} else if conf.Swap && !conf.Copy {
+		changes = orderSwaps(changes)
+	}
+
+	c := *conf
+	c.Verbose = false
+
+	rename(ctx, changes, &c, nil)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		if change.Error != nil {
+			return nil, change.Error
+		}
+	}
+
+	return tree(root)
+}
+
+// Simulate performs the renaming operation on a temporary copy of the
+// directory structure of the sources and prints the resulting tree. The copy
+// is discarded afterwards.
+func Simulate(
+	ctx context.Context,
+	conf *config.Config,
+	fileChanges []*file.Change,
+) error {
+	root, err := os.MkdirTemp("", "f2-simulate-")
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(root)
+
+	paths, err := simulate(ctx, conf, fileChanges, root)
+	if err != nil {
+		return err
+	}
+
+	return report.SimulatedTree(paths)
+}
@@ -0,0 +1,66 @@
+package rename
+
+import (
+	"path/filepath"
+
+	"github.com/ayoisaiah/f2/internal/file"
+)
+
+// stageChanges arranges the changes so that the sources are moved to
+// temporary names before any of them is moved to its target. No source is ever
+// in the way of a target, even one in another directory, so sets of
+// overlapping changes such as rotations (a -> b, b -> c, c -> a) are renamed
+// regardless of their order. The changes are grouped by the directories of
+// their sources in the order that their first change appears in, and the
+// returned changes include the temporary steps so that the operation can be
+// recorded and reverted exactly.
+func stageChanges(changes []*file.Change) []*file.Change {
+	var dirs []string
+
+	groups := make(map[string][]*file.Change)
+
+	for _, change := range changes {
+		dir := filepath.Join(change.BaseDir, filepath.Dir(change.Source))
+
+		if _, ok := groups[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+
+		groups[dir] = append(groups[dir], change)
+	}
+
+	staged := make([]*file.Change, 0, len(changes)*2)
+
+	// the final steps are only taken once every source has been vacated
+	// since a target may be a source in another directory
+	var final []*file.Change
+
+	for _, dir := range dirs {
+		for _, change := range groups[dir] {
+			sourcePath := filepath.Join(change.BaseDir, change.Source)
+			targetPath := filepath.Join(change.BaseDir, change.Target)
+
+			if sourcePath == targetPath {
+				staged = append(staged, change)
+				continue
+			}
+
+			tempName := tempSwapName(change)
+
+			staged = append(staged, &file.Change{
+				BaseDir:        change.BaseDir,
+				Source:         change.Source,
+				OriginalSource: change.OriginalSource,
+				Target:         tempName,
+				IsDir:          change.IsDir,
+				Status:         change.Status,
+			})
+
+			ch := *change
+			ch.Source = tempName
+			final = append(final, &ch)
+		}
+	}
+
+	return append(staged, final...)
+}
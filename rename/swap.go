@@ -0,0 +1,118 @@
+package rename
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/ayoisaiah/f2/internal/file"
+)
+
+// tempSwapName returns a temporary name for the source of a change that is
+// part of a cycle so that its original path can be vacated.
+func tempSwapName(change *file.Change) string {
+	timeStr := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	return filepath.Join(
+		filepath.Dir(change.Source),
+		"__"+timeStr+"__"+filepath.Base(change.Source),
+	)
+}
+
+// orderSwaps arranges the changes so that no source path is overwritten
+// before it has been renamed. Cycles such as swapping the names of two files
+// (a -> b, b -> a) are broken by moving one of the sources to a temporary name
+// first, and moving it to its intended target once the rest of the cycle has
+// been renamed. The returned changes include the temporary steps so that the
+// operation can be recorded and reverted exactly.
+func orderSwaps(changes []*file.Change) []*file.Change {
+	bySource := make(map[string]*file.Change, len(changes))
+
+	for _, change := range changes {
+		sourcePath := filepath.Join(change.BaseDir, change.Source)
+		targetPath := filepath.Join(change.BaseDir, change.Target)
+
+		if sourcePath != targetPath {
+			bySource[sourcePath] = change
+		}
+	}
+
+	// occupant returns the change whose source is located at the target of
+	// the provided change (if any)
+	occupant := func(change *file.Change) *file.Change {
+		next := bySource[filepath.Join(change.BaseDir, change.Target)]
+		if next == change {
+			return nil
+		}
+
+		return next
+	}
+
+	ordered := make([]*file.Change, 0, len(changes))
+	done := make(map[*file.Change]bool, len(changes))
+
+	for _, change := range changes {
+		if done[change] {
+			continue
+		}
+
+		// follow the chain of changes whose targets are occupied
+		var chain []*file.Change
+
+		onChain := make(map[*file.Change]int)
+
+		current := change
+		for current != nil && !done[current] {
+			if _, ok := onChain[current]; ok {
+				break
+			}
+
+			onChain[current] = len(chain)
+			chain = append(chain, current)
+			current = occupant(current)
+		}
+
+		for _, ch := range chain {
+			done[ch] = true
+		}
+
+		cycleStart, isCycle := onChain[current]
+		if current == nil || !isCycle {
+			// each target is vacated before it is needed when the
+			// chain is renamed in reverse
+			for i := len(chain) - 1; i >= 0; i-- {
+				ordered = append(ordered, chain[i])
+			}
+
+			continue
+		}
+
+		// break the cycle by moving the first change in the cycle out
+		// of the way
+		first := chain[cycleStart]
+		tempName := tempSwapName(first)
+
+		ordered = append(ordered, &file.Change{
+			BaseDir:        first.BaseDir,
+			Source:         first.Source,
+			OriginalSource: first.OriginalSource,
+			Target:         tempName,
+			IsDir:          first.IsDir,
+			Status:         first.Status,
+		})
+
+		for i := len(chain) - 1; i > cycleStart; i-- {
+			ordered = append(ordered, chain[i])
+		}
+
+		final := *first
+		final.Source = tempName
+		ordered = append(ordered, &final)
+
+		for i := cycleStart - 1; i >= 0; i-- {
+			ordered = append(ordered, chain[i])
+		}
+	}
+
+	return ordered
+}
@@ -1,20 +1,21 @@
 package rename
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/adrg/xdg"
 	"github.com/pterm/pterm"
 
 	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
 	internaljson "github.com/ayoisaiah/f2/internal/json"
-	internalos "github.com/ayoisaiah/f2/internal/os"
 	internalpath "github.com/ayoisaiah/f2/internal/path"
 	"github.com/ayoisaiah/f2/internal/sortfiles"
 	"github.com/ayoisaiah/f2/report"
@@ -32,37 +33,144 @@ var errBackupFileRemovalFailed = errors.New(
 	"unable to remove redundant backup file '%s' after reverting the changes. Please remove it manually",
 )
 
-// Undo reverses a renaming operation according to the relevant backup file.
-// The undo file is deleted if the operation is successfully reverted.
-func Undo(conf *config.Config) error {
-	dir := strings.ReplaceAll(conf.WorkingDir, internalpath.Separator, "_")
-	if runtime.GOOS == internalos.Windows {
-		dir = strings.ReplaceAll(dir, ":", "_")
-	}
+// backupFile returns the path to the backup file for the operation that is
+// to be reverted. An explicitly specified backup file takes precedence over
+// the one derived from the current working directory.
+func backupFile(conf *config.Config) (string, error) {
+	if conf.UndoFile != "" {
+		if _, err := os.Stat(conf.UndoFile); err != nil {
+			return "", err
+		}
 
-	file := dir + ".json"
+		return conf.UndoFile, nil
+	}
 
 	backupFilePath, err := xdg.SearchDataFile(
-		filepath.Join("f2", "backups", file),
+		filepath.Join("f2", "backups", backupName(conf.WorkingDir)),
 	)
 	if err != nil {
-		return errNothingToUndo
+		return "", errNothingToUndo
 	}
 
+	return backupFilePath, nil
+}
+
+// relocate resolves the base directory of each change against the directory
+// that the original tree now lives in. Absolute base directories within the
+// recorded working directory are rebased onto the new root, while relative
+// ones are resolved against it.
+func relocate(
+	changes []*file.Change,
+	recordedWorkingDir, root string,
+	conf *config.Config,
+) {
+	for i := range changes {
+		ch := changes[i]
+
+		// relative paths are already resolved against the current
+		// working directory
+		if !filepath.IsAbs(ch.BaseDir) {
+			if root != conf.WorkingDir {
+				ch.BaseDir = filepath.Join(root, ch.BaseDir)
+			}
+
+			continue
+		}
+
+		if root == recordedWorkingDir {
+			continue
+		}
+
+		rel, err := filepath.Rel(recordedWorkingDir, ch.BaseDir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		ch.BaseDir = filepath.Join(root, rel)
+	}
+}
+
+// readBackup decodes the operation recorded in the specified backup file.
+// Escaped names are restored to their original bytes.
+func readBackup(backupFilePath string) (*internaljson.Output, error) {
 	fileBytes, err := os.ReadFile(backupFilePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var o internaljson.Output
 
 	err = json.Unmarshal(fileBytes, &o)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.EscapedNames {
+		for i := range o.Changes {
+			o.Changes[i].Source = internalpath.UnescapeInvalidUTF8(o.Changes[i].Source)
+			o.Changes[i].Target = internalpath.UnescapeInvalidUTF8(o.Changes[i].Target)
+		}
+	}
+
+	return &o, nil
+}
+
+// removeCreatedDirs removes the directories that were created during the
+// renaming operation if they are empty after it is reverted. The deepest
+// directories are removed first so that their parents can be removed too.
+func removeCreatedDirs(changes []*file.Change) {
+	var dirs []string
+
+	for _, ch := range changes {
+		for _, dir := range ch.CreatedDirs {
+			dirs = append(dirs, filepath.Join(ch.BaseDir, dir))
+		}
+	}
+
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return len(dirs[i]) > len(dirs[j])
+	})
+
+	for _, dir := range dirs {
+		// os.Remove fails for directories that are not empty
+		// which ensures that they are left alone
+		_ = os.Remove(dir)
+	}
+}
+
+// Undo reverses a renaming operation according to the relevant backup file.
+// The undo file is deleted if the operation is successfully reverted except
+// if it was specified explicitly through --undo-file.
+func Undo(ctx context.Context, conf *config.Config) error {
+	backupFilePath, err := backupFile(conf)
+	if err != nil {
+		return err
+	}
+
+	o, err := readBackup(backupFilePath)
 	if err != nil {
 		return err
 	}
 
 	changes := o.Changes
 
+	root := o.WorkingDir
+
+	if conf.RelocateTo != "" {
+		root, err = filepath.Abs(conf.RelocateTo)
+		if err != nil {
+			return err
+		}
+	}
+
+	relocate(changes, o.WorkingDir, root, conf)
+
+	// the sources of a copy were never moved so only the copies need to
+	// be removed
+	if o.Copy {
+		return undoCopy(conf, o, backupFilePath)
+	}
+
 	for i := range changes {
 		ch := changes[i]
 
@@ -75,22 +183,112 @@ func Undo(conf *config.Config) error {
 		changes[i] = ch
 	}
 
+	// The changes are reverted in the opposite order to the one in which
+	// they were committed so that paths which depend on each other (such
+	// as in a swap) are restored correctly
+	for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+		changes[i], changes[j] = changes[j], changes[i]
+	}
+
 	// Always sort files before directories when undoing an operation
 	sortfiles.FilesBeforeDirs(changes, conf.Revert)
 
-	err = Rename(conf, changes)
+	// the tracked files are moved back through Git so that the index
+	// matches the restored names
+	if o.Git {
+		conf.UseGit = true
+	}
+
+	// the entries of an archive are reverted by restoring the backup
+	// of the original archive
+	if o.Archive != "" && conf.Exec {
+		err = restoreArchive(o.Archive, o.ArchiveBackup)
+		if err != nil {
+			return err
+		}
+
+		return removeBackupFile(conf, backupFilePath)
+	}
+
+	err = Rename(ctx, conf, changes)
 	if err != nil {
-		report.NonInteractive(changes)
+		report.NonInteractive(conf, changes)
 		return errUndoFailed
 	}
 
 	if conf.Exec {
-		if err = os.Remove(backupFilePath); err != nil {
-			return fmt.Errorf(
-				errBackupFileRemovalFailed.Error(),
-				pterm.LightYellow(backupFilePath),
-			)
+		removeCreatedDirs(changes)
+
+		err = restoreLinks(o.RemovedLinks)
+		if err != nil {
+			return err
 		}
+
+		return removeBackupFile(conf, backupFilePath)
+	}
+
+	return nil
+}
+
+// undoCopy reverts a copying operation by removing the copies that it
+// created. The sources are left alone so that any changes made to them since
+// the operation are preserved. The deepest copies are removed first followed
+// by any directories that were created for them.
+func undoCopy(
+	conf *config.Config,
+	o *internaljson.Output,
+	backupFilePath string,
+) error {
+	changes := make([]*file.Change, len(o.Changes))
+	copy(changes, o.Changes)
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return len(filepath.Join(changes[i].BaseDir, changes[i].Target)) >
+			len(filepath.Join(changes[j].BaseDir, changes[j].Target))
+	})
+
+	if !conf.Exec {
+		report.RemovedCopies(conf, changes)
+		return nil
+	}
+
+	for _, ch := range changes {
+		target := filepath.Join(ch.BaseDir, ch.Target)
+
+		var err error
+		if ch.IsDir {
+			err = os.RemoveAll(target)
+		} else {
+			err = os.Remove(target)
+		}
+
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	removeCreatedDirs(changes)
+
+	err := restoreLinks(o.RemovedLinks)
+	if err != nil {
+		return err
+	}
+
+	return removeBackupFile(conf, backupFilePath)
+}
+
+// removeBackupFile deletes the backup file once the operation has been
+// reverted unless it was specified explicitly through --undo-file.
+func removeBackupFile(conf *config.Config, backupFilePath string) error {
+	if conf.UndoFile != "" {
+		return nil
+	}
+
+	if err := os.Remove(backupFilePath); err != nil {
+		return fmt.Errorf(
+			errBackupFileRemovalFailed.Error(),
+			pterm.LightYellow(backupFilePath),
+		)
 	}
 
 	return nil
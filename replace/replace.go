@@ -5,15 +5,25 @@ package replace
 
 import (
 	"errors"
+	"fmt"
+	"io/fs"
 	"math"
+	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 
-	"github.com/ayoisaiah/f2/find"
 	"github.com/ayoisaiah/f2/internal/config"
 	"github.com/ayoisaiah/f2/internal/file"
+	internalos "github.com/ayoisaiah/f2/internal/os"
 	internalpath "github.com/ayoisaiah/f2/internal/path"
 	"github.com/ayoisaiah/f2/internal/sortfiles"
 	"github.com/ayoisaiah/f2/internal/status"
@@ -21,6 +31,20 @@ import (
 
 var errInvalidSubmatches = errors.New("Invalid number of submatches")
 
+var errInvalidDateLayout = errors.New(
+	"Invalid date layout: it must contain at least one element of the reference time 'Mon Jan 2 15:04:05 MST 2006'",
+)
+
+var errNoNumberInName = errors.New("no number was found in the file name")
+
+var errTargetsCountMismatch = errors.New(
+	"the number of names in the targets file '%s' (%d) does not match the number of matches (%d). Use --partial to apply the available names",
+)
+
+var errIdenticalTarget = errors.New(
+	"an identical file already exists at '%s'",
+)
+
 type numbersToSkip struct {
 	min int
 	max int
@@ -32,11 +56,15 @@ type indexVarMatch struct {
 	format string
 	skip   []numbersToSkip
 	val    []string
-	step   struct {
+	// name identifies a counter whose value is shared by every
+	// index variable with the same name
+	name string
+	step struct {
 		isSet bool
 		value int
 	}
 	startNumber int
+	startIsSet  bool
 }
 
 type indexVars struct {
@@ -103,9 +131,19 @@ type dateVars struct {
 	matches []dateVarMatch
 }
 
+type fileDateVarMatch struct {
+	regex  *regexp.Regexp
+	layout string
+}
+
+type fileDateVars struct {
+	matches []fileDateVarMatch
+}
+
 type hashVarMatch struct {
 	regex          *regexp.Regexp
 	hashFn         hashAlgorithm
+	length         int
 	transformToken string
 	val            []string
 }
@@ -126,6 +164,33 @@ type randomVars struct {
 	matches []randomVarMatch
 }
 
+type uuidVarMatch struct {
+	regex          *regexp.Regexp
+	transformToken string
+}
+
+type uuidVars struct {
+	matches []uuidVarMatch
+}
+
+type typeVarMatch struct {
+	regex          *regexp.Regexp
+	transformToken string
+}
+
+type typeVars struct {
+	matches []typeVarMatch
+}
+
+type numVarMatch struct {
+	regex  *regexp.Regexp
+	offset int
+}
+
+type numVars struct {
+	matches []numVarMatch
+}
+
 type csvVarMatch struct {
 	regex          *regexp.Regexp
 	transformToken string
@@ -165,6 +230,28 @@ type parentDirVars struct {
 	matches []parentDirVarMatch
 }
 
+type prevTargetVarMatch struct {
+	regex          *regexp.Regexp
+	transformToken string
+}
+
+type prevTargetVars struct {
+	matches []prevTargetVarMatch
+}
+
+type chainVarMatch struct {
+	regex          *regexp.Regexp
+	transformToken string
+}
+
+type chainVars struct {
+	matches []chainVarMatch
+}
+
+type batchIndexVars struct {
+	matches []*regexp.Regexp
+}
+
 type variables struct {
 	exif      exifVars
 	exiftool  exiftoolVars
@@ -172,12 +259,19 @@ type variables struct {
 	id3       id3Vars
 	hash      hashVars
 	date      dateVars
+	fileDate  fileDateVars
 	random    randomVars
+	uuid      uuidVars
+	fileType  typeVars
+	num       numVars
 	transform transformVars
 	csv       csvVars
 	filename  filenameVars
 	ext       extVars
 	parentDir parentDirVars
+	prev      prevTargetVars
+	chain     chainVars
+	batch     batchIndexVars
 }
 
 // getCSVVars retrieves all the csv variables in the replacement
@@ -195,7 +289,7 @@ func getCSVVars(replacementInput string) (csvVars, error) {
 
 			var match csvVarMatch
 
-			regex, err := regexp.Compile(submatch[0])
+			regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 			if err != nil {
 				return csv, err
 			}
@@ -239,7 +333,7 @@ func getDateVars(replacementInput string) (dateVars, error) {
 
 		var match dateVarMatch
 
-		regex, err := regexp.Compile(submatch[0])
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 		if err != nil {
 			return dateVarMatches, err
 		}
@@ -256,6 +350,51 @@ func getDateVars(replacementInput string) (dateVars, error) {
 	return dateVarMatches, nil
 }
 
+// getFileDateVars retrieves all the file date variables in the replacement
+// string if any. Each layout is validated to ensure that it contains at
+// least one element of Go's reference time.
+func getFileDateVars(replacementInput string) (fileDateVars, error) {
+	var fileDateMatches fileDateVars
+
+	if !fileDateVarRegex.MatchString(replacementInput) {
+		return fileDateMatches, nil
+	}
+
+	submatches := fileDateVarRegex.FindAllStringSubmatch(replacementInput, -1)
+	expectedLength := 2
+
+	// a layout without any reference elements is unchanged by formatting
+	sample := time.Date(1999, time.December, 31, 23, 59, 58, 0, time.UTC)
+
+	for _, submatch := range submatches {
+		if len(submatch) < expectedLength {
+			return fileDateMatches, errInvalidSubmatches
+		}
+
+		layout := submatch[1]
+
+		if sample.Format(layout) == layout {
+			return fileDateMatches, fmt.Errorf(
+				"%w: '%s'",
+				errInvalidDateLayout,
+				layout,
+			)
+		}
+
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
+		if err != nil {
+			return fileDateMatches, err
+		}
+
+		fileDateMatches.matches = append(
+			fileDateMatches.matches,
+			fileDateVarMatch{regex: regex, layout: layout},
+		)
+	}
+
+	return fileDateMatches, nil
+}
+
 // getHashVars retrieves all the hash variables in the replacement
 // string if any.
 func getHashVars(replacementInput string) (hashVars, error) {
@@ -269,7 +408,7 @@ func getHashVars(replacementInput string) (hashVars, error) {
 		replacementInput,
 		-1,
 	)
-	expectedLength := 3
+	expectedLength := 4
 
 	for _, submatch := range submatches {
 		if len(submatch) < expectedLength {
@@ -278,15 +417,23 @@ func getHashVars(replacementInput string) (hashVars, error) {
 
 		var match hashVarMatch
 
-		regex, err := regexp.Compile(submatch[0])
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 		if err != nil {
 			return hashMatches, err
 		}
 
+		// the full hash is used if the length is unset
+		if submatch[2] != "" {
+			match.length, err = strconv.Atoi(submatch[2])
+			if err != nil {
+				return hashMatches, err
+			}
+		}
+
 		match.regex = regex
 		match.val = submatch
 		match.hashFn = hashAlgorithm(submatch[1])
-		match.transformToken = submatch[2]
+		match.transformToken = submatch[3]
 
 		hashMatches.matches = append(hashMatches.matches, match)
 	}
@@ -316,7 +463,7 @@ func getTransformVars(replacementInput string) (transformVars, error) {
 
 		var match transformVarMatch
 
-		regex, err := regexp.Compile(submatch[0])
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 		if err != nil {
 			return transformVarMatches, err
 		}
@@ -356,7 +503,7 @@ func getExifVars(replacementInput string) (exifVars, error) {
 
 		var match exifVarMatch
 
-		regex, err := regexp.Compile(submatch[0])
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 		if err != nil {
 			return exifMatches, err
 		}
@@ -392,7 +539,7 @@ func getIndexingVars(replacementInput string) (indexVars, error) {
 		replacementInput,
 		-1,
 	)
-	expectedLength := 8
+	expectedLength := 9
 
 	for i, submatch := range submatches {
 		if len(submatch) < expectedLength {
@@ -401,7 +548,7 @@ func getIndexingVars(replacementInput string) (indexVars, error) {
 
 		var match indexVarMatch
 
-		regex, err := regexp.Compile(submatch[0])
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 		if err != nil {
 			return indexMatches, err
 		}
@@ -414,16 +561,17 @@ func getIndexingVars(replacementInput string) (indexVars, error) {
 		}
 
 		if submatch[2] != "" {
+			match.startIsSet = true
+
 			match.startNumber, err = strconv.Atoi(submatch[2])
 			if err != nil {
 				return indexMatches, err
 			}
-		} else {
-			match.startNumber = 1
 		}
 
 		match.index = submatch[3]
 		match.format = submatch[5]
+		match.name = submatch[8]
 
 		if submatch[6] != "" {
 			match.step.isSet = true
@@ -499,7 +647,7 @@ func getExifToolVars(replacementInput string) (exiftoolVars, error) {
 
 		var match exiftoolVarMatch
 
-		regex, err := regexp.Compile(submatch[0])
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 		if err != nil {
 			return exiftoolMatches, err
 		}
@@ -537,7 +685,7 @@ func getID3Vars(replacementInput string) (id3Vars, error) {
 
 		var match id3VarMatch
 
-		regex, err := regexp.Compile(submatch[0])
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 		if err != nil {
 			return id3Matches, err
 		}
@@ -553,6 +701,111 @@ func getID3Vars(replacementInput string) (id3Vars, error) {
 	return id3Matches, nil
 }
 
+// getNumVars retrieves all the number variables in the replacement
+// string if any.
+func getNumVars(replacementInput string) (numVars, error) {
+	var numMatches numVars
+
+	if !numVarRegex.MatchString(replacementInput) {
+		return numMatches, nil
+	}
+
+	submatches := numVarRegex.FindAllStringSubmatch(replacementInput, -1)
+	expectedLength := 2
+
+	for _, submatch := range submatches {
+		if len(submatch) < expectedLength {
+			return numMatches, errInvalidSubmatches
+		}
+
+		var match numVarMatch
+
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
+		if err != nil {
+			return numMatches, err
+		}
+
+		match.regex = regex
+
+		if submatch[1] != "" {
+			match.offset, err = strconv.Atoi(submatch[1])
+			if err != nil {
+				return numMatches, err
+			}
+		}
+
+		numMatches.matches = append(numMatches.matches, match)
+	}
+
+	return numMatches, nil
+}
+
+// getTypeVars retrieves all the file type variables in the replacement
+// string if any.
+func getTypeVars(replacementInput string) (typeVars, error) {
+	var typeMatches typeVars
+
+	if !typeVarRegex.MatchString(replacementInput) {
+		return typeMatches, nil
+	}
+
+	submatches := typeVarRegex.FindAllStringSubmatch(replacementInput, -1)
+	expectedLength := 2
+
+	for _, submatch := range submatches {
+		if len(submatch) < expectedLength {
+			return typeMatches, errInvalidSubmatches
+		}
+
+		var match typeVarMatch
+
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
+		if err != nil {
+			return typeMatches, err
+		}
+
+		match.regex = regex
+		match.transformToken = submatch[1]
+
+		typeMatches.matches = append(typeMatches.matches, match)
+	}
+
+	return typeMatches, nil
+}
+
+// getUUIDVars retrieves all the UUID variables in the replacement
+// string if any.
+func getUUIDVars(replacementInput string) (uuidVars, error) {
+	var uuidMatches uuidVars
+
+	if !uuidVarRegex.MatchString(replacementInput) {
+		return uuidMatches, nil
+	}
+
+	submatches := uuidVarRegex.FindAllStringSubmatch(replacementInput, -1)
+	expectedLength := 2
+
+	for _, submatch := range submatches {
+		if len(submatch) < expectedLength {
+			return uuidMatches, errInvalidSubmatches
+		}
+
+		var match uuidVarMatch
+
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
+		if err != nil {
+			return uuidMatches, err
+		}
+
+		match.regex = regex
+		match.transformToken = submatch[1]
+
+		uuidMatches.matches = append(uuidMatches.matches, match)
+	}
+
+	return uuidMatches, nil
+}
+
 // getRandomVars retrieves all the random variables in the
 // replacement string if any.
 func getRandomVars(replacementInput string) (randomVars, error) {
@@ -578,7 +831,7 @@ func getRandomVars(replacementInput string) (randomVars, error) {
 		match.length = 10
 		match.val = submatch
 
-		regex, err := regexp.Compile(submatch[0])
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 		if err != nil {
 			return rvMatches, err
 		}
@@ -625,7 +878,7 @@ func getExtVars(replacementInput string) (extVars, error) {
 
 		var match extVarMatch
 
-		regex, err := regexp.Compile(submatch[0])
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 		if err != nil {
 			return evMatches, err
 		}
@@ -649,7 +902,7 @@ func getParentDirVars(replacementInput string) (parentDirVars, error) {
 
 	submatches := parentDirVarRegex.FindAllStringSubmatch(replacementInput, -1)
 
-	expectedLength := 3
+	expectedLength := 4
 
 	for _, submatch := range submatches {
 		if len(submatch) < expectedLength {
@@ -658,7 +911,7 @@ func getParentDirVars(replacementInput string) (parentDirVars, error) {
 
 		var match parentDirVarMatch
 
-		regex, err := regexp.Compile(submatch[0])
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 		if err != nil {
 			return pvMatches, err
 		}
@@ -666,14 +919,20 @@ func getParentDirVars(replacementInput string) (parentDirVars, error) {
 		match.regex = regex
 		match.parent = 1
 
-		if submatch[1] != "" {
-			match.parent, err = strconv.Atoi(submatch[1])
+		// the level is specified as {2p} or {parent.2}
+		level := submatch[1]
+		if level == "" {
+			level = submatch[2]
+		}
+
+		if level != "" {
+			match.parent, err = strconv.Atoi(level)
 			if err != nil {
 				return pvMatches, err
 			}
 		}
 
-		match.transformToken = submatch[2]
+		match.transformToken = submatch[3]
 
 		pvMatches.matches = append(pvMatches.matches, match)
 	}
@@ -699,7 +958,7 @@ func getFilenameVars(replacementInput string) (filenameVars, error) {
 
 		var match filenameVarMatch
 
-		regex, err := regexp.Compile(submatch[0])
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
 		if err != nil {
 			return fvMatches, err
 		}
@@ -714,6 +973,89 @@ func getFilenameVars(replacementInput string) (filenameVars, error) {
 	return fvMatches, nil
 }
 
+// getPrevTargetVars retrieves all the variables that refer to the target of
+// the preceding change in the replacement string if any.
+func getPrevTargetVars(replacementInput string) (prevTargetVars, error) {
+	var prevMatches prevTargetVars
+
+	if !prevTargetRegex.MatchString(replacementInput) {
+		return prevMatches, nil
+	}
+
+	submatches := prevTargetRegex.FindAllStringSubmatch(replacementInput, -1)
+	expectedLength := 2
+
+	for _, submatch := range submatches {
+		if len(submatch) < expectedLength {
+			return prevMatches, errInvalidSubmatches
+		}
+
+		var match prevTargetVarMatch
+
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
+		if err != nil {
+			return prevMatches, err
+		}
+
+		match.regex = regex
+		match.transformToken = submatch[1]
+
+		prevMatches.matches = append(prevMatches.matches, match)
+	}
+
+	return prevMatches, nil
+}
+
+// getChainVars retrieves all the variables that refer to the name produced by
+// the preceding replacements in the replacement string if any.
+func getChainVars(replacementInput string) (chainVars, error) {
+	var chainMatches chainVars
+
+	if !chainVarRegex.MatchString(replacementInput) {
+		return chainMatches, nil
+	}
+
+	submatches := chainVarRegex.FindAllStringSubmatch(replacementInput, -1)
+	expectedLength := 2
+
+	for _, submatch := range submatches {
+		if len(submatch) < expectedLength {
+			return chainMatches, errInvalidSubmatches
+		}
+
+		var match chainVarMatch
+
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch[0]))
+		if err != nil {
+			return chainMatches, err
+		}
+
+		match.regex = regex
+		match.transformToken = submatch[1]
+
+		chainMatches.matches = append(chainMatches.matches, match)
+	}
+
+	return chainMatches, nil
+}
+
+// getBatchIndexVars retrieves all the {index} variables in the replacement
+// string if any.
+func getBatchIndexVars(replacementInput string) (batchIndexVars, error) {
+	var batchMatches batchIndexVars
+
+	for _, submatch := range batchIndexRegex.FindAllString(replacementInput, -1) {
+		regex, err := regexp.Compile(regexp.QuoteMeta(submatch))
+		if err != nil {
+			return batchMatches, err
+		}
+
+		batchMatches.matches = append(batchMatches.matches, regex)
+	}
+
+	return batchMatches, nil
+}
+
 // extractVariables retrieves all the variables present in the replacement
 // string.
 func extractVariables(replacement string) (variables, error) {
@@ -761,11 +1103,31 @@ func extractVariables(replacement string) (variables, error) {
 		return vars, err
 	}
 
+	vars.fileDate, err = getFileDateVars(replacement)
+	if err != nil {
+		return vars, err
+	}
+
 	vars.random, err = getRandomVars(replacement)
 	if err != nil {
 		return vars, err
 	}
 
+	vars.uuid, err = getUUIDVars(replacement)
+	if err != nil {
+		return vars, err
+	}
+
+	vars.fileType, err = getTypeVars(replacement)
+	if err != nil {
+		return vars, err
+	}
+
+	vars.num, err = getNumVars(replacement)
+	if err != nil {
+		return vars, err
+	}
+
 	vars.exiftool, err = getExifToolVars(replacement)
 	if err != nil {
 		return vars, err
@@ -781,59 +1143,92 @@ func extractVariables(replacement string) (variables, error) {
 		return vars, err
 	}
 
+	vars.prev, err = getPrevTargetVars(replacement)
+	if err != nil {
+		return vars, err
+	}
+
+	vars.chain, err = getChainVars(replacement)
+	if err != nil {
+		return vars, err
+	}
+
+	vars.batch, err = getBatchIndexVars(replacement)
+	if err != nil {
+		return vars, err
+	}
+
 	return vars, nil
 }
 
 // regexReplace replaces matched substrings in the input with the replacement.
 // It respects the specified replacement limit. A negative limit indicates that
-// replacement should start from the end of the fileName.
+// replacement should start from the end of the fileName. A limit of zero
+// replaces all matches.
 func regexReplace(
 	regex *regexp.Regexp,
 	input, replacement string,
 	replaceLimit int,
 ) string {
-	var output string
-
-	switch limit := replaceLimit; {
-	case limit > 0:
-		counter := 0
-		output = regex.ReplaceAllStringFunc(
-			input,
-			func(val string) string {
-				if counter == replaceLimit {
-					return val
-				}
+	if replaceLimit == 0 {
+		return regex.ReplaceAllString(input, replacement)
+	}
 
-				counter++
-				return regex.ReplaceAllString(val, replacement)
-			},
-		)
-	case limit < 0:
-		matches := regex.FindAllString(input, -1)
-
-		l := len(matches) + limit
-		counter := 0
-		output = regex.ReplaceAllStringFunc(
-			input,
-			func(val string) string {
-				if counter >= l {
-					return regex.ReplaceAllString(val, replacement)
-				}
+	matches := regex.FindAllStringSubmatchIndex(input, -1)
 
-				counter++
-				return val
-			},
-		)
-	default:
-		output = regex.ReplaceAllString(input, replacement)
+	start, end := matchRange(len(matches), replaceLimit)
+
+	var output []byte
+
+	lastIndex := 0
+
+	for _, match := range matches[start:end] {
+		output = append(output, input[lastIndex:match[0]]...)
+		// expanding against the full input ensures that capture
+		// variables refer to the original match context
+		output = regex.ExpandString(output, replacement, input, match)
+		lastIndex = match[1]
+	}
+
+	output = append(output, input[lastIndex:]...)
+
+	return string(output)
+}
+
+// matchRange determines the range of matches to be replaced according to the
+// replacement limit.
+func matchRange(n, replaceLimit int) (start, end int) {
+	start, end = 0, n
+	if replaceLimit > 0 && replaceLimit < end {
+		end = replaceLimit
+	} else if replaceLimit < 0 && n+replaceLimit > 0 {
+		start = n + replaceLimit
 	}
 
-	return output
+	return start, end
 }
 
 // replaceString replaces all matches in the filename
-// with the replacement string.
+// with the replacement string. In ReplaceScopeName mode, the entire filename
+// is replaced instead and capture variables are expanded against the first
+// match that is within the replacement limit.
 func replaceString(conf *config.Config, originalName string) string {
+	if conf.ReplaceScope == config.ReplaceScopeName {
+		matches := conf.SearchRegex.FindAllStringSubmatchIndex(originalName, -1)
+
+		start, end := matchRange(len(matches), conf.ReplaceLimit)
+		if start == end {
+			return originalName
+		}
+
+		return string(conf.SearchRegex.ExpandString(
+			nil,
+			conf.Replacement,
+			originalName,
+			matches[start],
+		))
+	}
+
 	return regexReplace(
 		conf.SearchRegex,
 		originalName,
@@ -842,20 +1237,236 @@ func replaceString(conf *config.Config, originalName string) string {
 	)
 }
 
-// replaceMatches handles the replacement of matches in each file with the
-// replacement string.
-func replaceMatches(
-	conf *config.Config,
-	matches []*file.Change,
-) ([]*file.Change, error) {
-	vars, err := extractVariables(conf.Replacement)
-	if err != nil {
-		return nil, err
+// annotate describes how the current find pattern applies to the searched
+// part of the source name: each match within the replacement limit along with
+// its capture groups and the expansion of the replacement for the match, and
+// the target that results from the replacement.
+func annotate(conf *config.Config, originalName, target string) []string {
+	matches := conf.SearchRegex.FindAllStringSubmatchIndex(originalName, -1)
+
+	start, end := matchRange(len(matches), conf.ReplaceLimit)
+
+	times := "times"
+	if end-start == 1 {
+		times = "time"
+	}
+
+	annotations := []string{
+		fmt.Sprintf("pattern '%s' matched %d %s", conf.SearchRegex, end-start, times),
 	}
 
+	names := conf.SearchRegex.SubexpNames()
+
+	for _, match := range matches[start:end] {
+		var groups []string
+
+		for g := 1; g < len(match)/2; g++ {
+			value := "<unmatched>"
+			if match[2*g] >= 0 {
+				value = fmt.Sprintf("'%s'", originalName[match[2*g]:match[2*g+1]])
+			}
+
+			group := fmt.Sprintf("$%d", g)
+			if names[g] != "" {
+				group = fmt.Sprintf("$%d (%s)", g, names[g])
+			}
+
+			groups = append(groups, group+"="+value)
+		}
+
+		annotation := fmt.Sprintf(
+			"'%s' at %d-%d",
+			originalName[match[0]:match[1]],
+			match[0],
+			match[1],
+		)
+
+		if len(groups) > 0 {
+			annotation += ": " + strings.Join(groups, ", ")
+		}
+
+		expansion := conf.SearchRegex.ExpandString(
+			nil,
+			conf.Replacement,
+			originalName,
+			match,
+		)
+
+		annotations = append(
+			annotations,
+			fmt.Sprintf("%s → '%s'", annotation, expansion),
+		)
+	}
+
+	return append(annotations, fmt.Sprintf("result: '%s'", target))
+}
+
+// countersGrouped reports whether the index numbers restart for each group
+// of changes instead of running across all of them.
+func countersGrouped(conf *config.Config) bool {
+	return conf.CounterGroupBy != "" ||
+		conf.CounterScope != config.CounterScopeGlobal
+}
+
+// counterGroup returns the key that determines which changes share the same
+// sequence of index numbers according to the counter scope, or the grouping
+// expression if set.
+func counterGroup(conf *config.Config, change *file.Change) string {
+	if conf.CounterGroupBy != "" {
+		return customCounterGroup(conf, change)
+	}
+
+	switch conf.CounterScope {
+	case config.CounterScopePerDir:
+		return change.BaseDir
+	case config.CounterScopePerRoot:
+		return change.Root
+	}
+
+	return ""
+}
+
+// customCounterGroup returns the grouping key of the change according to
+// the --counter-group-by expression. The key is computed from the path of
+// the change relative to its path argument with forward slashes as the
+// separators. The changes that the regular expression does not match share
+// the same group.
+func customCounterGroup(conf *config.Config, change *file.Change) string {
+	dir := change.BaseDir
+
+	if change.Root != "" {
+		if rel, err := filepath.Rel(change.Root, change.BaseDir); err == nil {
+			dir = rel
+		}
+	}
+
+	dir = filepath.ToSlash(dir)
+
+	if conf.CounterGroupLevel > 0 {
+		if dir == "." {
+			return ""
+		}
+
+		parts := strings.Split(dir, "/")
+		if len(parts) > conf.CounterGroupLevel {
+			parts = parts[:conf.CounterGroupLevel]
+		}
+
+		return strings.Join(parts, "/")
+	}
+
+	path := filepath.ToSlash(change.Source)
+	if dir != "." {
+		path = dir + "/" + path
+	}
+
+	match := conf.CounterGroupRegex.FindStringSubmatch(path)
+
+	switch {
+	case match == nil:
+		return ""
+	case len(match) == 1:
+		return match[0]
+	default:
+		// the groups are joined with a separator that cannot occur in a
+		// path so that different combinations produce different keys
+		return strings.Join(match[1:], "\x00")
+	}
+}
+
+// matchesOriginal reports whether the current find pattern matches the
+// original name of the change regardless of the preceding replacements. Unless
+// the rules of a rules file are chained, each rule only applies to the files
+// whose original names it matches.
+func matchesOriginal(conf *config.Config, change *file.Change) bool {
+	name := change.OriginalSource
+
+	if conf.IgnoreExt && !change.IsDir {
+		name = internalpath.FilenameWithoutExtension(name)
+	}
+
+	if conf.ExtOnly && !change.IsDir {
+		name = internalpath.Extension(name)
+	}
+
+	if conf.AllowInvalidUTF8 && !utf8.ValidString(name) {
+		name = internalpath.EscapeInvalidUTF8(name)
+	}
+
+	return conf.SearchRegex.MatchString(name)
+}
+
+// expandNamedTransforms rewrites the transformations of named capture groups
+// (`{<name>.up}`) to the form that refers to the group by its index
+// (`{<$1>.up}`). Names that are not groups in the search pattern are
+// transformed as literal text.
+func expandNamedTransforms(replacement string, re *regexp.Regexp) string {
+	if re == nil {
+		return replacement
+	}
+
+	return namedTransformVarRegex.ReplaceAllStringFunc(
+		replacement,
+		func(s string) string {
+			name := namedTransformVarRegex.FindStringSubmatch(s)[1]
+
+			index := re.SubexpIndex(name)
+			if index < 1 {
+				return s
+			}
+
+			return "{<$" + strconv.Itoa(index) + ">."
+		},
+	)
+}
+
+// replaceMatches handles the replacement of matches in each file with the
+// replacement string.
+func replaceMatches(
+	conf *config.Config,
+	matches []*file.Change,
+	tmpl *template.Template,
+) ([]*file.Change, error) {
+	vars, err := extractVariables(conf.Replacement)
+	if err != nil {
+		return nil, err
+	}
+
+	groupIndex := make(map[string]int)
+
+	// the first change for each file that has several hard links
+	hardlinks := make(map[string]*file.Change)
+
 	for i := range matches {
 		change := matches[i]
 		change.Index = i
+
+		if first, ok := hardlinks[change.HardlinkID]; ok {
+			change.CounterIndex = first.CounterIndex
+		} else {
+			group := counterGroup(conf, change)
+
+			change.CounterIndex = groupIndex[group]
+			groupIndex[group]++
+
+			// skipped numbers are tracked separately for each group
+			if countersGrouped(conf) && change.CounterIndex == 0 {
+				conf.NumberOffset = nil
+			}
+
+			if change.HardlinkID != "" {
+				hardlinks[change.HardlinkID] = change
+			}
+		}
+
+		if len(conf.Rules) > 0 && !conf.ChainRules &&
+			!matchesOriginal(conf, change) {
+			change.Target = change.Source
+			change.Status = status.OK
+
+			continue
+		}
+
 		originalName := change.Source
 		fileExt := filepath.Ext(originalName)
 
@@ -863,19 +1474,73 @@ func replaceMatches(
 			originalName = internalpath.FilenameWithoutExtension(originalName)
 		}
 
-		change.Target = replaceString(conf, originalName)
+		extOnly := conf.ExtOnly && !change.IsDir
+		if extOnly {
+			originalName = internalpath.Extension(originalName)
+		}
 
-		// Replace any variables present with their corresponding values
-		err = replaceVariables(conf, change, &vars)
-		if err != nil {
-			return nil, err
+		// invalid bytes are escaped so that they can be matched and
+		// restored afterwards instead of being replaced with U+FFFD
+		escaped := conf.AllowInvalidUTF8 && !utf8.ValidString(originalName)
+		if escaped {
+			originalName = internalpath.EscapeInvalidUTF8(originalName)
+		}
+
+		if tmpl != nil {
+			// variables are not supported in templates since the
+			// same information is available in the template data
+			change.Target, err = templateReplace(
+				conf,
+				tmpl,
+				originalName,
+				newTemplateData(conf, change),
+			)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			change.Target = replaceString(conf, originalName)
+
+			// the targets are computed in order so the preceding change
+			// already has its target for this replacement
+			var prevTarget string
+			if i > 0 {
+				prevTarget = matches[i-1].Target
+			}
+
+			// Replace any variables present with their corresponding values
+			err = replaceVariables(conf, change, &vars, prevTarget)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if conf.Annotate {
+			change.Annotations = append(
+				change.Annotations,
+				annotate(conf, originalName, change.Target)...,
+			)
 		}
 
 		// Reattach the original extension to the new file name
-		if conf.IgnoreExt && !change.IsDir {
+		if conf.IgnoreExt && conf.ReattachExt && !change.IsDir {
 			change.Target += fileExt
 		}
 
+		// Reattach the original name to the new extension
+		if extOnly {
+			stem := internalpath.FilenameWithoutExtension(change.Source)
+			if change.Target != "" {
+				stem += "."
+			}
+
+			change.Target = stem + change.Target
+		}
+
+		if escaped {
+			change.Target = internalpath.UnescapeInvalidUTF8(change.Target)
+		}
+
 		change.Target = strings.TrimSpace(filepath.Clean(change.Target))
 		change.Status = status.OK
 		matches[i] = change
@@ -890,12 +1555,42 @@ func handleReplacementChain(
 ) ([]*file.Change, error) {
 	replacementSlice := conf.ReplacementSlice
 
+	var templates []*template.Template
+
+	// the templates are parsed before any replacement is made
+	if conf.TemplateMode {
+		var err error
+
+		templates, err = parseTemplates(replacementSlice)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	for i, v := range replacementSlice {
-		config.SetReplacement(v)
+		// expand the shorthand form of capture variable transformations
+		// (`{$1.title}`) to the bracketed form (`{<$1>.title}`)
+		v = captureTransformVarRegex.ReplaceAllString(v, "{<${1}>.${2}}")
+
+		// the rules are searched for through a combined pattern, but
+		// each rule is applied with its own pattern
+		if i == 0 && len(conf.Rules) > 0 {
+			err := conf.SetFindStringRegex(0)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		conf.Replacement = expandNamedTransforms(v, conf.SearchRegex)
+
+		var tmpl *template.Template
+		if conf.TemplateMode {
+			tmpl = templates[i]
+		}
 
 		var err error
 
-		matches, err = replaceMatches(conf, matches)
+		matches, err = replaceMatches(conf, matches, tmpl)
 		if err != nil {
 			return nil, err
 		}
@@ -903,6 +1598,11 @@ func handleReplacementChain(
 		for j := range matches {
 			change := matches[j]
 
+			// the intermediate results are reported in verbose mode
+			if conf.Verbose && len(replacementSlice) > 1 {
+				change.Stages = append(change.Stages, change.Target)
+			}
+
 			// Update the source to the target from the previous replacement
 			// in preparation for the next replacement
 			if i != len(replacementSlice)-1 {
@@ -927,13 +1627,192 @@ func handleReplacementChain(
 	return matches, nil
 }
 
+// addAffixes inserts the configured prefix and suffix around the name of the
+// target. The suffix is placed before the extension of files unless it is
+// configured to be appended after it.
+func addAffixes(conf *config.Config, change *file.Change) string {
+	dir, name := filepath.Split(change.Target)
+
+	ext := filepath.Ext(name)
+	if change.IsDir || conf.SuffixAfterExt || ext == name {
+		ext = ""
+	}
+
+	stem := strings.TrimSuffix(name, ext)
+
+	return dir + conf.Prefix + stem + conf.Suffix + ext
+}
+
+// normalizeUnicode converts the target to the specified normalization form so
+// that names which look identical are also encoded identically.
+func normalizeUnicode(form, target string) string {
+	if form == config.NormalizeNFD {
+		return norm.NFD.String(target)
+	}
+
+	return norm.NFC.String(target)
+}
+
+// routeByExt places the target of a file in the directory that is mapped to
+// its extension. Files with unmapped extensions are placed in the default
+// directory if one is configured, or left as is otherwise.
+func routeByExt(conf *config.Config, change *file.Change) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(change.Target), "."))
+
+	dir, ok := conf.RouteByExt[ext]
+	if !ok {
+		dir, ok = conf.RouteByExt[config.RouteDefault]
+	}
+
+	if !ok {
+		return change.Target
+	}
+
+	return filepath.Join(dir, change.Target)
+}
+
+// intoTargetDir places the target in the directory specified through
+// --target-dir. The target is expressed relative to the base directory of the
+// change. In --preserve-structure mode, the directory of the source relative
+// to the path argument that it was found in is recreated under the target
+// directory.
+func intoTargetDir(conf *config.Config, change *file.Change) (string, error) {
+	baseDir, err := filepath.Abs(change.BaseDir)
+	if err != nil {
+		return "", err
+	}
+
+	dir := conf.TargetDir
+
+	if conf.PreserveStructure && change.Root != "" {
+		root, err := filepath.Abs(change.Root)
+		if err != nil {
+			return "", err
+		}
+
+		rel, err := filepath.Rel(root, baseDir)
+		if err != nil {
+			return "", err
+		}
+
+		dir = filepath.Join(dir, rel)
+	}
+
+	return filepath.Rel(baseDir, filepath.Join(dir, change.Target))
+}
+
+// trimName strips the specified characters (or whitespace if none are
+// specified) from the ends of the last component of the target. The stem of a
+// file is trimmed separately so that the characters next to its extension
+// are removed as well, while the extension itself is preserved.
+func trimName(target string, isDir bool, cutset string) string {
+	trim := func(r rune) bool {
+		return strings.ContainsRune(cutset, r)
+	}
+
+	if cutset == "" {
+		trim = unicode.IsSpace
+	}
+
+	dir, name := filepath.Split(target)
+
+	// the characters after the extension such as the trailing dots that
+	// are not allowed on Windows are removed first
+	name = strings.TrimRightFunc(name, trim)
+
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	// directories and dotfiles such as `.bashrc` have no extension
+	if isDir || stem == "" {
+		stem, ext = name, ""
+	}
+
+	return dir + strings.TrimFunc(stem, trim) + ext
+}
+
+// collapseSeparators reduces each run of the specified separator characters in
+// every component of the target to the first character of the run, and trims
+// the separators from the ends of each component. The extension of the last
+// component is left as is.
+func collapseSeparators(target, separators string) string {
+	if separators == "" {
+		return target
+	}
+
+	components := strings.Split(filepath.ToSlash(target), "/")
+
+	for i, component := range components {
+		ext := filepath.Ext(component)
+		stem := strings.TrimSuffix(component, ext)
+
+		// only the last component has an extension, and dotfiles such as
+		// `.bashrc` have none
+		if i != len(components)-1 || stem == "" {
+			stem, ext = component, ""
+		}
+
+		var b strings.Builder
+
+		var prevIsSeparator bool
+
+		for _, r := range stem {
+			isSeparator := strings.ContainsRune(separators, r)
+			if isSeparator && prevIsSeparator {
+				continue
+			}
+
+			prevIsSeparator = isSeparator
+
+			b.WriteRune(r)
+		}
+
+		components[i] = strings.Trim(b.String(), separators) + ext
+	}
+
+	return filepath.FromSlash(strings.Join(components, "/"))
+}
+
+// matchedDirs returns the directories that contain matches in the order they
+// were searched. Directories that were not recorded during the search (such as
+// those from a CSV file) are sorted after them.
+func matchedDirs(
+	conf *config.Config,
+	matches internalpath.Collection,
+) []string {
+	dirs := make([]string, 0, len(matches))
+
+	seen := make(map[string]bool, len(matches))
+
+	for _, dir := range conf.SearchedDirs {
+		if _, ok := matches[dir]; ok && !seen[dir] {
+			dirs = append(dirs, dir)
+			seen[dir] = true
+		}
+	}
+
+	var rest []string
+
+	for dir := range matches {
+		if !seen[dir] {
+			rest = append(rest, dir)
+		}
+	}
+
+	sort.Strings(rest)
+
+	return append(dirs, rest...)
+}
+
 // c creates a file.Change struct for each match.
 func c(conf *config.Config, matches internalpath.Collection) []*file.Change {
 	var changes []*file.Change
 
-	rows := find.GetCSVRows()
+	rows := conf.CSVRows
+
+	for _, path := range matchedDirs(conf, matches) {
+		dirEntry := matches[path]
 
-	for path, dirEntry := range matches {
 		for _, entry := range dirEntry {
 			filename := filepath.Clean(entry.Name())
 			change := &file.Change{
@@ -941,6 +1820,15 @@ func c(conf *config.Config, matches internalpath.Collection) []*file.Change {
 				IsDir:          entry.IsDir(),
 				Source:         filename,
 				OriginalSource: filename,
+				Root:           conf.DirRoots[path],
+				Links:          conf.LinkedTargets[filepath.Join(path, filename)],
+			}
+
+			// errors are ignored here since the modification time will
+			// be retrieved from the filesystem later if it is needed
+			if info, err := entry.Info(); err == nil {
+				change.ModTime = info.ModTime()
+				change.Size = info.Size()
 			}
 
 			if conf.CSVFilename != "" {
@@ -955,6 +1843,239 @@ func c(conf *config.Config, matches internalpath.Collection) []*file.Change {
 	return changes
 }
 
+// Changes creates a change for each match without a target. The changes are
+// sorted according to the configured sort value.
+func Changes(
+	conf *config.Config,
+	matches internalpath.Collection,
+) ([]*file.Change, error) {
+	return sortfiles.Changes(c(conf, matches), conf.Sort, conf.ReverseSort)
+}
+
+// groupHardlinks identifies the changes whose sources are hard links to the
+// same file. In HardlinkGroupFirst mode, only the first change for each file
+// is kept. Directories and the entries of archives are not considered.
+func groupHardlinks(
+	conf *config.Config,
+	changes []*file.Change,
+) ([]*file.Change, error) {
+	seen := make(map[string]bool)
+
+	result := changes[:0]
+
+	for _, change := range changes {
+		if change.IsDir || conf.FS != nil {
+			result = append(result, change)
+			continue
+		}
+
+		id, err := internalos.FileID(
+			filepath.Join(change.BaseDir, change.OriginalSource),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[id] && conf.HardlinkGroup == config.HardlinkGroupFirst {
+			continue
+		}
+
+		seen[id] = true
+		change.HardlinkID = id
+
+		result = append(result, change)
+	}
+
+	return result, nil
+}
+
+// applyTargets pairs the names in the targets file with the changes in the
+// order that they are sorted in. In partial mode, the changes without a
+// corresponding name are dropped and the extra names are ignored.
+func applyTargets(
+	conf *config.Config,
+	changes []*file.Change,
+) ([]*file.Change, error) {
+	if len(conf.Targets) != len(changes) && !conf.PartialTargets {
+		return nil, fmt.Errorf(
+			errTargetsCountMismatch.Error(),
+			conf.TargetsFile,
+			len(conf.Targets),
+			len(changes),
+		)
+	}
+
+	if len(changes) > len(conf.Targets) {
+		changes = changes[:len(conf.Targets)]
+	}
+
+	for i, change := range changes {
+		change.Target = filepath.Join(
+			filepath.Dir(change.Source),
+			filepath.FromSlash(conf.Targets[i]),
+		)
+	}
+
+	return changes, nil
+}
+
+// applyMapTargets assigns the target recorded for each source in the map file
+// to its change.
+func applyMapTargets(conf *config.Config, changes []*file.Change) {
+	for i, change := range changes {
+		change.Index = i
+
+		target, ok := conf.MapTargets[filepath.Join(
+			change.BaseDir,
+			change.OriginalSource,
+		)]
+		if !ok {
+			continue
+		}
+
+		change.Target = filepath.Join(
+			filepath.Dir(change.Source),
+			filepath.FromSlash(target),
+		)
+		change.Status = status.OK
+	}
+}
+
+// compactGlobalIndices renumbers the global indices of the changes that are
+// left after some were removed so that they remain contiguous while keeping
+// their order.
+func compactGlobalIndices(changes []*file.Change) {
+	ordered := make([]*file.Change, len(changes))
+	copy(ordered, changes)
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].GlobalIndex < ordered[j].GlobalIndex
+	})
+
+	for i := range ordered {
+		ordered[i].GlobalIndex = i
+	}
+}
+
+// SkipEmptyTargets removes the changes whose targets have an empty name so
+// that they are left unchanged instead of being reported as conflicts.
+func SkipEmptyTargets(changes []*file.Change) []*file.Change {
+	result := changes[:0]
+
+	for _, change := range changes {
+		if change.HasEmptyTarget() {
+			continue
+		}
+
+		result = append(result, change)
+	}
+
+	return result
+}
+
+// SkipAlreadyNamed removes the changes whose source path is identical to the
+// target path so that they are not validated or reported.
+func SkipAlreadyNamed(changes []*file.Change) []*file.Change {
+	result := changes[:0]
+
+	for _, change := range changes {
+		sourcePath := filepath.Join(change.BaseDir, change.Source)
+		targetPath := filepath.Join(change.BaseDir, change.Target)
+
+		if sourcePath == targetPath {
+			continue
+		}
+
+		result = append(result, change)
+	}
+
+	return result
+}
+
+// identical reports whether the target is an existing regular file with the
+// same contents as the source. The contents are compared by their SHA-256
+// hashes once their sizes are found to match.
+func identical(conf *config.Config, sourcePath, targetPath string) bool {
+	sourceInfo, err := os.Stat(sourcePath)
+	if err != nil || !sourceInfo.Mode().IsRegular() {
+		return false
+	}
+
+	targetInfo, err := os.Stat(targetPath)
+	if err != nil || !targetInfo.Mode().IsRegular() ||
+		os.SameFile(sourceInfo, targetInfo) ||
+		sourceInfo.Size() != targetInfo.Size() {
+		return false
+	}
+
+	sourceHash, err := getHash(conf, sourcePath, sha256Hash)
+	if err != nil {
+		return false
+	}
+
+	targetHash, err := getHash(conf, targetPath, sha256Hash)
+	if err != nil {
+		return false
+	}
+
+	return sourceHash == targetHash
+}
+
+// SkipIdentical removes the changes whose target already exists with the same
+// contents as the source so that it is neither overwritten nor reported as a
+// conflict. The removed changes are recorded in conf.SkippedPaths and
+// returned along with the remaining changes.
+func SkipIdentical(
+	conf *config.Config,
+	changes []*file.Change,
+) ([]*file.Change, []file.SkippedPath) {
+	var skipped []file.SkippedPath
+
+	result := changes[:0]
+
+	for _, change := range changes {
+		sourcePath := filepath.Join(change.BaseDir, change.Source)
+		targetPath := filepath.Join(change.BaseDir, change.Target)
+
+		if sourcePath != targetPath && identical(conf, sourcePath, targetPath) {
+			skipped = append(skipped, file.SkippedPath{
+				Path:  sourcePath,
+				Error: fmt.Sprintf(errIdenticalTarget.Error(), targetPath),
+			})
+
+			continue
+		}
+
+		result = append(result, change)
+	}
+
+	conf.SkippedPaths = append(conf.SkippedPaths, skipped...)
+
+	return result, skipped
+}
+
+// Explain computes the target of the specified path while recording the
+// intermediate result of each replacement in the change.
+func Explain(conf *config.Config, path string) (*file.Change, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	path = filepath.Clean(path)
+
+	conf.Verbose = true
+
+	changes, err := Replace(conf, internalpath.Collection{
+		filepath.Dir(path): {fs.FileInfoToDirEntry(info)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes[0], nil
+}
+
 // Replace applies the file name replacements according to the --replace
 // argument.
 func Replace(
@@ -965,17 +2086,110 @@ func Replace(
 
 	var changes []*file.Change
 
-	changes = c(conf, matches)
+	// a non-zero seed is fixed even if it was not set through --seed
+	conf.Random, err = newRandom(conf.Seed, conf.SeedSet || conf.Seed != 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// the hashes computed in a previous operation are discarded since the
+	// files may have changed in the meantime
+	conf.Hashes = nil
 
-	changes, err = sortfiles.Changes(changes, conf.Sort, conf.ReverseSort)
+	changes, err = Changes(conf, matches)
 	if err != nil {
 		return nil, err
 	}
 
+	for i := range changes {
+		changes[i].GlobalIndex = i
+	}
+
+	// group the changes by directory or path argument so that
+	// each group is numbered contiguously
+	if countersGrouped(conf) {
+		sort.SliceStable(changes, func(i, j int) bool {
+			return counterGroup(conf, changes[i]) <
+				counterGroup(conf, changes[j])
+		})
+	}
+
+	if conf.HardlinkGroup != "" {
+		changes, err = groupHardlinks(conf, changes)
+		if err != nil {
+			return nil, err
+		}
+
+		compactGlobalIndices(changes)
+	}
+
 	changes, err = handleReplacementChain(conf, changes)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(conf.Targets) > 0 {
+		changes, err = applyTargets(conf, changes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.MapTargets != nil {
+		applyMapTargets(conf, changes)
+	}
+
+	if conf.Prefix != "" || conf.Suffix != "" {
+		for _, change := range changes {
+			// empty targets are left for the conflict detection
+			if change.Target == "." || change.Target == "" {
+				continue
+			}
+
+			change.Target = addAffixes(conf, change)
+		}
+	}
+
+	if conf.CollapseSeparators {
+		for _, change := range changes {
+			change.Target = collapseSeparators(change.Target, conf.Separators)
+		}
+	}
+
+	if conf.Trim {
+		for _, change := range changes {
+			change.Target = trimName(change.Target, change.IsDir, conf.TrimChars)
+		}
+	}
+
+	if conf.NormalizeUnicode != "" {
+		for _, change := range changes {
+			change.Target = normalizeUnicode(conf.NormalizeUnicode, change.Target)
+		}
+	}
+
+	if len(conf.RouteByExt) > 0 {
+		for _, change := range changes {
+			if change.IsDir || change.Target == "." || change.Target == "" {
+				continue
+			}
+
+			change.Target = routeByExt(conf, change)
+		}
+	}
+
+	if conf.TargetDir != "" {
+		for _, change := range changes {
+			if change.Target == "." || change.Target == "" {
+				continue
+			}
+
+			change.Target, err = intoTargetDir(conf, change)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	return changes, nil
 }
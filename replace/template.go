@@ -0,0 +1,185 @@
+package replace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ayoisaiah/f2/internal/config"
+	"github.com/ayoisaiah/f2/internal/file"
+	internalpath "github.com/ayoisaiah/f2/internal/path"
+)
+
+// templateFuncs are the functions available to replacement templates in
+// addition to the builtin ones. The string being operated on is always the
+// last argument so that the functions can be used in pipelines.
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"title": func(s string) string { return transformString(s, "ti") },
+	"trim":  strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string {
+		return strings.TrimPrefix(s, prefix)
+	},
+	"trimSuffix": func(suffix, s string) string {
+		return strings.TrimSuffix(s, suffix)
+	},
+	"replace": func(old, replacement, s string) string {
+		return strings.ReplaceAll(s, old, replacement)
+	},
+	"contains": func(substr, s string) bool {
+		return strings.Contains(s, substr)
+	},
+	"hasPrefix": func(prefix, s string) bool {
+		return strings.HasPrefix(s, prefix)
+	},
+	"hasSuffix": func(suffix, s string) bool {
+		return strings.HasSuffix(s, suffix)
+	},
+	"pad": func(width, n int) string {
+		return fmt.Sprintf("%0*d", width, n)
+	},
+}
+
+// templateData is the context in which a replacement template is executed
+// for each match.
+type templateData struct {
+	// ModTime is the modification time of the source
+	ModTime time.Time
+	// Name is the name of the source including its extension
+	Name string
+	// Stem is the name of the source without its extension
+	Stem string
+	// Ext is the extension of the source including the leading dot
+	Ext string
+	// Dir is the directory of the source
+	Dir string
+	// Match is the text matched by the find pattern
+	Match string
+	// Groups contains the text matched by the capture groups of the find
+	// pattern starting from the first group
+	Groups []string
+	// Index is the position of the change in the sorted batch starting
+	// from 1
+	Index int
+	// Counter is the value of the index variables for the change
+	Counter int
+	// Size is the size of the source in bytes
+	Size  int64
+	IsDir bool
+}
+
+// parseTemplates parses each replacement as a template so that syntax errors
+// are reported before any match is replaced.
+func parseTemplates(replacements []string) ([]*template.Template, error) {
+	templates := make([]*template.Template, len(replacements))
+
+	for i, r := range replacements {
+		tmpl, err := template.New("replacement").
+			Funcs(templateFuncs).
+			Option("missingkey=error").
+			Parse(r)
+		if err != nil {
+			return nil, err
+		}
+
+		templates[i] = tmpl
+	}
+
+	return templates, nil
+}
+
+// newTemplateData creates the context for executing a template against the
+// source of the change.
+func newTemplateData(conf *config.Config, change *file.Change) templateData {
+	data := templateData{
+		Name:    change.Source,
+		Stem:    change.Source,
+		Dir:     change.BaseDir,
+		Index:   change.Index + 1,
+		Counter: conf.CounterStart + change.CounterIndex*conf.CounterStep,
+		ModTime: change.ModTime,
+		IsDir:   change.IsDir,
+	}
+
+	if !change.IsDir {
+		data.Ext = filepath.Ext(change.Source)
+		data.Stem = internalpath.FilenameWithoutExtension(change.Source)
+	}
+
+	// the size is unavailable for the entries of archives
+	info, err := os.Lstat(filepath.Join(change.BaseDir, change.OriginalSource))
+	if err == nil && conf.FS == nil {
+		data.Size = info.Size()
+	}
+
+	return data
+}
+
+// setMatch updates the data with the text matched by the find pattern and its
+// capture groups.
+func (data *templateData) setMatch(name string, match []int) {
+	data.Match = name[match[0]:match[1]]
+	data.Groups = nil
+
+	for i := 2; i < len(match); i += 2 {
+		var group string
+		if match[i] >= 0 {
+			group = name[match[i]:match[i+1]]
+		}
+
+		data.Groups = append(data.Groups, group)
+	}
+}
+
+// templateReplace replaces the matches in the name with the output of the
+// template. The template is executed for each match so that the capture
+// groups refer to that match. The replacement limit is respected just like in
+// regexReplace. In ReplaceScopeName mode, the entire name is replaced with the
+// output of the template for the first match instead.
+func templateReplace(
+	conf *config.Config,
+	tmpl *template.Template,
+	name string,
+	data templateData,
+) (string, error) {
+	matches := conf.SearchRegex.FindAllStringSubmatchIndex(name, -1)
+
+	start, end := matchRange(len(matches), conf.ReplaceLimit)
+
+	var output strings.Builder
+
+	if conf.ReplaceScope == config.ReplaceScopeName {
+		if start == end {
+			return name, nil
+		}
+
+		data.setMatch(name, matches[start])
+
+		err := tmpl.Execute(&output, data)
+
+		return output.String(), err
+	}
+
+	lastIndex := 0
+
+	for _, match := range matches[start:end] {
+		output.WriteString(name[lastIndex:match[0]])
+
+		data.setMatch(name, match)
+
+		err := tmpl.Execute(&output, data)
+		if err != nil {
+			return "", err
+		}
+
+		lastIndex = match[1]
+	}
+
+	output.WriteString(name[lastIndex:])
+
+	return output.String(), nil
+}
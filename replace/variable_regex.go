@@ -2,10 +2,8 @@ package replace
 
 import (
 	"fmt"
-	"math/rand"
 	"regexp"
 	"strings"
-	"time"
 
 	internaltime "github.com/ayoisaiah/f2/internal/time"
 )
@@ -18,15 +16,39 @@ var (
 	parentDirVarRegex *regexp.Regexp
 	indexVarRegex     *regexp.Regexp
 	randomVarRegex    *regexp.Regexp
+	uuidVarRegex      *regexp.Regexp
 	hashVarRegex      *regexp.Regexp
+	typeVarRegex      *regexp.Regexp
+	numVarRegex       *regexp.Regexp
 	transformVarRegex *regexp.Regexp
 	csvVarRegex       *regexp.Regexp
 	exiftoolVarRegex  *regexp.Regexp
 	id3VarRegex       *regexp.Regexp
 	exifVarRegex      *regexp.Regexp
 	dateVarRegex      *regexp.Regexp
+	fileDateVarRegex  *regexp.Regexp
+	prevTargetRegex   *regexp.Regexp
+	chainVarRegex     *regexp.Regexp
+	batchIndexRegex   *regexp.Regexp
+	globalIndexRegex  *regexp.Regexp
+	inodeRegex        *regexp.Regexp
+	sizeHumanRegex    *regexp.Regexp
+	sizeBucketRegex   *regexp.Regexp
+	matchCountRegex   *regexp.Regexp
 )
 
+// numberRegex matches the runs of digits that are used by number variables.
+var numberRegex = regexp.MustCompile(`\d+`)
+
+// captureTransformVarRegex matches the shorthand form of transforming
+// a capture variable such as `{$1.title}`. It supports the same tokens as
+// the `{<$1>.title}` form.
+var captureTransformVarRegex *regexp.Regexp
+
+// namedTransformVarRegex matches the start of a transformation that may refer
+// to a named capture group such as `{<name>.up}`.
+var namedTransformVarRegex = regexp.MustCompile(`{<([A-Za-z_]\w*)>\.`)
+
 var dateTokens = map[string]string{
 	"YYYY": "2006",
 	"YY":   "06",
@@ -58,7 +80,7 @@ func init() {
 	tokenString := strings.Join(tokens, "|")
 
 	transformTokens = fmt.Sprintf(
-		"(up|lw|ti|win|mac|di|(?:dt\\.(%s)))",
+		"(up|lw|low|ti|title|sc|sentence|win|mac|di|(?:dt\\.(%s))|(?:map\\([^(){}]*\\)))",
 		tokenString,
 	)
 
@@ -69,10 +91,13 @@ func init() {
 		fmt.Sprintf("{+ext(?:\\.%s)?}+", transformTokens),
 	)
 	parentDirVarRegex = regexp.MustCompile(
-		fmt.Sprintf("{+(\\d+)?p(?:\\.%s)?}+", transformTokens),
+		fmt.Sprintf(
+			"{+(?:(\\d+)?p|parent(?:\\.(\\d+))?)(?:\\.%s)?}+",
+			transformTokens,
+		),
 	)
 	indexVarRegex = regexp.MustCompile(
-		`{+(\$\d+)?(\d+)?(%(\d?)+d)([borh])?(-?\d+)?(?:<(\d+(?:-\d+)?(?:;\s*\d+(?:-\d+)?)*)>)?}+`,
+		`{+(\$\d+)?(\d+)?(%(\d?)+d)([borh])?(-?\d+)?(?:<(\d+(?:-\d+)?(?:;\s*\d+(?:-\d+)?)*)>)?(?::(\w+))?}+`,
 	)
 	randomVarRegex = regexp.MustCompile(
 		fmt.Sprintf(
@@ -80,15 +105,25 @@ func init() {
 			transformTokens,
 		),
 	)
+	uuidVarRegex = regexp.MustCompile(
+		fmt.Sprintf("{+uuid(?:\\.%s)?}+", transformTokens),
+	)
+	typeVarRegex = regexp.MustCompile(
+		fmt.Sprintf("{+type(?:\\.%s)?}+", transformTokens),
+	)
+	numVarRegex = regexp.MustCompile(`{+num([+-]\d+)?}+`)
 	hashVarRegex = regexp.MustCompile(
 		fmt.Sprintf(
-			"{+hash.(sha1|sha256|sha512|md5)(?:\\.%s)?}+",
+			"{+hash[.:](sha1|sha256|sha512|md5)(?::(\\d+))?(?:\\.%s)?}+",
 			transformTokens,
 		),
 	)
 	transformVarRegex = regexp.MustCompile(
 		fmt.Sprintf("{+(?:<(?:(\\$\\d+)|([^\\.]+))>)?\\.%s}+", transformTokens),
 	)
+	captureTransformVarRegex = regexp.MustCompile(
+		fmt.Sprintf("{(\\$\\d+)\\.%s}", transformTokens),
+	)
 	csvVarRegex = regexp.MustCompile(
 		fmt.Sprintf("{+csv.(\\d+)(?:\\.%s)?}+", transformTokens),
 	)
@@ -112,13 +147,25 @@ func init() {
 		),
 	)
 
+	fileDateVarRegex = regexp.MustCompile(`{+fdate\.([^{}]+?)}+`)
+
+	prevTargetRegex = regexp.MustCompile(
+		fmt.Sprintf("{+prev\\.target(?:\\.%s)?}+", transformTokens),
+	)
+	chainVarRegex = regexp.MustCompile(
+		fmt.Sprintf("{+chain(?:\\.%s)?}+", transformTokens),
+	)
+	batchIndexRegex = regexp.MustCompile(`{+index}+`)
+	globalIndexRegex = regexp.MustCompile(`{+gindex}+`)
+	inodeRegex = regexp.MustCompile(`{+inode}+`)
+	sizeHumanRegex = regexp.MustCompile(`{+size\.human}+`)
+	sizeBucketRegex = regexp.MustCompile(`{+sizebucket}+`)
+	matchCountRegex = regexp.MustCompile(`{+matchcount}+`)
+
 	exifVarRegex = regexp.MustCompile(
 		fmt.Sprintf(
 			"{+(?:exif|x)\\.(?:(iso|et|fl|w|h|wh|make|model|lens|fnum|fl35|lat|lon|soft)|(?:(cdt)\\.("+tokenString+")))(?:\\.%s)?}+",
 			transformTokens,
 		),
 	)
-
-	// for the sake of replacing random string variables
-	rand.Seed(time.Now().UnixNano())
 }
@@ -2,9 +2,11 @@ package replace
 
 import (
 	"crypto/md5"
+	cryptorand "crypto/rand"
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -17,6 +19,7 @@ import (
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	exiftool "github.com/barasher/go-exiftool"
 	"github.com/dhowden/tag"
@@ -35,6 +38,7 @@ import (
 	"github.com/ayoisaiah/f2/internal/config"
 	"github.com/ayoisaiah/f2/internal/file"
 	internalos "github.com/ayoisaiah/f2/internal/os"
+	"github.com/ayoisaiah/f2/internal/sniff"
 
 	"github.com/araddon/dateparse"
 )
@@ -101,20 +105,73 @@ func greatestCommonDivisor(a, b int) int {
 
 // getRandString returns a random string of the specified length
 // using the specified characterSet.
-func getRandString(n int, characterSet string) string {
+func getRandString(random *rand.Rand, n int, characterSet string) string {
 	b := make([]byte, n)
 
 	for i := range b {
-		b[i] = characterSet[rand.Intn(len(characterSet))] //nolint:gosec // appropriate use of math.rand
+		b[i] = characterSet[random.Intn(len(characterSet))]
 	}
 
 	return string(b)
 }
 
+// newRandom creates the source of randomness for the random string and UUID
+// variables with the provided seed so that the generated values are
+// reproducible. If no seed is specified, one is obtained from crypto/rand
+// instead.
+func newRandom(seed int64, fixed bool) (*rand.Rand, error) {
+	if !fixed {
+		var b [8]byte
+
+		_, err := cryptorand.Read(b[:])
+		if err != nil {
+			return nil, err
+		}
+
+		seed = int64(binary.LittleEndian.Uint64(b[:]))
+	}
+
+	return rand.New(rand.NewSource(seed)), nil //nolint:gosec // appropriate use of math.rand
+}
+
+// newUUID generates a version 4 UUID from the random source.
+func newUUID(random *rand.Rand) string {
+	var b [16]byte
+
+	// Read from a *rand.Rand never returns an error
+	_, _ = random.Read(b[:])
+
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// replaceUUIDVars replaces each UUID variable in the target filename
+// with a newly generated UUID.
+func replaceUUIDVars(target string, uv uuidVars, random *rand.Rand) string {
+	for i := range uv.matches {
+		current := uv.matches[i]
+
+		for current.regex.MatchString(target) {
+			uuid := transformString(newUUID(random), current.transformToken)
+
+			target = regexReplace(current.regex, target, uuid, 1)
+		}
+	}
+
+	return target
+}
+
 // replaceRandomVars replaces all random string variables
 // in the target filename with a generated random string that matches
 // the specifications.
-func replaceRandomVars(target string, matches []string, rv randomVars) string {
+func replaceRandomVars(
+	target string,
+	matches []string,
+	rv randomVars,
+	random *rand.Rand,
+) string {
 	for range matches {
 		for i := range rv.matches {
 			current := rv.matches[i]
@@ -131,7 +188,7 @@ func replaceRandomVars(target string, matches []string, rv randomVars) string {
 				characters = letterBytes + numberBytes
 			}
 
-			randString := getRandString(current.length, characters)
+			randString := getRandString(random, current.length, characters)
 
 			randString = transformString(randString, current.transformToken)
 
@@ -181,8 +238,21 @@ func integerToRoman(integer int) string {
 	return roman.String()
 }
 
-// getHash retrieves the appropriate hash value for the specified file.
-func getHash(filePath string, hashValue hashAlgorithm) (string, error) {
+// getHash retrieves the appropriate hash value for the specified file. The
+// contents of the file are streamed to the hash function, and the result is
+// cached in conf.Hashes for the rest of the operation so that the file is not
+// read again for each variable that references it.
+func getHash(
+	conf *config.Config,
+	filePath string,
+	hashValue hashAlgorithm,
+) (string, error) {
+	key := string(hashValue) + ":" + filePath
+
+	if cached, ok := conf.Hashes[key]; ok {
+		return cached, nil
+	}
+
 	openedFile, err := os.Open(filePath)
 	if err != nil {
 		return "", err
@@ -209,23 +279,36 @@ func getHash(filePath string, hashValue hashAlgorithm) (string, error) {
 		return "", err
 	}
 
-	return hex.EncodeToString(newHash.Sum(nil)), nil
+	sum := hex.EncodeToString(newHash.Sum(nil))
+
+	if conf.Hashes == nil {
+		conf.Hashes = make(map[string]string)
+	}
+
+	conf.Hashes[key] = sum
+
+	return sum, nil
 }
 
 // replaceFileHashVars replaces a hash variable with the corresponding
 // hash value.
 func replaceFileHashVars(
+	conf *config.Config,
 	target, sourcePath string,
 	hashMatches hashVars,
 ) (string, error) {
 	for i := range hashMatches.matches {
 		current := hashMatches.matches[i]
 
-		hashValue, err := getHash(sourcePath, current.hashFn)
+		hashValue, err := getHash(conf, sourcePath, current.hashFn)
 		if err != nil {
 			return "", err
 		}
 
+		if current.length > 0 && current.length < len(hashValue) {
+			hashValue = hashValue[:current.length]
+		}
+
 		hashValue = transformString(hashValue, current.transformToken)
 
 		target = regexReplace(current.regex, target, hashValue, 0)
@@ -234,6 +317,149 @@ func replaceFileHashVars(
 	return target, nil
 }
 
+// replaceInodeVars replaces the {inode} variables with the inode number of
+// the source so that the hard links to the same file can be told apart from
+// other files.
+func replaceInodeVars(target, sourcePath string) (string, error) {
+	ino, err := internalos.Inode(sourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	return inodeRegex.ReplaceAllString(
+		target,
+		strconv.FormatUint(ino, 10),
+	), nil
+}
+
+// sizeBucket returns the name of the bucket that the size falls into
+// according to the configured thresholds.
+func sizeBucket(size int64, buckets []int64) string {
+	switch {
+	case len(buckets) < 2:
+		return ""
+	case size < buckets[0]:
+		return "small"
+	case size < buckets[1]:
+		return "medium"
+	default:
+		return "large"
+	}
+}
+
+// replaceSizeVars replaces the {size.human} and {sizebucket} variables with
+// the size of the source (as recorded when it was found) in a human-readable
+// format and the name of its size bucket, respectively.
+func replaceSizeVars(target string, size int64, buckets []int64) string {
+	target = sizeHumanRegex.ReplaceAllString(target, config.HumanSize(size))
+
+	return sizeBucketRegex.ReplaceAllString(target, sizeBucket(size, buckets))
+}
+
+// replaceMatchCountVars replaces the {matchcount} variables with the number
+// of times that the find pattern matches the searched part of the source name.
+func replaceMatchCountVars(
+	conf *config.Config,
+	target string,
+	change *file.Change,
+) string {
+	sourceName := change.Source
+	if conf.IgnoreExt && !change.IsDir {
+		sourceName = internalpath.FilenameWithoutExtension(sourceName)
+	}
+
+	if conf.ExtOnly && !change.IsDir {
+		sourceName = internalpath.Extension(sourceName)
+	}
+
+	count := len(conf.SearchRegex.FindAllStringIndex(sourceName, -1))
+
+	return matchCountRegex.ReplaceAllString(target, strconv.Itoa(count))
+}
+
+// replaceNumVars replaces any number variables in the target with the first
+// number in the source name plus the specified offset. The zero-padding of
+// the original number is preserved even if the result is negative. If the source name does not contain a
+// number, the variables are replaced with the fallback value or an error is
+// returned if it is not set.
+func replaceNumVars(
+	target, sourceName, fallback string,
+	nv numVars,
+) (string, error) {
+	digits := numberRegex.FindString(sourceName)
+
+	if digits == "" && fallback == "" {
+		return "", fmt.Errorf(
+			"%w: '%s' (use --num-fallback to provide a replacement for {num})",
+			errNoNumberInName,
+			sourceName,
+		)
+	}
+
+	var num int
+
+	if digits != "" {
+		var err error
+
+		num, err = strconv.Atoi(digits)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for i := range nv.matches {
+		current := nv.matches[i]
+
+		value := fallback
+		if digits != "" {
+			value = padNumber(num+current.offset, len(digits))
+		}
+
+		target = regexReplace(current.regex, target, value, 0)
+	}
+
+	return target, nil
+}
+
+// padNumber zero-pads the absolute value of n to the specified width so that a
+// negative number keeps the same number of digits.
+func padNumber(n, width int) string {
+	if n < 0 {
+		return "-" + fmt.Sprintf("%0*d", width, -n)
+	}
+
+	return fmt.Sprintf("%0*d", width, n)
+}
+
+// replaceTypeVars replaces any file type variables in the target with the
+// type detected from the contents of the file.
+func replaceTypeVars(
+	target, sourcePath string,
+	isDir bool,
+	typeMatches typeVars,
+) (string, error) {
+	fileType := "directory"
+
+	if !isDir {
+		var err error
+
+		fileType, err = sniff.Type(sourcePath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for i := range typeMatches.matches {
+		current := typeMatches.matches[i]
+
+		value := transformString(fileType, current.transformToken)
+
+		target = regexReplace(current.regex, target, value, 0)
+	}
+
+	return target, nil
+}
+
 // replaceDateVars replaces any date variables in the target
 // with the corresponding date value.
 func replaceDateVars(
@@ -286,6 +512,37 @@ func replaceDateVars(
 	return target, nil
 }
 
+// replaceFileDateVars replaces each file date variable in the target with
+// the modification time of the file formatted according to the variable's
+// layout.
+func replaceFileDateVars(
+	target, sourcePath string,
+	modTime time.Time,
+	fileDateMatches fileDateVars,
+) (string, error) {
+	if modTime.IsZero() {
+		fileInfo, err := os.Stat(sourcePath)
+		if err != nil {
+			return "", err
+		}
+
+		modTime = fileInfo.ModTime()
+	}
+
+	for i := range fileDateMatches.matches {
+		current := fileDateMatches.matches[i]
+
+		target = regexReplace(
+			current.regex,
+			target,
+			modTime.Format(current.layout),
+			0,
+		)
+	}
+
+	return target, nil
+}
+
 // getID3Tags retrieves the id3 tags in an audi file (such as mp3)
 // errors while reading the id3 tags are ignored since the corresponding
 // variable will be replaced with an empty string.
@@ -652,37 +909,49 @@ func replaceExifToolVars(
 
 // replaceIndex replaces indexing variables in the target with their
 // corresponding values. The `changeIndex` argument is used in conjunction with
-// other values to increment the current index.
+// other values to increment the current index. The number offsets are
+// returned so that skipped numbers carry over to the next change.
 func replaceIndex(
 	target string,
 	changeIndex int, // position of change in the entire renaming operation
 	indexing indexVars,
 	numberOffset []int,
-) string {
+	counterStart, counterStep int,
+) (string, []int) {
 	if len(numberOffset) == 0 {
 		for range indexing.matches {
 			numberOffset = append(numberOffset, 0)
-			config.SetNumberOffset(numberOffset)
 		}
 	}
 
+	// the value of each named counter is determined by
+	// its first occurrence in the target
+	namedCounters := make(map[string]int)
+
 	for i := range indexing.matches {
 		current := indexing.matches[i]
 
 		isCaptureVar := slices.Contains(indexing.capturVarIndex, i)
 
 		if !current.step.isSet && !isCaptureVar {
-			current.step.value = 1
+			current.step.value = counterStep
 		}
 
 		startNumber := current.startNumber
+		if !current.startIsSet {
+			startNumber = counterStart
+		}
+
 		num := startNumber + (changeIndex * current.step.value) + numberOffset[i]
 
 		if isCaptureVar {
 			num = startNumber + (current.step.value) + numberOffset[i]
 		}
 
-		if len(current.skip) != 0 {
+		namedNum, isNamed := namedCounters[current.name]
+		if current.name != "" && isNamed {
+			num = namedNum
+		} else if len(current.skip) != 0 {
 		outer:
 			for {
 				for _, v := range current.skip {
@@ -696,7 +965,6 @@ func replaceIndex(
 
 						num += step
 						numberOffset[i] += step
-						config.SetNumberOffset(numberOffset)
 						continue outer
 					}
 				}
@@ -704,6 +972,10 @@ func replaceIndex(
 			}
 		}
 
+		if current.name != "" {
+			namedCounters[current.name] = num
+		}
+
 		numInt64 := int64(num)
 
 		var formattedNum string
@@ -732,18 +1004,43 @@ func replaceIndex(
 		target = current.regex.ReplaceAllString(target, formattedNum)
 	}
 
-	return target
+	return target, numberOffset
+}
+
+// sentenceCase converts the source to lowercase and capitalises its first
+// letter.
+func sentenceCase(source string) string {
+	lower := []rune(cases.Lower(language.Und).String(source))
+
+	for i, r := range lower {
+		if unicode.IsLetter(r) {
+			lower[i] = unicode.ToTitle(r)
+			break
+		}
+	}
+
+	return string(lower)
 }
 
 func transformString(source, token string) string {
+	// transform only the valid parts of the string so that the
+	// invalid bytes are preserved
+	if !utf8.ValidString(source) {
+		return internalpath.UnescapeInvalidUTF8(
+			transformString(internalpath.EscapeInvalidUTF8(source), token),
+		)
+	}
+
 	switch token {
 	case "up":
-		return strings.ToUpper(source)
-	case "lw":
-		return strings.ToLower(source)
-	case "ti":
+		return cases.Upper(language.Und).String(source)
+	case "lw", "low":
+		return cases.Lower(language.Und).String(source)
+	case "ti", "title":
 		c := cases.Title(language.English)
-		return c.String(strings.ToLower(source))
+		return c.String(cases.Lower(language.Und).String(source))
+	case "sc", "sentence":
+		return sentenceCase(source)
 	case "win":
 		return regexReplace(
 			internalos.CompleteWindowsForbiddenCharRegex,
@@ -783,15 +1080,87 @@ func transformString(source, token string) string {
 		return dateTime.Format(dateTokens[format])
 	}
 
+	if strings.HasPrefix(token, "map(") {
+		table := strings.TrimSuffix(strings.TrimPrefix(token, "map("), ")")
+
+		return mapValue(source, table)
+	}
+
+	return source
+}
+
+// mapValue translates the source through a comma-separated table of `from->to`
+// pairs such as `jpeg->jpg,tiff->tif`. Values that are not present in the
+// table are returned unchanged.
+func mapValue(source, table string) string {
+	for _, pair := range strings.Split(table, ",") {
+		from, to, found := strings.Cut(pair, "->")
+		if !found {
+			continue
+		}
+
+		if strings.TrimSpace(from) == source {
+			return strings.TrimSpace(to)
+		}
+	}
+
 	return source
 }
 
+// caseTokens are the transformations that change the case of letters.
+var caseTokens = map[string]bool{
+	"up":       true,
+	"lw":       true,
+	"low":      true,
+	"ti":       true,
+	"title":    true,
+	"sc":       true,
+	"sentence": true,
+}
+
+// transformKeepingExt transforms the source like transformString except that
+// the case of the extension at the end of the source (if any) is left intact
+// by case transformations.
+func transformKeepingExt(source, token, ext string) string {
+	if ext == "" || !caseTokens[token] || !strings.HasSuffix(source, ext) {
+		return transformString(source, token)
+	}
+
+	return transformString(strings.TrimSuffix(source, ext), token) + ext
+}
+
+// preservedExt returns the extension of the file name whose case should be
+// preserved by case transformations if the last match of the find pattern
+// includes it. The name of a dotfile without any other dots is not an
+// extension.
+func preservedExt(conf *config.Config, name string) string {
+	ext := filepath.Ext(name)
+	if ext == "" || ext == name {
+		return ""
+	}
+
+	loc := conf.SearchRegex.FindAllStringIndex(name, -1)
+	if len(loc) == 0 {
+		return ""
+	}
+
+	last := loc[len(loc)-1]
+	if last[1] != len(name) || last[0] > len(name)-len(ext) {
+		return ""
+	}
+
+	return ext
+}
+
 // replaceTransformVars handles string transformations like uppercase,
-// lowercase, stripping characters, e.t.c.
+// lowercase, stripping characters, e.t.c. The case of the extension (if
+// specified) is preserved in the last find match and capture variables that
+// end with it.
 func replaceTransformVars(
 	target string,
 	matches []string,
 	tv transformVars,
+	ext string,
 ) (string, error) {
 	// if capture variables are present, they would have been replaced by now
 	// so updated transform vars must be retrieved again
@@ -812,11 +1181,16 @@ func replaceTransformVars(
 
 		// if capture variables aren't being used, transform the find matches
 		if match == "" {
-			for _, v := range matches {
+			for j, v := range matches {
+				replacement := transformString(v, current.token)
+				if j == len(matches)-1 {
+					replacement = transformKeepingExt(v, current.token, ext)
+				}
+
 				target = regexReplace(
 					regex,
 					target,
-					transformString(v, current.token),
+					replacement,
 					1,
 				)
 			}
@@ -827,7 +1201,7 @@ func replaceTransformVars(
 		target = regexReplace(
 			regex,
 			target,
-			transformString(match, current.token),
+			transformKeepingExt(match, current.token, ext),
 			0,
 		)
 	}
@@ -923,12 +1297,52 @@ func replaceExtVars(target, fileExt string, ev extVars) string {
 	return target
 }
 
+// replacePositionVars replaces the variables that depend on the position of
+// the change in the sorted batch: {prev.target} with the target of the
+// preceding change (empty for the first one) and {index} with the position of
+// the change starting from 1.
+func replacePositionVars(
+	target, prevTarget string,
+	index int,
+	vars *variables,
+) string {
+	for i := range vars.prev.matches {
+		current := vars.prev.matches[i]
+
+		value := transformString(prevTarget, current.transformToken)
+
+		target = regexReplace(current.regex, target, value, 0)
+	}
+
+	for _, regex := range vars.batch.matches {
+		target = regexReplace(regex, target, strconv.Itoa(index+1), 0)
+	}
+
+	return target
+}
+
+// replaceChainVars replaces the {chain} variables with the name produced by
+// the preceding replacements, which is the original name for the first one.
+func replaceChainVars(target, current string, vars *variables) string {
+	for i := range vars.chain.matches {
+		m := vars.chain.matches[i]
+
+		value := transformString(current, m.transformToken)
+
+		// the name may contain `$` which must not be expanded
+		target = m.regex.ReplaceAllLiteralString(target, value)
+	}
+
+	return target
+}
+
 // replaceVariables checks if any variables are present in the target filename
 // and delegates the variable replacement to the appropriate function.
 func replaceVariables(
 	conf *config.Config,
 	change *file.Change,
 	vars *variables,
+	prevTarget string,
 ) error {
 	fileExt := filepath.Ext(change.OriginalSource)
 	sourcePath := filepath.Join(change.BaseDir, change.OriginalSource)
@@ -976,6 +1390,20 @@ func replaceVariables(
 		change.Target = out
 	}
 
+	if len(vars.fileDate.matches) > 0 {
+		out, err := replaceFileDateVars(
+			change.Target,
+			sourcePath,
+			change.ModTime,
+			vars.fileDate,
+		)
+		if err != nil {
+			return err
+		}
+
+		change.Target = out
+	}
+
 	if len(vars.exiftool.matches) > 0 {
 		out, err := replaceExifToolVars(
 			change.Target,
@@ -1014,7 +1442,66 @@ func replaceVariables(
 	}
 
 	if len(vars.hash.matches) > 0 {
-		out, err := replaceFileHashVars(change.Target, sourcePath, vars.hash)
+		out, err := replaceFileHashVars(
+			conf,
+			change.Target,
+			sourcePath,
+			vars.hash,
+		)
+		if err != nil {
+			return err
+		}
+
+		change.Target = out
+	}
+
+	if inodeRegex.MatchString(change.Target) {
+		out, err := replaceInodeVars(change.Target, sourcePath)
+		if err != nil {
+			return err
+		}
+
+		change.Target = out
+	}
+
+	if sizeHumanRegex.MatchString(change.Target) ||
+		sizeBucketRegex.MatchString(change.Target) {
+		change.Target = replaceSizeVars(
+			change.Target,
+			change.Size,
+			conf.SizeBuckets,
+		)
+	}
+
+	if matchCountRegex.MatchString(change.Target) {
+		change.Target = replaceMatchCountVars(conf, change.Target, change)
+	}
+
+	if len(vars.uuid.matches) > 0 {
+		change.Target = replaceUUIDVars(change.Target, vars.uuid, conf.Random)
+	}
+
+	if len(vars.num.matches) > 0 {
+		out, err := replaceNumVars(
+			change.Target,
+			change.Source,
+			conf.NumFallback,
+			vars.num,
+		)
+		if err != nil {
+			return err
+		}
+
+		change.Target = out
+	}
+
+	if len(vars.fileType.matches) > 0 {
+		out, err := replaceTypeVars(
+			change.Target,
+			sourcePath,
+			change.IsDir,
+			vars.fileType,
+		)
 		if err != nil {
 			return err
 		}
@@ -1024,7 +1511,12 @@ func replaceVariables(
 
 	if len(vars.random.matches) > 0 {
 		matches := conf.SearchRegex.FindAllString(change.Source, -1)
-		change.Target = replaceRandomVars(change.Target, matches, vars.random)
+		change.Target = replaceRandomVars(
+			change.Target,
+			matches,
+			vars.random,
+			conf.Random,
+		)
 	}
 
 	if transformVarRegex.MatchString(change.Target) {
@@ -1033,12 +1525,25 @@ func replaceVariables(
 			sourceName = internalpath.FilenameWithoutExtension(sourceName)
 		}
 
+		if conf.ExtOnly && !change.IsDir {
+			sourceName = internalpath.Extension(sourceName)
+		}
+
 		matches := conf.SearchRegex.FindAllString(sourceName, -1)
 
+		// the extension is not part of the matches when it is ignored
+		// or when only the extension is searched
+		var ext string
+		if conf.PreserveExtCase && !change.IsDir && !conf.IgnoreExt &&
+			!conf.ExtOnly {
+			ext = preservedExt(conf, sourceName)
+		}
+
 		out, err := replaceTransformVars(
 			change.Target,
 			matches,
 			vars.transform,
+			ext,
 		)
 		if err != nil {
 			return err
@@ -1062,13 +1567,39 @@ func replaceVariables(
 			vars.index.capturVarIndex = indices
 		}
 
-		change.Target = replaceIndex(
+		change.Target, conf.NumberOffset = replaceIndex(
 			change.Target,
-			change.Index,
+			change.CounterIndex,
 			vars.index,
 			conf.NumberOffset,
+			conf.CounterStart,
+			conf.CounterStep,
+		)
+	}
+
+	// {gindex} follows the sorted batch even if the changes are grouped
+	// by --counter-scope
+	if globalIndexRegex.MatchString(change.Target) {
+		change.Target = globalIndexRegex.ReplaceAllString(
+			change.Target,
+			strconv.Itoa(change.GlobalIndex+1),
 		)
 	}
 
+	// these are replaced last so that the inserted target is not
+	// interpreted as containing other variables
+	if len(vars.prev.matches) > 0 || len(vars.batch.matches) > 0 {
+		change.Target = replacePositionVars(
+			change.Target,
+			prevTarget,
+			change.Index,
+			vars,
+		)
+	}
+
+	if len(vars.chain.matches) > 0 {
+		change.Target = replaceChainVars(change.Target, change.Source, vars)
+	}
+
 	return nil
 }
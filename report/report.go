@@ -9,14 +9,21 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/pterm/pterm"
+	"github.com/pterm/pterm/putils"
 
+	"github.com/ayoisaiah/f2/find"
+	"github.com/ayoisaiah/f2/internal/config"
 	"github.com/ayoisaiah/f2/internal/conflict"
 	"github.com/ayoisaiah/f2/internal/file"
 	internaljson "github.com/ayoisaiah/f2/internal/json"
+	internalpath "github.com/ayoisaiah/f2/internal/path"
 	"github.com/ayoisaiah/f2/internal/status"
 )
 
@@ -25,10 +32,14 @@ var (
 	Stderr io.Writer = os.Stderr
 )
 
+// changeHeaders are the column headings of the table used to display changes
+// and conflicts.
+var changeHeaders = []string{"ORIGINAL", "RENAMED", "STATUS"}
+
 // Conflicts prints any detected conflicts to the standard output in table format.
-func Conflicts(conflicts conflict.Collection, jsonOut bool) {
-	if jsonOut {
-		o, err := internaljson.GetOutput(nil)
+func Conflicts(conf *config.Config, conflicts conflict.Collection) {
+	if conf.JSON {
+		o, err := output(conf, nil)
 		if err != nil {
 			pterm.Fprintln(Stderr, pterm.Error.Sprint(err))
 		}
@@ -40,6 +51,17 @@ func Conflicts(conflicts conflict.Collection, jsonOut bool) {
 
 	var data [][]string
 
+	if slice, exists := conflicts[conflict.SourceNotFound]; exists {
+		for _, v := range slice {
+			slice := []string{
+				strings.Join(v.Sources, ""),
+				v.Target,
+				pterm.Red(status.SourceNotFound),
+			}
+			data = append(data, slice)
+		}
+	}
+
 	if slice, exists := conflicts[conflict.EmptyFilename]; exists {
 		for _, v := range slice {
 			slice := []string{
@@ -126,7 +148,61 @@ func Conflicts(conflicts conflict.Collection, jsonOut bool) {
 		}
 	}
 
-	printTable(data, Stdout)
+	if slice, exists := conflicts[conflict.PermissionDenied]; exists {
+		for _, v := range slice {
+			for _, s := range v.Sources {
+				slice := []string{
+					s,
+					v.Target,
+					pterm.Red(status.PermissionDenied),
+				}
+				data = append(data, slice)
+			}
+		}
+	}
+
+	if slice, exists := conflicts[conflict.CaseCollision]; exists {
+		for _, v := range slice {
+			for _, s := range v.Sources {
+				slice := []string{
+					s,
+					v.Target,
+					pterm.Red(status.CaseCollision),
+				}
+				data = append(data, slice)
+			}
+		}
+	}
+
+	if slice, exists := conflicts[conflict.ControlCharacters]; exists {
+		for _, v := range slice {
+			for _, s := range v.Sources {
+				slice := []string{
+					s,
+					v.Target,
+					pterm.Red(
+						fmt.Sprintf(
+							string(status.ControlCharacters),
+							v.Cause,
+						),
+					),
+				}
+				data = append(data, slice)
+			}
+		}
+	}
+
+	// control characters are made visible so that each row fits on one line
+	for _, row := range data {
+		row[0] = internalpath.EscapeControlChars(
+			internalpath.RelativeTo(displayBase(conf), row[0]),
+		)
+		row[1] = internalpath.EscapeControlChars(
+			internalpath.RelativeTo(displayBase(conf), row[1]),
+		)
+	}
+
+	printTable(changeHeaders, data, Stdout)
 }
 
 func BackupFailed(err error) {
@@ -138,13 +214,331 @@ func BackupFailed(err error) {
 	)
 }
 
+// CheckpointFailed prints a warning indicating that the progress of the
+// renaming operation could not be recorded so it cannot be resumed if it is
+// interrupted.
+func CheckpointFailed(err error) {
+	pterm.Fprintln(Stderr,
+		pterm.Warning.Sprintf(
+			"Failed to create a checkpoint for the renaming operation due to error: %s. It cannot be resumed if interrupted",
+			err.Error(),
+		),
+	)
+}
+
+// LedgerFailed prints a warning indicating that the processed paths could not
+// be recorded in the ledger.
+func LedgerFailed(err error) {
+	pterm.Fprintln(Stderr,
+		pterm.Warning.Sprintf(
+			"Failed to record the renamed paths in the ledger due to error: %s",
+			err.Error(),
+		),
+	)
+}
+
+// LedgerCleared prints a message indicating that the ledger was removed.
+func LedgerCleared() {
+	pterm.Info.Prefix = pterm.Prefix{
+		Text:  "INFO",
+		Style: pterm.NewStyle(pterm.BgCyan, pterm.FgBlack),
+	}
+
+	pterm.Fprintln(
+		Stdout,
+		pterm.Info.Sprint("The ledger of processed paths has been cleared"),
+	)
+}
+
+// NoConflicts prints a message indicating that the planned changes are free
+// of conflicts in --check-only mode.
+func NoConflicts(conf *config.Config, fileChanges []*file.Change) {
+	if conf.JSON {
+		JSON(conf, fileChanges)
+		return
+	}
+
+	pterm.Fprintln(
+		Stdout,
+		pterm.Success.Sprintf(
+			"No conflicts detected in %s",
+			plural(len(fileChanges), "planned change", "planned changes"),
+		),
+	)
+}
+
+// Timings prints the duration of each stage of the renaming operation and the
+// number of entries that it processed to the standard error.
+func Timings(timings []config.Timing) {
+	for _, t := range timings {
+		pterm.Fprintln(
+			Stderr,
+			fmt.Sprintf(
+				"%-10s %12s %8d entries",
+				t.Stage,
+				t.Duration.Round(time.Microsecond),
+				t.Entries,
+			),
+		)
+	}
+}
+
+// SkippedPaths prints a warning for each path that was skipped during the
+// search because it could not be read.
+func SkippedPaths(skipped []file.SkippedPath) {
+	for _, v := range skipped {
+		pterm.Fprintln(Stderr,
+			pterm.Warning.Sprintf(
+				"Skipped unreadable path '%s': %s",
+				v.Path,
+				v.Error,
+			),
+		)
+	}
+}
+
+// SkippedIdentical prints a warning for each change that was skipped since
+// its target already exists with the same contents as the source.
+func SkippedIdentical(skipped []file.SkippedPath) {
+	for _, v := range skipped {
+		pterm.Fprintln(Stderr,
+			pterm.Warning.Sprintf("Skipped '%s': %s", v.Path, v.Error),
+		)
+	}
+}
+
+// IdenticalTargets reports that no changes remain since the targets of all
+// the matched files already exist with the same contents.
+func IdenticalTargets(conf *config.Config) {
+	noChanges(conf, "All matched files are identical to their existing targets")
+}
+
+// Warnings prints the warnings that were raised while searching for matches.
+func Warnings(warnings []string) {
+	for _, v := range warnings {
+		pterm.Fprintln(Stderr, pterm.Warning.Sprint(v))
+	}
+}
+
+// Stages prints the intermediate result of each replacement for the changes
+// that went through more than one replacement.
+func Stages(conf *config.Config, fileChanges []*file.Change) {
+	for _, change := range fileChanges {
+		if len(change.Stages) < 2 {
+			continue
+		}
+
+		stages := make([]string, len(change.Stages))
+		for i, stage := range change.Stages {
+			stages[i] = internalpath.EscapeControlChars(stage)
+		}
+
+		pterm.Fprintln(
+			Stdout,
+			fmt.Sprintf(
+				"%s: %s",
+				internalpath.EscapeControlChars(
+					internalpath.RelativeTo(
+						displayBase(conf),
+						filepath.Join(change.BaseDir, change.OriginalSource),
+					),
+				),
+				strings.Join(stages, " → "),
+			),
+		)
+	}
+}
+
+// Annotations prints how the find patterns apply to the source of each
+// change in verbose dry-run mode.
+func Annotations(conf *config.Config, fileChanges []*file.Change) {
+	for _, change := range fileChanges {
+		if len(change.Annotations) == 0 {
+			continue
+		}
+
+		pterm.Fprintln(
+			Stdout,
+			internalpath.EscapeControlChars(
+				internalpath.RelativeTo(
+					displayBase(conf),
+					filepath.Join(change.BaseDir, change.OriginalSource),
+				),
+			)+":",
+		)
+
+		for _, annotation := range change.Annotations {
+			pterm.Fprintln(
+				Stdout,
+				"  "+internalpath.EscapeControlChars(annotation),
+			)
+		}
+	}
+}
+
+// Overwrites lists the existing files that would be overwritten by the
+// renaming operation.
+func Overwrites(conf *config.Config) {
+	paths := conf.Overwrites
+	if len(paths) == 0 {
+		return
+	}
+
+	pterm.Fprintln(
+		Stdout,
+		pterm.Warning.Sprintf(
+			"%s will be overwritten:",
+			plural(len(paths), "existing file", "existing files"),
+		),
+	)
+
+	for _, path := range paths {
+		path = internalpath.RelativeTo(displayBase(conf), path)
+		pterm.Fprintln(Stdout, "  "+internalpath.EscapeControlChars(path))
+	}
+}
+
+// RemovedCopies lists the copies that would be removed when a copying
+// operation is undone.
+func RemovedCopies(conf *config.Config, fileChanges []*file.Change) {
+	if len(fileChanges) == 0 {
+		return
+	}
+
+	pterm.Fprintln(
+		Stdout,
+		pterm.Info.Sprintf(
+			"%s will be removed:",
+			plural(len(fileChanges), "copy", "copies"),
+		),
+	)
+
+	for _, change := range fileChanges {
+		path := internalpath.RelativeTo(
+			displayBase(conf),
+			filepath.Join(change.BaseDir, change.Target),
+		)
+		pterm.Fprintln(Stdout, "  "+internalpath.EscapeControlChars(path))
+	}
+}
+
+// DiskSpace prints the space required by the copies on each destination
+// filesystem along with the space available on it. A warning is printed for
+// the filesystems that the copies do not fit on.
+func DiskSpace(conf *config.Config) {
+	for _, d := range conf.DiskSpace {
+		dir := internalpath.EscapeControlChars(
+			internalpath.RelativeTo(displayBase(conf), d.Dir),
+		)
+
+		msg := fmt.Sprintf(
+			"Copying requires %s on the filesystem of '%s' (%s available)",
+			config.HumanSize(d.Required),
+			dir,
+			config.HumanSize(d.Available),
+		)
+
+		if d.Insufficient() {
+			pterm.Fprintln(
+				Stdout,
+				pterm.Warning.Sprintf("Not enough free space: %s", msg),
+			)
+
+			continue
+		}
+
+		pterm.Fprintln(Stdout, msg)
+	}
+}
+
+// CreatedDirs prints the number of directories that were created for the
+// targets of the operation.
+func CreatedDirs(conf *config.Config) {
+	if conf.CreatedDirs == 0 {
+		return
+	}
+
+	pterm.Fprintln(
+		Stdout,
+		pterm.Success.Sprintf(
+			"Created %s",
+			plural(conf.CreatedDirs, "directory", "directories"),
+		),
+	)
+}
+
+// CleanedUp prints the number of empty directories that were removed after
+// the renaming operation failed, and lists the changes that were applied
+// before the failure so that they can be reviewed.
+func CleanedUp(
+	conf *config.Config,
+	removedDirs int,
+	applied []*file.Change,
+) {
+	pterm.Fprintln(
+		Stdout,
+		pterm.Warning.Sprintf(
+			"Removed %s created by the failed operation",
+			plural(removedDirs, "empty directory", "empty directories"),
+		),
+	)
+
+	if len(applied) == 0 {
+		return
+	}
+
+	action := "renamed"
+	if conf.Copy {
+		action = "copied"
+	}
+
+	pterm.Fprintln(
+		Stdout,
+		pterm.Warning.Sprintf(
+			"The following %s %s before the failure:",
+			plural(len(applied), "path was", "paths were"),
+			action,
+		),
+	)
+
+	changes(conf, applied)
+}
+
+// BrokenLinks lists the broken symlinks that were found while searching for
+// matches, and whether they will be removed.
+func BrokenLinks(conf *config.Config) {
+	paths := conf.BrokenLinks
+	if len(paths) == 0 {
+		return
+	}
+
+	msg := "%s found:"
+
+	if conf.RemoveBrokenLinks {
+		msg = "%s will be removed:"
+	}
+
+	pterm.Fprintln(
+		Stderr,
+		pterm.Warning.Sprintf(
+			msg,
+			plural(len(paths), "broken symlink", "broken symlinks"),
+		),
+	)
+
+	for _, path := range paths {
+		path = internalpath.RelativeTo(displayBase(conf), path)
+		pterm.Fprintln(Stderr, "  "+internalpath.EscapeControlChars(path))
+	}
+}
+
 // NoMatches prints out a message indicating that the find string failed
 // to match any files.
-func NoMatches(jsonOut bool) {
+func NoMatches(conf *config.Config) {
 	msg := "Failed to match any files"
 
-	if jsonOut {
-		b, err := internaljson.GetOutput(nil)
+	if conf.JSON {
+		b, err := output(conf, nil)
 		if err != nil {
 			pterm.Fprintln(Stderr, err)
 			return
@@ -158,17 +552,277 @@ func NoMatches(jsonOut bool) {
 	pterm.Info.Println(msg)
 }
 
-func printTable(data [][]string, writer io.Writer) {
+// AlreadyNamed prints a message indicating that every matched file already
+// has its target name.
+func AlreadyNamed(conf *config.Config) {
+	noChanges(conf, "All matched files already have the expected names")
+}
+
+// EmptyTargets prints a message indicating that the target of every matched
+// file has an empty name.
+func EmptyTargets(conf *config.Config) {
+	noChanges(conf, "All matched files were skipped since their targets are empty")
+}
+
+// noChanges prints a message explaining why there are no changes to be made,
+// or an output without changes in JSON mode.
+func noChanges(conf *config.Config, msg string) {
+	if conf.JSON {
+		b, err := output(conf, nil)
+		if err != nil {
+			pterm.Fprintln(Stderr, err)
+			return
+		}
+
+		pterm.Fprintln(Stdout, string(b))
+
+		return
+	}
+
+	pterm.Info.Prefix = pterm.Prefix{
+		Text:  "INFO",
+		Style: pterm.NewStyle(pterm.BgCyan, pterm.FgBlack),
+	}
+
+	pterm.Fprintln(Stdout, pterm.Info.Sprint(msg))
+}
+
+// Explanation prints the outcome of each filtering stage for the specified
+// path and whether it would be matched.
+func Explanation(path string, steps []find.Step) {
+	matched := len(steps) > 0 && steps[len(steps)-1].Accepted
+
+	for _, step := range steps {
+		verdict := pterm.Green("accepted")
+		if !step.Accepted {
+			verdict = pterm.Red("rejected")
+		}
+
+		pterm.Fprintln(
+			Stdout,
+			fmt.Sprintf("%-10s %s: %s", step.Stage, verdict, step.Detail),
+		)
+	}
+
+	msg := fmt.Sprintf("'%s' would be matched", path)
+	if !matched {
+		msg = fmt.Sprintf("'%s' would not be matched", path)
+	}
+
+	pterm.Info.Prefix = pterm.Prefix{
+		Text:  "INFO",
+		Style: pterm.NewStyle(pterm.BgCyan, pterm.FgBlack),
+	}
+
+	pterm.Fprintln(Stdout, pterm.Info.Sprint(msg))
+}
+
+// SimulatedTree prints the tree that results from simulating the renaming
+// operation. Each path is relative to the root of the simulation and
+// separated by forward slashes. The paths must be sorted so that each
+// directory precedes its contents.
+func SimulatedTree(paths []string) error {
+	list := make(pterm.LeveledList, len(paths))
+
+	for i, p := range paths {
+		list[i] = pterm.LeveledListItem{
+			Level: strings.Count(p, "/"),
+			Text:  filepath.Base(p),
+		}
+	}
+
+	return printTree(list)
+}
+
+// printTree renders the leveled list as a tree.
+func printTree(list pterm.LeveledList) error {
+	return pterm.DefaultTree.
+		WithRoot(putils.TreeFromLeveledList(list)).
+		WithWriter(Stdout).
+		Render()
+}
+
+// treeNode is a file or directory in the tree of target paths.
+type treeNode struct {
+	children map[string]*treeNode
+	// source is the original name of a renamed path
+	source string
+}
+
+// resolvedDir returns the location of the directory after the directories
+// that contain it (or the directory itself) have been renamed.
+func resolvedDir(dir string, renamedDirs map[string]*file.Change) string {
+	for ancestor := dir; ; ancestor = filepath.Dir(ancestor) {
+		if change, ok := renamedDirs[ancestor]; ok {
+			rel, err := filepath.Rel(ancestor, dir)
+			if err != nil {
+				return dir
+			}
+
+			return filepath.Join(
+				resolvedDir(change.BaseDir, renamedDirs),
+				change.Target,
+				rel,
+			)
+		}
+
+		if parent := filepath.Dir(ancestor); parent == ancestor {
+			return dir
+		}
+	}
+}
+
+// targetTree arranges the targets of the changes in a tree according to
+// their directories. The location of each target accounts for the renamed
+// directories that contain it.
+func targetTree(fileChanges []*file.Change) *treeNode {
+	renamedDirs := make(map[string]*file.Change)
+
+	for _, change := range fileChanges {
+		if change.IsDir && change.Source != change.Target {
+			renamedDirs[filepath.Join(change.BaseDir, change.Source)] = change
+		}
+	}
+
+	root := &treeNode{children: make(map[string]*treeNode)}
+
+	for _, change := range fileChanges {
+		target := filepath.Join(
+			resolvedDir(change.BaseDir, renamedDirs),
+			change.Target,
+		)
+
+		node := root
+
+		for _, name := range strings.Split(filepath.ToSlash(target), "/") {
+			if name == "" {
+				continue
+			}
+
+			child, ok := node.children[name]
+			if !ok {
+				child = &treeNode{children: make(map[string]*treeNode)}
+				node.children[name] = child
+			}
+
+			node = child
+		}
+
+		if change.Source != change.Target {
+			node.source = change.Source
+		}
+	}
+
+	return root
+}
+
+// leveledList flattens the tree in lexical order.
+func (n *treeNode) leveledList(level int, list pterm.LeveledList) pterm.LeveledList {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := n.children[name]
+
+		text := name
+		if child.source != "" {
+			text = pterm.Green(name) + pterm.Gray(" <- "+child.source)
+		}
+
+		list = append(list, pterm.LeveledListItem{Level: level, Text: text})
+		list = child.leveledList(level+1, list)
+	}
+
+	return list
+}
+
+// Tree prints the paths that result from the changes as a tree grouped by
+// directory. Renamed paths are followed by their original names.
+func Tree(fileChanges []*file.Change) error {
+	return printTree(targetTree(fileChanges).leveledList(0, nil))
+}
+
+// Stats prints aggregate statistics about the renaming operation instead of
+// listing each change.
+func Stats(fileChanges []*file.Change, conflicts conflict.Collection) {
+	var changed int
+
+	extCount := make(map[string]int)
+
+	for _, change := range fileChanges {
+		sourcePath := filepath.Join(change.BaseDir, change.Source)
+		targetPath := filepath.Join(change.BaseDir, change.Target)
+
+		if sourcePath != targetPath {
+			changed++
+		}
+
+		ext := strings.ToLower(filepath.Ext(change.Source))
+
+		switch {
+		case change.IsDir:
+			ext = "(directory)"
+		case ext == "":
+			ext = "(none)"
+		}
+
+		extCount[ext]++
+	}
+
+	exts := make([]string, 0, len(extCount))
+	for ext := range extCount {
+		exts = append(exts, ext)
+	}
+
+	sort.Slice(exts, func(i, j int) bool {
+		if extCount[exts[i]] != extCount[exts[j]] {
+			return extCount[exts[i]] > extCount[exts[j]]
+		}
+
+		return exts[i] < exts[j]
+	})
+
+	data := make([][]string, len(exts))
+	for i, ext := range exts {
+		data[i] = []string{ext, strconv.Itoa(extCount[ext])}
+	}
+
+	pterm.Fprintln(Stdout, fmt.Sprintf("Matches:   %d", len(fileChanges)))
+	pterm.Fprintln(Stdout, fmt.Sprintf("Changes:   %d", changed))
+	pterm.Fprintln(Stdout, fmt.Sprintf("Unchanged: %d", len(fileChanges)-changed))
+	pterm.Fprintln(Stdout, fmt.Sprintf("Conflicts: %d", conflictingSources(conflicts)))
+
+	printTable([]string{"EXTENSION", "MATCHES"}, data, Stdout)
+}
+
+// displayBase returns the directory that the paths in the report are displayed
+// relative to. It defaults to the working directory if --relative-to is not
+// set. The JSON output keeps the full paths unless --relative-to is set.
+func displayBase(conf *config.Config) string {
+	if conf.DisplayRelativeTo != "" {
+		return conf.DisplayRelativeTo
+	}
+
+	return conf.WorkingDir
+}
+
+func printTable(headers []string, data [][]string, writer io.Writer) {
 	table := tablewriter.NewWriter(writer)
-	table.SetHeader([]string{"ORIGINAL", "RENAMED", "STATUS"})
+	table.SetHeader(headers)
 	table.SetCenterSeparator("*")
 	table.SetColumnSeparator("|")
 	table.SetRowSeparator("—")
-	table.SetHeaderColor(
-		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
-		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
-		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
-	)
+
+	colors := make([]tablewriter.Colors, len(headers))
+	for i := range colors {
+		colors[i] = tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor}
+	}
+
+	table.SetHeaderColor(colors...)
 	table.AppendBulk(data)
 
 	table.Render()
@@ -176,6 +830,7 @@ func printTable(data [][]string, writer io.Writer) {
 
 // changes displays the renaming changes to be made in a table format.
 func changes(
+	conf *config.Config,
 	fileChanges []*file.Change,
 ) {
 	data := make([][]string, len(fileChanges))
@@ -183,8 +838,18 @@ func changes(
 	for i := range fileChanges {
 		change := fileChanges[i]
 
-		source := filepath.Join(change.BaseDir, change.Source)
-		target := filepath.Join(change.BaseDir, change.Target)
+		source := internalpath.EscapeControlChars(
+			internalpath.RelativeTo(
+				displayBase(conf),
+				filepath.Join(change.BaseDir, change.Source),
+			),
+		)
+		target := internalpath.EscapeControlChars(
+			internalpath.RelativeTo(
+				displayBase(conf),
+				filepath.Join(change.BaseDir, change.Target),
+			),
+		)
 
 		var changeStatus string
 
@@ -212,14 +877,73 @@ func changes(
 		data[i] = d
 	}
 
-	printTable(data, Stdout)
+	printTable(changeHeaders, data, Stdout)
+}
+
+// Plan displays the planned renaming operation in JSON format.
+func Plan(conf *config.Config, out *internaljson.Output) {
+	o, err := internaljson.Encode(
+		internaljson.RelativeTo(out, conf.DisplayRelativeTo),
+	)
+	if err != nil {
+		pterm.Fprintln(Stderr, pterm.Error.Sprint(err))
+		return
+	}
+
+	pterm.Fprintln(Stdout, string(o))
+}
+
+// LastOperation displays the changes recorded in the backup file of the last
+// operation along with the date it was carried out.
+func LastOperation(conf *config.Config, o *internaljson.Output) {
+	if conf.JSON {
+		Plan(conf, o)
+		return
+	}
+
+	date := o.Date
+	if t, err := time.Parse(time.RFC3339, o.Date); err == nil {
+		date = t.Local().Format("2006-01-02 15:04:05")
+	}
+
+	action := "renamed"
+	if o.Copy {
+		action = "copied"
+	}
+
+	pterm.Fprintln(
+		Stdout,
+		pterm.Info.Sprintf(
+			"The last operation in '%s' %s %s on %s",
+			internalpath.EscapeControlChars(o.WorkingDir),
+			action,
+			plural(len(o.Changes), "path", "paths"),
+			date,
+		),
+	)
+
+	if len(o.Changes) > 0 {
+		changes(conf, o.Changes)
+	}
+}
+
+// output encodes the changes in JSON format with the paths relative to the
+// directory specified through --relative-to (if any).
+func output(conf *config.Config, fileChanges []*file.Change) ([]byte, error) {
+	return internaljson.Encode(
+		internaljson.RelativeTo(
+			internaljson.NewOutput(conf, fileChanges),
+			conf.DisplayRelativeTo,
+		),
+	)
 }
 
 // JSON displays the renaming changes to be made in JSON format.
 func JSON(
+	conf *config.Config,
 	fileChanges []*file.Change,
 ) {
-	o, err := internaljson.GetOutput(fileChanges)
+	o, err := output(conf, fileChanges)
 	if err != nil {
 		pterm.Fprintln(Stderr, pterm.Error.Sprint(err))
 		return
@@ -228,14 +952,89 @@ func JSON(
 	pterm.Fprintln(Stdout, string(o))
 }
 
-// Interactive prints the changes to be made and prompts the user
-// to commit the changes. Blocks unti user types ENTER.
+// The actions that can be chosen at the interactive prompt.
+const (
+	ActionAccept = "a"
+	ActionEdit   = "e"
+	ActionQuit   = "q"
+)
+
+// conflictingSources returns the number of sources that are involved in at
+// least one conflict. A source may be involved in more than one conflict.
+func conflictingSources(conflicts conflict.Collection) int {
+	sources := make(map[string]bool)
+
+	for _, v := range conflicts {
+		for _, c := range v {
+			for _, source := range c.Sources {
+				sources[source] = true
+			}
+		}
+	}
+
+	return len(sources)
+}
+
+// plural returns the count followed by the singular or plural form of a noun
+// accordingly.
+func plural(count int, singular, pluralForm string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, singular)
+	}
+
+	return fmt.Sprintf("%d %s", count, pluralForm)
+}
+
+// summary returns a one-line summary of the changes to be made.
+func summary(
+	conf *config.Config,
+	fileChanges []*file.Change,
+	conflicts conflict.Collection,
+) string {
+	var changed int
+
+	for _, change := range fileChanges {
+		sourcePath := filepath.Join(change.BaseDir, change.Source)
+		targetPath := filepath.Join(change.BaseDir, change.Target)
+
+		if sourcePath != targetPath {
+			changed++
+		}
+	}
+
+	changes := plural(changed, "rename", "renames")
+	if conf.Copy {
+		changes = plural(changed, "copy", "copies")
+	}
+
+	return changes + ", " + plural(
+		conflictingSources(conflicts),
+		"conflict",
+		"conflicts",
+	)
+}
+
+// Interactive prints the changes to be made along with a summary of the
+// operation and prompts the user for the next action: 'a' (or ENTER) to
+// commit the changes, 'e' to edit the targets in the editor or 'q' to quit
+// without committing anything. The changes cannot be accepted while there
+// are conflicts, and they cannot be edited when reverting an operation. The
+// prompt is repeated until a valid action is entered, and the operation is
+// cancelled if the input ends before then.
 func Interactive(
+	conf *config.Config,
+	reader *bufio.Reader,
 	fileChanges []*file.Change,
-) {
-	changes(fileChanges)
+	conflicts conflict.Collection,
+) string {
+	printChanges(conf, fileChanges)
+
+	if len(conflicts) > 0 {
+		Conflicts(conf, conflicts)
+	}
 
-	reader := bufio.NewReader(os.Stdin)
+	Overwrites(conf)
+	DiskSpace(conf)
 
 	pterm.Fprint(Stderr, "\033[s")
 	pterm.Info.Prefix = pterm.Prefix{
@@ -243,25 +1042,140 @@ func Interactive(
 		Style: pterm.NewStyle(pterm.BgBlue, pterm.FgBlack),
 	}
 
-	pterm.Fprint(
-		Stdout,
-		pterm.Info.Sprint(
-			"Press ENTER to commit the above changes",
-		),
-	)
+	pterm.Fprintln(Stdout, pterm.Info.Sprint(summary(conf, fileChanges, conflicts)))
 
-	_, err := reader.ReadString('\n')
-	if err != nil && !errors.Is(err, io.EOF) {
-		pterm.Fprintln(Stderr, pterm.Error.Print(err))
+	prompt := "Press ENTER or 'a' to commit the above changes, 'e' to edit them or 'q' to quit: "
+	if conf.Revert {
+		prompt = "Press ENTER or 'a' to commit the above changes or 'q' to quit: "
 	}
+
+	for {
+		pterm.Fprint(Stdout, pterm.Info.Sprint(prompt))
+
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			pterm.Fprintln(Stderr, pterm.Error.Sprint(err))
+			return ActionQuit
+		}
+
+		action := strings.ToLower(strings.TrimSpace(line))
+
+		// the input ended without an action so nothing is committed
+		if errors.Is(err, io.EOF) && action == "" {
+			return ActionQuit
+		}
+
+		switch {
+		case action == "" || action == ActionAccept:
+			if len(conflicts) == 0 {
+				return ActionAccept
+			}
+
+			pterm.Fprintln(
+				Stdout,
+				pterm.Warning.Sprint(
+					"The changes cannot be committed until the conflicts are resolved",
+				),
+			)
+		case action == ActionEdit && !conf.Revert:
+			return ActionEdit
+		case action == ActionQuit:
+			return ActionQuit
+		default:
+			pterm.Fprintln(
+				Stdout,
+				pterm.Warning.Sprintf("Unknown action: %q", action),
+			)
+		}
+
+		if errors.Is(err, io.EOF) {
+			return ActionQuit
+		}
+	}
+}
+
+// operationSections are the sections of the changes that are grouped by
+// operation in the order that they are printed.
+var operationSections = []struct {
+	op    file.Operation
+	title string
+}{
+	{file.OperationRename, "Renamed in place"},
+	{file.OperationCaseChange, "Case changes"},
+	{file.OperationRelocation, "Moved to existing directories"},
+	{file.OperationDirCreation, "Moved to new directories"},
+	{file.OperationNone, "Unchanged"},
+}
+
+// dirExists reports whether the directory exists on the filesystem.
+func dirExists(dir string) bool {
+	info, err := os.Stat(dir)
+
+	return err == nil && info.IsDir()
+}
+
+// groupedChanges prints the changes in a separate section for each kind of
+// operation. Empty sections are left out.
+func groupedChanges(conf *config.Config, fileChanges []*file.Change) {
+	groups := make(map[file.Operation][]*file.Change)
+
+	for _, change := range fileChanges {
+		op := change.Operation(dirExists)
+		groups[op] = append(groups[op], change)
+	}
+
+	for _, section := range operationSections {
+		group := groups[section.op]
+		if len(group) == 0 {
+			continue
+		}
+
+		pterm.Fprintln(
+			Stdout,
+			pterm.Bold.Sprintf("%s (%d)", section.title, len(group)),
+		)
+
+		changes(conf, group)
+	}
+}
+
+// printChanges prints the changes in a single table or grouped by operation
+// depending on the configuration.
+func printChanges(conf *config.Config, fileChanges []*file.Change) {
+	if conf.GroupByOperation {
+		groupedChanges(conf, fileChanges)
+		return
+	}
+
+	changes(conf, fileChanges)
 }
 
 // NonInteractive prints a report of the renaming changes to be made without
-// prompting the user.
+// prompting the user. The changes are grouped by operation if specified, and
+// the resulting paths are also printed as a tree in tree output mode.
 func NonInteractive(
+	conf *config.Config,
 	fileChanges []*file.Change,
 ) {
-	changes(fileChanges)
+	printChanges(conf, fileChanges)
+
+	if conf.Verbose {
+		Stages(conf, fileChanges)
+	}
+
+	if conf.Annotate {
+		Annotations(conf, fileChanges)
+	}
+
+	Overwrites(conf)
+	DiskSpace(conf)
+
+	if conf.TreeOutput {
+		err := Tree(fileChanges)
+		if err != nil {
+			pterm.Fprintln(Stderr, pterm.Error.Sprint(err))
+		}
+	}
 
 	pterm.Info.Prefix = pterm.Prefix{
 		Text:  "DRY RUN",
@@ -4,26 +4,114 @@ f2_opts="
   --find
   --replace
   --undo
+  --allow-control-chars
+  --allow-invalid-utf8
   --allow-overwrites
+  --apply-from-backup
+  --archive
+  --atomic-within-dir
+  --chain-rules
+  --check-only
+  --check-perms
+  --checkpoint
+  --cleanup-on-failure
+  --clear-ledger
+  --collapse-separators
+  --copy
+  --count
+  --counter-group-by
+  --counter-scope
+  --counter-start
+  --counter-step
+  --csv-in-order
+  --dereference-count
+  --edit
+  --empty-dirs
   --exclude
+  --exclude-from
+  --exclude-ignore-case
+  --exclude-mode
   --exec
+  --explain
+  --ext-only
+  --find-from
+  --first-line
   --fix-conflicts
+  --git
+  --group-by-operation
+  --hardlinks
   --help
   --hidden
   --include-dir
   --ignore-case
   --ignore-ext
+  --include-ext
+  --include-from
+  --include-own-files
   --json
+  --last
+  --map
   --max-depth
+  --max-entries-per-dir
+  --no-backup
   --no-color
+  --normalize-unicode
+  --null
+  --num-fallback
+  --on-error
   --only-dir
+  --only-empty
+  --only-hidden
+  --only-non-empty
+  --output-file
+  --partial
+  --plan
+  --prefix
+  --preserve-ext-case
+  --preserve-structure
   --quiet
   --recursive
+  --relative-to
+  --relocate-to
+  --remove-broken-links
   --replace-limit
+  --replace-scope
+  --report-broken-links
+  --resume
+  --retries
+  --retry-delay
+  --route-by-ext
+  --rules
+  --seed
+  --separators
+  --simulate
+  --size-buckets
+  --skip-already-named
+  --skip-empty-targets
+  --skip-identical
+  --skip-unreadable
   --sort
+  --sort-changes
   --sortr
+  --stem-only
+  --stop-on-match
   --string-mode
+  --suffix
+  --suffix-after-ext
+  --swap
+  --symlinks
+  --target-dir
+  --targets-file
+  --template
+  --timings
+  --traversal-order
+  --tree
+  --trim
+  --trim-chars
+  --undo-file
+  --unicode
   --verbose
+  --verify-copy
   --version
 "
 __f2_completions()
@@ -6,14 +6,79 @@ complete --command f2 --long-option replace --short-option r --description "Repl
 
 complete --command f2 --long-option undo --short-option u --description "Undo the last renaming operation in current directory" --no-files
 
+complete --command f2 --long-option allow-control-chars --description "Allow control characters in target names" --no-files
+
+complete --command f2 --long-option allow-invalid-utf8 --description "Match and preserve file names that are not valid UTF-8" --no-files
+
 complete --command f2 --long-option allow-overwrites --description "Allow overwriting existing files" --no-files
 
+
+complete --command f2 --long-option apply-from-backup --description "Apply the operation in a backup file to another directory" --exclusive
+
+complete --command f2 --long-option archive --description "Rename the entries of a zip or tar archive" --no-files
+
+complete --command f2 --long-option atomic-within-dir --description "Stage the renames in each directory through temporary names" --no-files
+
+complete --command f2 --long-option chain-rules --description "Apply the rules as a pipeline" --no-files
+
+complete --command f2 --long-option check-only --description "Report conflicts without modifying the filesystem" --no-files
+
+complete --command f2 --long-option check-perms --description "Verify directory permissions before renaming" --no-files
+
+complete --command f2 --long-option checkpoint --description "Record the progress so that the operation can be resumed" --no-files
+
+complete --command f2 --long-option cleanup-on-failure --description "Remove the empty directories left by failed changes" --no-files
+
+complete --command f2 --long-option clear-ledger --description "Forget the paths recorded by --stop-on-match" --no-files
+
+complete --command f2 --long-option collapse-separators --description "Collapse runs of separators in the target" --no-files
+
+complete --command f2 --long-option copy --description "Copy matches instead of renaming them" --no-files
+
+complete --command f2 --long-option count --description "Print statistics about the matches instead of listing them" --no-files
+
+complete --command f2 --long-option counter-group-by --description "Restart the index numbering for each group of matches sharing a key" --exclusive
+
+complete --command f2 --long-option counter-scope --description "Number index variables globally or per directory" --exclusive
+
+complete --command f2 --long-option counter-start --description "Default starting number for index variables" --exclusive
+
+complete --command f2 --long-option counter-step --description "Default step for index variables" --exclusive
+
+complete --command f2 --long-option csv-in-order --description "Apply repeated CSV glob rows to the matched files in order" --no-files
+
+complete --command f2 --long-option dereference-count --description "Limit the number of links dereferenced in a symlink chain" --exclusive
+
+complete --command f2 --long-option edit --description "Edit the targets in a text editor" --no-files
+
+complete --command f2 --long-option empty-dirs --description "Treat directories without entries as empty" --no-files
+
 complete --command f2 --long-option exclude --short-option E --description "Exclude files and directories matching pattern" --no-files
 
+complete --command f2 --long-option exclude-from --description "Read exclude patterns from a file" --exclusive
+
+complete --command f2 --long-option exclude-ignore-case --description "Match the exclude patterns case-insensitively" --no-files
+
+complete --command f2 --long-option exclude-mode --description "Combine exclude patterns with any or all semantics" --exclusive
+
 complete --command f2 --long-option exec --short-option x --description "Execute renaming operation" --no-files
 
+complete --command f2 --long-option explain --description "Explain why a path would or would not be matched" --exclusive
+
+complete --command f2 --long-option ext-only --description "Match and replace only the extension" --no-files
+
+complete --command f2 --long-option find-from --description "Read the search pattern from a file" --exclusive
+
+complete --command f2 --long-option first-line --description "Only match files whose first line matches a pattern" --exclusive
+
 complete --command f2 --long-option fix-conflicts --short-option F --description "Auto fix renaming conflicts" --no-files
 
+complete --command f2 --long-option git --description "Rename tracked files through git mv" --no-files
+
+complete --command f2 --long-option group-by-operation --description "Group the changes by the kind of operation in dry-run mode" --no-files
+
+complete --command f2 --long-option hardlinks --description "Treat hard links to the same file as a group" --exclusive
+
 complete --command f2 --long-option help --short-option h --description "Display help and exit" --no-files
 
 complete --command f2 --long-option hidden --short-option H --description "Match hidden files" --no-files
@@ -24,18 +89,64 @@ complete --command f2 --long-option ignore-case --short-option i --description "
 
 complete --command f2 --long-option ignore-ext --short-option e --description "Ignore file extension" --no-files
 
+complete --command f2 --long-option include-ext --description "Reattach the original extension when it is ignored" --no-files
+
+complete --command f2 --long-option include-from --description "Only match the paths listed in the specified file" --exclusive
+
+complete --command f2 --long-option include-own-files --description "Match the CSV, map and rules files and the backup files created by f2" --no-files
+
 complete --command f2 --long-option json --description "Enable json output" --no-files
 
+complete --command f2 --long-option last --description "Print the changes made by the last operation" --no-files
+
+complete --command f2 --long-option map --description "Load a JSON file that maps each source to its target" --exclusive
+
 complete --command f2 --long-option max-depth --short-option m --description "Specify max depth for recursive search" --no-files
 
+complete --command f2 --long-option max-entries-per-dir --description "Abort if a directory contains more entries than this" --exclusive
+
+complete --command f2 --long-option no-backup --description "Do not create a backup file" --no-files
+
 complete --command f2 --long-option no-color --description "Disable coloured output" --no-files
 
+complete --command f2 --long-option normalize-unicode --description "Convert the targets to a Unicode normalization form" --exclusive
+
+complete --command f2 --long-option null --short-option 0 --description "Separate the paths read from the standard input with NUL bytes" --no-files
+
+complete --command f2 --long-option num-fallback --description "Value used for {num} when a name has no number" --exclusive
+
+complete --command f2 --long-option on-error --description "Continue or abort after a failed rename" --exclusive
+
 complete --command f2 --long-option only-dir --short-option D --description "Rename only directories" --no-files
 
+complete --command f2 --long-option only-empty --description "Match only empty files" --no-files
+
+complete --command f2 --long-option only-hidden --description "Match only hidden files" --no-files
+
+complete --command f2 --long-option only-non-empty --description "Match only non-empty files" --no-files
+
+complete --command f2 --long-option output-file --description "Write the report to a file" --exclusive
+
+complete --command f2 --long-option partial --description "Apply as many names from the targets file as are available" --no-files
+
+complete --command f2 --long-option plan --description "Print the planned changes in JSON format without renaming" --no-files
+
+complete --command f2 --long-option prefix --description "Add a prefix to each target name" --exclusive
+
+complete --command f2 --long-option preserve-ext-case --description "Keep the case of extensions in case transformations" --no-files
+
+complete --command f2 --long-option preserve-structure --description "Recreate the structure of the matches under the target directory" --no-files
+
 complete --command f2 --long-option quiet --short-option q --description "Disable all output except errors" --no-files
 
 complete --command f2 --long-option recursive --short-option R --description "Search for matches in subdirectories" --no-files
 
+complete --command f2 --long-option relative-to --description "Display paths relative to the specified directory" --exclusive
+
+complete --command f2 --long-option relocate-to --description "Resolve backup paths against a different directory" --exclusive
+
+complete --command f2 --long-option remove-broken-links --description "Remove the matched broken symlinks" --no-files
+
 complete --command f2 --long-option replace-limit --short-option l --description "Limit the matches to be replaced" --no-files
 
 set -l sort_args "
@@ -47,13 +158,79 @@ set -l sort_args "
   ctime\t'Sort by file metadata last change time'
 "
 
+complete --command f2 --long-option replace-scope --description "Replace only the match or the entire name" --exclusive
+
+complete --command f2 --long-option report-broken-links --description "List the broken symlinks found while searching" --no-files
+
+complete --command f2 --long-option resume --description "Complete an interrupted renaming operation" --no-files
+
+complete --command f2 --long-option retries --description "Retry transient rename failures" --exclusive
+
+complete --command f2 --long-option retry-delay --description "Delay before the first retry" --exclusive
+
+complete --command f2 --long-option route-by-ext --description "Place renamed files in a directory mapped to their extension" --exclusive
+
+complete --command f2 --long-option rules --description "Load find and replace rules from a file" --exclusive
+
+complete --command f2 --long-option seed --description "Seed the random string and UUID generator" --exclusive
+
+complete --command f2 --long-option separators --description "Characters collapsed by --collapse-separators" --exclusive
+
+complete --command f2 --long-option simulate --description "Perform the renaming operation on a temporary copy of the tree" --no-files
+
+complete --command f2 --long-option size-buckets --description "Set the thresholds used by the sizebucket variable" --exclusive
+
+complete --command f2 --long-option skip-already-named --description "Drop matches that already have their target name" --no-files
+
+complete --command f2 --long-option skip-empty-targets --description "Skip matches whose targets are empty" --no-files
+
+complete --command f2 --long-option skip-identical --description "Drop changes whose target already exists with identical contents" --no-files
+
+complete --command f2 --long-option skip-unreadable --description "Skip paths that cannot be read" --no-files
+
 complete --command f2 --long-option sort --description "Sort matches in ascending order" --exclusive --keep-order --arguments $sort_args
 
+complete --command f2 --long-option sort-changes --description "Order the reported changes" --exclusive
+
 complete --command f2 --long-option sortr --description "Sort matches in descending order" --exclusive --keep-order --arguments $sort_args
 
+complete --command f2 --long-option stem-only --description "Match and replace only the name without the extension" --no-files
+
+complete --command f2 --long-option stop-on-match --description "Skip matches produced by previous renaming operations" --no-files
+
 complete --command f2 --long-option string-mode --short-option s --description "Treat the search pattern as a non-regex string" --no-files
 
+complete --command f2 --long-option suffix --description "Add a suffix to each target name" --exclusive
+
+complete --command f2 --long-option suffix-after-ext --description "Append the suffix after the extension" --no-files
+
+complete --command f2 --long-option swap --description "Allow swapping or rotating file names" --no-files
+
+complete --command f2 --long-option symlinks --description "Determines how matched symlinks are handled" --exclusive
+
+complete --command f2 --long-option target-dir --description "Place each renamed file in the specified directory" --exclusive
+
+complete --command f2 --long-option targets-file --description "Load the target names from a text file" --exclusive
+
+complete --command f2 --long-option template --description "Parse the replacement as a Go template" --no-files
+
+complete --command f2 --long-option timings --description "Print the duration of each stage of the operation" --no-files
+
+complete --command f2 --long-option traversal-order --description "Search directories in breadth-first or depth-first order" --exclusive
+
+complete --command f2 --long-option tree --description "Print the resulting paths as a tree in dry-run mode" --no-files
+
+complete --command f2 --long-option trim --description "Strip whitespace from the ends of each name" --no-files
+
+complete --command f2 --long-option trim-chars --description "Set the characters stripped by --trim" --exclusive
+
+complete --command f2 --long-option undo-file --description "Undo the operation recorded in a backup file" --exclusive
+
+complete --command f2 --long-option unicode --description "Match Unicode characters with the digit, word and space classes" --no-files
+
 complete --command f2 --long-option verbose --short-option V --description "Enable verbose output" --no-files
 
+complete --command f2 --long-option verify-copy --description "Verify checksums of copied files" --no-files
+
 complete --command f2 --long-option version --short-option v --description "Display version and exit" --no-files
 
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package validate
+
+import "golang.org/x/sys/unix"
+
+// isWritable reports whether the current user is permitted to create, rename,
+// or remove entries in the specified directory.
+func isWritable(dir string) bool {
+	return unix.Access(dir, unix.W_OK) == nil
+}
@@ -0,0 +1,23 @@
+//go:build windows
+// +build windows
+
+package validate
+
+import "os"
+
+// isWritable reports whether the current user is permitted to create, rename,
+// or remove entries in the specified directory. Since ACLs make it impractical
+// to determine this from the file attributes alone, a temporary file is
+// created in the directory and removed immediately afterwards.
+func isWritable(dir string) bool {
+	f, err := os.CreateTemp(dir, ".f2-perm-*")
+	if err != nil {
+		return false
+	}
+
+	name := f.Name()
+
+	_ = f.Close()
+
+	return os.Remove(name) == nil
+}
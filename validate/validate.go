@@ -9,6 +9,13 @@
 // 4. Target name exceeds the maximum allowed length (255 characters in windows, and 255 bytes on Linux and macOS).
 // 5. Target destination contains trailing periods in any of the sub paths (Windows only).
 // 6. Target destination is empty.
+// 7. Source or target directory is not writable by the current user (only if
+// --check-perms is specified).
+// 8. Two or more targets differ only in letter case (Windows and macOS only).
+// 9. Source no longer exists (if it was moved or deleted after the operation
+// was planned).
+// 10. Target introduces control characters such as newlines (except if
+// --allow-control-chars is specified).
 //
 // It detects each conflicts and reports them, but it can also automatically fix
 // them according to predefined rules (if -F/--fix-conflicts is specified).
@@ -17,13 +24,19 @@ package validate
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/ayoisaiah/f2/internal/config"
 	"github.com/ayoisaiah/f2/internal/conflict"
 	"github.com/ayoisaiah/f2/internal/file"
 	internalos "github.com/ayoisaiah/f2/internal/os"
@@ -31,9 +44,40 @@ import (
 	"github.com/ayoisaiah/f2/internal/status"
 )
 
-var conflicts conflict.Collection
+// detector holds the state of a single conflict detection run so that
+// independent operations can be validated concurrently.
+type detector struct {
+	conflicts conflict.Collection
+	// fsys is the filesystem in which the targets are checked for existence.
+	// The real filesystem is used if it is nil
+	fsys    fs.FS
+	changes []*file.Change
+	// dirNames caches the names in each directory that the targets are
+	// compared against in their normalized form
+	dirNames map[string][]string
+	// normalize is set if the targets are normalized
+	normalize bool
+}
+
+// stat returns the file info of the specified path in the filesystem
+// being renamed.
+func (d *detector) stat(path string) (fs.FileInfo, error) {
+	if d.fsys != nil {
+		return fs.Stat(d.fsys, filepath.ToSlash(path))
+	}
+
+	return os.Stat(path)
+}
+
+// lstat is like stat but it does not follow symbolic links on the real
+// filesystem so that broken links are still found.
+func (d *detector) lstat(path string) (fs.FileInfo, error) {
+	if d.fsys != nil {
+		return fs.Stat(d.fsys, filepath.ToSlash(path))
+	}
 
-var changes []*file.Change
+	return os.Lstat(path)
+}
 
 const (
 	// max filename length of 255 characters in Windows.
@@ -56,7 +100,7 @@ type renamedPathsType map[string][]struct {
 // newTarget appends a number to the target file name so that it
 // does not conflict with an existing path on the filesystem or
 // another renamed file. For example: image.png becomes image (2).png.
-func newTarget(change *file.Change, renamedPaths map[string][]struct {
+func (d *detector) newTarget(change *file.Change, renamedPaths map[string][]struct {
 	sourcePath string
 	index      int
 },
@@ -83,7 +127,7 @@ func newTarget(change *file.Change, renamedPaths map[string][]struct {
 		targetPath := filepath.Join(change.BaseDir, target)
 
 		// Ensure the new path does not exist on the filesystem
-		if _, err := os.Stat(targetPath); err != nil &&
+		if _, err := d.stat(targetPath); err != nil &&
 			errors.Is(err, os.ErrNotExist) {
 			for k := range renamedPaths {
 				if k == targetPath {
@@ -98,19 +142,64 @@ func newTarget(change *file.Change, renamedPaths map[string][]struct {
 	}
 }
 
+// checkSourceNotFoundConflict reports if the source of the change no longer
+// exists, which happens when it is moved or deleted after the operation was
+// planned. This conflict is automatically fixed by leaving the change out of
+// the operation.
+func (d *detector) checkSourceNotFoundConflict(
+	change *file.Change,
+	autoFix bool,
+) (conflictDetected bool) {
+	sourcePath := filepath.Join(change.BaseDir, change.Source)
+	targetPath := filepath.Join(change.BaseDir, change.Target)
+
+	if _, err := d.lstat(sourcePath); !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+
+	conflictDetected = true
+
+	if autoFix {
+		change.Target = change.Source
+		change.Status = status.Unchanged
+
+		return
+	}
+
+	d.conflicts[conflict.SourceNotFound] = append(
+		d.conflicts[conflict.SourceNotFound],
+		conflict.New(
+			conflict.SourceNotFound,
+			[]string{sourcePath},
+			targetPath,
+			"",
+		),
+	)
+	change.Status = status.SourceNotFound
+
+	return
+}
+
 // checkEmptyFilenameConflict reports if the file renaming has resulted
-// in an empty string. This conflict is automatically fixed by leaving
-// the filename unchanged.
-func checkEmptyFilenameConflict(
+// in an empty name or one that is made up of whitespace alone. This
+// conflict is automatically fixed by leaving the filename unchanged.
+func (d *detector) checkEmptyFilenameConflict(
 	change *file.Change,
 	autoFix bool,
 ) (conflictDetected bool) {
 	sourcePath := filepath.Join(change.BaseDir, change.Source)
 	targetPath := filepath.Join(change.BaseDir, change.Target)
 
-	if change.Target == "." || change.Target == "" {
+	if change.HasEmptyTarget() {
 		conflictDetected = true
 
+		// the cause is only given for the names that are not obviously
+		// empty such as those made up of whitespace
+		var cause string
+		if change.Target != "" && change.Target != "." {
+			cause = "the name of the target is empty or made up of whitespace alone"
+		}
+
 		if autoFix {
 			// The file is left unchanged
 			change.Target = change.Source
@@ -119,12 +208,14 @@ func checkEmptyFilenameConflict(
 			return
 		}
 
-		conflicts[conflict.EmptyFilename] = append(
-			conflicts[conflict.EmptyFilename],
-			conflict.Conflict{
-				Sources: []string{sourcePath},
-				Target:  targetPath,
-			},
+		d.conflicts[conflict.EmptyFilename] = append(
+			d.conflicts[conflict.EmptyFilename],
+			conflict.New(
+				conflict.EmptyFilename,
+				[]string{sourcePath},
+				targetPath,
+				cause,
+			),
 		)
 		change.Status = status.EmptyFilename
 	}
@@ -132,77 +223,139 @@ func checkEmptyFilenameConflict(
 	return
 }
 
+// equivalentPath returns an existing path other than the source in the
+// directory of the target whose name is identical to the target once both are
+// normalized. An empty string is returned if there is no such path.
+func (d *detector) equivalentPath(sourcePath, targetPath string) string {
+	dir, name := filepath.Split(targetPath)
+	dir = filepath.Clean(dir)
+
+	names, ok := d.dirNames[dir]
+	if !ok {
+		var entries []fs.DirEntry
+
+		if d.fsys != nil {
+			entries, _ = fs.ReadDir(d.fsys, filepath.ToSlash(dir))
+		} else {
+			entries, _ = os.ReadDir(dir)
+		}
+
+		names = make([]string, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Name()
+		}
+
+		d.dirNames[dir] = names
+	}
+
+	name = norm.NFC.String(name)
+
+	for _, n := range names {
+		p := filepath.Join(dir, n)
+		if p != sourcePath && norm.NFC.String(n) == name {
+			return p
+		}
+	}
+
+	return ""
+}
+
 // checkPathExistsConflict reports if the newly renamed path
-// already exists on the filesystem.
-func checkPathExistsConflict(
+// already exists on the filesystem. If the targets are normalized, a path
+// that only differs from the target in its normalization form is considered
+// to be the same path.
+func (d *detector) checkPathExistsConflict(
 	change *file.Change,
-	autoFix, allowOverwrites bool,
+	autoFix, allowOverwrites, copyMode, swapMode bool,
 ) (conflictDetected bool) {
 	sourcePath := filepath.Join(change.BaseDir, change.Source)
 	targetPath := filepath.Join(change.BaseDir, change.Target)
 
-	// Report if target path exists on the filesystem
-	if _, err := os.Stat(targetPath); err == nil ||
-		errors.Is(err, os.ErrExist) {
-		// Don't report a conflict for an unchanged filename
-		if sourcePath == targetPath {
-			change.Status = status.Unchanged
-			return
-		}
+	existingPath := targetPath
 
-		// Case-insensitive filesystems should not report conflicts
-		// if only the case of the filename is being changed.
-		if strings.EqualFold(sourcePath, targetPath) {
-			return
-		}
+	_, err := d.stat(targetPath)
+	exists := err == nil || errors.Is(err, os.ErrExist)
 
-		// Don't report a conflict if overwriting files are allowed
-		if allowOverwrites {
-			change.WillOverwrite = true
-			change.Status = status.Overwriting
+	if !exists && d.normalize {
+		existingPath = d.equivalentPath(sourcePath, targetPath)
+		exists = existingPath != ""
+	}
 
-			return
-		}
+	// Report if target path exists on the filesystem
+	if !exists {
+		return
+	}
 
-		// Don't report a conflict if target path is changing before
-		// the source path is renamed
-		for j := 0; j < len(changes); j++ {
-			ch := changes[j]
-			sp := filepath.Join(ch.BaseDir, ch.Source)
-			tp := filepath.Join(ch.BaseDir, ch.Target)
+	// Don't report a conflict for an unchanged filename
+	if sourcePath == targetPath {
+		change.Status = status.Unchanged
+		return
+	}
 
-			if targetPath == sp && !strings.EqualFold(sp, tp) &&
-				change.Index > j {
-				return
-			}
-		}
+	// Case-insensitive filesystems should not report conflicts
+	// if only the case of the filename is being changed.
+	if strings.EqualFold(sourcePath, targetPath) {
+		return
+	}
 
-		if autoFix {
-			change.Target = newTarget(change, nil)
-			change.Status = status.OK
+	// Likewise, filesystems that do not distinguish between normalization
+	// forms should not report conflicts if the source is only normalized
+	if d.normalize && norm.NFC.String(sourcePath) == norm.NFC.String(targetPath) {
+		return
+	}
 
+	// Don't report a conflict if target path is changing before
+	// the source path is renamed. In swap and staged modes, the order does
+	// not matter since the changes are rearranged (and cycles are broken)
+	// or the sources are vacated before they are committed. This does not
+	// apply in copy mode since the sources are left in place
+	for j := 0; j < len(d.changes) && !copyMode; j++ {
+		ch := d.changes[j]
+		sp := filepath.Join(ch.BaseDir, ch.Source)
+		tp := filepath.Join(ch.BaseDir, ch.Target)
+
+		if existingPath == sp && !strings.EqualFold(sp, tp) &&
+			(change.Index > j || swapMode) {
 			return
 		}
+	}
 
-		conflicts[conflict.FileExists] = append(
-			conflicts[conflict.FileExists],
-			conflict.Conflict{
-				Sources: []string{sourcePath},
-				Target:  targetPath,
-			},
-		)
+	// Don't report a conflict if overwriting files are allowed. The
+	// existing targets that are renamed first (above) are not overwritten
+	if allowOverwrites {
+		change.WillOverwrite = true
+		change.Status = status.Overwriting
 
-		conflictDetected = true
-		change.Status = status.PathExists
+		return
+	}
+
+	if autoFix {
+		change.Target = d.newTarget(change, nil)
+		change.Status = status.OK
+
+		return
 	}
 
+	d.conflicts[conflict.FileExists] = append(
+		d.conflicts[conflict.FileExists],
+		conflict.New(
+			conflict.FileExists,
+			[]string{sourcePath},
+			existingPath,
+			"",
+		),
+	)
+
+	conflictDetected = true
+	change.Status = status.PathExists
+
 	return conflictDetected
 }
 
 // checkOverwritingPathConflict ensures that a newly renamed path
 // is not overwritten by another renamed file. Such conflicts are solved by
 // appending a number to the filename until no conflict is detected.
-func checkOverwritingPathConflict(
+func (d *detector) checkOverwritingPathConflict(
 	renamedPaths renamedPathsType,
 	autoFix bool,
 ) {
@@ -213,7 +366,7 @@ func checkOverwritingPathConflict(
 
 			for _, s := range source {
 				sources = append(sources, s.sourcePath)
-				changes[s.index].Status = status.OverwritingNewPath
+				d.changes[s.index].Status = status.OverwritingNewPath
 			}
 
 			if autoFix {
@@ -221,27 +374,27 @@ func checkOverwritingPathConflict(
 					item := source[i]
 
 					if i == 0 {
-						changes[item.index].Status = status.OK
+						d.changes[item.index].Status = status.OK
 						continue
 					}
 
-					target := newTarget(
-						changes[item.index],
+					target := d.newTarget(
+						d.changes[item.index],
 						renamedPaths,
 					)
-					pt := filepath.Join(changes[item.index].BaseDir, target)
+					pt := filepath.Join(d.changes[item.index].BaseDir, target)
 
 					if _, ok := renamedPaths[pt]; !ok {
 						renamedPaths[pt] = []struct {
 							sourcePath string
 							index      int
 						}{}
-						changes[item.index].Target = target
-						changes[item.index].Status = status.OK
+						d.changes[item.index].Target = target
+						d.changes[item.index].Status = status.OK
 					} else {
 						// repeat the last iteration to generate a new path
-						changes[item.index].Target = target
-						changes[item.index].Status = status.OK
+						d.changes[item.index].Target = target
+						d.changes[item.index].Status = status.OK
 						i--
 						continue
 					}
@@ -250,17 +403,84 @@ func checkOverwritingPathConflict(
 				continue
 			}
 
-			conflicts[conflict.OverwritingNewPath] = append(
-				conflicts[conflict.OverwritingNewPath],
-				conflict.Conflict{
-					Sources: sources,
-					Target:  targetPath,
-				},
+			d.conflicts[conflict.OverwritingNewPath] = append(
+				d.conflicts[conflict.OverwritingNewPath],
+				conflict.New(
+					conflict.OverwritingNewPath,
+					sources,
+					targetPath,
+					"",
+				),
 			)
 		}
 	}
 }
 
+// checkCaseCollisionConflict reports targets that differ from each other only
+// in letter case since they refer to the same path on case-insensitive
+// filesystems. Such conflicts are solved by appending a number to all but the
+// first of the colliding targets.
+func (d *detector) checkCaseCollisionConflict(
+	renamedPaths renamedPathsType,
+	autoFix bool,
+) {
+	byLowerCase := make(map[string][]string)
+
+	for targetPath, source := range renamedPaths {
+		// only consider paths that aren't already in conflict
+		if len(source) != 1 || d.changes[source[0].index].Status != status.OK {
+			continue
+		}
+
+		key := strings.ToLower(targetPath)
+		byLowerCase[key] = append(byLowerCase[key], targetPath)
+	}
+
+	for _, targetPaths := range byLowerCase {
+		if len(targetPaths) == 1 {
+			continue
+		}
+
+		sort.Strings(targetPaths)
+
+		var sources []string
+
+		for i, targetPath := range targetPaths {
+			item := renamedPaths[targetPath][0]
+			change := d.changes[item.index]
+
+			if autoFix {
+				if i > 0 {
+					change.Target = d.newTarget(change, renamedPaths)
+					newPath := filepath.Join(change.BaseDir, change.Target)
+
+					renamedPaths[newPath] = renamedPaths[targetPath]
+					delete(renamedPaths, targetPath)
+				}
+
+				continue
+			}
+
+			sources = append(sources, item.sourcePath)
+			change.Status = status.CaseCollision
+		}
+
+		if autoFix {
+			continue
+		}
+
+		d.conflicts[conflict.CaseCollision] = append(
+			d.conflicts[conflict.CaseCollision],
+			conflict.New(
+				conflict.CaseCollision,
+				sources,
+				targetPaths[0],
+				"",
+			),
+		)
+	}
+}
+
 // checkForbiddenCharacters is responsible for ensuring that target file names
 // do not contain forbidden characters for the current OS.
 func checkForbiddenCharacters(path string) string {
@@ -311,7 +531,7 @@ func isTargetLengthExceeded(target string) bool {
 // checkTrailingPeriods reports if the file renaming has resulted in
 // files or sub directories that end in trailing dots (Windows only).
 // This conflict is automatically resolved by removing the trailing periods.
-func checkTrailingPeriodConflict(
+func (d *detector) checkTrailingPeriodConflict(
 	change *file.Change,
 	autoFix bool,
 ) (conflictDetected bool) {
@@ -343,12 +563,14 @@ func checkTrailingPeriodConflict(
 		}
 
 		if conflictDetected {
-			conflicts[conflict.TrailingPeriod] = append(
-				conflicts[conflict.TrailingPeriod],
-				conflict.Conflict{
-					Sources: []string{sourcePath},
-					Target:  targetPath,
-				},
+			d.conflicts[conflict.TrailingPeriod] = append(
+				d.conflicts[conflict.TrailingPeriod],
+				conflict.New(
+					conflict.TrailingPeriod,
+					[]string{sourcePath},
+					targetPath,
+					"",
+				),
 			)
 
 			change.Status = status.TrailingPeriod
@@ -362,7 +584,7 @@ func checkTrailingPeriodConflict(
 // name that is longer than the acceptable limit (255 characters in Windows and
 // 255 bytes on Unix). This conflict is automatically fixed by removing the
 // excess characters/bytes until the name is under the limit.
-func checkFileNameLengthConflict(
+func (d *detector) checkFileNameLengthConflict(
 	change *file.Change,
 	autoFix bool,
 ) (conflictDetected bool) {
@@ -410,13 +632,14 @@ func checkFileNameLengthConflict(
 			cause = "255 characters"
 		}
 
-		conflicts[conflict.MaxFilenameLengthExceeded] = append(
-			conflicts[conflict.MaxFilenameLengthExceeded],
-			conflict.Conflict{
-				Sources: []string{sourcePath},
-				Target:  targetPath,
-				Cause:   cause,
-			},
+		d.conflicts[conflict.MaxFilenameLengthExceeded] = append(
+			d.conflicts[conflict.MaxFilenameLengthExceeded],
+			conflict.New(
+				conflict.MaxFilenameLengthExceeded,
+				[]string{sourcePath},
+				targetPath,
+				cause,
+			),
 		)
 		conflictDetected = true
 		change.Status = status.FilenameLengthExceeded
@@ -431,7 +654,7 @@ func checkFileNameLengthConflict(
 // backward slashes as their presence has a special meaning in the renaming
 // ration (automatic directory creation).
 // Conflicts are automatically fixed by removing the culprit characters.
-func checkForbiddenCharactersConflict(
+func (d *detector) checkForbiddenCharactersConflict(
 	change *file.Change,
 	autoFix bool,
 ) (conflictDetected bool) {
@@ -461,13 +684,14 @@ func checkForbiddenCharactersConflict(
 			return
 		}
 
-		conflicts[conflict.InvalidCharacters] = append(
-			conflicts[conflict.InvalidCharacters],
-			conflict.Conflict{
-				Sources: []string{sourcePath},
-				Target:  targetPath,
-				Cause:   forbiddenChars,
-			},
+		d.conflicts[conflict.InvalidCharacters] = append(
+			d.conflicts[conflict.InvalidCharacters],
+			conflict.New(
+				conflict.InvalidCharacters,
+				[]string{sourcePath},
+				targetPath,
+				forbiddenChars,
+			),
 		)
 
 		conflictDetected = true
@@ -477,48 +701,220 @@ func checkForbiddenCharactersConflict(
 	return
 }
 
+// checkControlCharactersConflict is used to detect control characters such as
+// newlines introduced in the target since they break line-oriented tools and
+// can be mistaken for other names when displayed. Control characters that are
+// already present in the source are left alone. Conflicts are automatically
+// fixed by removing the introduced characters.
+func (d *detector) checkControlCharactersConflict(
+	change *file.Change,
+	autoFix bool,
+) (conflictDetected bool) {
+	existing := make(map[rune]bool)
+
+	for _, r := range change.Source {
+		if unicode.IsControl(r) {
+			existing[r] = true
+		}
+	}
+
+	introduced := func(r rune) bool {
+		return unicode.IsControl(r) && !existing[r]
+	}
+
+	if strings.IndexFunc(change.Target, introduced) == -1 {
+		return
+	}
+
+	if autoFix {
+		change.Target = strings.Map(func(r rune) rune {
+			if introduced(r) {
+				return -1
+			}
+
+			return r
+		}, change.Target)
+
+		change.Status = status.OK
+
+		return
+	}
+
+	var chars []string
+
+	seen := make(map[rune]bool)
+
+	for _, r := range change.Target {
+		if introduced(r) && !seen[r] {
+			seen[r] = true
+			chars = append(chars, internalpath.EscapeControl(r))
+		}
+	}
+
+	sourcePath := filepath.Join(change.BaseDir, change.Source)
+	targetPath := filepath.Join(change.BaseDir, change.Target)
+
+	d.conflicts[conflict.ControlCharacters] = append(
+		d.conflicts[conflict.ControlCharacters],
+		conflict.New(
+			conflict.ControlCharacters,
+			[]string{sourcePath},
+			targetPath,
+			strings.Join(chars, ","),
+		),
+	)
+
+	change.Status = status.ControlCharacters
+
+	return true
+}
+
+// nearestExistingDir returns the closest ancestor of the provided path
+// (including the path itself) that exists on the filesystem. This is the
+// directory in which any missing directories would be created.
+func nearestExistingDir(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+
+		path = parent
+	}
+}
+
+// checkPermissionConflict reports if the source directory or the target
+// directory (when it differs from the source) is not writable for the current
+// user so that the failure is known before the renaming operation is carried
+// out. The results are cached in writableDirs since many changes typically
+// share the same directories. This conflict cannot be fixed automatically.
+func (d *detector) checkPermissionConflict(
+	change *file.Change,
+	writableDirs map[string]bool,
+) (conflictDetected bool) {
+	sourcePath := filepath.Join(change.BaseDir, change.Source)
+	targetPath := filepath.Join(change.BaseDir, change.Target)
+
+	sourceDir := filepath.Dir(sourcePath)
+	targetDir := nearestExistingDir(filepath.Dir(targetPath))
+
+	dirs := []struct {
+		path  string
+		cause string
+	}{
+		{sourceDir, "source directory is not writable"},
+	}
+
+	if targetDir != sourceDir {
+		dirs = append(dirs, struct {
+			path  string
+			cause string
+		}{targetDir, "target directory is not writable"})
+	}
+
+	for _, dir := range dirs {
+		writable, ok := writableDirs[dir.path]
+		if !ok {
+			writable = isWritable(dir.path)
+			writableDirs[dir.path] = writable
+		}
+
+		if writable {
+			continue
+		}
+
+		d.conflicts[conflict.PermissionDenied] = append(
+			d.conflicts[conflict.PermissionDenied],
+			conflict.New(
+				conflict.PermissionDenied,
+				[]string{sourcePath},
+				targetPath,
+				dir.cause,
+			),
+		)
+
+		change.Status = status.PermissionDenied
+
+		return true
+	}
+
+	return false
+}
+
 // detectConflicts checks the renamed files for various conflicts and
 // automatically fixes them if allowed.
-func detectConflicts(autoFix, allowOverwrites bool) {
+func (d *detector) detectConflicts(conf *config.Config) {
+	autoFix := conf.AutoFixConflicts
+
 	renamedPaths := make(renamedPathsType)
 
-	for i := 0; i < len(changes); i++ {
-		change := changes[i]
+	writableDirs := make(map[string]bool)
+
+	for i := 0; i < len(d.changes); i++ {
+		change := d.changes[i]
 		sourcePath := filepath.Join(change.BaseDir, change.Source)
 		targetPath := filepath.Join(change.BaseDir, change.Target)
 
-		detected := checkEmptyFilenameConflict(change, autoFix)
+		detected := d.checkSourceNotFoundConflict(change, autoFix)
+		if detected {
+			// the other conflicts are irrelevant if the source is gone
+			continue
+		}
+
+		detected = d.checkEmptyFilenameConflict(change, autoFix)
 		if detected {
 			// no need to check for other conflicts here since the filename
 			// is empty. If auto fixed, no renaming will occur for the entry
 			continue
 		}
 
-		detected = checkTrailingPeriodConflict(change, autoFix)
+		detected = d.checkTrailingPeriodConflict(change, autoFix)
 		if detected && autoFix {
 			// going back an index allows rechecking the path for conflicts once more
 			i--
 			continue
 		}
 
-		detected = checkFileNameLengthConflict(change, autoFix)
+		detected = d.checkFileNameLengthConflict(change, autoFix)
 		if detected && autoFix {
 			i--
 			continue
 		}
 
-		detected = checkForbiddenCharactersConflict(change, autoFix)
+		detected = d.checkForbiddenCharactersConflict(change, autoFix)
 		if detected && autoFix {
 			i--
 			continue
 		}
 
-		detected = checkPathExistsConflict(change, autoFix, allowOverwrites)
+		if !conf.AllowControlChars {
+			detected = d.checkControlCharactersConflict(change, autoFix)
+			if detected && autoFix {
+				i--
+				continue
+			}
+		}
+
+		detected = d.checkPathExistsConflict(
+			change,
+			autoFix,
+			conf.AllowOverwrites,
+			conf.Copy,
+			conf.Swap || conf.StagedRename,
+		)
 		if detected && autoFix {
 			i--
 			continue
 		}
 
+		if conf.CheckPermissions && d.fsys == nil {
+			d.checkPermissionConflict(change, writableDirs)
+		}
+
 		renamedPaths[targetPath] = append(renamedPaths[targetPath], struct {
 			sourcePath string
 			index      int
@@ -528,24 +924,48 @@ func detectConflicts(autoFix, allowOverwrites bool) {
 		})
 	}
 
-	checkOverwritingPathConflict(renamedPaths, autoFix)
+	d.checkOverwritingPathConflict(renamedPaths, autoFix)
+
+	if runtime.GOOS == internalos.Windows || runtime.GOOS == internalos.Darwin {
+		d.checkCaseCollisionConflict(renamedPaths, autoFix)
+	}
+}
+
+// overwrites returns the paths to the existing files that would be clobbered
+// by the changes. Since existing targets are reported as conflicts (or given
+// a new name when conflicts are fixed automatically) unless overwrites are
+// allowed, this depends on the overwrite policy. Targets that are renamed
+// before they are replaced are not included.
+func overwrites(changes []*file.Change) []string {
+	var paths []string
+
+	for _, change := range changes {
+		if change.WillOverwrite && change.Status == status.Overwriting {
+			paths = append(paths, filepath.Join(change.BaseDir, change.Target))
+		}
+	}
+
+	return paths
 }
 
 // Validate detects and reports any conflicts that can occur while renaming a
 // file. Conflicts are automatically fixed if specified in the program options.
 func Validate(
 	matches []*file.Change,
-	autoFix, allowOverwrites bool,
+	conf *config.Config,
 ) conflict.Collection {
-	conflicts = make(conflict.Collection)
-
-	changes = matches
+	d := &detector{
+		conflicts: make(conflict.Collection),
+		changes:   matches,
+		fsys:      conf.FS,
+		dirNames:  make(map[string][]string),
+		normalize: conf.NormalizeUnicode != "",
+	}
 
-	detectConflicts(autoFix, allowOverwrites)
+	d.detectConflicts(conf)
 
-	return conflicts
-}
+	conf.Conflicts = d.conflicts
+	conf.Overwrites = overwrites(matches)
 
-func GetConflicts() conflict.Collection {
-	return conflicts
+	return d.conflicts
 }